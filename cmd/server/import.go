@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+)
+
+// runImport runs the import subcommand, which imports the characters of a CSV or NDJSON file:
+//
+//	server [-config file] import -owner ID [-format csv|ndjson] [-dry-run] [-batch-size N] FILE
+//
+// The format defaults to the extension of the file, which may be "-" to read the standard input.
+// The import report is written to out as JSON. An error is returned if any row failed.
+func runImport(ctx context.Context, service character.Service, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	owner := flags.String("owner", "", "ID of the user owning the imported characters")
+	format := flags.String("format", "", "format of the file: csv or ndjson (default: the file extension)")
+	dryRun := flags.Bool("dry-run", false, "check the file without saving any character")
+	batchSize := flags.Int("batch-size", character.DefaultImportBatchSize, "number of characters inserted at once")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("exactly one file must be given")
+	}
+	if *owner == "" {
+		return errors.New("the owner of the characters must be given")
+	}
+
+	file := flags.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), ".")
+	}
+	in := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	rows, err := character.NewRowReader(in, *format)
+	if err != nil {
+		return err
+	}
+	ctx = auth.WithUser(ctx, *owner, "import")
+	report, err := service.Import(ctx, rows, character.ImportOptions{DryRun: *dryRun, BatchSize: *batchSize})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		return errors.New("some rows failed to import")
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_runImport_args(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	assert.NotNil(t, runImport(ctx, nil, []string{"-owner", "100"}, &out))
+	assert.NotNil(t, runImport(ctx, nil, []string{"roster.csv"}, &out))
+	assert.NotNil(t, runImport(ctx, nil, []string{"-owner", "100", "-format", "xml", "-"}, &out))
+	assert.NotNil(t, runImport(ctx, nil, []string{"-owner", "100", "no-such-file.csv"}, &out))
+	assert.NotNil(t, runImport(ctx, nil, []string{"-unknown"}, &out))
+	assert.Empty(t, out.String())
+}
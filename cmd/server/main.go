@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"time"
@@ -14,12 +15,19 @@ import (
 	"github.com/go-ozzo/ozzo-routing/v2/content"
 	"github.com/go-ozzo/ozzo-routing/v2/cors"
 	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/charactertype"
 	_ "github.com/lib/pq"
 
+	"github.com/hikvineh/go-rest-game-character/internal/ability"
 	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/battle"
 	"github.com/hikvineh/go-rest-game-character/internal/config"
 	"github.com/hikvineh/go-rest-game-character/internal/errors"
 	"github.com/hikvineh/go-rest-game-character/internal/healthcheck"
+	"github.com/hikvineh/go-rest-game-character/internal/idempotency"
+	"github.com/hikvineh/go-rest-game-character/internal/item"
+	"github.com/hikvineh/go-rest-game-character/internal/party"
+	"github.com/hikvineh/go-rest-game-character/internal/webhook"
 	"github.com/hikvineh/go-rest-game-character/pkg/accesslog"
 	"github.com/hikvineh/go-rest-game-character/pkg/dbcontext"
 	"github.com/hikvineh/go-rest-game-character/pkg/log"
@@ -30,6 +38,9 @@ var Version = "1.0.0"
 
 var flagConfig = flag.String("config", "./config/local.yml", "path to the config file")
 
+// usage describes the command line, which runs the API server unless a subcommand is given.
+const usage = `usage: server [-config file] [import [flags] FILE]`
+
 func main() {
 	flag.Parse()
 	// create root logger tagged with server version
@@ -56,12 +67,42 @@ func main() {
 		}
 	}()
 
+	switch flag.Arg(0) {
+	case "":
+	case "import":
+		dbc := dbcontext.New(db)
+		characterTypeService := charactertype.NewService(charactertype.NewRepository(dbc, logger), logger)
+		equipment := character.CombineEquipment(item.NewRepository(dbc, logger), ability.NewRepository(dbc, logger))
+		webhookService := webhook.NewService(webhook.NewRepository(dbc, logger), net.DefaultResolver, logger)
+		characterService := newCharacterService(logger, dbc, characterTypeService, cfg, equipment, webhookService)
+		if err := runImport(context.Background(), characterService, flag.Args()[1:], os.Stdout); err != nil {
+			logger.Errorf("import failed: %s", err)
+			os.Exit(1)
+		}
+		return
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// remove the expired idempotency keys in the background
+	go purgeIdempotencyKeys(idempotency.NewRepository(dbcontext.New(db), logger), logger)
+	// send the webhook deliveries in the background until the server shuts down
+	dispatcherCtx, stopDispatcher := context.WithCancel(context.Background())
+	dispatcherDone := make(chan struct{})
+	go func() {
+		defer close(dispatcherDone)
+		webhook.NewDispatcher(webhook.NewRepository(dbcontext.New(db), logger), nil, webhook.DefaultRetryPolicy(), logger).
+			Run(dispatcherCtx, time.Second)
+	}()
+
 	// build HTTP server
 	address := fmt.Sprintf(":%v", cfg.ServerPort)
 	hs := &http.Server{
 		Addr:    address,
 		Handler: buildHandler(logger, dbcontext.New(db), cfg),
 	}
+	hs.RegisterOnShutdown(stopDispatcher)
 
 	// start the HTTP server with graceful shutdown
 	go routing.GracefulShutdown(hs, 10*time.Second, logger.Infof)
@@ -70,6 +111,8 @@ func main() {
 		logger.Error(err)
 		os.Exit(-1)
 	}
+	// wait for the webhook deliveries in progress
+	<-dispatcherDone
 }
 
 // buildHandler sets up the HTTP routing and builds an HTTP handler.
@@ -87,10 +130,62 @@ func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.
 
 	rg := router.Group("/v1")
 
-	authHandler := auth.Handler(cfg.JWTSigningKey)
+	// POST requests requiring a valid JWT can be retried safely with an Idempotency-Key header
+	authHandler := chain(
+		auth.Handler(cfg.JWTSigningKey),
+		idempotency.Handler(idempotency.NewRepository(db, logger), time.Duration(cfg.IdempotencyTTL)*time.Hour, logger),
+	)
+
+	characterTypeService := charactertype.NewService(charactertype.NewRepository(db, logger), logger)
+	charactertype.RegisterHandlers(rg.Group(""),
+		characterTypeService,
+		authHandler, auth.AdminHandler(cfg.AdminIDs), logger,
+	)
+
+	partyRules := party.DefaultRules()
+	partyRules.MaxMembers = cfg.PartySize
+	if cfg.PartyTypeLimits != nil {
+		partyRules.TypeLimits = cfg.PartyTypeLimits
+	}
+	partyRepository := party.NewRepository(db, logger)
+
+	itemRepository := item.NewRepository(db, logger)
+	abilityRepository := ability.NewRepository(db, logger)
+	webhookService := webhook.NewService(webhook.NewRepository(db, logger), net.DefaultResolver, logger)
+	characterService := newCharacterService(logger, db, characterTypeService, cfg,
+		character.CombineEquipment(itemRepository, abilityRepository),
+		character.CombineListeners(party.NewGuard(partyRepository, partyRules), ability.NewGuard(abilityRepository), webhookService))
 
 	character.RegisterHandlers(rg.Group(""),
-		character.NewService(character.NewRepository(db, logger), logger),
+		characterService,
+		authHandler, auth.AdminHandler(cfg.AdminIDs), character.Options{
+			RequireIfMatch: cfg.RequireIfMatch,
+			TrashRetention: time.Duration(cfg.TrashRetention) * 24 * time.Hour,
+		}, logger,
+	)
+
+	item.RegisterHandlers(rg.Group(""),
+		item.NewService(itemRepository, characterService, db.Transactional, logger),
+		authHandler, auth.AdminHandler(cfg.AdminIDs), logger,
+	)
+
+	ability.RegisterHandlers(rg.Group(""),
+		ability.NewService(abilityRepository, characterTypeService, characterService, db.Transactional, logger),
+		authHandler, auth.AdminHandler(cfg.AdminIDs), logger,
+	)
+
+	battle.RegisterHandlers(rg.Group(""),
+		battle.NewService(battle.NewRepository(db, logger), characterService, battle.DefaultRules(), logger),
+		authHandler, logger,
+	)
+
+	party.RegisterHandlers(rg.Group(""),
+		party.NewService(partyRepository, characterService, partyRules, db.Transactional, logger),
+		authHandler, logger,
+	)
+
+	webhook.RegisterHandlers(rg.Group(""),
+		webhookService,
 		authHandler, logger,
 	)
 
@@ -102,6 +197,43 @@ func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.
 	return router
 }
 
+// newCharacterService creates the character service with its dependencies.
+// The characters are valued with the given character types, their modifiers are read from the given equipment,
+// which combines their items and abilities, and their changes are sent to the given listener, which guards the rules
+// of parties and abilities and delivers the changes to webhooks.
+func newCharacterService(logger log.Logger, db *dbcontext.DB, types charactertype.Service, cfg *config.Config,
+	equipment character.Equipment, listener character.Listener) character.Service {
+	progression := character.DefaultProgression()
+	if len(cfg.LevelCurve) > 0 {
+		progression.Curve = cfg.LevelCurve
+	}
+	return character.NewService(character.NewRepository(db, logger), types, character.DefaultValuators(), progression, equipment, listener, db.Transactional, logger)
+}
+
+// chain returns a handler calling the given handlers in order, until one of them fails.
+func chain(handlers ...routing.Handler) routing.Handler {
+	return func(c *routing.Context) error {
+		for _, handler := range handlers {
+			if err := handler(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// purgeIdempotencyKeys removes the expired idempotency keys every hour.
+func purgeIdempotencyKeys(repo idempotency.Repository, logger log.Logger) {
+	for range time.Tick(time.Hour) {
+		count, err := repo.Purge(context.Background(), time.Now())
+		if err != nil {
+			logger.Errorf("failed to purge idempotency keys: %s", err)
+		} else if count > 0 {
+			logger.Infof("purged %v expired idempotency keys", count)
+		}
+	}
+}
+
 // logDBQuery returns a logging function that can be used to log SQL queries.
 func logDBQuery(logger log.Logger) dbx.QueryLogFunc {
 	return func(ctx context.Context, t time.Duration, sql string, rows *sql.Rows, err error) {
@@ -0,0 +1,142 @@
+package ability
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	apperrors "github.com/hikvineh/go-rest-game-character/internal/errors"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/hikvineh/go-rest-game-character/pkg/pagination"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+// The adminHandler guards the changes to the ability catalog, which affect the characters that learned the abilities.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler, adminHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/abilities/<id>", res.get)
+	r.Get("/abilities", res.query)
+	r.Get("/characters/<id>/abilities", res.learned)
+
+	r.Use(authHandler)
+
+	// the following endpoints require a valid JWT
+	r.Post("/abilities", adminHandler, res.create)
+	r.Put("/abilities/<id>", adminHandler, res.update)
+	r.Delete("/abilities/<id>", adminHandler, res.delete)
+	r.Post("/characters/<id>/abilities", res.learn)
+	r.Delete("/characters/<id>/abilities/<ability_id>", res.forget)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	ability, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(ability)
+}
+
+func (r resource) query(c *routing.Context) error {
+	var characterCode int64
+	if value := c.Query("character_code"); value != "" {
+		var err error
+		if characterCode, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return validation.Errors{
+				"character_code": errors.New("must be an integer"),
+			}
+		}
+	}
+
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx, characterCode)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	abilities, err := r.service.Query(ctx, characterCode, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = abilities
+	return c.Write(pages)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreateAbilityRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return apperrors.BadRequest("")
+	}
+	ability, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(ability, http.StatusCreated)
+}
+
+func (r resource) update(c *routing.Context) error {
+	var input UpdateAbilityRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return apperrors.BadRequest("")
+	}
+
+	ability, err := r.service.Update(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(ability)
+}
+
+func (r resource) delete(c *routing.Context) error {
+	ability, err := r.service.Delete(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(ability)
+}
+
+func (r resource) learned(c *routing.Context) error {
+	abilities, err := r.service.Learned(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(abilities)
+}
+
+func (r resource) learn(c *routing.Context) error {
+	var input LearnAbilityRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return apperrors.BadRequest("")
+	}
+
+	abilities, err := r.service.Learn(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(abilities)
+}
+
+func (r resource) forget(c *routing.Context) error {
+	abilities, err := r.service.Forget(c.Request.Context(), c.Param("id"), c.Param("ability_id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(abilities)
+}
@@ -0,0 +1,81 @@
+package ability
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{abilities: []entity.Ability{
+		{ID: "light", Name: "Light", CharacterCode: 1, MinLevel: 1, PowerBonus: 5},
+		{ID: "fireball", Name: "Fireball", CharacterCode: 1, MinLevel: 3, PrerequisiteID: "light", PowerPercent: 50},
+		{ID: "archery", Name: "Archery", CharacterCode: 2, MinLevel: 1, PowerBonus: 5},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, mockTypeService{}, newMockCharacterService(repo), repo.transactional, logger), auth.MockAuthHandler, auth.AdminHandler([]string{"100"}), logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/abilities", "", nil, http.StatusOK, `*"total_count":3*`},
+		{"get of type", "GET", "/abilities?character_code=1", "", nil, http.StatusOK, `*"total_count":2*`},
+		{"get invalid type", "GET", "/abilities?character_code=abc", "", nil, http.StatusBadRequest, `*character_code*`},
+		{"get 1", "GET", "/abilities/fireball", "", nil, http.StatusOK, `*"character_code":1,"min_level":3,"prerequisite_id":"light","power_bonus":0,"power_percent":50*`},
+		{"get unknown", "GET", "/abilities/none", "", nil, http.StatusNotFound, ""},
+		{"create ok", "POST", "/abilities", `{"name":"Volley","character_code":2,"prerequisite_id":"archery","power_bonus":10}`, header, http.StatusCreated, `*"name":"Volley","character_code":2,"min_level":1*`},
+		{"create auth error", "POST", "/abilities", `{"name":"Volley","character_code":2}`, nil, http.StatusUnauthorized, ""},
+		{"create input error", "POST", "/abilities", `"name":"Volley"}`, header, http.StatusBadRequest, ""},
+		{"create validation error", "POST", "/abilities", `{"name":"Volley","character_code":2,"power_percent":-200}`, header, http.StatusBadRequest, `*power_percent*`},
+		{"create wrong prerequisite", "POST", "/abilities", `{"name":"Volley","character_code":2,"prerequisite_id":"light"}`, header, http.StatusBadRequest, `*prerequisite_id*`},
+		{"update ok", "PUT", "/abilities/light", `{"name":"Light","power_bonus":6}`, header, http.StatusOK, `*"power_bonus":6*`},
+		{"update unknown", "PUT", "/abilities/none", `{"name":"Light"}`, header, http.StatusNotFound, ""},
+		{"update auth error", "PUT", "/abilities/light", `{"name":"Light"}`, nil, http.StatusUnauthorized, ""},
+		{"learned empty", "GET", "/characters/gandalf/abilities", "", nil, http.StatusOK, `*"abilities":[]*`},
+		{"learned unknown", "GET", "/characters/none/abilities", "", nil, http.StatusNotFound, ""},
+		{"learn", "POST", "/characters/gandalf/abilities", `{"ability_id":"light"}`, header, http.StatusOK, `*"effective_power":26,"character_value":52*`},
+		{"learn again", "POST", "/characters/gandalf/abilities", `{"ability_id":"light"}`, header, http.StatusConflict, ""},
+		{"learn level gate", "POST", "/characters/gandalf/abilities", `{"ability_id":"fireball"}`, header, http.StatusBadRequest, `*level 3*`},
+		{"learn prerequisite", "POST", "/characters/radagast/abilities", `{"ability_id":"fireball"}`, header, http.StatusBadRequest, `*learn the ability light first*`},
+		{"learn wrong type", "POST", "/characters/gandalf/abilities", `{"ability_id":"archery"}`, header, http.StatusBadRequest, ""},
+		{"learn unknown ability", "POST", "/characters/gandalf/abilities", `{"ability_id":"none"}`, header, http.StatusBadRequest, `*ability_id*`},
+		{"learn not owner", "POST", "/characters/saruman/abilities", `{"ability_id":"light"}`, header, http.StatusForbidden, ""},
+		{"learn auth error", "POST", "/characters/gandalf/abilities", `{"ability_id":"light"}`, nil, http.StatusUnauthorized, ""},
+		{"learned", "GET", "/characters/gandalf/abilities", "", nil, http.StatusOK, `*"abilities":[{"id":"light"*`},
+		{"delete prerequisite", "DELETE", "/abilities/light", "", header, http.StatusBadRequest, ""},
+		{"forget", "DELETE", "/characters/gandalf/abilities/light", "", header, http.StatusOK, `*"effective_power":20,*`},
+		{"forget not learned", "DELETE", "/characters/gandalf/abilities/light", "", header, http.StatusNotFound, ""},
+		{"forget auth error", "DELETE", "/characters/gandalf/abilities/light", "", nil, http.StatusUnauthorized, ""},
+		{"delete ok", "DELETE", "/abilities/fireball", "", header, http.StatusOK, "*Fireball*"},
+		{"delete verify", "GET", "/abilities/fireball", "", nil, http.StatusNotFound, ""},
+		{"delete auth error", "DELETE", "/abilities/light", "", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+func TestAPI_admin(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{abilities: []entity.Ability{
+		{ID: "light", Name: "Light", CharacterCode: 1, MinLevel: 1, PowerBonus: 5},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, mockTypeService{}, newMockCharacterService(repo), repo.transactional, logger), auth.MockAuthHandler, auth.AdminHandler(nil), logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get 1", "GET", "/abilities/light", "", nil, http.StatusOK, "*Light*"},
+		{"create forbidden", "POST", "/abilities", `{"name":"Archery","character_code":2,"min_level":1}`, header, http.StatusForbidden, ""},
+		{"update forbidden", "PUT", "/abilities/light", `{"name":"Light","character_code":1,"min_level":1,"power_bonus":500}`, header, http.StatusForbidden, ""},
+		{"delete forbidden", "DELETE", "/abilities/light", ``, header, http.StatusForbidden, ""},
+		{"catalog unchanged", "GET", "/abilities/light", "", nil, http.StatusOK, `*"power_bonus":5,*`},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
@@ -0,0 +1,22 @@
+package ability
+
+import (
+	"net/http"
+
+	"github.com/hikvineh/go-rest-game-character/internal/errors"
+)
+
+var (
+	// ErrPrerequisite is returned when an ability that is the prerequisite of other abilities is deleted from the
+	// catalog, or forgotten by a character that learned those abilities.
+	ErrPrerequisite = errors.BadRequest("The ability is a prerequisite of other abilities.")
+	// ErrWrongType is returned when a character attempts to learn an ability restricted to another character type.
+	ErrWrongType = errors.BadRequest("The ability cannot be learned by characters of this type.")
+	// ErrTypeChange is returned when a character that learned abilities of its type is reverted to another type.
+	ErrTypeChange = errors.BadRequest("The character must forget the abilities of its type before changing type.")
+	// ErrAlreadyLearned is returned when a character attempts to learn an ability it already knows.
+	ErrAlreadyLearned = errors.ErrorResponse{
+		Status:  http.StatusConflict,
+		Message: "The character has already learned the ability.",
+	}
+)
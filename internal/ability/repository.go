@@ -0,0 +1,188 @@
+package ability
+
+import (
+	"context"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/dbcontext"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// Repository encapsulates the logic to access abilities and the abilities learned by characters from the data source.
+// It implements character.Equipment.
+type Repository interface {
+	// Get returns the ability with the specified ID.
+	Get(ctx context.Context, id string) (entity.Ability, error)
+	// Count returns the number of abilities of the given character type, or of all abilities if the code is 0.
+	Count(ctx context.Context, characterCode int64) (int, error)
+	// Query returns the list of abilities of the given character type, or all abilities if the code is 0, ordered by
+	// name with the given offset and limit.
+	Query(ctx context.Context, characterCode int64, offset, limit int) ([]entity.Ability, error)
+	// Create saves a new ability in the storage.
+	Create(ctx context.Context, ability entity.Ability) error
+	// Update updates the ability with given ID in the storage.
+	Update(ctx context.Context, ability entity.Ability) error
+	// Delete removes the ability with given ID from the storage, along with the characters' knowledge of it.
+	Delete(ctx context.Context, id string) error
+	// CountDependents returns the number of abilities whose prerequisite is the ability with the given ID.
+	CountDependents(ctx context.Context, id string) (int, error)
+	// LockCharacter locks the character with the given ID until the end of the transaction, so that concurrent changes
+	// to its abilities wait for each other.
+	LockCharacter(ctx context.Context, characterID string) error
+	// QueryLearned returns the abilities learned by the character with the given ID, ordered by name.
+	QueryLearned(ctx context.Context, characterID string) ([]entity.Ability, error)
+	// AddLearned saves an ability learned by a character, unless the character already learned it. It reports whether
+	// the ability was saved.
+	AddLearned(ctx context.Context, learned entity.CharacterAbility) (bool, error)
+	// DeleteLearned removes the given ability from the abilities learned by the character with the given ID.
+	DeleteLearned(ctx context.Context, characterID, abilityID string) error
+	// QueryLearners returns the IDs of the characters that learned the ability with the given ID.
+	QueryLearners(ctx context.Context, abilityID string) ([]string, error)
+	// Modifiers returns the stat modifiers of the abilities learned by the character with the given ID.
+	Modifiers(ctx context.Context, characterID string) ([]character.Modifier, error)
+}
+
+// repository persists abilities in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new ability repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the ability with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Ability, error) {
+	var ability entity.Ability
+	err := r.db.With(ctx).Select().Model(id, &ability)
+	return ability, err
+}
+
+// Create saves a new ability record in the database.
+func (r repository) Create(ctx context.Context, ability entity.Ability) error {
+	return r.db.With(ctx).Model(&ability).Insert()
+}
+
+// Update saves the changes to an ability in the database.
+func (r repository) Update(ctx context.Context, ability entity.Ability) error {
+	return r.db.With(ctx).Model(&ability).Update()
+}
+
+// Delete deletes the ability record with the specified ID from the database. The character ability records of that
+// ability are deleted by the foreign key.
+func (r repository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.With(ctx).Delete("ability", dbx.HashExp{"id": id}).Execute()
+	return err
+}
+
+// Count returns the number of the ability records of the given character type in the database.
+func (r repository) Count(ctx context.Context, characterCode int64) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("ability").Where(ofType(characterCode)).Row(&count)
+	return count, err
+}
+
+// Query retrieves the ability records of the given character type ordered by name with the specified offset and
+// limit from the database.
+func (r repository) Query(ctx context.Context, characterCode int64, offset, limit int) ([]entity.Ability, error) {
+	var abilities []entity.Ability
+	err := r.db.With(ctx).
+		Select().
+		Where(ofType(characterCode)).
+		OrderBy("name", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&abilities)
+	return abilities, err
+}
+
+// ofType returns the condition matching the abilities of the given character type, or nil if the code is 0.
+func ofType(characterCode int64) dbx.Expression {
+	if characterCode == 0 {
+		return nil
+	}
+	return dbx.HashExp{"character_code": characterCode}
+}
+
+// CountDependents returns the number of the ability records having the given ability as prerequisite in the database.
+func (r repository) CountDependents(ctx context.Context, id string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("ability").Where(dbx.HashExp{"prerequisite_id": id}).Row(&count)
+	return count, err
+}
+
+// LockCharacter locks the character record with the given ID in the database until the end of the transaction.
+func (r repository) LockCharacter(ctx context.Context, characterID string) error {
+	var id string
+	return r.db.With(ctx).
+		NewQuery("SELECT [[id]] FROM {{character}} WHERE [[id]] = {:id} FOR UPDATE").
+		Bind(dbx.Params{"id": characterID}).
+		Row(&id)
+}
+
+// QueryLearned retrieves the ability records learned by the given character, ordered by name, from the database.
+func (r repository) QueryLearned(ctx context.Context, characterID string) ([]entity.Ability, error) {
+	var abilities []entity.Ability
+	err := r.db.With(ctx).
+		Select("ability.*").
+		From("character_ability").
+		InnerJoin("ability", dbx.NewExp("ability.id = character_ability.ability_id")).
+		Where(dbx.HashExp{"character_ability.character_id": characterID}).
+		OrderBy("ability.name", "ability.id").
+		All(&abilities)
+	return abilities, err
+}
+
+// AddLearned inserts a character ability record in the database, unless it exists.
+func (r repository) AddLearned(ctx context.Context, learned entity.CharacterAbility) (bool, error) {
+	result, err := r.db.With(ctx).
+		NewQuery("INSERT INTO {{character_ability}} ([[character_id]], [[ability_id]], [[created_at]]) " +
+			"VALUES ({:character_id}, {:ability_id}, {:created_at}) ON CONFLICT DO NOTHING").
+		Bind(dbx.Params{
+			"character_id": learned.CharacterID,
+			"ability_id":   learned.AbilityID,
+			"created_at":   learned.CreatedAt,
+		}).
+		Execute()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// DeleteLearned deletes the character ability record of the given character and ability from the database.
+func (r repository) DeleteLearned(ctx context.Context, characterID, abilityID string) error {
+	_, err := r.db.With(ctx).Delete("character_ability", dbx.HashExp{"character_id": characterID, "ability_id": abilityID}).Execute()
+	return err
+}
+
+// QueryLearners retrieves the IDs of the characters having a character ability record of the given ability from the
+// database.
+func (r repository) QueryLearners(ctx context.Context, abilityID string) ([]string, error) {
+	var ids []string
+	err := r.db.With(ctx).
+		Select("character_id").
+		From("character_ability").
+		Where(dbx.HashExp{"ability_id": abilityID}).
+		OrderBy("character_id").
+		Column(&ids)
+	return ids, err
+}
+
+// Modifiers retrieves the stat modifiers of the abilities of the character ability records of the given character
+// from the database.
+func (r repository) Modifiers(ctx context.Context, characterID string) ([]character.Modifier, error) {
+	var modifiers []character.Modifier
+	err := r.db.With(ctx).
+		Select("ability.power_bonus AS flat", "ability.power_percent AS percent").
+		From("character_ability").
+		InnerJoin("ability", dbx.NewExp("ability.id = character_ability.ability_id")).
+		Where(dbx.HashExp{"character_ability.character_id": characterID}).
+		All(&modifiers)
+	return modifiers, err
+}
@@ -0,0 +1,107 @@
+package ability
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "ability")
+	// learned abilities reference characters, so a character is created for this test
+	_, err := db.DB().Delete("character", dbx.HashExp{"id": "ability_test"}).Execute()
+	assert.Nil(t, err)
+	_, err = db.DB().Insert("character", dbx.Params{
+		"id": "ability_test", "name": "Gandalf", "character_code": 1, "character_power": 20, "effective_power": 20,
+		"character_value": 60, "version": 1, "created_at": time.Now(), "updated_at": time.Now(),
+	}).Execute()
+	assert.Nil(t, err)
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+
+	// create
+	now := time.Now()
+	assert.Nil(t, repo.Create(ctx, entity.Ability{ID: "light", Name: "Light", CharacterCode: 1, MinLevel: 1, PowerBonus: 5, CreatedAt: now, UpdatedAt: now}))
+	assert.Nil(t, repo.Create(ctx, entity.Ability{ID: "fireball", Name: "Fireball", CharacterCode: 1, MinLevel: 3, PrerequisiteID: "light", PowerPercent: 50, CreatedAt: now, UpdatedAt: now}))
+	assert.Nil(t, repo.Create(ctx, entity.Ability{ID: "archery", Name: "Archery", CharacterCode: 2, MinLevel: 1, CreatedAt: now, UpdatedAt: now}))
+	count, err := repo.Count(ctx, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	count, err = repo.Count(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	// get
+	ability, err := repo.Get(ctx, "fireball")
+	assert.Nil(t, err)
+	assert.Equal(t, "light", ability.PrerequisiteID)
+	assert.Equal(t, int64(3), ability.MinLevel)
+	_, err = repo.Get(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// update
+	ability.PowerPercent = 60
+	assert.Nil(t, repo.Update(ctx, ability))
+	ability, _ = repo.Get(ctx, "fireball")
+	assert.Equal(t, int64(60), ability.PowerPercent)
+
+	// query
+	abilities, err := repo.Query(ctx, 1, 0, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, abilities, 2) {
+		assert.Equal(t, "Fireball", abilities[0].Name)
+	}
+	count, err = repo.CountDependents(ctx, "light")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	// learning
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		assert.Nil(t, repo.LockCharacter(ctx, "ability_test"))
+		assert.Equal(t, sql.ErrNoRows, repo.LockCharacter(ctx, "none"))
+		added, err := repo.AddLearned(ctx, entity.CharacterAbility{CharacterID: "ability_test", AbilityID: "light", CreatedAt: now})
+		assert.True(t, added)
+		return err
+	})
+	assert.Nil(t, err)
+	added, err := repo.AddLearned(ctx, entity.CharacterAbility{CharacterID: "ability_test", AbilityID: "fireball", CreatedAt: now})
+	assert.Nil(t, err)
+	assert.True(t, added)
+	added, err = repo.AddLearned(ctx, entity.CharacterAbility{CharacterID: "ability_test", AbilityID: "light", CreatedAt: now})
+	assert.Nil(t, err)
+	assert.False(t, added)
+	abilities, err = repo.QueryLearned(ctx, "ability_test")
+	assert.Nil(t, err)
+	if assert.Len(t, abilities, 2) {
+		assert.Equal(t, "fireball", abilities[0].ID)
+	}
+	learners, err := repo.QueryLearners(ctx, "light")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ability_test"}, learners)
+	modifiers, err := repo.Modifiers(ctx, "ability_test")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []character.Modifier{{Flat: 5}, {Percent: 60}}, modifiers)
+
+	// forgetting
+	assert.Nil(t, repo.DeleteLearned(ctx, "ability_test", "fireball"))
+	abilities, _ = repo.QueryLearned(ctx, "ability_test")
+	assert.Len(t, abilities, 1)
+
+	// delete
+	assert.Nil(t, repo.Delete(ctx, "light"))
+	_, err = repo.Get(ctx, "light")
+	assert.Equal(t, sql.ErrNoRows, err)
+	abilities, _ = repo.QueryLearned(ctx, "ability_test")
+	assert.Empty(t, abilities)
+}
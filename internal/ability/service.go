@@ -0,0 +1,418 @@
+package ability
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/charactertype"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	apperrors "github.com/hikvineh/go-rest-game-character/internal/errors"
+	"github.com/hikvineh/go-rest-game-character/pkg/dbcontext"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// Stat modifier and level bounds
+const (
+	// MaxPowerBonus is the maximum flat power bonus or malus of an ability.
+	MaxPowerBonus = 1000000
+	// MinPowerPercent and MaxPowerPercent bound the percentage of the base power that an ability adds.
+	MinPowerPercent = -100
+	MaxPowerPercent = 1000
+	// MaxMinLevel is the maximum level required to learn an ability.
+	MaxMinLevel = 1000
+)
+
+// Service encapsulates usecase logic for abilities and the abilities learned by characters.
+type Service interface {
+	Get(ctx context.Context, id string) (Ability, error)
+	Query(ctx context.Context, characterCode int64, offset, limit int) ([]Ability, error)
+	Count(ctx context.Context, characterCode int64) (int, error)
+	Create(ctx context.Context, input CreateAbilityRequest) (Ability, error)
+	Update(ctx context.Context, id string, input UpdateAbilityRequest) (Ability, error)
+	Delete(ctx context.Context, id string) (Ability, error)
+	Learned(ctx context.Context, characterID string) (Abilities, error)
+	Learn(ctx context.Context, characterID string, input LearnAbilityRequest) (Abilities, error)
+	Forget(ctx context.Context, characterID, abilityID string) (Abilities, error)
+}
+
+// Ability represents the data about an ability.
+type Ability struct {
+	entity.Ability
+}
+
+// Abilities represents the abilities learned by a character, along with the character. The effective power and the
+// value of the character account for them.
+type Abilities struct {
+	Character character.Character `json:"character"`
+	Abilities []Ability           `json:"abilities"`
+}
+
+// CreateAbilityRequest represents an ability creation request. The minimum level defaults to 1.
+type CreateAbilityRequest struct {
+	Name           string `json:"name"`
+	CharacterCode  int64  `json:"character_code"`
+	MinLevel       int64  `json:"min_level"`
+	PrerequisiteID string `json:"prerequisite_id"`
+	PowerBonus     int64  `json:"power_bonus"`
+	PowerPercent   int64  `json:"power_percent"`
+}
+
+// Validate validates the CreateAbilityRequest fields.
+func (m CreateAbilityRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.CharacterCode, validation.Required),
+		validation.Field(&m.MinLevel, validation.Min(int64(1)), validation.Max(int64(MaxMinLevel))),
+		validation.Field(&m.PowerBonus, validation.Min(int64(-MaxPowerBonus)), validation.Max(int64(MaxPowerBonus))),
+		validation.Field(&m.PowerPercent, validation.Min(int64(MinPowerPercent)), validation.Max(int64(MaxPowerPercent))),
+	)
+}
+
+// UpdateAbilityRequest represents an ability update request. The character type and the prerequisite of an ability
+// cannot be changed. The minimum level defaults to 1.
+type UpdateAbilityRequest struct {
+	Name         string `json:"name"`
+	MinLevel     int64  `json:"min_level"`
+	PowerBonus   int64  `json:"power_bonus"`
+	PowerPercent int64  `json:"power_percent"`
+}
+
+// Validate validates the UpdateAbilityRequest fields.
+func (m UpdateAbilityRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.MinLevel, validation.Min(int64(1)), validation.Max(int64(MaxMinLevel))),
+		validation.Field(&m.PowerBonus, validation.Min(int64(-MaxPowerBonus)), validation.Max(int64(MaxPowerBonus))),
+		validation.Field(&m.PowerPercent, validation.Min(int64(MinPowerPercent)), validation.Max(int64(MaxPowerPercent))),
+	)
+}
+
+// LearnAbilityRequest represents a request for a character to learn an ability.
+type LearnAbilityRequest struct {
+	AbilityID string `json:"ability_id"`
+}
+
+// Validate validates the LearnAbilityRequest fields.
+func (m LearnAbilityRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.AbilityID, validation.Required),
+	)
+}
+
+type service struct {
+	repo          Repository
+	types         charactertype.Service
+	characters    character.Service
+	transactional dbcontext.TransactionFunc
+	logger        log.Logger
+}
+
+// NewService creates a new ability service.
+// The character service is used to recompute the characters whose abilities change, in the transaction run by the
+// transactional function.
+func NewService(repo Repository, types charactertype.Service, characters character.Service, transactional dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, types, characters, transactional, logger}
+}
+
+// Get returns the ability with the specified ID.
+func (s service) Get(ctx context.Context, id string) (Ability, error) {
+	ability, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Ability{}, err
+	}
+	return Ability{ability}, nil
+}
+
+// Count returns the number of abilities of the specified character type, or of all abilities if the code is 0.
+func (s service) Count(ctx context.Context, characterCode int64) (int, error) {
+	return s.repo.Count(ctx, characterCode)
+}
+
+// Query returns the abilities of the specified character type, or all abilities if the code is 0, ordered by name
+// with the specified offset and limit.
+func (s service) Query(ctx context.Context, characterCode int64, offset, limit int) ([]Ability, error) {
+	abilities, err := s.repo.Query(ctx, characterCode, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(abilities), nil
+}
+
+// wrap returns the given abilities as service abilities.
+func wrap(abilities []entity.Ability) []Ability {
+	result := []Ability{}
+	for _, ability := range abilities {
+		result = append(result, Ability{ability})
+	}
+	return result
+}
+
+// Create creates a new ability. Its prerequisite, if any, must be an ability of the same character type.
+func (s service) Create(ctx context.Context, req CreateAbilityRequest) (Ability, error) {
+	if err := req.Validate(); err != nil {
+		return Ability{}, err
+	}
+	if _, err := s.types.Get(ctx, req.CharacterCode); err == sql.ErrNoRows {
+		return Ability{}, validation.Errors{
+			"character_code": errors.New("must be a registered character type"),
+		}
+	} else if err != nil {
+		return Ability{}, err
+	}
+	if req.PrerequisiteID != "" {
+		prerequisite, err := s.repo.Get(ctx, req.PrerequisiteID)
+		if err == sql.ErrNoRows || err == nil && prerequisite.CharacterCode != req.CharacterCode {
+			return Ability{}, validation.Errors{
+				"prerequisite_id": errors.New("must be the ID of an ability of the same character type"),
+			}
+		} else if err != nil {
+			return Ability{}, err
+		}
+	}
+	if req.MinLevel == 0 {
+		req.MinLevel = 1
+	}
+	now := time.Now()
+	id := entity.GenerateID()
+	err := s.repo.Create(ctx, entity.Ability{
+		ID:             id,
+		Name:           req.Name,
+		CharacterCode:  req.CharacterCode,
+		MinLevel:       req.MinLevel,
+		PrerequisiteID: req.PrerequisiteID,
+		PowerBonus:     req.PowerBonus,
+		PowerPercent:   req.PowerPercent,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	})
+	if err != nil {
+		return Ability{}, err
+	}
+	return s.Get(ctx, id)
+}
+
+// Update renames the ability with the specified ID and changes its level gate and its stat modifiers. The level gate
+// only applies to characters learning the ability later. The characters that learned the ability are recomputed in
+// the same transaction.
+func (s service) Update(ctx context.Context, id string, req UpdateAbilityRequest) (Ability, error) {
+	if err := req.Validate(); err != nil {
+		return Ability{}, err
+	}
+	if req.MinLevel == 0 {
+		req.MinLevel = 1
+	}
+
+	var ability Ability
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		if ability, err = s.Get(ctx, id); err != nil {
+			return err
+		}
+		refresh := ability.PowerBonus != req.PowerBonus || ability.PowerPercent != req.PowerPercent
+		ability.Name = req.Name
+		ability.MinLevel = req.MinLevel
+		ability.PowerBonus = req.PowerBonus
+		ability.PowerPercent = req.PowerPercent
+		ability.UpdatedAt = time.Now()
+		if err := s.repo.Update(ctx, ability.Ability); err != nil {
+			return err
+		}
+		if !refresh {
+			return nil
+		}
+		learners, err := s.repo.QueryLearners(ctx, id)
+		if err != nil {
+			return err
+		}
+		return s.refresh(ctx, learners)
+	})
+	return ability, err
+}
+
+// Delete deletes the ability with the specified ID, which the characters that learned it forget. They are recomputed
+// in the same transaction. The prerequisite of other abilities cannot be deleted.
+func (s service) Delete(ctx context.Context, id string) (Ability, error) {
+	var ability Ability
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		if ability, err = s.Get(ctx, id); err != nil {
+			return err
+		}
+		dependents, err := s.repo.CountDependents(ctx, id)
+		if err != nil {
+			return err
+		}
+		if dependents > 0 {
+			return ErrPrerequisite
+		}
+		learners, err := s.repo.QueryLearners(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.refresh(ctx, learners)
+	})
+	return ability, err
+}
+
+// refresh recomputes the characters with the specified IDs after their abilities changed.
+func (s service) refresh(ctx context.Context, characterIDs []string) error {
+	for _, id := range characterIDs {
+		if _, err := s.characters.RefreshEquipment(ctx, id); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+	return nil
+}
+
+// Learned returns the abilities learned by the character with the specified ID.
+func (s service) Learned(ctx context.Context, characterID string) (Abilities, error) {
+	c, err := s.characters.Get(ctx, characterID)
+	if err != nil {
+		return Abilities{}, err
+	}
+	return s.learned(ctx, c)
+}
+
+// learned returns the abilities learned by the given character.
+func (s service) learned(ctx context.Context, c character.Character) (Abilities, error) {
+	abilities, err := s.repo.QueryLearned(ctx, c.ID)
+	if err != nil {
+		return Abilities{}, err
+	}
+	return Abilities{Character: c, Abilities: wrap(abilities)}, nil
+}
+
+// changeAbilities applies a change to the abilities of the character with the specified ID in a transaction that
+// locks the character, recomputes the character and returns its resulting abilities. Only the owner of a character
+// can change its abilities. The change is given the character and the abilities it learned.
+func (s service) changeAbilities(ctx context.Context, characterID string, change func(ctx context.Context, c character.Character, learned []entity.Ability) error) (Abilities, error) {
+	var abilities Abilities
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.LockCharacter(ctx, characterID); err != nil {
+			return err
+		}
+		c, err := s.characters.Get(ctx, characterID)
+		if err != nil {
+			return err
+		}
+		if user := auth.CurrentUser(ctx); user == nil || user.GetID() != c.OwnerID {
+			return character.ErrNotOwner
+		}
+		learned, err := s.repo.QueryLearned(ctx, characterID)
+		if err != nil {
+			return err
+		}
+		if err := change(ctx, c, learned); err != nil {
+			return err
+		}
+		if c, err = s.characters.RefreshEquipment(ctx, characterID); err != nil {
+			return err
+		}
+		abilities, err = s.learned(ctx, c)
+		return err
+	})
+	return abilities, err
+}
+
+// Learn makes the character with the specified ID learn an ability. The ability must be of the type of the
+// character, which must have reached the minimum level of the ability and learned its prerequisite, if any.
+func (s service) Learn(ctx context.Context, characterID string, req LearnAbilityRequest) (Abilities, error) {
+	if err := req.Validate(); err != nil {
+		return Abilities{}, err
+	}
+	return s.changeAbilities(ctx, characterID, func(ctx context.Context, c character.Character, learned []entity.Ability) error {
+		ability, err := s.repo.Get(ctx, req.AbilityID)
+		if err == sql.ErrNoRows {
+			return validation.Errors{
+				"ability_id": errors.New("must be the ID of an existing ability"),
+			}
+		} else if err != nil {
+			return err
+		}
+		if ability.CharacterCode != c.CharacterCode {
+			return ErrWrongType
+		}
+		if c.Level < ability.MinLevel {
+			return apperrors.BadRequest(fmt.Sprintf("The character must reach level %v to learn the ability.", ability.MinLevel))
+		}
+		if ability.PrerequisiteID != "" && !knows(learned, ability.PrerequisiteID) {
+			return apperrors.BadRequest(fmt.Sprintf("The character must learn the ability %v first.", ability.PrerequisiteID))
+		}
+		added, err := s.repo.AddLearned(ctx, entity.CharacterAbility{
+			CharacterID: c.ID,
+			AbilityID:   ability.ID,
+			CreatedAt:   time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		if !added {
+			return ErrAlreadyLearned
+		}
+		return nil
+	})
+}
+
+// knows tells whether the ability with the given ID is among the given ones.
+func knows(abilities []entity.Ability, id string) bool {
+	for _, ability := range abilities {
+		if ability.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Forget makes the character with the specified ID forget an ability, unless it is the prerequisite of another
+// ability the character learned. sql.ErrNoRows is returned if the character did not learn the ability.
+func (s service) Forget(ctx context.Context, characterID, abilityID string) (Abilities, error) {
+	return s.changeAbilities(ctx, characterID, func(ctx context.Context, c character.Character, learned []entity.Ability) error {
+		if !knows(learned, abilityID) {
+			return sql.ErrNoRows
+		}
+		for _, ability := range learned {
+			if ability.PrerequisiteID == abilityID {
+				return ErrPrerequisite
+			}
+		}
+		return s.repo.DeleteLearned(ctx, characterID, abilityID)
+	})
+}
+
+// Guard keeps the abilities learned by characters consistent with their type, which changes when they are reverted.
+type Guard struct {
+	repo Repository
+}
+
+// NewGuard creates a guard checking the abilities of the given repository. It is meant to be the listener of the
+// character service.
+func NewGuard(repo Repository) Guard {
+	return Guard{repo}
+}
+
+// CharactersChanged returns ErrTypeChange if a character changed type while it knows abilities of another type. It
+// runs in the transaction of the changes, which fails along with it.
+func (g Guard) CharactersChanged(ctx context.Context, revisions []entity.CharacterRevision) error {
+	for _, rev := range revisions {
+		if rev.Before == nil || rev.After == nil || rev.Before.CharacterCode == rev.After.CharacterCode {
+			continue
+		}
+		learned, err := g.repo.QueryLearned(ctx, rev.CharacterID)
+		if err != nil {
+			return err
+		}
+		for _, ability := range learned {
+			if ability.CharacterCode != rev.After.CharacterCode {
+				return ErrTypeChange
+			}
+		}
+	}
+	return nil
+}
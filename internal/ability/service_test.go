@@ -0,0 +1,383 @@
+package ability
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/charactertype"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test/charactertest"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var errCRUD = errors.New("error crud")
+
+func TestCreateAbilityRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     CreateAbilityRequest
+		wantError bool
+	}{
+		{"success", CreateAbilityRequest{Name: "Fireball", CharacterCode: character.Wizard, MinLevel: 3, PowerBonus: 5, PowerPercent: 10}, false},
+		{"required", CreateAbilityRequest{Name: "", CharacterCode: character.Wizard}, true},
+		{"type required", CreateAbilityRequest{Name: "Fireball"}, true},
+		{"level too high", CreateAbilityRequest{Name: "Fireball", CharacterCode: character.Wizard, MinLevel: MaxMinLevel + 1}, true},
+		{"level too low", CreateAbilityRequest{Name: "Fireball", CharacterCode: character.Wizard, MinLevel: -1}, true},
+		{"percent too low", CreateAbilityRequest{Name: "Fireball", CharacterCode: character.Wizard, PowerPercent: -101}, true},
+		{"bonus too high", CreateAbilityRequest{Name: "Fireball", CharacterCode: character.Wizard, PowerBonus: MaxPowerBonus + 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func TestUpdateAbilityRequest_Validate(t *testing.T) {
+	assert.Nil(t, UpdateAbilityRequest{Name: "Fireball", MinLevel: 2, PowerBonus: -5}.Validate())
+	assert.NotNil(t, UpdateAbilityRequest{}.Validate())
+	assert.NotNil(t, UpdateAbilityRequest{Name: "Fireball", PowerPercent: MaxPowerPercent + 1}.Validate())
+}
+
+func TestLearnAbilityRequest_Validate(t *testing.T) {
+	assert.Nil(t, LearnAbilityRequest{AbilityID: "fireball"}.Validate())
+	assert.NotNil(t, LearnAbilityRequest{}.Validate())
+}
+
+func Test_service_CRUD(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, mockTypeService{}, newMockCharacterService(repo), repo.transactional, logger)
+	ctx := context.Background()
+
+	// successful creation
+	ability, err := s.Create(ctx, CreateAbilityRequest{Name: "Light", CharacterCode: character.Wizard, PowerBonus: 5})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, ability.ID)
+	light := ability.ID
+	assert.Equal(t, int64(1), ability.MinLevel)
+	assert.Equal(t, int64(5), ability.PowerBonus)
+	ability, err = s.Create(ctx, CreateAbilityRequest{Name: "Fireball", CharacterCode: character.Wizard, MinLevel: 3, PrerequisiteID: light})
+	assert.Nil(t, err)
+	assert.Equal(t, light, ability.PrerequisiteID)
+	fireball := ability.ID
+	_, err = s.Create(ctx, CreateAbilityRequest{Name: "Archery", CharacterCode: character.Elf})
+	assert.Nil(t, err)
+	count, _ := s.Count(ctx, 0)
+	assert.Equal(t, 3, count)
+	count, _ = s.Count(ctx, character.Wizard)
+	assert.Equal(t, 2, count)
+	abilities, _ := s.Query(ctx, character.Elf, 0, 10)
+	assert.Len(t, abilities, 1)
+
+	// creation errors
+	_, err = s.Create(ctx, CreateAbilityRequest{Name: ""})
+	assert.NotNil(t, err)
+	_, err = s.Create(ctx, CreateAbilityRequest{Name: "Dig", CharacterCode: 9})
+	assert.EqualError(t, err, "character_code: must be a registered character type.")
+	_, err = s.Create(ctx, CreateAbilityRequest{Name: "Volley", CharacterCode: character.Elf, PrerequisiteID: light})
+	assert.EqualError(t, err, "prerequisite_id: must be the ID of an ability of the same character type.")
+	_, err = s.Create(ctx, CreateAbilityRequest{Name: "Volley", CharacterCode: character.Elf, PrerequisiteID: "none"})
+	assert.NotNil(t, err)
+
+	// update
+	ability, err = s.Update(ctx, light, UpdateAbilityRequest{Name: "Bright Light", PowerBonus: 6})
+	assert.Nil(t, err)
+	assert.Equal(t, "Bright Light", ability.Name)
+	assert.Equal(t, int64(1), ability.MinLevel)
+	_, err = s.Update(ctx, "none", UpdateAbilityRequest{Name: "Light"})
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Update(ctx, light, UpdateAbilityRequest{})
+	assert.NotNil(t, err)
+
+	// delete
+	_, err = s.Delete(ctx, light)
+	assert.Equal(t, ErrPrerequisite, err)
+	_, err = s.Delete(ctx, fireball)
+	assert.Nil(t, err)
+	_, err = s.Get(ctx, fireball)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Delete(ctx, light)
+	assert.Nil(t, err)
+	_, err = s.Delete(ctx, light)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func Test_service_Learning(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	characters := newMockCharacterService(repo)
+	s := NewService(repo, mockTypeService{}, characters, repo.transactional, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+	repo.abilities = []entity.Ability{
+		{ID: "light", Name: "Light", CharacterCode: character.Wizard, MinLevel: 1, PowerBonus: 5},
+		{ID: "fireball", Name: "Fireball", CharacterCode: character.Wizard, MinLevel: 3, PrerequisiteID: "light", PowerPercent: 50},
+		{ID: "archery", Name: "Archery", CharacterCode: character.Elf, MinLevel: 1, PowerBonus: 5},
+	}
+
+	abilities, err := s.Learned(ctx, "gandalf")
+	assert.Nil(t, err)
+	assert.Empty(t, abilities.Abilities)
+	_, err = s.Learned(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// learning feeds into the value
+	abilities, err = s.Learn(ctx, "gandalf", LearnAbilityRequest{AbilityID: "light"})
+	assert.Nil(t, err)
+	if assert.Len(t, abilities.Abilities, 1) {
+		assert.Equal(t, "light", abilities.Abilities[0].ID)
+	}
+	assert.Equal(t, int64(25), abilities.Character.EffectivePower)
+	assert.Equal(t, int64(50), abilities.Character.CharacterValue)
+
+	// learning errors
+	_, err = s.Learn(ctx, "gandalf", LearnAbilityRequest{AbilityID: "light"})
+	assert.Equal(t, ErrAlreadyLearned, err)
+	_, err = s.Learn(ctx, "gandalf", LearnAbilityRequest{AbilityID: "archery"})
+	assert.Equal(t, ErrWrongType, err)
+	_, err = s.Learn(ctx, "gandalf", LearnAbilityRequest{AbilityID: "none"})
+	assert.EqualError(t, err, "ability_id: must be the ID of an existing ability.")
+	_, err = s.Learn(ctx, "gandalf", LearnAbilityRequest{})
+	assert.NotNil(t, err)
+	_, err = s.Learn(ctx, "saruman", LearnAbilityRequest{AbilityID: "light"})
+	assert.Equal(t, character.ErrNotOwner, err)
+	_, err = s.Learn(ctx, "none", LearnAbilityRequest{AbilityID: "light"})
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Learn(ctx, "gandalf", LearnAbilityRequest{AbilityID: "fireball"})
+	assert.EqualError(t, err, "The character must reach level 3 to learn the ability.")
+	_, err = s.Learn(ctx, "radagast", LearnAbilityRequest{AbilityID: "fireball"})
+	assert.EqualError(t, err, "The character must learn the ability light first.")
+
+	// prerequisites and level gates
+	characters.Characters["gandalf"].Level = 3
+	abilities, err = s.Learn(ctx, "gandalf", LearnAbilityRequest{AbilityID: "fireball"})
+	assert.Nil(t, err)
+	assert.Len(t, abilities.Abilities, 2)
+	assert.Equal(t, int64(35), abilities.Character.EffectivePower)
+
+	// catalog changes recompute the learners
+	_, err = s.Update(ctx, "fireball", UpdateAbilityRequest{Name: "Fireball", MinLevel: 3, PowerPercent: 100})
+	assert.Nil(t, err)
+	abilities, _ = s.Learned(ctx, "gandalf")
+	assert.Equal(t, int64(45), abilities.Character.EffectivePower)
+
+	// forgetting
+	_, err = s.Forget(ctx, "gandalf", "light")
+	assert.Equal(t, ErrPrerequisite, err)
+	_, err = s.Forget(ctx, "gandalf", "archery")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Forget(auth.WithUser(context.Background(), "101", "Other"), "gandalf", "fireball")
+	assert.Equal(t, character.ErrNotOwner, err)
+	abilities, err = s.Forget(ctx, "gandalf", "fireball")
+	assert.Nil(t, err)
+	assert.Len(t, abilities.Abilities, 1)
+	assert.Equal(t, int64(25), abilities.Character.EffectivePower)
+
+	// deleting an ability makes its learners forget it
+	_, err = s.Delete(ctx, "fireball")
+	assert.Nil(t, err)
+	_, err = s.Delete(ctx, "light")
+	assert.Nil(t, err)
+	abilities, _ = s.Learned(ctx, "gandalf")
+	assert.Empty(t, abilities.Abilities)
+	assert.Equal(t, int64(20), abilities.Character.EffectivePower)
+
+	// failures roll back
+	repo.abilities = append(repo.abilities, entity.Ability{ID: "error", Name: "Error", CharacterCode: character.Wizard, MinLevel: 1})
+	_, err = s.Learn(ctx, "gandalf", LearnAbilityRequest{AbilityID: "error"})
+	assert.Equal(t, errCRUD, err)
+	abilities, _ = s.Learned(ctx, "gandalf")
+	assert.Empty(t, abilities.Abilities)
+}
+
+func TestGuard_CharactersChanged(t *testing.T) {
+	repo := &mockRepository{
+		abilities: []entity.Ability{{ID: "light", Name: "Light", CharacterCode: character.Wizard, MinLevel: 1}},
+		learned:   []entity.CharacterAbility{{CharacterID: "gandalf", AbilityID: "light"}},
+	}
+	g := NewGuard(repo)
+	ctx := context.Background()
+	revision := func(id string, from, to int64) entity.CharacterRevision {
+		before := entity.CharacterSnapshot{ID: id, CharacterCode: from}
+		after := entity.CharacterSnapshot{ID: id, CharacterCode: to}
+		return entity.CharacterRevision{CharacterID: id, Action: entity.ActionRevert, Before: &before, After: &after}
+	}
+
+	// a character knowing abilities of its type cannot change type
+	assert.Equal(t, ErrTypeChange, g.CharactersChanged(ctx, []entity.CharacterRevision{revision("gandalf", character.Wizard, character.Elf)}))
+	assert.Nil(t, g.CharactersChanged(ctx, []entity.CharacterRevision{revision("gandalf", character.Wizard, character.Wizard)}))
+	// a character without abilities can
+	assert.Nil(t, g.CharactersChanged(ctx, []entity.CharacterRevision{revision("radagast", character.Wizard, character.Elf)}))
+	// creations and deletions are not checked
+	after := entity.CharacterSnapshot{ID: "gandalf", CharacterCode: character.Elf}
+	assert.Nil(t, g.CharactersChanged(ctx, []entity.CharacterRevision{{CharacterID: "gandalf", Action: entity.ActionCreate, After: &after}}))
+}
+
+type mockRepository struct {
+	abilities []entity.Ability
+	learned   []entity.CharacterAbility
+}
+
+// transactional runs f and restores the abilities and the learned abilities if it fails.
+func (m *mockRepository) transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	abilities := append([]entity.Ability{}, m.abilities...)
+	learned := append([]entity.CharacterAbility{}, m.learned...)
+	err := f(ctx)
+	if err != nil {
+		m.abilities, m.learned = abilities, learned
+	}
+	return err
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.Ability, error) {
+	for _, ability := range m.abilities {
+		if ability.ID == id {
+			return ability, nil
+		}
+	}
+	return entity.Ability{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context, characterCode int64) (int, error) {
+	abilities, _ := m.Query(ctx, characterCode, 0, len(m.abilities))
+	return len(abilities), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, characterCode int64, offset, limit int) ([]entity.Ability, error) {
+	var abilities []entity.Ability
+	for _, ability := range m.abilities {
+		if characterCode == 0 || ability.CharacterCode == characterCode {
+			abilities = append(abilities, ability)
+		}
+	}
+	return abilities, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, ability entity.Ability) error {
+	m.abilities = append(m.abilities, ability)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, ability entity.Ability) error {
+	for i, item := range m.abilities {
+		if item.ID == ability.ID {
+			m.abilities[i] = ability
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	for i, ability := range m.abilities {
+		if ability.ID == id {
+			m.abilities = append(m.abilities[:i], m.abilities[i+1:]...)
+			break
+		}
+	}
+	learned := []entity.CharacterAbility{}
+	for _, item := range m.learned {
+		if item.AbilityID != id {
+			learned = append(learned, item)
+		}
+	}
+	m.learned = learned
+	return nil
+}
+
+func (m mockRepository) CountDependents(ctx context.Context, id string) (int, error) {
+	count := 0
+	for _, ability := range m.abilities {
+		if ability.PrerequisiteID == id {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m mockRepository) LockCharacter(ctx context.Context, characterID string) error {
+	return nil
+}
+
+func (m mockRepository) QueryLearned(ctx context.Context, characterID string) ([]entity.Ability, error) {
+	var abilities []entity.Ability
+	for _, item := range m.learned {
+		if item.CharacterID == characterID {
+			ability, _ := m.Get(ctx, item.AbilityID)
+			abilities = append(abilities, ability)
+		}
+	}
+	sort.Slice(abilities, func(i, j int) bool { return abilities[i].Name < abilities[j].Name })
+	return abilities, nil
+}
+
+func (m *mockRepository) AddLearned(ctx context.Context, learned entity.CharacterAbility) (bool, error) {
+	if learned.AbilityID == "error" {
+		return false, errCRUD
+	}
+	for _, item := range m.learned {
+		if item.CharacterID == learned.CharacterID && item.AbilityID == learned.AbilityID {
+			return false, nil
+		}
+	}
+	m.learned = append(m.learned, learned)
+	return true, nil
+}
+
+func (m *mockRepository) DeleteLearned(ctx context.Context, characterID, abilityID string) error {
+	for i, item := range m.learned {
+		if item.CharacterID == characterID && item.AbilityID == abilityID {
+			m.learned = append(m.learned[:i], m.learned[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m mockRepository) QueryLearners(ctx context.Context, abilityID string) ([]string, error) {
+	var ids []string
+	for _, item := range m.learned {
+		if item.AbilityID == abilityID {
+			ids = append(ids, item.CharacterID)
+		}
+	}
+	return ids, nil
+}
+
+func (m mockRepository) Modifiers(ctx context.Context, characterID string) ([]character.Modifier, error) {
+	var modifiers []character.Modifier
+	abilities, _ := m.QueryLearned(ctx, characterID)
+	for _, ability := range abilities {
+		modifiers = append(modifiers, character.Modifier{Flat: ability.PowerBonus, Percent: ability.PowerPercent})
+	}
+	return modifiers, nil
+}
+
+// mockTypeService knows the Wizard, Elf and Hobbit character types. Its other methods are not implemented.
+type mockTypeService struct {
+	charactertype.Service
+}
+
+func (m mockTypeService) Get(ctx context.Context, code int64) (charactertype.CharacterType, error) {
+	if code < character.Wizard || code > character.Hobbit {
+		return charactertype.CharacterType{}, sql.ErrNoRows
+	}
+	return charactertype.CharacterType{CharacterType: entity.CharacterType{CharacterCode: code}}, nil
+}
+
+// newMockCharacterService returns a character service serving the wizards gandalf and radagast, owned by the user 100,
+// and saruman, owned by the user 101, with the modifiers of the given equipment.
+func newMockCharacterService(equipment character.Equipment) *charactertest.Service {
+	return charactertest.NewService(equipment,
+		entity.Character{ID: "gandalf", CharacterCode: character.Wizard, CharacterPower: 20, EffectivePower: 20, CharacterValue: 40, Level: 1, OwnerID: "100"},
+		entity.Character{ID: "radagast", CharacterCode: character.Wizard, CharacterPower: 20, EffectivePower: 20, CharacterValue: 40, Level: 5, OwnerID: "100"},
+		entity.Character{ID: "saruman", CharacterCode: character.Wizard, CharacterPower: 20, EffectivePower: 20, CharacterValue: 40, Level: 1, OwnerID: "101"},
+	)
+}
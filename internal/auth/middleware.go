@@ -46,6 +46,21 @@ func CurrentUser(ctx context.Context) Identity {
 	return nil
 }
 
+// AdminHandler returns a middleware that only lets through the users with one of the given IDs.
+// It must be used after an authentication middleware, and rejects all other users with a 403 error.
+func AdminHandler(adminIDs []string) routing.Handler {
+	admins := map[string]bool{}
+	for _, id := range adminIDs {
+		admins[id] = true
+	}
+	return func(c *routing.Context) error {
+		if user := CurrentUser(c.Request.Context()); user == nil || !admins[user.GetID()] {
+			return errors.Forbidden("")
+		}
+		return nil
+	}
+}
+
 // MockAuthHandler creates a mock authentication middleware for testing purpose.
 // If the request contains an Authorization header whose value is "TEST", then
 // it considers the user is authenticated as "Tester" whose ID is "100".
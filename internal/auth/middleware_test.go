@@ -43,6 +43,18 @@ func Test_handleToken(t *testing.T) {
 	}
 }
 
+func TestAdminHandler(t *testing.T) {
+	handler := AdminHandler([]string{"1", "100"})
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	ctx, _ := test.MockRoutingContext(req)
+	assert.NotNil(t, handler(ctx))
+
+	ctx.Request = req.WithContext(WithUser(req.Context(), "100", "test"))
+	assert.Nil(t, handler(ctx))
+	ctx.Request = req.WithContext(WithUser(req.Context(), "101", "test"))
+	assert.NotNil(t, handler(ctx))
+}
+
 func TestMocks(t *testing.T) {
 	req, _ := http.NewRequest("GET", "http://example.com", nil)
 	ctx, _ := test.MockRoutingContext(req)
@@ -0,0 +1,77 @@
+package battle
+
+import (
+	"net/http"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/hikvineh/go-rest-game-character/internal/errors"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/hikvineh/go-rest-game-character/pkg/pagination"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/battles/<id>", res.get)
+	r.Get("/battles/<id>/replay", res.replay)
+	r.Get("/battles", res.query)
+
+	r.Use(authHandler)
+
+	// the following endpoints require a valid JWT
+	r.Post("/battles", res.create)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	battle, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(battle)
+}
+
+func (r resource) replay(c *routing.Context) error {
+	replay, err := r.service.Replay(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(replay)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	characterID := c.Query("character_id")
+	count, err := r.service.Count(ctx, characterID)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	battles, err := r.service.Query(ctx, characterID, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = battles
+	return c.Write(pages)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreateBattleRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	battle, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(battle, http.StatusCreated)
+}
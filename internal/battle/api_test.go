@@ -0,0 +1,40 @@
+package battle
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	recorded := DefaultRules().Simulate(legolas, gandalf, 3)
+	recorded.ID, recorded.UserID, recorded.CreatedAt = "fight", "101", time.Now()
+	repo := &mockRepository{items: []entity.Battle{recorded}}
+	RegisterHandlers(router.Group(""), NewService(repo, mockCharacterService{}, DefaultRules(), logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/battles", "", nil, http.StatusOK, `*"total_count":1*`},
+		{"get 1", "GET", "/battles/fight", "", nil, http.StatusOK, `*"id":"fight","attacker_id":"legolas","defender_id":"gandalf","seed":3*`},
+		{"get unknown", "GET", "/battles/none", "", nil, http.StatusNotFound, ""},
+		{"replay", "GET", "/battles/fight/replay", "", nil, http.StatusOK, `*"matches":true}`},
+		{"replay unknown", "GET", "/battles/none/replay", "", nil, http.StatusNotFound, ""},
+		{"create ok", "POST", "/battles", `{"attacker_id":"gandalf","defender_id":"legolas","seed":1}`, header, http.StatusCreated, `*"rounds":[{"round":1,"attacks":[{"attacker_id":"gandalf"*`},
+		{"create ok count", "GET", "/battles?character_id=gandalf", "", nil, http.StatusOK, `*"total_count":2*`},
+		{"create auth error", "POST", "/battles", `{"attacker_id":"gandalf","defender_id":"legolas"}`, nil, http.StatusUnauthorized, ""},
+		{"create input error", "POST", "/battles", `"attacker_id":"gandalf"}`, header, http.StatusBadRequest, ""},
+		{"create validation error", "POST", "/battles", `{"attacker_id":"gandalf","defender_id":"gandalf"}`, header, http.StatusBadRequest, `*defender_id*`},
+		{"create unknown character", "POST", "/battles", `{"attacker_id":"gandalf","defender_id":"none"}`, header, http.StatusBadRequest, `*defender_id*`},
+		{"create not owner", "POST", "/battles", `{"attacker_id":"legolas","defender_id":"gandalf"}`, header, http.StatusForbidden, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
@@ -0,0 +1,76 @@
+package battle
+
+import (
+	"context"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/dbcontext"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// Repository encapsulates the logic to access battles from the data source.
+type Repository interface {
+	// Get returns the battle with the specified ID.
+	Get(ctx context.Context, id string) (entity.Battle, error)
+	// Count returns the number of battles fought by the character with the given ID, or of all battles if it is empty.
+	Count(ctx context.Context, characterID string) (int, error)
+	// Query returns the battles fought by the character with the given ID, or all battles if it is empty, latest
+	// first, with the given offset and limit.
+	Query(ctx context.Context, characterID string, offset, limit int) ([]entity.Battle, error)
+	// Create saves a new battle in the storage.
+	Create(ctx context.Context, battle entity.Battle) error
+}
+
+// repository persists battles in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new battle repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the battle with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Battle, error) {
+	var battle entity.Battle
+	err := r.db.With(ctx).Select().Model(id, &battle)
+	return battle, err
+}
+
+// Create saves a new battle record in the database.
+func (r repository) Create(ctx context.Context, battle entity.Battle) error {
+	return r.db.With(ctx).Model(&battle).Insert()
+}
+
+// Count returns the number of the battle records of the given character in the database.
+func (r repository) Count(ctx context.Context, characterID string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("battle").Where(fighting(characterID)).Row(&count)
+	return count, err
+}
+
+// Query retrieves the battle records of the given character, latest first, with the specified offset and limit from
+// the database.
+func (r repository) Query(ctx context.Context, characterID string, offset, limit int) ([]entity.Battle, error) {
+	var battles []entity.Battle
+	err := r.db.With(ctx).
+		Select().
+		Where(fighting(characterID)).
+		OrderBy("created_at DESC", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&battles)
+	return battles, err
+}
+
+// fighting returns the condition matching the battles fought by the character with the given ID, or nil if it is
+// empty.
+func fighting(characterID string) dbx.Expression {
+	if characterID == "" {
+		return nil
+	}
+	return dbx.Or(dbx.HashExp{"attacker_id": characterID}, dbx.HashExp{"defender_id": characterID})
+}
@@ -0,0 +1,58 @@
+package battle
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "battle")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+
+	// create
+	first := DefaultRules().Simulate(gandalf, legolas, 1)
+	first.ID, first.UserID, first.CreatedAt = "first", "100", time.Now().Add(-time.Hour)
+	assert.Nil(t, repo.Create(ctx, first))
+	second := DefaultRules().Simulate(legolas, gandalf, 2)
+	second.ID, second.UserID, second.CreatedAt = "second", "101", time.Now()
+	assert.Nil(t, repo.Create(ctx, second))
+
+	// get
+	battle, err := repo.Get(ctx, "first")
+	assert.Nil(t, err)
+	assert.Equal(t, first.WinnerID, battle.WinnerID)
+	assert.Equal(t, first.Rounds, battle.Rounds)
+	assert.Equal(t, "Gandalf", battle.Attacker.Name)
+	assert.Equal(t, int64(1), battle.Seed)
+	_, err = repo.Get(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// count and query
+	count, err := repo.Count(ctx, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	count, err = repo.Count(ctx, "legolas")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	count, err = repo.Count(ctx, "frodo")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+	battles, err := repo.Query(ctx, "gandalf", 0, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, battles, 2) {
+		assert.Equal(t, "second", battles[0].ID)
+	}
+	battles, err = repo.Query(ctx, "", 1, 10)
+	assert.Nil(t, err)
+	assert.Len(t, battles, 1)
+}
@@ -0,0 +1,155 @@
+package battle
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// Service encapsulates usecase logic for battles.
+type Service interface {
+	Get(ctx context.Context, id string) (Battle, error)
+	Query(ctx context.Context, characterID string, offset, limit int) ([]Battle, error)
+	Count(ctx context.Context, characterID string) (int, error)
+	Create(ctx context.Context, input CreateBattleRequest) (Battle, error)
+	Replay(ctx context.Context, id string) (Replay, error)
+}
+
+// Battle represents the data about a battle.
+type Battle struct {
+	entity.Battle
+}
+
+// Replay represents a battle simulated again from its recorded characters and seed. Matches tells whether the
+// outcome is the recorded one.
+type Replay struct {
+	Battle
+	Matches bool `json:"matches"`
+}
+
+// CreateBattleRequest represents a battle creation request. A random seed is used if none is given.
+type CreateBattleRequest struct {
+	AttackerID string `json:"attacker_id"`
+	DefenderID string `json:"defender_id"`
+	Seed       *int64 `json:"seed"`
+}
+
+// Validate validates the CreateBattleRequest fields.
+func (m CreateBattleRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.AttackerID, validation.Required),
+		validation.Field(&m.DefenderID, validation.Required,
+			validation.NotIn(m.AttackerID).Error("must be different from attacker_id")),
+	)
+}
+
+type service struct {
+	repo       Repository
+	characters character.Service
+	rules      Rules
+	logger     log.Logger
+}
+
+// NewService creates a new battle service.
+// The character service provides the characters fighting, which are simulated according to the given rules.
+func NewService(repo Repository, characters character.Service, rules Rules, logger log.Logger) Service {
+	return service{repo, characters, rules, logger}
+}
+
+// Get returns the battle with the specified ID.
+func (s service) Get(ctx context.Context, id string) (Battle, error) {
+	battle, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Battle{}, err
+	}
+	return Battle{battle}, nil
+}
+
+// Count returns the number of battles fought by the character with the specified ID, or of all battles if it is
+// empty.
+func (s service) Count(ctx context.Context, characterID string) (int, error) {
+	return s.repo.Count(ctx, characterID)
+}
+
+// Query returns the battles fought by the character with the specified ID, or all battles if it is empty, latest
+// first, with the specified offset and limit.
+func (s service) Query(ctx context.Context, characterID string, offset, limit int) ([]Battle, error) {
+	battles, err := s.repo.Query(ctx, characterID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Battle{}
+	for _, battle := range battles {
+		result = append(result, Battle{battle})
+	}
+	return result, nil
+}
+
+// Create makes two characters fight and records the battle. Only the owner of the attacker can start a battle, and
+// any character can be attacked.
+func (s service) Create(ctx context.Context, req CreateBattleRequest) (Battle, error) {
+	if err := req.Validate(); err != nil {
+		return Battle{}, err
+	}
+	attacker, err := s.fighter(ctx, "attacker_id", req.AttackerID)
+	if err != nil {
+		return Battle{}, err
+	}
+	user := auth.CurrentUser(ctx)
+	if user == nil || user.GetID() != attacker.OwnerID {
+		return Battle{}, character.ErrNotOwner
+	}
+	defender, err := s.fighter(ctx, "defender_id", req.DefenderID)
+	if err != nil {
+		return Battle{}, err
+	}
+
+	seed := time.Now().UnixNano()
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+	battle := s.rules.Simulate(attacker.Character, defender.Character, seed)
+	battle.ID = entity.GenerateID()
+	battle.UserID = user.GetID()
+	battle.CreatedAt = time.Now()
+	if err := s.repo.Create(ctx, battle); err != nil {
+		return Battle{}, err
+	}
+	return s.Get(ctx, battle.ID)
+}
+
+// fighter returns the character with the given ID, reporting a missing one as an invalid value of the given field.
+func (s service) fighter(ctx context.Context, field, id string) (character.Character, error) {
+	c, err := s.characters.Get(ctx, id)
+	if err == sql.ErrNoRows {
+		return c, validation.Errors{
+			field: errors.New("must be an existing character"),
+		}
+	}
+	return c, err
+}
+
+// Replay simulates again the battle with the specified ID from the characters as they were recorded and its seed,
+// so that its outcome can be audited.
+func (s service) Replay(ctx context.Context, id string) (Replay, error) {
+	battle, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Replay{}, err
+	}
+	replay := s.rules.Simulate(entity.Character(battle.Attacker), entity.Character(battle.Defender), battle.Seed)
+	replay.ID = battle.ID
+	replay.UserID = battle.UserID
+	replay.CreatedAt = battle.CreatedAt
+	return Replay{
+		Battle:  Battle{replay},
+		Matches: reflect.DeepEqual(replay, battle),
+	}, nil
+}
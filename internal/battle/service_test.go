@@ -0,0 +1,149 @@
+package battle
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var errCRUD = errors.New("error crud")
+
+func TestCreateBattleRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     CreateBattleRequest
+		wantError bool
+	}{
+		{"success", CreateBattleRequest{AttackerID: "gandalf", DefenderID: "legolas"}, false},
+		{"required", CreateBattleRequest{AttackerID: "gandalf"}, true},
+		{"same", CreateBattleRequest{AttackerID: "gandalf", DefenderID: "gandalf"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, mockCharacterService{}, DefaultRules(), logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+	seed := int64(7)
+
+	// successful battle
+	battle, err := s.Create(ctx, CreateBattleRequest{AttackerID: "gandalf", DefenderID: "legolas", Seed: &seed})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, battle.ID)
+	assert.Equal(t, int64(7), battle.Seed)
+	assert.Equal(t, "100", battle.UserID)
+	assert.NotEmpty(t, battle.WinnerID)
+	assert.NotEmpty(t, battle.Rounds)
+	assert.NotEmpty(t, battle.CreatedAt)
+	assert.Equal(t, DefaultRules().Simulate(gandalf, legolas, 7).Rounds, battle.Rounds)
+
+	// random seed
+	random, err := s.Create(ctx, CreateBattleRequest{AttackerID: "gandalf", DefenderID: "legolas"})
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultRules().Simulate(gandalf, legolas, random.Seed).Rounds, random.Rounds)
+
+	// errors
+	_, err = s.Create(ctx, CreateBattleRequest{AttackerID: "gandalf"})
+	assert.NotNil(t, err)
+	_, err = s.Create(ctx, CreateBattleRequest{AttackerID: "none", DefenderID: "legolas"})
+	assert.EqualError(t, err, "attacker_id: must be an existing character.")
+	_, err = s.Create(ctx, CreateBattleRequest{AttackerID: "gandalf", DefenderID: "none"})
+	assert.EqualError(t, err, "defender_id: must be an existing character.")
+	_, err = s.Create(ctx, CreateBattleRequest{AttackerID: "legolas", DefenderID: "gandalf"})
+	assert.Equal(t, character.ErrNotOwner, err)
+	_, err = s.Create(context.Background(), CreateBattleRequest{AttackerID: "gandalf", DefenderID: "legolas"})
+	assert.Equal(t, character.ErrNotOwner, err)
+	_, err = s.Create(ctx, CreateBattleRequest{AttackerID: "gandalf", DefenderID: "error"})
+	assert.Equal(t, errCRUD, err)
+
+	// get and query
+	got, err := s.Get(ctx, battle.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, battle, got)
+	_, err = s.Get(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+	count, _ := s.Count(ctx, "legolas")
+	assert.Equal(t, 2, count)
+	count, _ = s.Count(ctx, "frodo")
+	assert.Equal(t, 0, count)
+	battles, err := s.Query(ctx, "", 0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, battles, 2)
+
+	// replays match the recorded battles, even after the characters changed
+	replay, err := s.Replay(ctx, battle.ID)
+	assert.Nil(t, err)
+	assert.True(t, replay.Matches)
+	assert.Equal(t, battle.Rounds, replay.Rounds)
+	repo.items[0].Rounds[0].Attacks[0].Damage++
+	replay, err = s.Replay(ctx, battle.ID)
+	assert.Nil(t, err)
+	assert.False(t, replay.Matches)
+	_, err = s.Replay(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+type mockRepository struct {
+	items []entity.Battle
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.Battle, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.Battle{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context, characterID string) (int, error) {
+	items, _ := m.Query(ctx, characterID, 0, len(m.items))
+	return len(items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, characterID string, offset, limit int) ([]entity.Battle, error) {
+	var items []entity.Battle
+	for _, item := range m.items {
+		if characterID == "" || item.AttackerID == characterID || item.DefenderID == characterID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, battle entity.Battle) error {
+	m.items = append(m.items, battle)
+	return nil
+}
+
+// mockCharacterService serves the characters gandalf, owned by the user 100, and legolas, owned by the user 101.
+// Getting the character "error" fails. Its other methods are not implemented.
+type mockCharacterService struct {
+	character.Service
+}
+
+func (m mockCharacterService) Get(ctx context.Context, id string) (character.Character, error) {
+	switch id {
+	case "gandalf":
+		return character.Character{Character: gandalf}, nil
+	case "legolas":
+		return character.Character{Character: legolas}, nil
+	case "error":
+		return character.Character{}, errCRUD
+	}
+	return character.Character{}, sql.ErrNoRows
+}
@@ -0,0 +1,164 @@
+package battle
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+)
+
+const (
+	// BaseHP is the number of hit points of a character on top of its value.
+	BaseHP = 100
+	// maxStat bounds the stats used in simulations, so that damage computations cannot overflow.
+	maxStat = math.MaxInt64 / 1000
+	// minRoll and maxRoll bound the random percentage of the power dealt by an attack.
+	minRoll = 80
+	maxRoll = 120
+)
+
+// Matchups holds the damage bonuses of character types against other types, in percent, indexed by the code of the
+// attacking type and then by the code of the defending type. A negative bonus reduces the damage.
+type Matchups map[int64]map[int64]int64
+
+// Bonus returns the damage bonus of a character of the given type against a character of the other given type.
+func (m Matchups) Bonus(attacker, defender int64) int64 {
+	return m[attacker][defender]
+}
+
+// DefaultMatchups returns the matchups of the built-in character types: wizards are strong against elves, elves
+// against hobbits and hobbits against wizards.
+func DefaultMatchups() Matchups {
+	return Matchups{
+		character.Wizard: {character.Elf: 25},
+		character.Elf:    {character.Hobbit: 25},
+		character.Hobbit: {character.Wizard: 25},
+	}
+}
+
+// Rules holds the parameters of battle simulations.
+type Rules struct {
+	Matchups Matchups
+	// MaxRounds is the number of rounds after which a battle is decided on the remaining hit points.
+	MaxRounds int
+	// CriticalChance is the chance, in percent, that an attack deals double damage.
+	CriticalChance int
+}
+
+// DefaultRules returns the rules used by default in battles.
+func DefaultRules() Rules {
+	return Rules{
+		Matchups:       DefaultMatchups(),
+		MaxRounds:      50,
+		CriticalChance: 10,
+	}
+}
+
+// fighter is a character taking part in a simulation.
+type fighter struct {
+	entity.Character
+	hp    int64
+	maxHP int64
+}
+
+// newFighter prepares the given character for a simulation. Its hit points are derived from its value, and the
+// damage it deals from its effective power.
+func newFighter(c entity.Character) *fighter {
+	hp := BaseHP + clamp(c.CharacterValue, 0, maxStat-BaseHP)
+	return &fighter{Character: c, hp: hp, maxHP: hp}
+}
+
+// Simulate runs a battle between the given characters, using a random number generator initialized with the given
+// seed. The same characters and seed always lead to the same battle.
+//
+// In each round, the character with the highest effective power strikes first, the attacker in case of a tie. The
+// battle ends as soon as a character has no hit points left. After the maximum number of rounds, the character with
+// the highest share of its hit points left wins, and an equal share is a draw.
+func (r Rules) Simulate(attacker, defender entity.Character, seed int64) entity.Battle {
+	rng := rand.New(rand.NewSource(seed))
+	a, d := newFighter(attacker), newFighter(defender)
+	battle := entity.Battle{
+		AttackerID: attacker.ID,
+		DefenderID: defender.ID,
+		Seed:       seed,
+		Attacker:   entity.CharacterSnapshot(attacker),
+		Defender:   entity.CharacterSnapshot(defender),
+		AttackerHP: a.hp,
+		DefenderHP: d.hp,
+		Rounds:     entity.BattleRounds{},
+	}
+	first, second := a, d
+	if d.EffectivePower > a.EffectivePower {
+		first, second = d, a
+	}
+
+	for round := 1; round <= r.MaxRounds; round++ {
+		log := entity.BattleRound{Round: round}
+		for _, turn := range [][2]*fighter{{first, second}, {second, first}} {
+			log.Attacks = append(log.Attacks, r.attack(rng, turn[0], turn[1]))
+			if turn[1].hp == 0 {
+				battle.Rounds = append(battle.Rounds, log)
+				battle.WinnerID = turn[0].ID
+				return battle
+			}
+		}
+		battle.Rounds = append(battle.Rounds, log)
+	}
+
+	// compare the shares of hit points left without overflowing
+	left := new(big.Int).Mul(big.NewInt(a.hp), big.NewInt(d.maxHP))
+	right := new(big.Int).Mul(big.NewInt(d.hp), big.NewInt(a.maxHP))
+	switch left.Cmp(right) {
+	case 1:
+		battle.WinnerID = a.ID
+	case -1:
+		battle.WinnerID = d.ID
+	}
+	return battle
+}
+
+// attack makes a character strike another one and returns the log of the attack.
+func (r Rules) attack(rng *rand.Rand, attacker, defender *fighter) entity.BattleAttack {
+	power := clamp(attacker.EffectivePower, 1, maxStat)
+	damage := percent(power, 100+r.Matchups.Bonus(attacker.CharacterCode, defender.CharacterCode))
+	damage = percent(damage, int64(minRoll+rng.Intn(maxRoll-minRoll+1)))
+	critical := rng.Intn(100) < r.CriticalChance
+	if critical {
+		damage *= 2
+	}
+	if damage < 1 {
+		damage = 1
+	}
+	defender.hp -= damage
+	if defender.hp < 0 {
+		defender.hp = 0
+	}
+	return entity.BattleAttack{
+		AttackerID:  attacker.ID,
+		DefenderID:  defender.ID,
+		Damage:      damage,
+		Critical:    critical,
+		RemainingHP: defender.hp,
+	}
+}
+
+// percent returns the given percentage of a value, rounded down. Both are expected to be bounded by maxStat and 1000.
+func percent(value, pct int64) int64 {
+	if pct <= 0 {
+		return 0
+	}
+	return value/100*pct + value%100*pct/100
+}
+
+// clamp returns the value bounded by min and max.
+func clamp(value, min, max int64) int64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
@@ -0,0 +1,99 @@
+package battle
+
+import (
+	"math"
+	"testing"
+
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	gandalf = entity.Character{ID: "gandalf", Name: "Gandalf", CharacterCode: character.Wizard, CharacterPower: 20, EffectivePower: 20, CharacterValue: 200, OwnerID: "100"}
+	legolas = entity.Character{ID: "legolas", Name: "Legolas", CharacterCode: character.Elf, CharacterPower: 20, EffectivePower: 20, CharacterValue: 200, OwnerID: "101"}
+)
+
+func TestMatchups_Bonus(t *testing.T) {
+	matchups := DefaultMatchups()
+	assert.Equal(t, int64(25), matchups.Bonus(character.Wizard, character.Elf))
+	assert.Equal(t, int64(0), matchups.Bonus(character.Elf, character.Wizard))
+	assert.Equal(t, int64(0), matchups.Bonus(99, character.Elf))
+}
+
+func TestRules_Simulate(t *testing.T) {
+	rules := DefaultRules()
+
+	// the same seed always leads to the same battle
+	battle := rules.Simulate(gandalf, legolas, 42)
+	assert.Equal(t, battle, rules.Simulate(gandalf, legolas, 42))
+	assert.Equal(t, int64(42), battle.Seed)
+	assert.Equal(t, "gandalf", battle.AttackerID)
+	assert.Equal(t, "legolas", battle.DefenderID)
+	assert.Equal(t, int64(300), battle.AttackerHP)
+	assert.Equal(t, int64(300), battle.DefenderHP)
+	assert.Equal(t, "Gandalf", battle.Attacker.Name)
+	if assert.NotEmpty(t, battle.Rounds) {
+		first := battle.Rounds[0]
+		assert.Equal(t, 1, first.Round)
+		if assert.Len(t, first.Attacks, 2) {
+			// the attacker strikes first in case of a tie, with the matchup bonus
+			assert.Equal(t, "gandalf", first.Attacks[0].AttackerID)
+			assert.Equal(t, "legolas", first.Attacks[1].AttackerID)
+		}
+		last := battle.Rounds[len(battle.Rounds)-1].Attacks
+		assert.Equal(t, int64(0), last[len(last)-1].RemainingHP)
+		assert.Equal(t, battle.WinnerID, last[len(last)-1].AttackerID)
+	}
+	// damage stays within the rolls, doubled by critical hits
+	for _, round := range battle.Rounds {
+		for _, attack := range round.Attacks {
+			min, max := int64(16), int64(24)
+			if attack.AttackerID == "gandalf" {
+				min, max = 20, 30
+			}
+			if attack.Critical {
+				min, max = min*2, max*2
+			}
+			assert.True(t, attack.Damage >= min && attack.Damage <= max, "damage %v", attack.Damage)
+		}
+	}
+
+	// the matchup favors the wizard over many seeds
+	wins := 0
+	for seed := int64(0); seed < 100; seed++ {
+		if rules.Simulate(gandalf, legolas, seed).WinnerID == "gandalf" {
+			wins++
+		}
+	}
+	assert.True(t, wins > 50, "wins %v", wins)
+
+	// the character with the highest effective power strikes first
+	strong := legolas
+	strong.EffectivePower = 1000
+	battle = rules.Simulate(gandalf, strong, 1)
+	assert.Equal(t, "legolas", battle.WinnerID)
+	assert.Len(t, battle.Rounds, 1)
+	assert.Len(t, battle.Rounds[0].Attacks, 1)
+
+	// undecided battles go to the highest share of hit points left, or are draws
+	rules.MaxRounds = 1
+	battle = rules.Simulate(gandalf, legolas, 1)
+	assert.Len(t, battle.Rounds, 1)
+	assert.NotEmpty(t, battle.WinnerID)
+	rules.MaxRounds = 0
+	battle = rules.Simulate(gandalf, legolas, 1)
+	assert.Empty(t, battle.Rounds)
+	assert.Empty(t, battle.WinnerID)
+
+	// huge stats do not overflow
+	huge := legolas
+	huge.EffectivePower, huge.CharacterValue = math.MaxInt64, math.MaxInt64
+	battle = DefaultRules().Simulate(huge, huge, 1)
+	assert.True(t, battle.AttackerHP > 0)
+	for _, round := range battle.Rounds {
+		for _, attack := range round.Attacks {
+			assert.True(t, attack.Damage > 0 && attack.RemainingHP >= 0)
+		}
+	}
+}
@@ -1,51 +1,192 @@
 package character
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	routing "github.com/go-ozzo/ozzo-routing/v2"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
 	"github.com/hikvineh/go-rest-game-character/internal/errors"
 	"github.com/hikvineh/go-rest-game-character/pkg/log"
 	"github.com/hikvineh/go-rest-game-character/pkg/pagination"
 )
 
+// Options configures the HTTP handlers of characters.
+type Options struct {
+	// RequireIfMatch rejects the writes to an existing character that do not carry an If-Match header.
+	RequireIfMatch bool
+	// TrashRetention is how long deleted characters are kept in the trash before they can be purged.
+	TrashRetention time.Duration
+}
+
 // RegisterHandlers sets up the routing of the HTTP handlers.
-func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
-	res := resource{service, logger}
+// The adminHandler guards the endpoints reserved to administrators, such as listing and purging the trash.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler, adminHandler routing.Handler, options Options, logger log.Logger) {
+	res := resource{service, authHandler, options, logger}
+
+	// the trash, the export and the statistics are registered first so that they are not taken for character IDs;
+	// the trash is reserved to administrators
+	r.Get("/characters/trash", authHandler, adminHandler, res.queryDeleted)
+	r.Delete("/characters/trash", authHandler, adminHandler, res.purge)
+	r.Get("/characters/export", res.export)
+	r.Get("/characters/stats", res.stats)
 
+	// the past states of a character come from its history, which requires a valid JWT like the history itself
 	r.Get("/characters/<id>", res.get)
+	r.Get("/characters/<id>/diff", authHandler, res.diff)
 	r.Get("/characters", res.query)
+	r.Get("/leaderboard", res.leaderboard)
 
 	r.Use(authHandler)
 
 	// the following endpoints require a valid JWT
 	r.Post("/characters", res.create)
+	r.Post("/characters/bulk", res.bulk)
+	r.Post("/characters/import", res.importRows)
 	r.Put("/characters/<id>", res.update)
+	r.Patch("/characters/<id>", res.patch)
 	r.Delete("/characters/<id>", res.delete)
+	r.Post("/characters/<id>/restore", res.restore)
+	r.Post("/characters/<id>/revert", res.revert)
+	r.Post("/characters/<id>/experience", res.grantExperience)
+	r.Get("/characters/<id>/history", res.history)
+	r.Get("/me/characters", res.queryMine)
 }
 
 type resource struct {
-	service Service
-	logger  log.Logger
+	service     Service
+	authHandler routing.Handler
+	options     Options
+	logger      log.Logger
+}
+
+// etag returns the entity tag of the given version of a character.
+func etag(version int64) string {
+	return fmt.Sprintf(`"%v"`, version)
+}
+
+// ifMatch evaluates the If-Match header of the request against the current version of the character with the
+// given ID. It returns the version that the write must be based on, which is AnyVersion if the header is absent.
+func (r resource) ifMatch(c *routing.Context, id string) (int64, error) {
+	header := c.Request.Header.Get("If-Match")
+	if header == "" {
+		if r.options.RequireIfMatch {
+			return AnyVersion, errors.PreconditionRequired("")
+		}
+		return AnyVersion, nil
+	}
+	character, err := r.service.Get(c.Request.Context(), id)
+	if err != nil {
+		return AnyVersion, err
+	}
+	current := etag(character.Version)
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == current {
+			return character.Version, nil
+		}
+	}
+	return AnyVersion, ErrVersionConflict
+}
+
+// writeCharacter writes the given character with its entity tag using the given HTTP status.
+func writeCharacter(c *routing.Context, character Character, status int) error {
+	c.Response.Header().Set("ETag", etag(character.Version))
+	return c.WriteWithStatus(character, status)
 }
 
 func (r resource) get(c *routing.Context) error {
+	if c.Query("as_of") != "" {
+		if err := r.authHandler(c); err != nil {
+			return err
+		}
+		return r.getAsOf(c)
+	}
 	character, err := r.service.Get(c.Request.Context(), c.Param("id"))
 	if err != nil {
 		return err
 	}
 
+	return writeCharacter(c, character, http.StatusOK)
+}
+
+// getAsOf writes the character as it was at the time given by the as_of parameter.
+// No entity tag is sent since the character may have changed since then.
+func (r resource) getAsOf(c *routing.Context) error {
+	errs := validation.Errors{}
+	at := parseTimeParam(c.Request.URL.Query(), "as_of", errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	character, err := r.service.GetAsOf(c.Request.Context(), c.Param("id"), *at)
+	if err != nil {
+		return err
+	}
+
 	return c.Write(character)
 }
 
+func (r resource) diff(c *routing.Context) error {
+	query := c.Request.URL.Query()
+	errs := validation.Errors{}
+	from := parseIntParam(query, "from", errs)
+	to := parseIntParam(query, "to", errs)
+	err := validation.Errors{
+		"from": validation.Validate(from, validation.Required, validation.Min(int64(1))),
+		"to":   validation.Validate(to, validation.Required, validation.Min(int64(1))),
+	}.Filter()
+	if len(errs) > 0 {
+		return errs
+	} else if err != nil {
+		return err
+	}
+	diff, err := r.service.Diff(c.Request.Context(), c.Param("id"), *from, *to)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(diff)
+}
+
 func (r resource) query(c *routing.Context) error {
+	filter, sort, err := ParseQuery(c.Request.URL.Query())
+	if err != nil {
+		return err
+	}
+	return r.list(c, filter, sort)
+}
+
+func (r resource) queryMine(c *routing.Context) error {
+	filter, sort, err := ParseQuery(c.Request.URL.Query())
+	if err != nil {
+		return err
+	}
+	filter.OwnerID = auth.CurrentUser(c.Request.Context()).GetID()
+	return r.list(c, filter, sort)
+}
+
+// list writes a page of the characters satisfying the given filter, paginated either by cursors or by page numbers.
+func (r resource) list(c *routing.Context, filter Filter, sort Sort) error {
 	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
+	if pagination.IsCursorRequest(c.Request) {
+		pages := pagination.NewCursorFromRequest(c.Request)
+		if err := r.service.QueryCursor(ctx, filter, sort, pages); err != nil {
+			return err
+		}
+		return c.Write(pages)
+	}
+	count, err := r.service.Count(ctx, filter)
 	if err != nil {
 		return err
 	}
 	pages := pagination.NewFromRequest(c.Request, count)
-	characters, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	characters, err := r.service.Query(ctx, filter, sort, pages.Offset(), pages.Limit())
 	if err != nil {
 		return err
 	}
@@ -53,6 +194,51 @@ func (r resource) query(c *routing.Context) error {
 	return c.Write(pages)
 }
 
+func (r resource) stats(c *routing.Context) error {
+	filter, _, err := ParseQuery(c.Request.URL.Query())
+	if err != nil {
+		return err
+	}
+	stats, err := r.service.Stats(c.Request.Context(), filter)
+	if err != nil {
+		return err
+	}
+	return c.Write(map[string]interface{}{"items": stats})
+}
+
+func (r resource) leaderboard(c *routing.Context) error {
+	query := c.Request.URL.Query()
+	filter, _, err := ParseQuery(query)
+	if err != nil {
+		return err
+	}
+	req := LeaderboardRequest{Filter: filter, Top: DefaultLeaderboardTop, Around: query.Get("around"), Window: DefaultLeaderboardWindow}
+	errs := validation.Errors{}
+	if top := parseIntParam(query, "top", errs); top != nil {
+		req.Top = int(*top)
+	}
+	if window := parseIntParam(query, "window", errs); window != nil {
+		req.Window = int(*window)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx, filter)
+	if err != nil {
+		return err
+	}
+	characters, err := r.service.Leaderboard(ctx, req)
+	if err != nil {
+		return err
+	}
+	return c.Write(map[string]interface{}{
+		"total_count": count,
+		"items":       characters,
+	})
+}
+
 func (r resource) create(c *routing.Context) error {
 	var input CreateCharacterRequest
 	if err := c.Read(&input); err != nil {
@@ -64,7 +250,7 @@ func (r resource) create(c *routing.Context) error {
 		return err
 	}
 
-	return c.WriteWithStatus(character, http.StatusCreated)
+	return writeCharacter(c, character, http.StatusCreated)
 }
 
 func (r resource) update(c *routing.Context) error {
@@ -73,20 +259,264 @@ func (r resource) update(c *routing.Context) error {
 		r.logger.With(c.Request.Context()).Info(err)
 		return errors.BadRequest("")
 	}
+	version, err := r.ifMatch(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
 
-	character, err := r.service.Update(c.Request.Context(), c.Param("id"), input)
+	character, err := r.service.Update(c.Request.Context(), c.Param("id"), input, version)
 	if err != nil {
 		return err
 	}
 
-	return c.Write(character)
+	return writeCharacter(c, character, http.StatusOK)
+}
+
+func (r resource) patch(c *routing.Context) error {
+	contentType := strings.TrimSpace(strings.Split(c.Request.Header.Get("Content-Type"), ";")[0])
+	if contentType != "application/merge-patch+json" && contentType != "application/json" {
+		return routing.NewHTTPError(http.StatusUnsupportedMediaType)
+	}
+	patch, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil || !json.Valid(patch) {
+		r.logger.With(c.Request.Context()).Info("invalid merge patch: ", err)
+		return errors.BadRequest("")
+	}
+	version, err := r.ifMatch(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	character, err := r.service.Patch(c.Request.Context(), c.Param("id"), patch, version)
+	if err != nil {
+		return err
+	}
+
+	return writeCharacter(c, character, http.StatusOK)
 }
 
 func (r resource) delete(c *routing.Context) error {
-	character, err := r.service.Delete(c.Request.Context(), c.Param("id"))
+	version, err := r.ifMatch(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	character, err := r.service.Delete(c.Request.Context(), c.Param("id"), version)
 	if err != nil {
 		return err
 	}
 
 	return c.Write(character)
 }
+
+func (r resource) queryDeleted(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.CountDeleted(ctx)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	characters, err := r.service.QueryDeleted(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = characters
+	return c.Write(pages)
+}
+
+func (r resource) restore(c *routing.Context) error {
+	character, err := r.service.Restore(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return writeCharacter(c, character, http.StatusOK)
+}
+
+func (r resource) history(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.CountRevisions(ctx, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	revisions, err := r.service.QueryRevisions(ctx, c.Param("id"), pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = revisions
+	return c.Write(pages)
+}
+
+func (r resource) revert(c *routing.Context) error {
+	var input RevertCharacterRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	version, err := r.ifMatch(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	character, err := r.service.Revert(c.Request.Context(), c.Param("id"), input, version)
+	if err != nil {
+		return err
+	}
+
+	return writeCharacter(c, character, http.StatusOK)
+}
+
+func (r resource) grantExperience(c *routing.Context) error {
+	var input GrantExperienceRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	character, err := r.service.GrantExperience(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return writeCharacter(c, character, http.StatusOK)
+}
+
+func (r resource) purge(c *routing.Context) error {
+	count, err := r.service.Purge(c.Request.Context(), r.options.TrashRetention)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(map[string]int64{"purged": count})
+}
+
+// bulkItem is the result of an operation of a bulk request as returned to the client.
+type bulkItem struct {
+	Index     int                   `json:"index"`
+	Op        string                `json:"op"`
+	Status    int                   `json:"status"`
+	Character *Character            `json:"character,omitempty"`
+	Error     *errors.ErrorResponse `json:"error,omitempty"`
+}
+
+func (r resource) bulk(c *routing.Context) error {
+	var input BulkRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	input.RequireVersion = r.options.RequireIfMatch
+	results, committed, err := r.service.Bulk(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	items := make([]bulkItem, len(results))
+	succeeded := 0
+	for i, result := range results {
+		items[i] = bulkItem{Index: i, Op: result.Op}
+		if result.Err != nil {
+			res := errors.BuildErrorResponse(result.Err)
+			if res.StatusCode() == http.StatusInternalServerError {
+				r.logger.With(c.Request.Context()).Errorf("bulk operation %v failed: %v", i, result.Err)
+			}
+			items[i].Status, items[i].Error = res.StatusCode(), &res
+			continue
+		}
+		succeeded++
+		items[i].Status, items[i].Character = http.StatusOK, &results[i].Character
+		if result.Op == BulkCreate {
+			items[i].Status = http.StatusCreated
+		}
+	}
+	return c.Write(map[string]interface{}{
+		"atomic":    input.Atomic,
+		"committed": committed,
+		"succeeded": succeeded,
+		"failed":    len(items) - succeeded,
+		"items":     items,
+	})
+}
+
+// importFormats maps the media types accepted by the import endpoint to import formats.
+var importFormats = map[string]string{
+	"text/csv":             FormatCSV,
+	"application/x-ndjson": FormatNDJSON,
+	"application/ndjson":   FormatNDJSON,
+}
+
+func (r resource) importRows(c *routing.Context) error {
+	query := c.Request.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = importFormats[strings.TrimSpace(strings.Split(c.Request.Header.Get("Content-Type"), ";")[0])]
+	}
+	options := ImportOptions{}
+	if s := query.Get("dry_run"); s != "" {
+		dryRun, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.BadRequest("dry_run must be a boolean")
+		}
+		options.DryRun = dryRun
+	}
+	if s := query.Get("batch_size"); s != "" {
+		batchSize, err := strconv.Atoi(s)
+		if err != nil {
+			return errors.BadRequest("batch_size must be an integer")
+		}
+		options.BatchSize = batchSize
+	}
+
+	rows, err := NewRowReader(c.Request.Body, format)
+	if err != nil {
+		return err
+	}
+	report, err := r.service.Import(c.Request.Context(), rows, options)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(report)
+}
+
+func (r resource) export(c *routing.Context) error {
+	filter, sort, err := ParseQuery(c.Request.URL.Query())
+	if err != nil {
+		return err
+	}
+	format := c.Request.URL.Query().Get("format")
+	if format == "" {
+		format = FormatJSON
+	}
+	buffer := bufio.NewWriter(c.Response)
+	rows, err := NewRowWriter(buffer, format)
+	if err != nil {
+		return err
+	}
+
+	// the response starts with the first character, so errors occurring before it can still be reported
+	ctx := c.Request.Context()
+	count := 0
+	err = r.service.Export(ctx, filter, sort, func(character Character) error {
+		if count == 0 {
+			c.Response.Header().Set("Content-Type", ExportContentTypes[format])
+			c.Response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="characters.%v"`, format))
+		}
+		count++
+		return rows.Write(character)
+	})
+	if err == nil {
+		if count == 0 {
+			c.Response.Header().Set("Content-Type", ExportContentTypes[format])
+		}
+		if err = rows.Close(); err == nil {
+			err = buffer.Flush()
+		}
+	}
+	if err != nil && count > 0 {
+		// the status has been sent already, so the export can only be cut short
+		r.logger.With(ctx).Errorf("export failed after %v characters: %v", count, err)
+		return nil
+	}
+	return err
+}
@@ -5,7 +5,9 @@ import (
 	"github.com/hikvineh/go-rest-game-character/internal/entity"
 	"github.com/hikvineh/go-rest-game-character/internal/test"
 	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -14,30 +16,169 @@ func TestAPI(t *testing.T) {
 	logger, _ := log.NewForTest()
 	router := test.MockRouter(logger)
 	repo := &mockRepository{items: []entity.Character{
-		{"123", "Frodo", 3, 100, 300, time.Now(), time.Now()},
+		{ID: "123", Name: "Frodo", CharacterCode: 3, CharacterPower: 100, CharacterValue: 300, Version: 1, OwnerID: "100", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+		{ID: "456", Name: "Sam", CharacterCode: 3, CharacterPower: 10, CharacterValue: 20, Version: 1, OwnerID: "101", CreatedAt: time.Now(), UpdatedAt: time.Now()},
 	}}
-	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, logger)
+	RegisterHandlers(router.Group(""), newMockService(repo, logger), auth.MockAuthHandler, auth.AdminHandler([]string{"100"}), Options{}, logger)
 	header := auth.MockAuthHeader()
+	patchHeader := auth.MockAuthHeader()
+	patchHeader.Set("Content-Type", "application/merge-patch+json")
+	textHeader := auth.MockAuthHeader()
+	textHeader.Set("Content-Type", "text/plain")
+	staleHeader := auth.MockAuthHeader()
+	staleHeader.Set("If-Match", `"1"`)
+	matchHeader := auth.MockAuthHeader()
+	matchHeader.Set("If-Match", `"0", "7"`)
+	csvHeader := auth.MockAuthHeader()
+	csvHeader.Set("Content-Type", "text/csv")
+	anyHeader := auth.MockAuthHeader()
+	anyHeader.Set("If-Match", "*")
 
 	tests := []test.APITestCase{
-		{"get all", "GET", "/characters", "", nil, http.StatusOK, `*"total_count":1*`},
+		{"get all", "GET", "/characters", "", nil, http.StatusOK, `*"total_count":2*`},
+		{"get mine", "GET", "/me/characters", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get mine filtered", "GET", "/me/characters?character_code=1", "", header, http.StatusOK, `*"total_count":0*`},
+		{"get mine cursor", "GET", "/me/characters?after=", "", header, http.StatusOK, `*Frodo*`},
+		{"get mine auth error", "GET", "/me/characters", "", nil, http.StatusUnauthorized, ""},
+		{"update not owner", "PUT", "/characters/456", `{"name":"Stolen"}`, header, http.StatusForbidden, ""},
+		{"patch not owner", "PATCH", "/characters/456", `{"name":"Stolen"}`, patchHeader, http.StatusForbidden, ""},
+		{"delete not owner", "DELETE", "/characters/456", ``, header, http.StatusForbidden, ""},
 		{"get 123", "GET", "/characters/123", "", nil, http.StatusOK, `*Frodo*`},
 		{"get unknown", "GET", "/characters/1234", "", nil, http.StatusNotFound, ""},
-		{"create ok", "POST", "/characters", `{"name":"test"}`, header, http.StatusCreated, "*test*"},
-		{"create ok count", "GET", "/characters", "", nil, http.StatusOK, `*"total_count":2*`},
-		{"create auth error", "POST", "/characters", `{"name":"test"}`, nil, http.StatusUnauthorized, ""},
+		{"create ok", "POST", "/characters", `{"name":"test","character_code":1}`, header, http.StatusCreated, `*"owner_id":"100"*`},
+		{"create ok count", "GET", "/characters", "", nil, http.StatusOK, `*"total_count":3*`},
+		{"create ok mine", "GET", "/me/characters", "", header, http.StatusOK, `*"total_count":2*`},
+		{"filtered count", "GET", "/characters?character_code=3&sort=-character_value", "", nil, http.StatusOK, `*"total_count":2*`},
+		{"filter error", "GET", "/characters?min_power=abc", "", nil, http.StatusBadRequest, `*min_power*`},
+		{"cursor", "GET", "/characters?after=&per_page=1", "", nil, http.StatusOK, `*"next_cursor":"*`},
+		{"cursor error", "GET", "/characters?after=abc", "", nil, http.StatusBadRequest, `*after*`},
+		{"sort error", "GET", "/characters?sort=secret", "", nil, http.StatusBadRequest, `*sort*`},
+		{"stats", "GET", "/characters/stats?character_code=3", "", nil, http.StatusOK, `{"items":[{"character_code":3,"count":2,"character_power":{"sum":110,"avg":55,"min":10,"max":100,"p50":55,"p90":91,"p99":99.1},"character_value":{"sum":320,"avg":160,"min":20,"max":300,"p50":160,"p90":272,"p99":297.2}}]}`},
+		{"stats empty", "GET", "/characters/stats?character_code=9", "", nil, http.StatusOK, `{"items":[]}`},
+		{"stats error", "GET", "/characters/stats?max_value=abc", "", nil, http.StatusBadRequest, `*max_value*`},
+		{"leaderboard", "GET", "/leaderboard", "", nil, http.StatusOK, `{"items":[{"id":"123",*`},
+		{"leaderboard top", "GET", "/leaderboard?top=1&character_code=3", "", nil, http.StatusOK, `*"rank":1}],"total_count":2}`},
+		{"leaderboard around", "GET", "/leaderboard?around=456&window=0", "", nil, http.StatusOK, `*"name":"Sam"*`},
+		{"leaderboard around unknown", "GET", "/leaderboard?around=1234", "", nil, http.StatusNotFound, ""},
+		{"leaderboard error", "GET", "/leaderboard?top=abc", "", nil, http.StatusBadRequest, `*top*`},
+		{"leaderboard top error", "GET", "/leaderboard?top=1000", "", nil, http.StatusBadRequest, `*top*`},
+		{"create auth error", "POST", "/characters", `{"name":"test","character_code":1}`, nil, http.StatusUnauthorized, ""},
+		{"create unknown type", "POST", "/characters", `{"name":"test","character_code":9}`, header, http.StatusBadRequest, `*character_code*`},
 		{"create input error", "POST", "/characters", `"name":"test"}`, header, http.StatusBadRequest, ""},
+		{"create invalid attribute", "POST", "/characters", `{"name":"test","character_code":1,"attributes":{"mana":-1}}`, header, http.StatusBadRequest, `*{"field":"attributes.mana","error":"must be no less than 0"}*`},
+		{"bulk ok", "POST", "/characters/bulk", `{"operations":[{"op":"create","name":"Merry","character_code":3},{"op":"delete","id":"none"}]}`, header, http.StatusOK, `*"succeeded":1*`},
+		{"bulk atomic", "POST", "/characters/bulk", `{"atomic":true,"operations":[{"op":"create","name":"Pippin","character_code":3},{"op":"delete","id":"none"},{"op":"delete","id":"456"}]}`, header, http.StatusOK, `*"committed":false*`},
+		{"bulk item status", "POST", "/characters/bulk", `{"operations":[{"op":"delete","id":"456"}]}`, header, http.StatusOK, `*"status":403*`},
+		{"bulk verify", "GET", "/characters", "", nil, http.StatusOK, `*"total_count":4*`},
+		{"bulk invalid", "POST", "/characters/bulk", `{"operations":[]}`, header, http.StatusBadRequest, `*operations*`},
+		{"bulk input error", "POST", "/characters/bulk", `{"operations":`, header, http.StatusBadRequest, ""},
+		{"bulk auth error", "POST", "/characters/bulk", `{"operations":[{"op":"delete","id":"123"}]}`, nil, http.StatusUnauthorized, ""},
+		{"import dry run", "POST", "/characters/import?dry_run=true", "name,character_code\nBilbo,3\n,3\n", csvHeader, http.StatusOK, `{"dry_run":true,"rows":2,"valid":1,"imported":0,"failed":1,"errors":[{"line":3,"errors":{"name":"cannot be blank"}}]}`},
+		{"import ndjson", "POST", "/characters/import?format=ndjson", `{"name":"Bilbo","character_code":3}`, header, http.StatusOK, `*"imported":1*`},
+		{"import verify", "GET", "/characters", "", nil, http.StatusOK, `*"total_count":5*`},
+		{"import format error", "POST", "/characters/import", `{"name":"Bilbo","character_code":3}`, header, http.StatusBadRequest, `*format*`},
+		{"import header error", "POST", "/characters/import", "title\nBilbo", csvHeader, http.StatusBadRequest, `*header*`},
+		{"import option error", "POST", "/characters/import?dry_run=maybe", "name,character_code\n", csvHeader, http.StatusBadRequest, ""},
+		{"import auth error", "POST", "/characters/import?format=ndjson", `{"name":"Bilbo","character_code":3}`, nil, http.StatusUnauthorized, ""},
+		{"export", "GET", "/characters/export", "", nil, http.StatusOK, `*"name":"Bilbo"*`},
+		{"export csv", "GET", "/characters/export?format=csv&character_code=3&sort=name", "", nil, http.StatusOK, "id,name,character_code,character_power,effective_power,character_value,formula_version,experience,level,attributes,version,owner_id,created_at,updated_at\n*"},
+		{"export empty", "GET", "/characters/export?format=ndjson&character_code=9", "", nil, http.StatusOK, ""},
+		{"export format error", "GET", "/characters/export?format=xml", "", nil, http.StatusBadRequest, `*format*`},
+		{"export filter error", "GET", "/characters/export?min_power=abc", "", nil, http.StatusBadRequest, `*min_power*`},
 		{"update ok", "PUT", "/characters/123", `{"name":"Frodoxyz"}`, header, http.StatusOK, "*Frodoxyz*"},
 		{"update ok", "PUT", "/characters/123", `{"name":"Frodoxyz", "character_power":19}`, header, http.StatusOK, "*38*"},
 		{"update ok", "PUT", "/characters/123", `{"name":"Frodoxyz", "character_power":20}`, header, http.StatusOK, "*60*"},
 		{"update verify", "GET", "/characters/123", "", nil, http.StatusOK, `*Frodoxyz*`},
 		{"update auth error", "PUT", "/characters/123", `{"name":"Frodoxyz"}`, nil, http.StatusUnauthorized, ""},
 		{"update input error", "PUT", "/characters/123", `"name":"Frodoxyz"}`, header, http.StatusBadRequest, ""},
+		{"patch ok", "PATCH", "/characters/123", `{"name":"Frodo Baggins"}`, patchHeader, http.StatusOK, `*"character_power":20*`},
+		{"patch power", "PATCH", "/characters/123", `{"character_power":10}`, patchHeader, http.StatusOK, `*"character_value":20*`},
+		{"patch verify", "GET", "/characters/123", "", nil, http.StatusOK, `*Frodo Baggins*`},
+		{"patch json content type", "PATCH", "/characters/123", `{"name":"Frodoxyz"}`, header, http.StatusOK, `*"version":7*`},
+		{"update stale", "PUT", "/characters/123", `{"name":"Stale"}`, staleHeader, http.StatusPreconditionFailed, ""},
+		{"delete stale", "DELETE", "/characters/123", ``, staleHeader, http.StatusPreconditionFailed, ""},
+		{"update matching", "PUT", "/characters/123", `{"name":"Frodoxyz", "character_power":20}`, matchHeader, http.StatusOK, `*"version":8*`},
+		{"patch stale", "PATCH", "/characters/123", `{"name":"Stale"}`, matchHeader, http.StatusPreconditionFailed, ""},
+		{"patch any", "PATCH", "/characters/123", `{"name":"Frodoxyz"}`, anyHeader, http.StatusOK, `*"version":9*`},
+		{"patch read-only field", "PATCH", "/characters/123", `{"character_value":1}`, patchHeader, http.StatusBadRequest, `*character_value*`},
+		{"patch unknown", "PATCH", "/characters/1234", `{"name":"x"}`, patchHeader, http.StatusNotFound, ""},
+		{"patch auth error", "PATCH", "/characters/123", `{"name":"x"}`, nil, http.StatusUnauthorized, ""},
+		{"patch input error", "PATCH", "/characters/123", `"name":"x"}`, patchHeader, http.StatusBadRequest, ""},
+		{"patch media type error", "PATCH", "/characters/123", `{"name":"x"}`, textHeader, http.StatusUnsupportedMediaType, ""},
+		{"as of now", "GET", "/characters/123?as_of=" + time.Now().Add(time.Hour).Format(time.RFC3339), "", header, http.StatusOK, `*Frodoxyz*`},
+		{"as of past", "GET", "/characters/123?as_of=2000-01-01T00:00:00Z", "", header, http.StatusNotFound, ""},
+		{"as of error", "GET", "/characters/123?as_of=yesterday", "", header, http.StatusBadRequest, `*as_of*`},
+		{"as of auth error", "GET", "/characters/123?as_of=2000-01-01T00:00:00Z", "", nil, http.StatusUnauthorized, ""},
+		{"diff", "GET", "/characters/123/diff?from=1&to=2", "", header, http.StatusOK, `*{"field":"name","from":"Frodo","to":"Frodoxyz"}]}*`},
+		{"diff unknown", "GET", "/characters/123/diff?from=1&to=99", "", header, http.StatusNotFound, ""},
+		{"diff error", "GET", "/characters/123/diff?from=0", "", header, http.StatusBadRequest, `*to*`},
+		{"diff auth error", "GET", "/characters/123/diff?from=1&to=2", "", nil, http.StatusUnauthorized, ""},
+		{"history", "GET", "/characters/123/history?per_page=1", "", header, http.StatusOK, `*"revision":9,"action":"update"*`},
+		{"history empty", "GET", "/characters/456/history", "", header, http.StatusOK, `*"total_count":0*`},
+		{"history unknown", "GET", "/characters/1234/history", "", header, http.StatusNotFound, ""},
+		{"history auth error", "GET", "/characters/123/history", "", nil, http.StatusUnauthorized, ""},
+		{"revert", "POST", "/characters/123/revert", `{"revision":1}`, header, http.StatusOK, `*"name":"Frodo","character_code":3,"character_power":100,"effective_power":100,"character_value":300*`},
+		{"revert before history", "POST", "/characters/123/revert", `{"as_of":"` + time.Now().Add(-time.Minute).Format(time.RFC3339) + `"}`, header, http.StatusBadRequest, `*as_of*`},
+		{"revert again", "POST", "/characters/123/revert", `{"revision":9}`, staleHeader, http.StatusPreconditionFailed, ""},
+		{"revert undo", "POST", "/characters/123/revert", `{"revision":9}`, header, http.StatusOK, `*"version":11*`},
+		{"revert not owner", "POST", "/characters/456/revert", `{"revision":1}`, header, http.StatusForbidden, ""},
+		{"revert input error", "POST", "/characters/123/revert", `{}`, header, http.StatusBadRequest, `*revision*`},
+		{"revert auth error", "POST", "/characters/123/revert", `{"revision":1}`, nil, http.StatusUnauthorized, ""},
+		{"experience", "POST", "/characters/123/experience", `{"amount":100}`, header, http.StatusOK, `*"experience":100,"level":2,*`},
+		{"experience not owner", "POST", "/characters/456/experience", `{"amount":100}`, header, http.StatusForbidden, ""},
+		{"experience unknown", "POST", "/characters/1234/experience", `{"amount":100}`, header, http.StatusNotFound, ""},
+		{"experience input error", "POST", "/characters/123/experience", `{"amount":0}`, header, http.StatusBadRequest, `*amount*`},
+		{"experience auth error", "POST", "/characters/123/experience", `{"amount":100}`, nil, http.StatusUnauthorized, ""},
 		{"delete ok", "DELETE", "/characters/123", ``, header, http.StatusOK, "*Frodoxyz*"},
 		{"delete verify", "DELETE", "/characters/123", ``, header, http.StatusNotFound, ""},
 		{"delete auth error", "DELETE", "/characters/123", ``, nil, http.StatusUnauthorized, ""},
+		{"trash", "GET", "/characters/trash", "", header, http.StatusOK, `*"deleted_at":*`},
+		{"trash auth error", "GET", "/characters/trash", "", nil, http.StatusUnauthorized, ""},
+		{"get deleted", "GET", "/characters/123", "", nil, http.StatusNotFound, ""},
+		{"restore ok", "POST", "/characters/123/restore", "", header, http.StatusOK, `*Frodoxyz*`},
+		{"restore verify", "GET", "/characters/123", "", nil, http.StatusOK, `*Frodoxyz*`},
+		{"restore not deleted", "POST", "/characters/123/restore", "", header, http.StatusNotFound, ""},
+		{"restore auth error", "POST", "/characters/123/restore", "", nil, http.StatusUnauthorized, ""},
+		{"delete again", "DELETE", "/characters/123", ``, header, http.StatusOK, "*Frodoxyz*"},
+		{"purge", "DELETE", "/characters/trash", ``, header, http.StatusOK, `{"purged":1}`},
+		{"purge verify", "POST", "/characters/123/restore", "", header, http.StatusNotFound, ""},
+		{"purge auth error", "DELETE", "/characters/trash", ``, nil, http.StatusUnauthorized, ""},
 	}
 	for _, tc := range tests {
 		test.Endpoint(t, router, tc)
 	}
 }
+
+func TestAPI_requireIfMatch(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{items: []entity.Character{
+		{ID: "123", Name: "Frodo", CharacterCode: 3, CharacterPower: 100, CharacterValue: 300, Version: 1, OwnerID: "100", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+	}}
+	RegisterHandlers(router.Group(""), newMockService(repo, logger), auth.MockAuthHandler, auth.AdminHandler(nil), Options{RequireIfMatch: true}, logger)
+	header := auth.MockAuthHeader()
+	matchHeader := auth.MockAuthHeader()
+	matchHeader.Set("If-Match", `"1"`)
+	matchHeader.Set("Content-Type", "application/merge-patch+json")
+
+	tests := []test.APITestCase{
+		{"update without precondition", "PUT", "/characters/123", `{"name":"Frodoxyz"}`, header, http.StatusPreconditionRequired, ""},
+		{"patch without precondition", "PATCH", "/characters/123", `{"name":"Frodoxyz"}`, header, http.StatusPreconditionRequired, ""},
+		{"delete without precondition", "DELETE", "/characters/123", ``, header, http.StatusPreconditionRequired, ""},
+		{"create without precondition", "POST", "/characters", `{"name":"test","character_code":1}`, header, http.StatusCreated, `*"version":1*`},
+		{"patch with precondition", "PATCH", "/characters/123", `{"name":"Frodoxyz"}`, matchHeader, http.StatusOK, `*"version":2*`},
+		{"delete unknown", "DELETE", "/characters/1234", ``, matchHeader, http.StatusNotFound, ""},
+		{"bulk without version", "POST", "/characters/bulk", `{"operations":[{"op":"update","id":"123","name":"Frodo"},{"op":"delete","id":"123"}]}`, header, http.StatusOK, `*"failed":2,"items":[{"index":0,"op":"update","status":428*`},
+		{"bulk with version", "POST", "/characters/bulk", `{"operations":[{"op":"update","id":"123","version":2,"name":"Frodo"}]}`, header, http.StatusOK, `*"succeeded":1*`},
+		{"trash by non-admin", "GET", "/characters/trash", "", header, http.StatusForbidden, ""},
+		{"purge by non-admin", "DELETE", "/characters/trash", ``, header, http.StatusForbidden, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+
+	req, _ := http.NewRequest("GET", "/characters/123", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, `"3"`, res.Header().Get("ETag"))
+}
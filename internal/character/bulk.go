@@ -0,0 +1,141 @@
+package character
+
+import (
+	"context"
+	"errors"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+)
+
+// MaxBulkOperations is the maximum number of operations in a bulk request.
+const MaxBulkOperations = 1000
+
+// Bulk operation types
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+// BulkOperation represents a single create, update or delete operation of a bulk request.
+type BulkOperation struct {
+	Op string `json:"op"`
+	// ID identifies the character to update or delete.
+	ID string `json:"id"`
+	// Version is the version an update or delete is based on. Zero skips the version check, unless the request
+	// requires versions.
+	Version        int64  `json:"version"`
+	Name           string `json:"name"`
+	CharacterCode  int64  `json:"character_code"`
+	CharacterPower int64  `json:"character_power"`
+	// Attributes are the attributes of a created character, or the new attributes of an updated character, which
+	// keeps its attributes if they are omitted.
+	Attributes entity.Attributes `json:"attributes"`
+}
+
+// Validate validates the BulkOperation fields.
+// The character fields are validated when the operation runs, like those of the single-item requests.
+func (m BulkOperation) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Op, validation.Required, validation.In(BulkCreate, BulkUpdate, BulkDelete)),
+		validation.Field(&m.ID, validation.When(m.Op != BulkCreate, validation.Required)),
+	)
+}
+
+// BulkRequest represents a request running several character operations in one transaction.
+type BulkRequest struct {
+	// Atomic makes all operations fail as soon as one of them fails. Otherwise every operation succeeds or fails
+	// on its own.
+	Atomic     bool            `json:"atomic"`
+	Operations []BulkOperation `json:"operations"`
+	// RequireVersion rejects the updates and deletes without a version, like the single writes without an If-Match
+	// header when Options.RequireIfMatch is set. It is set by the server, not by clients.
+	RequireVersion bool `json:"-"`
+}
+
+// Validate validates the BulkRequest fields.
+func (m BulkRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Operations, validation.Required, validation.Length(0, MaxBulkOperations)),
+	)
+}
+
+// BulkResult represents the outcome of an operation of a bulk request.
+type BulkResult struct {
+	Op string
+	// Character is the character created, updated or deleted by a successful operation.
+	Character Character
+	// Err is the failure of the operation, if any.
+	Err error
+}
+
+// errBulkAborted rolls back an atomic bulk request after one of its operations failed.
+var errBulkAborted = errors.New("bulk request aborted")
+
+// Bulk runs the operations of the given request in a single transaction and returns their results in order,
+// along with whether the transaction was committed.
+//
+// In atomic mode the first failure rolls back the whole request and the remaining operations are reported as
+// ErrBulkSkipped. Otherwise each operation runs in a nested transaction so that a failure only undoes that
+// operation, and the transaction is committed with the successful ones.
+func (s service) Bulk(ctx context.Context, req BulkRequest) ([]BulkResult, bool, error) {
+	if err := req.Validate(); err != nil {
+		return nil, false, err
+	}
+
+	results := make([]BulkResult, len(req.Operations))
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		for i, op := range req.Operations {
+			results[i].Op = op.Op
+			run := func(ctx context.Context) (err error) {
+				results[i].Character, err = s.bulkOperation(ctx, op, req.RequireVersion)
+				return err
+			}
+			if req.Atomic {
+				results[i].Err = run(ctx)
+			} else {
+				results[i].Err = s.transactional(ctx, run)
+			}
+			if results[i].Err != nil && req.Atomic {
+				for j := i + 1; j < len(results); j++ {
+					results[j] = BulkResult{Op: req.Operations[j].Op, Err: ErrBulkSkipped}
+				}
+				return errBulkAborted
+			}
+		}
+		return nil
+	})
+	if err == errBulkAborted {
+		return results, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return results, true, nil
+}
+
+// bulkOperation runs a single operation of a bulk request. Updates and deletes fail with ErrVersionRequired if they
+// have no version while one is required.
+func (s service) bulkOperation(ctx context.Context, op BulkOperation, requireVersion bool) (Character, error) {
+	if requireVersion && op.Op != BulkCreate && op.Version == AnyVersion {
+		return Character{}, ErrVersionRequired
+	}
+	switch op.Op {
+	case BulkCreate:
+		return s.Create(ctx, CreateCharacterRequest{
+			Name:           op.Name,
+			CharacterCode:  op.CharacterCode,
+			CharacterPower: op.CharacterPower,
+			Attributes:     op.Attributes,
+		})
+	case BulkUpdate:
+		return s.Update(ctx, op.ID, UpdateCharacterRequest{
+			Name:           op.Name,
+			CharacterPower: op.CharacterPower,
+			Attributes:     op.Attributes,
+		}, op.Version)
+	default:
+		return s.Delete(ctx, op.ID, op.Version)
+	}
+}
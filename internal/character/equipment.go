@@ -0,0 +1,121 @@
+package character
+
+import (
+	"context"
+	"errors"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/charactertype"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+)
+
+// Modifier changes the power of the characters equipping an item or learning an ability: by Percent percent of their
+// base power, truncated toward zero, plus Flat. Either may be negative.
+type Modifier struct {
+	Flat    int64
+	Percent int64
+}
+
+// Equipment gives the stat modifiers of the items that characters have equipped.
+type Equipment interface {
+	// Modifiers returns the modifiers of the items equipped by the character with the given ID.
+	Modifiers(ctx context.Context, characterID string) ([]Modifier, error)
+}
+
+// CombineEquipment returns the equipment giving the modifiers of all the given ones, such as the items and the
+// abilities of the characters.
+func CombineEquipment(equipment ...Equipment) Equipment {
+	return combinedEquipment(equipment)
+}
+
+type combinedEquipment []Equipment
+
+// Modifiers returns the modifiers of the character with the given ID from all the combined equipment.
+func (e combinedEquipment) Modifiers(ctx context.Context, characterID string) ([]Modifier, error) {
+	var modifiers []Modifier
+	for _, equipment := range e {
+		m, err := equipment.Modifiers(ctx, characterID)
+		if err != nil {
+			return nil, err
+		}
+		modifiers = append(modifiers, m...)
+	}
+	return modifiers, nil
+}
+
+// effectivePower returns the power that the character with the specified ID has with its equipment when its base
+// power is the given one. The modifiers add up, and the result is never negative.
+func (s service) effectivePower(ctx context.Context, id string, power int64) (int64, error) {
+	modifiers, err := s.equipment.Modifiers(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	var percent, flat int64
+	for _, modifier := range modifiers {
+		if percent, err = add(percent, modifier.Percent); err != nil {
+			return 0, err
+		}
+		if flat, err = add(flat, modifier.Flat); err != nil {
+			return 0, err
+		}
+	}
+	bonus, err := scale(power, percent)
+	if err != nil {
+		return 0, err
+	}
+	if bonus, err = add(bonus, flat); err != nil {
+		return 0, err
+	}
+	if power, err = add(power, bonus); err != nil || power < 0 {
+		return 0, err
+	}
+	return power, nil
+}
+
+// setPower sets the base power of a character of the given type, and recomputes its effective power with its current
+// equipment and its value with the current valuation of the type.
+func (s service) setPower(ctx context.Context, character *entity.Character, characterType charactertype.CharacterType, power int64) error {
+	effectivePower, err := s.effectivePower(ctx, character.ID, power)
+	if err == ErrValueOverflow {
+		return validation.Errors{
+			"character_power": errors.New("is too large to be valued"),
+		}
+	} else if err != nil {
+		return err
+	}
+	value, formulaVersion, err := s.value(characterType, effectivePower)
+	if err != nil {
+		return err
+	}
+	character.CharacterPower = power
+	character.EffectivePower = effectivePower
+	character.CharacterValue = value
+	character.FormulaVersion = formulaVersion
+	return nil
+}
+
+// RefreshEquipment recomputes the effective power and the value of the character with the specified ID after its
+// equipment or its abilities, or their modifiers, changed. It must run in the transaction making that change.
+// A change of the effective power is recorded as an equipment revision; nothing is written otherwise.
+func (s service) RefreshEquipment(ctx context.Context, id string) (Character, error) {
+	var character Character
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		if character, err = s.Get(ctx, id); err != nil {
+			return err
+		}
+		characterType, err := s.types.Get(ctx, character.CharacterCode)
+		if err != nil {
+			return err
+		}
+		before := character.Character
+		if err := s.setPower(ctx, &character.Character, characterType, character.CharacterPower); err != nil {
+			return err
+		}
+		if character.EffectivePower == before.EffectivePower {
+			character.Character = before
+			return nil
+		}
+		return s.save(ctx, entity.ActionEquipment, &character, before)
+	})
+	return character, err
+}
@@ -0,0 +1,23 @@
+package character
+
+import (
+	"net/http"
+
+	"github.com/hikvineh/go-rest-game-character/internal/errors"
+)
+
+var (
+	// ErrVersionConflict is returned when a character is written based on a version that is no longer current.
+	ErrVersionConflict = errors.PreconditionFailed("The character has been modified since you last retrieved it.")
+	// ErrVersionRequired is reported for the bulk updates and deletes without a version when writes must be based on a
+	// known version of the characters.
+	ErrVersionRequired = errors.PreconditionRequired("The version of the character is required.")
+	// ErrNotOwner is returned when a user attempts to change a character owned by someone else.
+	ErrNotOwner = errors.Forbidden("Only the owner of the character can change it.")
+	// ErrBulkSkipped is reported for the operations of an atomic bulk request that were not run because an earlier
+	// operation failed.
+	ErrBulkSkipped = errors.ErrorResponse{
+		Status:  http.StatusFailedDependency,
+		Message: "The operation was not run because an earlier operation failed.",
+	}
+)
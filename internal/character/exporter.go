@@ -0,0 +1,152 @@
+package character
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+)
+
+// FormatJSON exports the characters as a single JSON array.
+const FormatJSON = "json"
+
+// ExportContentTypes maps the export formats to the media types of the exported files.
+var ExportContentTypes = map[string]string{
+	FormatCSV:    "text/csv; charset=utf-8",
+	FormatNDJSON: "application/x-ndjson",
+	FormatJSON:   "application/json",
+}
+
+// exportCSVColumns lists the columns of a CSV export. Its header is accepted by the CSV import.
+var exportCSVColumns = []string{"id", "name", "character_code", "character_power", "effective_power",
+	"character_value", "formula_version", "experience", "level", "attributes", "version", "owner_id", "created_at",
+	"updated_at"}
+
+// RowWriter writes characters to an export file one at a time.
+type RowWriter interface {
+	// Write writes a character to the file.
+	Write(character Character) error
+	// Close completes the file, which is valid even if no character was written.
+	Close() error
+}
+
+// NewRowWriter returns a RowWriter encoding characters to the given stream in the given format.
+// Nothing is written to the stream until the first character is written or the writer is closed.
+func NewRowWriter(w io.Writer, format string) (RowWriter, error) {
+	switch format {
+	case FormatCSV:
+		return &csvRowWriter{writer: csv.NewWriter(w)}, nil
+	case FormatNDJSON:
+		return &ndjsonRowWriter{encoder: json.NewEncoder(w)}, nil
+	case FormatJSON:
+		return &jsonRowWriter{writer: w}, nil
+	}
+	return nil, validation.Errors{
+		"format": errors.New("must be csv, ndjson or json"),
+	}
+}
+
+type csvRowWriter struct {
+	writer  *csv.Writer
+	started bool
+}
+
+func (w *csvRowWriter) Write(character Character) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	attributes, err := character.Attributes.Value()
+	if err != nil {
+		return err
+	}
+	return w.writer.Write([]string{
+		character.ID,
+		character.Name,
+		strconv.FormatInt(character.CharacterCode, 10),
+		strconv.FormatInt(character.CharacterPower, 10),
+		strconv.FormatInt(character.EffectivePower, 10),
+		strconv.FormatInt(character.CharacterValue, 10),
+		strconv.FormatInt(character.FormulaVersion, 10),
+		strconv.FormatInt(character.Experience, 10),
+		strconv.FormatInt(character.Level, 10),
+		attributes.(string),
+		strconv.FormatInt(character.Version, 10),
+		character.OwnerID,
+		character.CreatedAt.Format(time.RFC3339),
+		character.UpdatedAt.Format(time.RFC3339),
+	})
+}
+
+// start writes the header of the file before the first record.
+func (w *csvRowWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	return w.writer.Write(exportCSVColumns)
+}
+
+func (w *csvRowWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type ndjsonRowWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonRowWriter) Write(character Character) error {
+	return w.encoder.Encode(character)
+}
+
+func (w *ndjsonRowWriter) Close() error {
+	return nil
+}
+
+type jsonRowWriter struct {
+	writer io.Writer
+	count  int
+}
+
+func (w *jsonRowWriter) Write(character Character) error {
+	data, err := json.Marshal(character)
+	if err != nil {
+		return err
+	}
+	separator := ",\n"
+	if w.count == 0 {
+		separator = "[\n"
+	}
+	w.count++
+	if _, err := io.WriteString(w.writer, separator); err != nil {
+		return err
+	}
+	_, err = w.writer.Write(data)
+	return err
+}
+
+func (w *jsonRowWriter) Close() error {
+	end := "\n]\n"
+	if w.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w.writer, end)
+	return err
+}
+
+// Export calls fn for every character satisfying the given filter, in the given order, and stops at the first error
+// returned by fn. The characters are streamed from the storage, so the memory used does not depend on their number.
+func (s service) Export(ctx context.Context, filter Filter, sort Sort, fn func(Character) error) error {
+	return s.repo.Each(ctx, filter, sort, func(character entity.Character) error {
+		return fn(Character{character})
+	})
+}
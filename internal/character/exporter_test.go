@@ -0,0 +1,71 @@
+package character
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+// exportRows writes the given characters in the given format and returns the file.
+func exportRows(t *testing.T, format string, characters ...Character) string {
+	var buf bytes.Buffer
+	writer, err := NewRowWriter(&buf, format)
+	if !assert.Nil(t, err) {
+		return ""
+	}
+	for _, character := range characters {
+		assert.Nil(t, writer.Write(character))
+	}
+	assert.Nil(t, writer.Close())
+	return buf.String()
+}
+
+func TestNewRowWriter(t *testing.T) {
+	created := time.Date(2019, 10, 1, 15, 36, 38, 0, time.UTC)
+	characters := []Character{
+		{entity.Character{ID: "1", Name: "Gandalf", CharacterCode: 1, CharacterPower: 100, EffectivePower: 100, CharacterValue: 150, FormulaVersion: 1, Experience: 150, Level: 2, Attributes: entity.Attributes{"mana": json.Number("40")}, Version: 2, OwnerID: "100", CreatedAt: created, UpdatedAt: created}},
+		{entity.Character{ID: "2", Name: "Baggins, Frodo", CharacterCode: 3, CharacterPower: 10, EffectivePower: 12, CharacterValue: 20, FormulaVersion: 1, Level: 1, Version: 1, OwnerID: "100", CreatedAt: created, UpdatedAt: created}},
+	}
+
+	_, err := NewRowWriter(&bytes.Buffer{}, "xml")
+	assert.NotNil(t, err)
+
+	// csv
+	data := exportRows(t, FormatCSV, characters...)
+	assert.Equal(t, "id,name,character_code,character_power,effective_power,character_value,formula_version,experience,level,attributes,version,owner_id,created_at,updated_at\n"+
+		"1,Gandalf,1,100,100,150,1,150,2,\"{\"\"mana\"\":40}\",2,100,2019-10-01T15:36:38Z,2019-10-01T15:36:38Z\n"+
+		"2,\"Baggins, Frodo\",3,10,12,20,1,0,1,{},1,100,2019-10-01T15:36:38Z,2019-10-01T15:36:38Z\n", data)
+	rows := readRows(t, mustRowReader(t, data, FormatCSV))
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, CreateCharacterRequest{Name: "Gandalf", CharacterCode: 1, CharacterPower: 100, Attributes: entity.Attributes{"mana": json.Number("40")}}, rows[0].Request)
+		assert.Equal(t, CreateCharacterRequest{Name: "Baggins, Frodo", CharacterCode: 3, CharacterPower: 10, Attributes: entity.Attributes{}}, rows[1].Request)
+	}
+	assert.Equal(t, "id,name,character_code,character_power,effective_power,character_value,formula_version,experience,level,attributes,version,owner_id,created_at,updated_at\n", exportRows(t, FormatCSV))
+
+	// ndjson
+	data = exportRows(t, FormatNDJSON, characters...)
+	lines := strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.True(t, strings.HasPrefix(lines[0], `{"id":"1","name":"Gandalf",`))
+	}
+	assert.Equal(t, "", exportRows(t, FormatNDJSON))
+
+	// json
+	data = exportRows(t, FormatJSON, characters...)
+	var decoded []Character
+	assert.Nil(t, json.Unmarshal([]byte(data), &decoded))
+	assert.Equal(t, characters, decoded)
+	assert.Equal(t, "[]\n", exportRows(t, FormatJSON))
+}
+
+// mustRowReader returns a RowReader of the given import file.
+func mustRowReader(t *testing.T, data, format string) RowReader {
+	reader, err := NewRowReader(strings.NewReader(data), format)
+	assert.Nil(t, err)
+	return reader
+}
@@ -0,0 +1,327 @@
+package character
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	gosort "sort"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/pagination"
+)
+
+// Filter specifies the conditions that listed characters must satisfy.
+// Unset fields do not restrict the result.
+type Filter struct {
+	// CharacterCodes restricts the characters to the given types.
+	CharacterCodes []int64
+	// MinPower and MaxPower restrict the character power to an inclusive range.
+	MinPower, MaxPower *int64
+	// MinValue and MaxValue restrict the character value to an inclusive range.
+	MinValue, MaxValue *int64
+	// NamePrefix matches the characters whose name starts with the given string, ignoring case.
+	NamePrefix string
+	// NameContains matches the characters whose name contains the given string, ignoring case.
+	NameContains string
+	// CreatedAfter and CreatedBefore restrict the creation time to the window [CreatedAfter, CreatedBefore).
+	CreatedAfter, CreatedBefore *time.Time
+	// OwnerID restricts the characters to those owned by the given user.
+	OwnerID string
+	// Attributes restricts the characters by the values of their attributes.
+	Attributes []AttributeFilter
+}
+
+// AttributeFilter specifies the conditions that an attribute of listed characters must satisfy.
+// Unset fields do not restrict the result.
+type AttributeFilter struct {
+	// Name is the name of the attribute.
+	Name string
+	// Equals matches the characters whose attribute, in its text form, is equal to the given string.
+	Equals *string
+	// Min and Max restrict a numeric attribute to an inclusive range. Non-numeric attributes never match them.
+	Min, Max *float64
+}
+
+// SortField specifies a column that characters are ordered by.
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// Sort specifies the ordering of characters. Characters are always ordered by ID last.
+type Sort []SortField
+
+// sortableColumns lists the columns that characters can be ordered by.
+var sortableColumns = map[string]bool{
+	"id":              true,
+	"name":            true,
+	"character_code":  true,
+	"character_power": true,
+	"effective_power": true,
+	"character_value": true,
+	"experience":      true,
+	"level":           true,
+	"created_at":      true,
+	"updated_at":      true,
+}
+
+// DefaultSort orders characters by ID.
+var DefaultSort = Sort{{Column: "id"}}
+
+// ParseSort parses a comma-separated list of column names, each optionally prefixed by "-" for descending order,
+// such as "-character_value,name". An empty string results in DefaultSort.
+func ParseSort(s string) (Sort, error) {
+	var sort Sort
+	hasID := false
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		field := SortField{Column: strings.TrimPrefix(name, "-"), Desc: strings.HasPrefix(name, "-")}
+		if !sortableColumns[field.Column] {
+			return nil, errors.New("cannot sort by " + field.Column)
+		}
+		sort = append(sort, field)
+		if field.Column == "id" {
+			hasID = true
+			break
+		}
+	}
+	if !hasID {
+		sort = append(sort, SortField{Column: "id"})
+	}
+	return sort, nil
+}
+
+// String returns the sort in the format accepted by ParseSort.
+func (s Sort) String() string {
+	names := make([]string, len(s))
+	for i, field := range s {
+		names[i] = field.Column
+		if field.Desc {
+			names[i] = "-" + names[i]
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// OrderBy returns the ORDER BY columns of the sort.
+func (s Sort) OrderBy() []string {
+	cols := make([]string, len(s))
+	for i, field := range s {
+		if field.Desc {
+			cols[i] = field.Column + " DESC"
+		} else {
+			cols[i] = field.Column + " ASC"
+		}
+	}
+	return cols
+}
+
+// Reverse returns the sort with every direction flipped.
+func (s Sort) Reverse() Sort {
+	reversed := make(Sort, len(s))
+	for i, field := range s {
+		reversed[i] = SortField{Column: field.Column, Desc: !field.Desc}
+	}
+	return reversed
+}
+
+// Keys returns the values of the sort columns of the given character.
+func (s Sort) Keys(character entity.Character) []interface{} {
+	keys := make([]interface{}, len(s))
+	for i, field := range s {
+		switch field.Column {
+		case "id":
+			keys[i] = character.ID
+		case "name":
+			keys[i] = character.Name
+		case "character_code":
+			keys[i] = character.CharacterCode
+		case "character_power":
+			keys[i] = character.CharacterPower
+		case "effective_power":
+			keys[i] = character.EffectivePower
+		case "character_value":
+			keys[i] = character.CharacterValue
+		case "experience":
+			keys[i] = character.Experience
+		case "level":
+			keys[i] = character.Level
+		case "created_at":
+			keys[i] = character.CreatedAt
+		case "updated_at":
+			keys[i] = character.UpdatedAt
+		}
+	}
+	return keys
+}
+
+// EncodeCursor returns a pagination cursor pointing at the given character in the sort order.
+func (s Sort) EncodeCursor(character entity.Character) (string, error) {
+	return pagination.EncodeCursor(s.String(), s.Keys(character)...)
+}
+
+// DecodeCursor returns the sort column values held in a pagination cursor created by EncodeCursor.
+func (s Sort) DecodeCursor(token string) ([]interface{}, error) {
+	var character entity.Character
+	ptrs := make([]interface{}, len(s))
+	for i, field := range s {
+		switch field.Column {
+		case "id":
+			ptrs[i] = &character.ID
+		case "name":
+			ptrs[i] = &character.Name
+		case "character_code":
+			ptrs[i] = &character.CharacterCode
+		case "character_power":
+			ptrs[i] = &character.CharacterPower
+		case "effective_power":
+			ptrs[i] = &character.EffectivePower
+		case "character_value":
+			ptrs[i] = &character.CharacterValue
+		case "experience":
+			ptrs[i] = &character.Experience
+		case "level":
+			ptrs[i] = &character.Level
+		case "created_at":
+			ptrs[i] = &character.CreatedAt
+		case "updated_at":
+			ptrs[i] = &character.UpdatedAt
+		}
+	}
+	if err := pagination.DecodeCursor(token, s.String(), ptrs...); err != nil {
+		return nil, err
+	}
+	return s.Keys(character), nil
+}
+
+// ParseQuery parses the filter and sort of a character listing from the given query parameters.
+// Invalid parameters are reported as validation errors keyed by the parameter name.
+func ParseQuery(query url.Values) (Filter, Sort, error) {
+	var filter Filter
+	errs := validation.Errors{}
+
+	if s := query.Get("character_code"); s != "" {
+		for _, code := range strings.Split(s, ",") {
+			c, err := strconv.ParseInt(strings.TrimSpace(code), 10, 64)
+			if err != nil {
+				errs["character_code"] = errors.New("must be a comma-separated list of integers")
+				break
+			}
+			filter.CharacterCodes = append(filter.CharacterCodes, c)
+		}
+	}
+	filter.MinPower = parseIntParam(query, "min_power", errs)
+	filter.MaxPower = parseIntParam(query, "max_power", errs)
+	filter.MinValue = parseIntParam(query, "min_value", errs)
+	filter.MaxValue = parseIntParam(query, "max_value", errs)
+	filter.NamePrefix = query.Get("name_prefix")
+	filter.NameContains = query.Get("name")
+	filter.CreatedAfter = parseTimeParam(query, "created_after", errs)
+	filter.CreatedBefore = parseTimeParam(query, "created_before", errs)
+	filter.Attributes = parseAttributeParams(query, errs)
+
+	sort, err := ParseSort(query.Get("sort"))
+	if err != nil {
+		errs["sort"] = err
+	}
+
+	if len(errs) > 0 {
+		return Filter{}, nil, errs
+	}
+	return filter, sort, nil
+}
+
+// attributeParams lists the prefixes of the query parameters filtering attributes, such as "min_attr.mana".
+var attributeParams = []string{"attr.", "min_attr.", "max_attr."}
+
+// parseAttributeParams parses the attribute filters of the query parameters, ordered by attribute name.
+// "attr.<name>" matches the value of the attribute, while "min_attr.<name>" and "max_attr.<name>" bound it.
+func parseAttributeParams(query url.Values, errs validation.Errors) []AttributeFilter {
+	filters := map[string]*AttributeFilter{}
+	var names []string
+	for param := range query {
+		for _, prefix := range attributeParams {
+			if !strings.HasPrefix(param, prefix) {
+				continue
+			}
+			name := strings.TrimPrefix(param, prefix)
+			if name == "" {
+				errs[param] = errors.New("must name an attribute")
+				break
+			}
+			filter, ok := filters[name]
+			if !ok {
+				filter = &AttributeFilter{Name: name}
+				filters[name] = filter
+				names = append(names, name)
+			}
+			switch prefix {
+			case "attr.":
+				v := query.Get(param)
+				filter.Equals = &v
+			case "min_attr.":
+				filter.Min = parseFloatParam(query, param, errs)
+			case "max_attr.":
+				filter.Max = parseFloatParam(query, param, errs)
+			}
+			break
+		}
+	}
+	gosort.Strings(names)
+	var result []AttributeFilter
+	for _, name := range names {
+		result = append(result, *filters[name])
+	}
+	return result
+}
+
+// parseFloatParam parses an optional number query parameter, recording an error if it is malformed.
+func parseFloatParam(query url.Values, name string, errs validation.Errors) *float64 {
+	s := query.Get(name)
+	if s == "" {
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		errs[name] = errors.New("must be a number")
+		return nil
+	}
+	return &v
+}
+
+// parseIntParam parses an optional integer query parameter, recording an error if it is malformed.
+func parseIntParam(query url.Values, name string, errs validation.Errors) *int64 {
+	s := query.Get(name)
+	if s == "" {
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		errs[name] = errors.New("must be an integer")
+		return nil
+	}
+	return &v
+}
+
+// parseTimeParam parses an optional RFC3339 time query parameter, recording an error if it is malformed.
+func parseTimeParam(query url.Values, name string, errs validation.Errors) *time.Time {
+	s := query.Get(name)
+	if s == "" {
+		return nil
+	}
+	v, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		errs[name] = errors.New("must be a time in RFC3339 format")
+		return nil
+	}
+	// timestamps are stored without time zone in the local time of the server
+	v = v.Local()
+	return &v
+}
@@ -0,0 +1,151 @@
+package character
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		name      string
+		sort      string
+		want      Sort
+		wantError bool
+	}{
+		{"empty", "", DefaultSort, false},
+		{"single", "name", Sort{{Column: "name"}, {Column: "id"}}, false},
+		{"descending", "-character_value,name", Sort{{Column: "character_value", Desc: true}, {Column: "name"}, {Column: "id"}}, false},
+		{"spaces", " -created_at , ", Sort{{Column: "created_at", Desc: true}, {Column: "id"}}, false},
+		{"explicit id", "-id", Sort{{Column: "id", Desc: true}}, false},
+		{"after id", "id,name", Sort{{Column: "id"}}, false},
+		{"not sortable", "password", nil, true},
+		{"injection", "name;DROP TABLE character", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sort, err := ParseSort(tt.sort)
+			assert.Equal(t, tt.wantError, err != nil)
+			assert.Equal(t, tt.want, sort)
+		})
+	}
+}
+
+func TestSort_OrderBy(t *testing.T) {
+	sort := Sort{{Column: "character_value", Desc: true}, {Column: "id"}}
+	assert.Equal(t, []string{"character_value DESC", "id ASC"}, sort.OrderBy())
+	assert.Equal(t, "-character_value,id", sort.String())
+}
+
+func TestParseQuery(t *testing.T) {
+	query, _ := url.ParseQuery("character_code=1,3&min_power=10&max_power=20&min_value=5&max_value=50" +
+		"&name_prefix=Fro&name=do&created_after=2019-10-01T00:00:00Z&created_before=2019-11-01T00:00:00Z&sort=-name")
+	filter, sort, err := ParseQuery(query)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 3}, filter.CharacterCodes)
+	assert.Equal(t, int64(10), *filter.MinPower)
+	assert.Equal(t, int64(20), *filter.MaxPower)
+	assert.Equal(t, int64(5), *filter.MinValue)
+	assert.Equal(t, int64(50), *filter.MaxValue)
+	assert.Equal(t, "Fro", filter.NamePrefix)
+	assert.Equal(t, "do", filter.NameContains)
+	assert.True(t, time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC).Equal(*filter.CreatedAfter))
+	assert.True(t, time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC).Equal(*filter.CreatedBefore))
+	assert.Equal(t, Sort{{Column: "name", Desc: true}, {Column: "id"}}, sort)
+
+	filter, sort, err = ParseQuery(url.Values{})
+	assert.Nil(t, err)
+	assert.Equal(t, Filter{}, filter)
+	assert.Equal(t, DefaultSort, sort)
+
+	query, _ = url.ParseQuery("character_code=1,x&min_power=a&max_value=1.5&created_after=yesterday&sort=secret")
+	_, _, err = ParseQuery(query)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "character_code: must be a comma-separated list of integers; created_after: must be a time in RFC3339 format; max_value: must be an integer; min_power: must be an integer; sort: cannot sort by secret.", err.Error())
+	}
+}
+
+func TestSort_Cursor_sortableColumns(t *testing.T) {
+	character := entity.Character{
+		ID:             "id1",
+		Name:           "Frodo",
+		CharacterCode:  3,
+		CharacterPower: 10,
+		EffectivePower: 15,
+		CharacterValue: 30,
+		Experience:     150,
+		Level:          2,
+		CreatedAt:      time.Date(2019, 10, 5, 5, 21, 11, 0, time.UTC),
+		UpdatedAt:      time.Date(2019, 10, 6, 5, 21, 11, 0, time.UTC),
+	}
+	for column := range sortableColumns {
+		t.Run(column, func(t *testing.T) {
+			sort, err := ParseSort("-" + column)
+			assert.Nil(t, err)
+			keys := sort.Keys(character)
+			for _, key := range keys {
+				assert.NotNil(t, key)
+			}
+			token, err := sort.EncodeCursor(character)
+			assert.Nil(t, err)
+			decoded, err := sort.DecodeCursor(token)
+			assert.Nil(t, err)
+			if assert.Equal(t, len(keys), len(decoded)) {
+				for i, key := range keys {
+					if tm, ok := key.(time.Time); ok {
+						assert.True(t, tm.Equal(decoded[i].(time.Time)))
+					} else {
+						assert.Equal(t, key, decoded[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseQuery_attributes(t *testing.T) {
+	query, _ := url.ParseQuery("min_attr.mana=100&attr.school=fire&max_attr.mana=500.5&attr.agility=90")
+	filter, _, err := ParseQuery(query)
+	assert.Nil(t, err)
+	school, agility := "fire", "90"
+	min, max := float64(100), 500.5
+	assert.Equal(t, []AttributeFilter{
+		{Name: "agility", Equals: &agility},
+		{Name: "mana", Min: &min, Max: &max},
+		{Name: "school", Equals: &school},
+	}, filter.Attributes)
+
+	query, _ = url.ParseQuery("min_attr.mana=lots&max_attr.=1&attr.=x")
+	_, _, err = ParseQuery(query)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "attr.: must name an attribute; max_attr.: must name an attribute; min_attr.mana: must be a number.", err.Error())
+	}
+}
+
+func TestSort_Cursor(t *testing.T) {
+	sort := Sort{{Column: "character_value", Desc: true}, {Column: "created_at"}, {Column: "name"}, {Column: "id"}}
+	assert.Equal(t, Sort{{Column: "character_value"}, {Column: "created_at", Desc: true}, {Column: "name", Desc: true}, {Column: "id", Desc: true}}, sort.Reverse())
+
+	character := entity.Character{
+		ID:             "id1",
+		Name:           "Frodo",
+		CharacterValue: 20,
+		CreatedAt:      time.Date(2019, 10, 5, 5, 21, 11, 0, time.UTC),
+	}
+	token, err := sort.EncodeCursor(character)
+	assert.Nil(t, err)
+	keys, err := sort.DecodeCursor(token)
+	assert.Nil(t, err)
+	if assert.Equal(t, 4, len(keys)) {
+		assert.Equal(t, int64(20), keys[0])
+		assert.True(t, character.CreatedAt.Equal(keys[1].(time.Time)))
+		assert.Equal(t, "Frodo", keys[2])
+		assert.Equal(t, "id1", keys[3])
+	}
+
+	_, err = DefaultSort.DecodeCursor(token)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,350 @@
+package character
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/charactertype"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+)
+
+// Import and export formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// MaxImportLineSize is the maximum size in bytes of a line of an NDJSON import.
+const MaxImportLineSize = 1 << 20
+
+// ImportRow represents a row of an import file.
+type ImportRow struct {
+	// Line is the line number of the row. For CSV files it counts records, the header being line 1.
+	Line    int
+	Request CreateCharacterRequest
+	// Err holds the validation errors found while decoding the row, if any.
+	Err validation.Errors
+}
+
+// RowReader reads the characters of an import file one row at a time.
+type RowReader interface {
+	// Read returns the next row of the file, or io.EOF when there are no more rows.
+	// Rows that cannot be decoded are returned with Err set, and reading can continue after them.
+	Read() (ImportRow, error)
+}
+
+// NewRowReader returns a RowReader decoding the given stream in the given format.
+// CSV files must start with a header naming the columns name, character_code and optionally character_power,
+// in any order.
+func NewRowReader(r io.Reader, format string) (RowReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVRowReader(r)
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), MaxImportLineSize)
+		return &ndjsonRowReader{scanner: scanner}, nil
+	}
+	return nil, validation.Errors{
+		"format": errors.New("must be csv or ndjson"),
+	}
+}
+
+// requiredCSVColumns lists the columns that a CSV import must have. Other columns than these, character_power and
+// attributes, which holds a JSON object, are ignored.
+var requiredCSVColumns = []string{"name", "character_code"}
+
+type csvRowReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+func newCSVRowReader(r io.Reader) (*csvRowReader, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, validation.Errors{
+			"header": errors.New("is missing"),
+		}
+	} else if err != nil {
+		return nil, validation.Errors{
+			"header": errors.New("is not valid CSV"),
+		}
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range requiredCSVColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, validation.Errors{
+				"header": errors.New("must contain the column " + name),
+			}
+		}
+	}
+	return &csvRowReader{reader: reader, columns: columns, line: 1}, nil
+}
+
+func (r *csvRowReader) Read() (ImportRow, error) {
+	record, err := r.reader.Read()
+	if err == io.EOF {
+		return ImportRow{}, err
+	}
+	r.line++
+	row := ImportRow{Line: r.line}
+	if err != nil {
+		e, ok := err.(*csv.ParseError)
+		if !ok {
+			return row, err
+		}
+		row.Err = validation.Errors{
+			"record": errors.New("is not valid CSV"),
+		}
+		if e.Err == csv.ErrFieldCount {
+			row.Err["record"] = errors.New("must have as many fields as the header")
+		}
+		return row, nil
+	}
+
+	row.Err = validation.Errors{}
+	row.Request.Name = r.field(record, "name")
+	row.Request.CharacterCode = r.intField(record, "character_code", row.Err)
+	row.Request.CharacterPower = r.intField(record, "character_power", row.Err)
+	row.Request.Attributes = r.attributesField(record, "attributes", row.Err)
+	if len(row.Err) == 0 {
+		row.Err = nil
+	}
+	return row, nil
+}
+
+// field returns the value of the named column in the given record, or an empty string if there is no such column.
+func (r *csvRowReader) field(record []string, name string) string {
+	if i, ok := r.columns[name]; ok && i < len(record) {
+		return strings.TrimSpace(record[i])
+	}
+	return ""
+}
+
+// intField returns the integer value of the named column, recording an error if it is malformed.
+// Empty values result in 0.
+func (r *csvRowReader) intField(record []string, name string, errs validation.Errors) int64 {
+	s := r.field(record, name)
+	if s == "" {
+		return 0
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		errs[name] = errors.New("must be an integer")
+	}
+	return v
+}
+
+// attributesField returns the attributes encoded as a JSON object in the named column, recording an error if they are
+// malformed. Empty values result in nil.
+func (r *csvRowReader) attributesField(record []string, name string, errs validation.Errors) entity.Attributes {
+	s := r.field(record, name)
+	if s == "" {
+		return nil
+	}
+	var attributes entity.Attributes
+	if err := json.Unmarshal([]byte(s), &attributes); err != nil || attributes == nil {
+		errs[name] = errors.New("must be a JSON object")
+		return nil
+	}
+	return attributes
+}
+
+type ndjsonRowReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (r *ndjsonRowReader) Read() (ImportRow, error) {
+	for r.scanner.Scan() {
+		r.line++
+		data := bytes.TrimSpace(r.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		row := ImportRow{Line: r.line}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&row.Request)
+		if err == nil && decoder.More() {
+			err = errors.New("unexpected data after the object")
+		}
+		if err != nil {
+			if e, ok := err.(*json.UnmarshalTypeError); ok {
+				row.Err = validation.Errors{
+					e.Field: errors.New("has the wrong type"),
+				}
+			} else {
+				row.Err = validation.Errors{
+					"record": errors.New("is not a valid JSON object of a character"),
+				}
+			}
+		}
+		return row, nil
+	}
+	if err := r.scanner.Err(); err == bufio.ErrTooLong {
+		return ImportRow{}, validation.Errors{
+			"record": fmt.Errorf("line %v is longer than %v bytes", r.line+1, MaxImportLineSize),
+		}
+	} else if err != nil {
+		return ImportRow{}, err
+	}
+	return ImportRow{}, io.EOF
+}
+
+// DefaultImportBatchSize is the number of characters inserted at once by an import, unless specified otherwise.
+const DefaultImportBatchSize = 500
+
+// MaxImportBatchSize is the maximum number of characters inserted at once by an import.
+const MaxImportBatchSize = 1000
+
+// MaxImportErrors is the maximum number of row errors listed in an import report.
+// Rows failing beyond this limit are still counted.
+const MaxImportErrors = 1000
+
+// ImportOptions specifies how characters are imported.
+type ImportOptions struct {
+	// DryRun checks the rows without saving any character.
+	DryRun bool
+	// BatchSize is the number of characters inserted at once. Zero means DefaultImportBatchSize.
+	BatchSize int
+}
+
+// ImportError describes why a row of an import failed.
+type ImportError struct {
+	Line   int               `json:"line"`
+	Errors validation.Errors `json:"errors"`
+}
+
+// ImportReport summarizes the outcome of an import.
+type ImportReport struct {
+	DryRun bool `json:"dry_run"`
+	// Rows is the number of rows read.
+	Rows int `json:"rows"`
+	// Valid is the number of rows passing validation and valuation.
+	Valid int `json:"valid"`
+	// Imported is the number of characters saved. It is zero for a dry run.
+	Imported int `json:"imported"`
+	// Failed is the number of rows failing validation or valuation.
+	Failed int           `json:"failed"`
+	Errors []ImportError `json:"errors"`
+}
+
+// Import creates a character for every valid row read from the given reader, owned by the current user.
+// Each row is validated and valued like a creation request. Rows that fail are listed in the report and skipped,
+// while valid rows are saved in batches. A dry run only fills the report.
+//
+// The rows are streamed, so the memory used does not depend on the size of the file. If saving a batch fails,
+// the import stops and the batches saved before remain. Every character saved is recorded as created by the
+// current user.
+func (s service) Import(ctx context.Context, rows RowReader, options ImportOptions) (ImportReport, error) {
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultImportBatchSize
+	}
+	if batchSize > MaxImportBatchSize {
+		batchSize = MaxImportBatchSize
+	}
+	report := ImportReport{DryRun: options.DryRun, Errors: []ImportError{}}
+	batch := make([]entity.Character, 0, batchSize)
+	flush := func() error {
+		if options.DryRun || len(batch) == 0 {
+			batch = batch[:0]
+			return nil
+		}
+		revisions := make([]entity.CharacterRevision, len(batch))
+		for i := range batch {
+			revisions[i] = newRevision(ctx, entity.ActionCreate, nil, &batch[i])
+		}
+		err := s.transactional(ctx, func(ctx context.Context) error {
+			if err := s.repo.CreateBatch(ctx, batch); err != nil {
+				return err
+			}
+			return s.recordAll(ctx, revisions)
+		})
+		if err != nil {
+			return err
+		}
+		report.Imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	// character types are looked up once per import
+	types := map[int64]charactertype.CharacterType{}
+	typeErrors := map[int64]error{}
+	for {
+		row, err := rows.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return report, err
+		}
+		report.Rows++
+
+		character, err := s.importRow(ctx, row, types, typeErrors)
+		if errs, ok := err.(validation.Errors); ok {
+			report.Failed++
+			if len(report.Errors) < MaxImportErrors {
+				report.Errors = append(report.Errors, ImportError{row.Line, errs})
+			}
+			continue
+		} else if err != nil {
+			return report, err
+		}
+		report.Valid++
+		if batch = append(batch, character); len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return report, err
+	}
+	s.logger.With(ctx).Infof("imported %v of %v characters (dry run: %v)", report.Imported, report.Rows, options.DryRun)
+	return report, nil
+}
+
+// importRow validates and values an import row, using and filling the given caches of character types.
+func (s service) importRow(ctx context.Context, row ImportRow, types map[int64]charactertype.CharacterType, typeErrors map[int64]error) (entity.Character, error) {
+	if row.Err != nil {
+		return entity.Character{}, row.Err
+	}
+	if err := row.Request.Validate(); err != nil {
+		return entity.Character{}, err
+	}
+	code := row.Request.CharacterCode
+	if err, ok := typeErrors[code]; ok {
+		return entity.Character{}, err
+	}
+	characterType, ok := types[code]
+	if !ok {
+		var err error
+		if characterType, err = s.creatableType(ctx, code); err != nil {
+			if _, ok := err.(validation.Errors); ok {
+				typeErrors[code] = err
+			}
+			return entity.Character{}, err
+		}
+		types[code] = characterType
+	}
+	return s.newCharacter(ctx, row.Request, characterType)
+}
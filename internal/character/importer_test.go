@@ -0,0 +1,82 @@
+package character
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+// readRows reads all rows from the given reader.
+func readRows(t *testing.T, reader RowReader) []ImportRow {
+	var rows []ImportRow
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows
+		}
+		if !assert.Nil(t, err) {
+			return rows
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestNewRowReader_CSV(t *testing.T) {
+	data := "Character_Power, name,character_code,notes,attributes\n" +
+		"100,Gandalf,1,grey,\"{\"\"mana\"\":40}\"\n" +
+		",\"Baggins, Frodo\",3,,\n" +
+		"x,Sam,y,,[1]\n" +
+		"1,Merry\n"
+	reader, err := NewRowReader(strings.NewReader(data), FormatCSV)
+	if !assert.Nil(t, err) {
+		return
+	}
+	rows := readRows(t, reader)
+	if assert.Equal(t, 4, len(rows)) {
+		assert.Equal(t, ImportRow{Line: 2, Request: CreateCharacterRequest{Name: "Gandalf", CharacterCode: 1, CharacterPower: 100, Attributes: entity.Attributes{"mana": json.Number("40")}}}, rows[0])
+		assert.Equal(t, ImportRow{Line: 3, Request: CreateCharacterRequest{Name: "Baggins, Frodo", CharacterCode: 3}}, rows[1])
+		assert.Equal(t, 4, rows[2].Line)
+		assert.Equal(t, "attributes: must be a JSON object; character_code: must be an integer; character_power: must be an integer.", rows[2].Err.Error())
+		assert.Equal(t, 5, rows[3].Line)
+		assert.Equal(t, "record: must have as many fields as the header.", rows[3].Err.Error())
+	}
+
+	_, err = NewRowReader(strings.NewReader(""), FormatCSV)
+	assert.Equal(t, "header: is missing.", err.Error())
+	_, err = NewRowReader(strings.NewReader("name,power\n"), FormatCSV)
+	assert.Equal(t, "header: must contain the column character_code.", err.Error())
+	_, err = NewRowReader(strings.NewReader("name"), "xml")
+	assert.Equal(t, "format: must be csv or ndjson.", err.Error())
+}
+
+func TestNewRowReader_NDJSON(t *testing.T) {
+	data := `{"name":"Gandalf","character_code":1,"character_power":100}` + "\n" +
+		"\n" +
+		`{"name":"Sam","character_code":"three"}` + "\n" +
+		`{"name":"Merry","character_code":3,"level":2}` + "\n" +
+		`{"name":"Pippin"} {}` + "\n" +
+		`not json`
+	reader, err := NewRowReader(strings.NewReader(data), FormatNDJSON)
+	if !assert.Nil(t, err) {
+		return
+	}
+	rows := readRows(t, reader)
+	if assert.Equal(t, 5, len(rows)) {
+		assert.Equal(t, ImportRow{Line: 1, Request: CreateCharacterRequest{Name: "Gandalf", CharacterCode: 1, CharacterPower: 100}}, rows[0])
+		assert.Equal(t, 3, rows[1].Line)
+		assert.Equal(t, "character_code: has the wrong type.", rows[1].Err.Error())
+		assert.Equal(t, 4, rows[2].Line)
+		assert.NotNil(t, rows[2].Err)
+		assert.NotNil(t, rows[3].Err)
+		assert.Equal(t, 6, rows[4].Line)
+		assert.NotNil(t, rows[4].Err)
+	}
+
+	reader, _ = NewRowReader(strings.NewReader(strings.Repeat("x", MaxImportLineSize+1)), FormatNDJSON)
+	_, err = reader.Read()
+	assert.NotNil(t, err)
+}
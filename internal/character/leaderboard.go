@@ -0,0 +1,72 @@
+package character
+
+import (
+	"context"
+	"database/sql"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+)
+
+// Leaderboard sizes
+const (
+	// DefaultLeaderboardTop is the number of characters listed by a leaderboard unless specified otherwise.
+	DefaultLeaderboardTop = 10
+	// MaxLeaderboardTop is the maximum number of characters listed by a leaderboard.
+	MaxLeaderboardTop = 100
+	// DefaultLeaderboardWindow is the number of characters listed on each side of the character that a leaderboard
+	// is centered on, unless specified otherwise.
+	DefaultLeaderboardWindow = 5
+	// MaxLeaderboardWindow is the maximum number of characters listed on each side of the character that a
+	// leaderboard is centered on.
+	MaxLeaderboardWindow = 50
+)
+
+// RankedCharacter represents a character with its rank on a leaderboard.
+type RankedCharacter struct {
+	entity.Character
+	// Rank is the position of the character on the leaderboard. Characters tied on value, power and creation time
+	// share the same rank, and the next rank is skipped.
+	Rank int64 `json:"rank"`
+}
+
+// LeaderboardRequest represents a request for a part of a leaderboard.
+type LeaderboardRequest struct {
+	// Filter restricts the leaderboard to the characters satisfying it, such as those of some types.
+	Filter Filter `json:"-"`
+	// Top is the number of characters listed from the top of the leaderboard. It is ignored if Around is set.
+	Top int `json:"top"`
+	// Around is the ID of the character that the listed part of the leaderboard is centered on.
+	Around string `json:"around"`
+	// Window is the number of characters listed before and after the character given by Around.
+	Window int `json:"window"`
+}
+
+// Validate validates the LeaderboardRequest fields.
+func (m LeaderboardRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Top, validation.When(m.Around == "", validation.Required, validation.Min(1), validation.Max(MaxLeaderboardTop))),
+		validation.Field(&m.Window, validation.Min(0), validation.Max(MaxLeaderboardWindow)),
+	)
+}
+
+// Leaderboard returns a part of the ranking of the characters by value, with ties broken by power and then by
+// creation time: either the top of the ranking, or the characters around a given character.
+// sql.ErrNoRows is returned if the character to center on is not on the leaderboard.
+func (s service) Leaderboard(ctx context.Context, req LeaderboardRequest) ([]RankedCharacter, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	size := req.Top
+	if req.Around != "" {
+		size = req.Window
+	}
+	characters, err := s.repo.Rank(ctx, req.Filter, req.Around, size)
+	if err != nil {
+		return nil, err
+	}
+	if req.Around != "" && len(characters) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return characters, nil
+}
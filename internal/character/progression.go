@@ -0,0 +1,159 @@
+package character
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"sort"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+)
+
+// MaxExperienceGrant is the maximum number of experience points granted at once.
+const MaxExperienceGrant = 1000000
+
+// MaxExperience is the maximum number of experience points of a character, bounded by the bigint column.
+const MaxExperience = math.MaxInt64
+
+// LevelCurve lists the total experience points required to reach each level, starting with level 2.
+// The thresholds must be positive and strictly increasing. Characters start at level 1 and stop leveling up at the
+// last level of the curve, although they keep gaining experience.
+type LevelCurve []int64
+
+// DefaultLevelCurve returns the level curve used unless configured otherwise: reaching level n requires
+// 50 * n * (n - 1) experience points, up to level 50.
+func DefaultLevelCurve() LevelCurve {
+	curve := LevelCurve{}
+	for level := int64(2); level <= 50; level++ {
+		curve = append(curve, 50*level*(level-1))
+	}
+	return curve
+}
+
+// Level returns the level reached with the given experience points.
+func (c LevelCurve) Level(experience int64) int64 {
+	return int64(sort.Search(len(c), func(i int) bool { return c[i] > experience })) + 1
+}
+
+// Growth describes how the power of a character grows each time it levels up: by Percent percent of its power,
+// truncated toward zero, plus Flat.
+type Growth struct {
+	Percent int64
+	Flat    int64
+}
+
+// Grow returns the power that a character with the given power has after leveling up once.
+func (g Growth) Grow(power int64) (int64, error) {
+	increase, err := scale(power, g.Percent)
+	if err != nil {
+		return 0, err
+	}
+	if increase, err = add(increase, g.Flat); err != nil {
+		return 0, err
+	}
+	return add(power, increase)
+}
+
+// Progression holds the rules by which characters gain levels and power.
+type Progression struct {
+	// Curve gives the level reached with some experience points.
+	Curve LevelCurve
+	// Growth holds the power growth rules indexed by character code. Characters of types without a rule level up
+	// without gaining power.
+	Growth map[int64]Growth
+}
+
+// DefaultProgression returns the default level curve and the growth rules of the built-in character types.
+func DefaultProgression() Progression {
+	return Progression{
+		Curve: DefaultLevelCurve(),
+		Growth: map[int64]Growth{
+			Wizard: {Percent: 10, Flat: 5},
+			Elf:    {Percent: 5, Flat: 8},
+			Hobbit: {Flat: 3},
+		},
+	}
+}
+
+// levelUp returns the power of a character of the given type and power after it goes from one level to a higher one.
+func (p Progression) levelUp(code, power, from, to int64) (int64, error) {
+	growth := p.Growth[code]
+	for level := from; level < to; level++ {
+		var err error
+		if power, err = growth.Grow(power); err != nil {
+			return 0, err
+		}
+	}
+	return power, nil
+}
+
+// GrantExperienceRequest represents a grant of experience points to a character.
+type GrantExperienceRequest struct {
+	Amount int64 `json:"amount"`
+}
+
+// Validate validates the GrantExperienceRequest fields.
+func (m GrantExperienceRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Amount, validation.Required, validation.Min(int64(1)), validation.Max(int64(MaxExperienceGrant))),
+	)
+}
+
+// GrantExperience adds experience points to the character with the specified ID. When the character crosses
+// thresholds of the level curve, it levels up: its power grows by the rule of its type for each level gained and its
+// value is recomputed with the current valuation of its type.
+// Only the owner can grant experience to a character. Concurrent grants do not conflict: they are applied one after
+// another, so none is lost and each level up happens once.
+func (s service) GrantExperience(ctx context.Context, id string, req GrantExperienceRequest) (Character, error) {
+	if err := req.Validate(); err != nil {
+		return Character{}, err
+	}
+
+	var character Character
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		// the character stays locked by the increment until the transaction ends
+		character.Character, err = s.repo.AddExperience(ctx, id, req.Amount)
+		if err == sql.ErrNoRows {
+			// the increment skips the characters that it would take past MaxExperience
+			if character.Character, err = s.repo.Get(ctx, id); err != nil {
+				return err
+			}
+			if !isOwner(ctx, character.Character) {
+				return ErrNotOwner
+			}
+			return validation.Errors{
+				"amount": errors.New("would raise the character experience too high"),
+			}
+		} else if err != nil {
+			return err
+		}
+		if !isOwner(ctx, character.Character) {
+			return ErrNotOwner
+		}
+		before := character.Character
+		before.Experience -= req.Amount
+
+		if level := s.progression.Curve.Level(character.Experience); level > character.Level {
+			power, err := s.progression.levelUp(character.CharacterCode, character.CharacterPower, character.Level, level)
+			if err == ErrValueOverflow {
+				return validation.Errors{
+					"amount": errors.New("would raise the character power too high"),
+				}
+			} else if err != nil {
+				return err
+			}
+			characterType, err := s.types.Get(ctx, character.CharacterCode)
+			if err != nil {
+				return err
+			}
+			if err := s.setPower(ctx, &character.Character, characterType, power); err != nil {
+				return err
+			}
+			character.Level = level
+		}
+		return s.save(ctx, entity.ActionExperience, &character, before)
+	})
+	return character, err
+}
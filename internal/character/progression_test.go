@@ -0,0 +1,55 @@
+package character
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelCurve_Level(t *testing.T) {
+	curve := LevelCurve{100, 300, 600}
+	tests := []struct {
+		experience int64
+		want       int64
+	}{
+		{0, 1}, {99, 1}, {100, 2}, {299, 2}, {300, 3}, {600, 4}, {math.MaxInt64, 4},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, curve.Level(tt.experience), tt.experience)
+	}
+	assert.Equal(t, int64(1), LevelCurve{}.Level(1000))
+
+	curve = DefaultLevelCurve()
+	assert.Len(t, curve, 49)
+	assert.Equal(t, int64(100), curve[0])
+	assert.Equal(t, int64(300), curve[1])
+	assert.Equal(t, int64(50), curve.Level(math.MaxInt64))
+}
+
+func TestGrowth_Grow(t *testing.T) {
+	power, err := Growth{Percent: 10, Flat: 5}.Grow(100)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(115), power)
+	power, err = Growth{}.Grow(100)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), power)
+	_, err = Growth{Percent: 100}.Grow(math.MaxInt64/2 + 1)
+	assert.Equal(t, ErrValueOverflow, err)
+
+	progression := DefaultProgression()
+	power, err = progression.levelUp(Hobbit, 10, 1, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(19), power)
+	power, err = progression.levelUp(9, 10, 1, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), power)
+}
+
+func TestGrantExperienceRequest_Validate(t *testing.T) {
+	assert.Nil(t, GrantExperienceRequest{Amount: 1}.Validate())
+	assert.Nil(t, GrantExperienceRequest{Amount: MaxExperienceGrant}.Validate())
+	assert.NotNil(t, GrantExperienceRequest{}.Validate())
+	assert.NotNil(t, GrantExperienceRequest{Amount: -1}.Validate())
+	assert.NotNil(t, GrantExperienceRequest{Amount: MaxExperienceGrant + 1}.Validate())
+}
@@ -2,80 +2,549 @@ package character
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
 	"github.com/hikvineh/go-rest-game-character/internal/entity"
 	"github.com/hikvineh/go-rest-game-character/pkg/dbcontext"
 	"github.com/hikvineh/go-rest-game-character/pkg/log"
 )
 
-// Repository encapsulates the logic to access albums from the data source.
+// Repository encapsulates the logic to access characters from the data source.
+// Deleted characters are kept in the trash until they are purged, and are ignored by all methods except
+// CountDeleted, QueryDeleted, Restore and Purge.
 type Repository interface {
-	// Get returns the album with the specified album ID.
+	// Get returns the character with the specified ID.
 	Get(ctx context.Context, id string) (entity.Character, error)
-	// Count returns the number of albums.
-	Count(ctx context.Context) (int, error)
-	// Query returns the list of albums with the given offset and limit.
-	Query(ctx context.Context, offset, limit int) ([]entity.Character, error)
-	// Create saves a new album in the storage.
-	Create(ctx context.Context, album entity.Character) error
-	// Update updates the album with given ID in the storage.
-	Update(ctx context.Context, album entity.Character) error
-	// Delete removes the album with given ID from the storage.
-	Delete(ctx context.Context, id string) error
-}
-
-// repository persists albums in database
+	// Count returns the number of characters satisfying the given filter.
+	Count(ctx context.Context, filter Filter) (int, error)
+	// Query returns the list of characters satisfying the given filter, in the given order, with the given offset and limit.
+	Query(ctx context.Context, filter Filter, sort Sort, offset, limit int) ([]entity.Character, error)
+	// QueryAfter returns at most limit characters satisfying the given filter which come strictly after the given
+	// sort column values in the given order. A nil keys starts from the beginning.
+	QueryAfter(ctx context.Context, filter Filter, sort Sort, keys []interface{}, limit int) ([]entity.Character, error)
+	// Each calls fn for every character satisfying the given filter, in the given order, and stops at the first
+	// error returned by fn. The characters are read one at a time instead of being loaded all at once.
+	Each(ctx context.Context, filter Filter, sort Sort, fn func(entity.Character) error) error
+	// Rank returns characters satisfying the given filter ranked by value, power and creation time. If around is
+	// empty, the first size characters of the ranking are returned. Otherwise the character with that ID is returned
+	// along with size characters on each side, or nothing if it does not satisfy the filter.
+	Rank(ctx context.Context, filter Filter, around string, size int) ([]RankedCharacter, error)
+	// Stats returns the statistics of the characters satisfying the given filter for each character type.
+	Stats(ctx context.Context, filter Filter) ([]TypeStats, error)
+	// Create saves a new character in the storage.
+	Create(ctx context.Context, character entity.Character) error
+	// CreateBatch saves several new characters in the storage at once.
+	CreateBatch(ctx context.Context, characters []entity.Character) error
+	// Update updates the character with given ID in the storage if it is still at the version of the given character.
+	// The stored version is incremented. ErrVersionConflict is returned if the character has been changed meanwhile.
+	Update(ctx context.Context, character entity.Character) error
+	// AddExperience adds experience points to the character with the given ID and returns the character.
+	// The character stays locked until the end of the transaction, so that concurrent writes wait for it.
+	// sql.ErrNoRows is returned if the character is not found or its experience would exceed MaxExperience.
+	AddExperience(ctx context.Context, id string, amount int64) (entity.Character, error)
+	// Delete moves the character with given ID to the trash if it is at the given version, or at any version
+	// if the version is AnyVersion. ErrVersionConflict is returned if the character is at a different version.
+	Delete(ctx context.Context, id string, version int64) error
+	// GetDeleted returns the character in the trash with the specified ID.
+	GetDeleted(ctx context.Context, id string) (entity.Character, error)
+	// CountDeleted returns the number of characters in the trash.
+	CountDeleted(ctx context.Context) (int, error)
+	// QueryDeleted returns the characters in the trash, most recently deleted first, with the given offset and limit.
+	QueryDeleted(ctx context.Context, offset, limit int) ([]entity.Character, error)
+	// Restore moves the character with the given ID out of the trash.
+	Restore(ctx context.Context, id string) error
+	// Purge permanently removes the characters deleted before the given time and returns their number.
+	// Their revisions are kept.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	// CreateRevisions saves the given character revisions in the storage.
+	CreateRevisions(ctx context.Context, revisions []entity.CharacterRevision) error
+	// CountRevisions returns the number of revisions of the character with the given ID.
+	CountRevisions(ctx context.Context, characterID string) (int, error)
+	// QueryRevisions returns the revisions of the character with the given ID, latest first, with the given offset
+	// and limit.
+	QueryRevisions(ctx context.Context, characterID string, offset, limit int) ([]entity.CharacterRevision, error)
+	// GetRevision returns the given revision of the character with the given ID.
+	GetRevision(ctx context.Context, characterID string, revision int64) (entity.CharacterRevision, error)
+	// GetRevisionAt returns the latest revision of the character with the given ID made at or before the given time.
+	GetRevisionAt(ctx context.Context, characterID string, at time.Time) (entity.CharacterRevision, error)
+	// GetFirstRevision returns the earliest revision of the character with the given ID.
+	GetFirstRevision(ctx context.Context, characterID string) (entity.CharacterRevision, error)
+}
+
+// notDeleted selects the characters that are not in the trash.
+var notDeleted = dbx.HashExp{"deleted_at": nil}
+
+// AnyVersion matches every version of a character when used as the expected version of a write.
+const AnyVersion int64 = 0
+
+// repository persists characters in database
 type repository struct {
 	db     *dbcontext.DB
 	logger log.Logger
 }
 
-// NewRepository creates a new album repository
+// NewRepository creates a new character repository
 func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
 	return repository{db, logger}
 }
 
-// Get reads the album with the specified ID from the database.
+// Get reads the character with the specified ID from the database.
 func (r repository) Get(ctx context.Context, id string) (entity.Character, error) {
 	var character entity.Character
-	err := r.db.With(ctx).Select().Model(id, &character)
+	err := r.db.With(ctx).Select().Where(notDeleted).Model(id, &character)
 	return character, err
 }
 
-// Create saves a new album record in the database.
-// It returns the ID of the newly inserted album record.
+// Create saves a new character record in the database.
+// It returns the ID of the newly inserted character record.
 func (r repository) Create(ctx context.Context, character entity.Character) error {
 	return r.db.With(ctx).Model(&character).Insert()
 }
 
-// Update saves the changes to an album in the database.
+// CreateBatch saves several new character records in the database with a single statement.
+func (r repository) CreateBatch(ctx context.Context, characters []entity.Character) error {
+	rows := make([][]interface{}, len(characters))
+	for i, c := range characters {
+		rows[i] = []interface{}{c.ID, c.Name, c.CharacterCode, c.CharacterPower, c.EffectivePower, c.CharacterValue,
+			c.FormulaVersion, c.Experience, c.Level, c.Attributes, c.Version, c.OwnerID, c.CreatedAt, c.UpdatedAt}
+	}
+	return r.insertRows(ctx, "character", []string{"id", "name", "character_code", "character_power",
+		"effective_power", "character_value", "formula_version", "experience", "level", "attributes", "version", "owner_id",
+		"created_at", "updated_at"}, rows)
+}
+
+// insertRows inserts several rows into the given table with a single statement.
+func (r repository) insertRows(ctx context.Context, table string, columns []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	params := dbx.Params{}
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		placeholders := make([]string, len(row))
+		for j, value := range row {
+			name := fmt.Sprintf("r%v_%v", i, j)
+			params[name] = value
+			placeholders[j] = "{:" + name + "}"
+		}
+		values[i] = "(" + strings.Join(placeholders, ", ") + ")"
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = "[[" + column + "]]"
+	}
+	sql := fmt.Sprintf("INSERT INTO {{%v}} (%v) VALUES %v", table, strings.Join(quoted, ", "), strings.Join(values, ", "))
+	_, err := r.db.With(ctx).NewQuery(sql).Bind(params).Execute()
+	return err
+}
+
+// Update saves the changes to a character in the database.
+// The row is only changed if its version still matches, which makes concurrent updates detectable.
 func (r repository) Update(ctx context.Context, character entity.Character) error {
-	return r.db.With(ctx).Model(&character).Update()
+	result, err := r.db.With(ctx).Update("character", dbx.Params{
+		"name":            character.Name,
+		"character_code":  character.CharacterCode,
+		"character_power": character.CharacterPower,
+		"effective_power": character.EffectivePower,
+		"character_value": character.CharacterValue,
+		"formula_version": character.FormulaVersion,
+		"experience":      character.Experience,
+		"level":           character.Level,
+		"attributes":      character.Attributes,
+		"updated_at":      character.UpdatedAt,
+		"version":         dbx.NewExp("version + 1"),
+	}, dbx.HashExp{"id": character.ID, "version": character.Version, "deleted_at": nil}).Execute()
+	if err != nil {
+		return err
+	}
+	return r.checkAffected(ctx, character.ID, result)
+}
+
+// AddExperience increments the experience of the character record with the specified ID in the database and
+// returns the updated record. The row lock taken by the update is held until the end of the transaction.
+// A record whose experience would exceed MaxExperience is left unchanged, like a missing one.
+func (r repository) AddExperience(ctx context.Context, id string, amount int64) (entity.Character, error) {
+	var character entity.Character
+	err := r.db.With(ctx).
+		NewQuery("UPDATE {{character}} SET [[experience]] = [[experience]] + {:amount} " +
+			"WHERE [[id]] = {:id} AND [[deleted_at]] IS NULL AND [[experience]] <= {:limit} RETURNING *").
+		Bind(dbx.Params{"id": id, "amount": amount, "limit": int64(MaxExperience) - amount}).
+		One(&character)
+	return character, err
+}
+
+// Delete marks a character with the specified ID as deleted in the database.
+// The row is kept so that the character can be restored until it is purged.
+func (r repository) Delete(ctx context.Context, id string, version int64) error {
+	where := dbx.HashExp{"id": id, "deleted_at": nil}
+	if version != AnyVersion {
+		where["version"] = version
+	}
+	result, err := r.db.With(ctx).Update("character", dbx.Params{
+		"deleted_at": time.Now(),
+		"version":    dbx.NewExp("version + 1"),
+	}, where).Execute()
+	if err != nil {
+		return err
+	}
+	return r.checkAffected(ctx, id, result)
+}
+
+// checkAffected tells apart the reasons why a conditional write to a character did not affect any row.
+// It returns sql.ErrNoRows if the character does not exist and ErrVersionConflict if it is at another version.
+func (r repository) checkAffected(ctx context.Context, id string, result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil || n > 0 {
+		return err
+	}
+	if _, err := r.Get(ctx, id); err != nil {
+		return err
+	}
+	return ErrVersionConflict
+}
+
+// GetDeleted reads the character marked as deleted with the specified ID from the database.
+func (r repository) GetDeleted(ctx context.Context, id string) (entity.Character, error) {
+	var character entity.Character
+	err := r.db.With(ctx).Select().Where(dbx.Not(notDeleted)).Model(id, &character)
+	return character, err
+}
+
+// CountDeleted returns the number of the character records marked as deleted in the database.
+func (r repository) CountDeleted(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("character").Where(dbx.Not(notDeleted)).Row(&count)
+	return count, err
+}
+
+// QueryDeleted retrieves the character records marked as deleted, most recently deleted first, with the specified
+// offset and limit from the database.
+func (r repository) QueryDeleted(ctx context.Context, offset, limit int) ([]entity.Character, error) {
+	var characters []entity.Character
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.Not(notDeleted)).
+		OrderBy("deleted_at DESC", "id ASC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&characters)
+	return characters, err
 }
 
-// Delete deletes an album with the specified ID from the database.
-func (r repository) Delete(ctx context.Context, id string) error {
-	character, err := r.Get(ctx, id)
+// Restore clears the deletion mark of the character record with the specified ID in the database.
+// It returns sql.ErrNoRows if there is no such deleted character.
+func (r repository) Restore(ctx context.Context, id string) error {
+	result, err := r.db.With(ctx).Update("character", dbx.Params{
+		"deleted_at": nil,
+		"version":    dbx.NewExp("version + 1"),
+	}, dbx.And(dbx.HashExp{"id": id}, dbx.Not(notDeleted))).Execute()
 	if err != nil {
 		return err
 	}
-	return r.db.With(ctx).Model(&character).Delete()
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Purge deletes the character records marked as deleted before the given time from the database.
+func (r repository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.With(ctx).Delete("character",
+		dbx.NewExp("deleted_at < {:before}", dbx.Params{"before": before}),
+	).Execute()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CreateRevisions saves the given character revision records in the database with a single statement.
+func (r repository) CreateRevisions(ctx context.Context, revisions []entity.CharacterRevision) error {
+	rows := make([][]interface{}, len(revisions))
+	for i, rev := range revisions {
+		// nil snapshots are passed untyped so that they are stored as NULL
+		var before, after interface{}
+		if rev.Before != nil {
+			before = *rev.Before
+		}
+		if rev.After != nil {
+			after = *rev.After
+		}
+		rows[i] = []interface{}{rev.ID, rev.CharacterID, rev.Revision, rev.Action, before, after, rev.UserID,
+			rev.UserName, rev.RequestID, rev.CreatedAt}
+	}
+	return r.insertRows(ctx, "character_revision", []string{"id", "character_id", "revision", "action", "before",
+		"after", "user_id", "user_name", "request_id", "created_at"}, rows)
+}
+
+// CountRevisions returns the number of the revision records of the character with the given ID in the database.
+func (r repository) CountRevisions(ctx context.Context, characterID string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("character_revision").
+		Where(dbx.HashExp{"character_id": characterID}).Row(&count)
+	return count, err
+}
+
+// QueryRevisions retrieves the revision records of the character with the given ID, latest first, with the
+// specified offset and limit from the database.
+func (r repository) QueryRevisions(ctx context.Context, characterID string, offset, limit int) ([]entity.CharacterRevision, error) {
+	var revisions []entity.CharacterRevision
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"character_id": characterID}).
+		OrderBy("revision DESC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&revisions)
+	return revisions, err
+}
+
+// GetRevision reads the given revision record of the character with the given ID from the database.
+func (r repository) GetRevision(ctx context.Context, characterID string, revision int64) (entity.CharacterRevision, error) {
+	var rev entity.CharacterRevision
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"character_id": characterID, "revision": revision}).
+		One(&rev)
+	return rev, err
+}
+
+// GetRevisionAt reads the latest revision record of the character with the given ID created at or before the given
+// time from the database.
+func (r repository) GetRevisionAt(ctx context.Context, characterID string, at time.Time) (entity.CharacterRevision, error) {
+	var rev entity.CharacterRevision
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"character_id": characterID}).
+		AndWhere(dbx.NewExp("created_at <= {:at}", dbx.Params{"at": at})).
+		OrderBy("revision DESC").
+		Limit(1).
+		One(&rev)
+	return rev, err
+}
+
+// GetFirstRevision reads the earliest revision record of the character with the given ID from the database.
+func (r repository) GetFirstRevision(ctx context.Context, characterID string) (entity.CharacterRevision, error) {
+	var rev entity.CharacterRevision
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"character_id": characterID}).
+		OrderBy("revision ASC").
+		Limit(1).
+		One(&rev)
+	return rev, err
 }
 
-// Count returns the number of the album records in the database.
-func (r repository) Count(ctx context.Context) (int, error) {
+// Count returns the number of the character records satisfying the given filter in the database.
+func (r repository) Count(ctx context.Context, filter Filter) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("character").Row(&count)
+	err := r.db.With(ctx).Select("COUNT(*)").From("character").Where(filterExp(filter)).AndWhere(notDeleted).Row(&count)
 	return count, err
 }
 
-// Query retrieves the album records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Character, error) {
+// Query retrieves the character records satisfying the given filter, in the given order, with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, filter Filter, sort Sort, offset, limit int) ([]entity.Character, error) {
 	var characters []entity.Character
 	err := r.db.With(ctx).
 		Select().
-		OrderBy("id").
+		Where(filterExp(filter)).
+		AndWhere(notDeleted).
+		OrderBy(sort.OrderBy()...).
 		Offset(int64(offset)).
 		Limit(int64(limit)).
 		All(&characters)
 	return characters, err
 }
+
+// QueryAfter retrieves the character records satisfying the given filter which follow the given sort column values
+// in the given order. It seeks with a WHERE condition instead of an OFFSET, so it is stable under concurrent inserts.
+func (r repository) QueryAfter(ctx context.Context, filter Filter, sort Sort, keys []interface{}, limit int) ([]entity.Character, error) {
+	var characters []entity.Character
+	q := r.db.With(ctx).
+		Select().
+		Where(filterExp(filter)).
+		AndWhere(notDeleted)
+	if keys != nil {
+		q = q.AndWhere(keysetExp(sort, keys))
+	}
+	err := q.OrderBy(sort.OrderBy()...).
+		Limit(int64(limit)).
+		All(&characters)
+	return characters, err
+}
+
+// Each iterates over the character records satisfying the given filter, in the given order, with a database cursor.
+// Only the current row is held in memory, and all rows come from a single query, so they are consistent.
+func (r repository) Each(ctx context.Context, filter Filter, sort Sort, fn func(entity.Character) error) error {
+	rows, err := r.db.With(ctx).
+		Select().
+		From("character").
+		Where(filterExp(filter)).
+		AndWhere(notDeleted).
+		OrderBy(sort.OrderBy()...).
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var character entity.Character
+		if err := rows.ScanStruct(&character); err != nil {
+			return err
+		}
+		if err := fn(character); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// rankOrder is the order of the characters on a leaderboard. Characters tied on all columns share the same rank.
+const rankOrder = "character_value DESC, character_power DESC, created_at ASC"
+
+// Rank ranks the character records satisfying the given filter in the database with window functions, and retrieves
+// either the top of the ranking or the records within size positions of the record with the given ID.
+func (r repository) Rank(ctx context.Context, filter Filter, around string, size int) ([]RankedCharacter, error) {
+	params := dbx.Params{}
+	where := dbx.And(filterExp(filter), notDeleted).Build(r.db.DB(), params)
+	window := "[[position]] <= {:size}"
+	if around != "" {
+		params["around"] = around
+		window = "[[position]] BETWEEN (SELECT [[position]] FROM ranked WHERE [[id]] = {:around}) - {:size} " +
+			"AND (SELECT [[position]] FROM ranked WHERE [[id]] = {:around}) + {:size}"
+	}
+	params["size"] = size
+	sql := fmt.Sprintf(`WITH ranked AS (
+	SELECT *,
+		RANK() OVER (ORDER BY %[1]v) AS [[rank]],
+		ROW_NUMBER() OVER (ORDER BY %[1]v, id ASC) AS [[position]]
+	FROM {{character}}
+	WHERE %[2]v
+)
+SELECT * FROM ranked WHERE %[3]v ORDER BY [[position]]`, rankOrder, where, window)
+
+	var characters []RankedCharacter
+	err := r.db.With(ctx).NewQuery(sql).Bind(params).All(&characters)
+	return characters, err
+}
+
+// Stats aggregates the character records satisfying the given filter by character code in the database.
+// The columns are named after the fields of TypeStats so that they are scanned into its nested structs.
+func (r repository) Stats(ctx context.Context, filter Filter) ([]TypeStats, error) {
+	columns := []string{"character_code", "COUNT(*) AS count"}
+	for _, field := range []string{"character_power", "character_value"} {
+		columns = append(columns,
+			fmt.Sprintf(`SUM(%[1]v) AS "%[1]v.sum"`, field),
+			fmt.Sprintf(`AVG(%[1]v) AS "%[1]v.avg"`, field),
+			fmt.Sprintf(`MIN(%[1]v) AS "%[1]v.min"`, field),
+			fmt.Sprintf(`MAX(%[1]v) AS "%[1]v.max"`, field),
+			fmt.Sprintf(`PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY %[1]v) AS "%[1]v.p50"`, field),
+			fmt.Sprintf(`PERCENTILE_CONT(0.9) WITHIN GROUP (ORDER BY %[1]v) AS "%[1]v.p90"`, field),
+			fmt.Sprintf(`PERCENTILE_CONT(0.99) WITHIN GROUP (ORDER BY %[1]v) AS "%[1]v.p99"`, field),
+		)
+	}
+	var stats []TypeStats
+	err := r.db.With(ctx).
+		Select(columns...).
+		From("character").
+		Where(filterExp(filter)).
+		AndWhere(notDeleted).
+		GroupBy("character_code").
+		OrderBy("character_code").
+		All(&stats)
+	return stats, err
+}
+
+// keysetExp builds the condition selecting the rows that come strictly after the given sort column values.
+// For a sort (a, b DESC, id) it is: a > :a OR (a = :a AND b < :b) OR (a = :a AND b = :b AND id > :id).
+func keysetExp(sort Sort, keys []interface{}) dbx.Expression {
+	var exps []dbx.Expression
+	for i, field := range sort {
+		var and []dbx.Expression
+		for j := 0; j < i; j++ {
+			and = append(and, dbx.HashExp{sort[j].Column: keys[j]})
+		}
+		op := ">"
+		if field.Desc {
+			op = "<"
+		}
+		param := fmt.Sprintf("keyset%v", i)
+		and = append(and, dbx.NewExp(fmt.Sprintf("%v %v {:%v}", field.Column, op, param), dbx.Params{param: keys[i]}))
+		exps = append(exps, dbx.And(and...))
+	}
+	return dbx.Or(exps...)
+}
+
+// filterExp builds the WHERE condition selecting the characters that satisfy the given filter.
+func filterExp(filter Filter) dbx.Expression {
+	var exps []dbx.Expression
+	if len(filter.CharacterCodes) > 0 {
+		codes := make([]interface{}, len(filter.CharacterCodes))
+		for i, code := range filter.CharacterCodes {
+			codes[i] = code
+		}
+		exps = append(exps, dbx.In("character_code", codes...))
+	}
+	if filter.MinPower != nil {
+		exps = append(exps, dbx.NewExp("character_power >= {:min_power}", dbx.Params{"min_power": *filter.MinPower}))
+	}
+	if filter.MaxPower != nil {
+		exps = append(exps, dbx.NewExp("character_power <= {:max_power}", dbx.Params{"max_power": *filter.MaxPower}))
+	}
+	if filter.MinValue != nil {
+		exps = append(exps, dbx.NewExp("character_value >= {:min_value}", dbx.Params{"min_value": *filter.MinValue}))
+	}
+	if filter.MaxValue != nil {
+		exps = append(exps, dbx.NewExp("character_value <= {:max_value}", dbx.Params{"max_value": *filter.MaxValue}))
+	}
+	if filter.NamePrefix != "" {
+		exp := dbx.Like("name", filter.NamePrefix).Match(false, true)
+		exp.Like = "ILIKE"
+		exps = append(exps, exp)
+	}
+	if filter.NameContains != "" {
+		exp := dbx.Like("name", filter.NameContains)
+		exp.Like = "ILIKE"
+		exps = append(exps, exp)
+	}
+	if filter.CreatedAfter != nil {
+		exps = append(exps, dbx.NewExp("created_at >= {:created_after}", dbx.Params{"created_after": *filter.CreatedAfter}))
+	}
+	if filter.CreatedBefore != nil {
+		exps = append(exps, dbx.NewExp("created_at < {:created_before}", dbx.Params{"created_before": *filter.CreatedBefore}))
+	}
+	if filter.OwnerID != "" {
+		exps = append(exps, dbx.HashExp{"owner_id": filter.OwnerID})
+	}
+	for i, attribute := range filter.Attributes {
+		exps = append(exps, attributeExp(i, attribute)...)
+	}
+	return dbx.And(exps...)
+}
+
+// attributeExp returns the conditions of the given attribute filter. The index makes the parameter names unique
+// among the attribute filters. Range conditions only match numeric attributes.
+func attributeExp(index int, filter AttributeFilter) []dbx.Expression {
+	var exps []dbx.Expression
+	name := fmt.Sprintf("attr_%d", index)
+	number := fmt.Sprintf("CASE WHEN jsonb_typeof(attributes->{:%s}) = 'number' THEN (attributes->>{:%s})::numeric END", name, name)
+	if filter.Equals != nil {
+		exps = append(exps, dbx.NewExp(fmt.Sprintf("attributes->>{:%s} = {:%s_equals}", name, name),
+			dbx.Params{name: filter.Name, name + "_equals": *filter.Equals}))
+	}
+	if filter.Min != nil {
+		exps = append(exps, dbx.NewExp(fmt.Sprintf("%s >= {:%s_min}", number, name),
+			dbx.Params{name: filter.Name, name + "_min": *filter.Min}))
+	}
+	if filter.Max != nil {
+		exps = append(exps, dbx.NewExp(fmt.Sprintf("%s <= {:%s_max}", number, name),
+			dbx.Params{name: filter.Name, name + "_max": *filter.Max}))
+	}
+	return exps
+}
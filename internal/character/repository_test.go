@@ -3,9 +3,12 @@ package character
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"sync"
 	"testing"
 	"time"
 
+	dbx "github.com/go-ozzo/ozzo-dbx"
 	"github.com/hikvineh/go-rest-game-character/internal/entity"
 	"github.com/hikvineh/go-rest-game-character/internal/test"
 	"github.com/hikvineh/go-rest-game-character/pkg/log"
@@ -15,13 +18,13 @@ import (
 func TestRepository(t *testing.T) {
 	logger, _ := log.NewForTest()
 	db := test.DB(t)
-	test.ResetTables(t, db, "character")
+	test.ResetTables(t, db, "character", "character_revision")
 	repo := NewRepository(db, logger)
 
 	ctx := context.Background()
 
 	// initial count
-	count, err := repo.Count(ctx)
+	count, err := repo.Count(ctx, Filter{})
 	assert.Nil(t, err)
 
 	// create
@@ -31,11 +34,13 @@ func TestRepository(t *testing.T) {
 		CharacterCode:  1,
 		CharacterPower: 100,
 		CharacterValue: 150,
+		Version:        1,
+		OwnerID:        "100",
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	})
 	assert.Nil(t, err)
-	count2, _ := repo.Count(ctx)
+	count2, _ := repo.Count(ctx, Filter{})
 	assert.Equal(t, 1, count2-count)
 
 	// get
@@ -44,6 +49,7 @@ func TestRepository(t *testing.T) {
 	assert.Equal(t, "character1", character.Name)
 	assert.Equal(t, int64(100), character.CharacterPower)
 	assert.Equal(t, int64(150), character.CharacterValue)
+	assert.Equal(t, "100", character.OwnerID)
 
 	_, err = repo.Get(ctx, "test0")
 	assert.Equal(t, sql.ErrNoRows, err)
@@ -52,8 +58,12 @@ func TestRepository(t *testing.T) {
 	err = repo.Update(ctx, entity.Character{
 		ID:             "test1",
 		Name:           "character1 updated",
+		CharacterCode:  1,
 		CharacterPower: 10,
 		CharacterValue: 15,
+		Level:          2,
+		Attributes:     entity.Attributes{"mana": float64(500), "school": "fire"},
+		Version:        1,
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	})
@@ -62,17 +72,266 @@ func TestRepository(t *testing.T) {
 	assert.Equal(t, "character1 updated", character.Name)
 	assert.Equal(t, int64(10), character.CharacterPower)
 	assert.Equal(t, int64(15), character.CharacterValue)
+	assert.Equal(t, int64(2), character.Level)
+	assert.Equal(t, entity.Attributes{"mana": json.Number("500"), "school": "fire"}, character.Attributes)
+	assert.Equal(t, int64(2), character.Version)
+
+	// stale update
+	stale := character
+	stale.Version = 1
+	stale.Name = "stale"
+	assert.Equal(t, ErrVersionConflict, repo.Update(ctx, stale))
+	stale.ID = "test0"
+	assert.Equal(t, sql.ErrNoRows, repo.Update(ctx, stale))
+
+	// add experience, concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, db.Transactional(ctx, func(ctx context.Context) error {
+				_, err := repo.AddExperience(ctx, "test1", 10)
+				return err
+			}))
+		}()
+	}
+	wg.Wait()
+	character, err = repo.AddExperience(ctx, "test1", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(60), character.Experience)
+	assert.Equal(t, int64(2), character.Version)
+	_, err = repo.AddExperience(ctx, "test0", 10)
+	assert.Equal(t, sql.ErrNoRows, err)
 
 	// query
-	characters, err := repo.Query(ctx, 0, count2)
+	characters, err := repo.Query(ctx, Filter{}, DefaultSort, 0, count2)
 	assert.Nil(t, err)
 	assert.Equal(t, count2, len(characters))
 
+	// filtered query
+	minPower, maxPower := int64(5), int64(10)
+	filter := Filter{CharacterCodes: []int64{1}, MinPower: &minPower, MaxPower: &maxPower, NamePrefix: "CHARACTER1"}
+	count3, err := repo.Count(ctx, filter)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count3)
+	characters, err = repo.Query(ctx, filter, Sort{{Column: "character_value", Desc: true}, {Column: "id"}}, 0, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(characters)) {
+		assert.Equal(t, "test1", characters[0].ID)
+	}
+	count3, _ = repo.Count(ctx, Filter{NameContains: "no such name"})
+	assert.Equal(t, 0, count3)
+
+	// attribute query
+	school, minMana, maxMana := "fire", float64(100), float64(499)
+	count3, err = repo.Count(ctx, Filter{Attributes: []AttributeFilter{{Name: "school", Equals: &school}, {Name: "mana", Min: &minMana}}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count3)
+	count3, _ = repo.Count(ctx, Filter{Attributes: []AttributeFilter{{Name: "mana", Max: &maxMana}}})
+	assert.Equal(t, 0, count3)
+	count3, _ = repo.Count(ctx, Filter{Attributes: []AttributeFilter{{Name: "school", Min: &minMana}}})
+	assert.Equal(t, 0, count3)
+
+	// keyset query
+	characters, err = repo.QueryAfter(ctx, Filter{}, DefaultSort, nil, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(characters))
+	characters, err = repo.QueryAfter(ctx, Filter{}, DefaultSort, []interface{}{"test0"}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(characters))
+	characters, err = repo.QueryAfter(ctx, Filter{}, DefaultSort, []interface{}{"test1"}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(characters))
+
 	// delete
-	err = repo.Delete(ctx, "test1")
+	deleted, _ := repo.CountDeleted(ctx)
+	err = repo.Delete(ctx, "test1", 1)
+	assert.Equal(t, ErrVersionConflict, err)
+	err = repo.Delete(ctx, "test1", 2)
 	assert.Nil(t, err)
 	_, err = repo.Get(ctx, "test1")
 	assert.Equal(t, sql.ErrNoRows, err)
-	err = repo.Delete(ctx, "test1")
+	err = repo.Delete(ctx, "test1", AnyVersion)
+	assert.Equal(t, sql.ErrNoRows, err)
+	count3, _ = repo.Count(ctx, Filter{})
+	assert.Equal(t, count, count3)
+
+	// trash
+	deleted2, err := repo.CountDeleted(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted2-deleted)
+	characters, err = repo.QueryDeleted(ctx, 0, 1)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(characters)) {
+		assert.Equal(t, "test1", characters[0].ID)
+		assert.NotNil(t, characters[0].DeletedAt)
+	}
+
+	// restore
+	character, err = repo.GetDeleted(ctx, "test1")
+	assert.Nil(t, err)
+	assert.Equal(t, "test1", character.ID)
+	err = repo.Restore(ctx, "test1")
+	assert.Nil(t, err)
+	character, err = repo.Get(ctx, "test1")
+	assert.Nil(t, err)
+	assert.Nil(t, character.DeletedAt)
+	assert.Equal(t, int64(4), character.Version)
+	_, err = repo.GetDeleted(ctx, "test1")
+	assert.Equal(t, sql.ErrNoRows, err)
+	err = repo.Restore(ctx, "test1")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// purge
+	err = repo.Delete(ctx, "test1", AnyVersion)
+	assert.Nil(t, err)
+	purged, err := repo.Purge(ctx, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), purged)
+	purged, err = repo.Purge(ctx, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.True(t, purged >= 1)
+	err = repo.Restore(ctx, "test1")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// create batch
+	err = repo.CreateBatch(ctx, []entity.Character{
+		{ID: "test2", Name: "character2", CharacterCode: 1, Version: 1, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+		{ID: "test3", Name: "character3", CharacterCode: 3, CharacterPower: 10, CharacterValue: 20, Version: 1, OwnerID: "100", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+	})
+	assert.Nil(t, err)
+	count3, _ = repo.Count(ctx, Filter{})
+	assert.Equal(t, 2, count3-count)
+	character, err = repo.Get(ctx, "test3")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), character.CharacterValue)
+	assert.Equal(t, "100", character.OwnerID)
+	assert.Nil(t, repo.CreateBatch(ctx, nil))
+
+	// revisions
+	before := entity.CharacterSnapshot(character)
+	err = repo.CreateRevisions(ctx, []entity.CharacterRevision{
+		{ID: "rev1", CharacterID: "test3", Revision: 1, Action: entity.ActionCreate, After: &before, UserID: "100", CreatedAt: time.Now()},
+		{ID: "rev2", CharacterID: "test3", Revision: 2, Action: entity.ActionDelete, Before: &before, UserID: "100", RequestID: "abc", CreatedAt: time.Now()},
+	})
+	assert.Nil(t, err)
+	err = repo.CreateRevisions(ctx, []entity.CharacterRevision{
+		{ID: "rev3", CharacterID: "test3", Revision: 2, Action: entity.ActionUpdate, CreatedAt: time.Now()},
+	})
+	assert.NotNil(t, err)
+	revisionCount, err := repo.CountRevisions(ctx, "test3")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, revisionCount)
+	revisions, err := repo.QueryRevisions(ctx, "test3", 0, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, revisions, 2) {
+		assert.Equal(t, "rev2", revisions[0].ID)
+		assert.Nil(t, revisions[0].After)
+		assert.Equal(t, "character3", revisions[0].Before.Name)
+		assert.Equal(t, "abc", revisions[0].RequestID)
+		assert.Nil(t, revisions[1].Before)
+	}
+	rev, err := repo.GetRevision(ctx, "test3", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "rev1", rev.ID)
+	_, err = repo.GetRevision(ctx, "test3", 3)
+	assert.Equal(t, sql.ErrNoRows, err)
+	rev, err = repo.GetRevisionAt(ctx, "test3", time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, "rev2", rev.ID)
+	_, err = repo.GetRevisionAt(ctx, "test3", time.Now().Add(-time.Hour))
+	assert.Equal(t, sql.ErrNoRows, err)
+	rev, err = repo.GetFirstRevision(ctx, "test3")
+	assert.Nil(t, err)
+	assert.Equal(t, "rev1", rev.ID)
+	_, err = repo.GetFirstRevision(ctx, "test1")
 	assert.Equal(t, sql.ErrNoRows, err)
+
+	// each
+	var names []string
+	err = repo.Each(ctx, Filter{OwnerID: "100"}, Sort{{Column: "name", Desc: true}, {Column: "id"}}, func(c entity.Character) error {
+		names = append(names, c.Name)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Contains(t, names, "character3")
+	assert.NotContains(t, names, "character2")
+	for i := 1; i < len(names); i++ {
+		assert.True(t, names[i-1] >= names[i])
+	}
+	err = repo.Each(ctx, Filter{}, DefaultSort, func(c entity.Character) error {
+		return sql.ErrTxDone
+	})
+	assert.Equal(t, sql.ErrTxDone, err)
+
+	// rank
+	ranked, err := repo.Rank(ctx, Filter{}, "", 100)
+	assert.Nil(t, err)
+	for i := 1; i < len(ranked); i++ {
+		assert.True(t, ranked[i-1].CharacterValue >= ranked[i].CharacterValue)
+		assert.True(t, ranked[i-1].Rank <= ranked[i].Rank)
+	}
+	ranked, err = repo.Rank(ctx, Filter{CharacterCodes: []int64{3}}, "test3", 0)
+	assert.Nil(t, err)
+	if assert.Len(t, ranked, 1) {
+		assert.Equal(t, "test3", ranked[0].ID)
+	}
+	ranked, err = repo.Rank(ctx, Filter{CharacterCodes: []int64{1}}, "test3", 10)
+	assert.Nil(t, err)
+	assert.Empty(t, ranked)
+
+	// stats
+	stats, err := repo.Stats(ctx, Filter{CharacterCodes: []int64{3}})
+	assert.Nil(t, err)
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, int64(3), stats[0].CharacterCode)
+		assert.True(t, stats[0].Count >= 1)
+		assert.True(t, stats[0].CharacterPower.Min <= stats[0].CharacterPower.Max)
+		assert.True(t, stats[0].CharacterValue.P50 <= stats[0].CharacterValue.P99)
+	}
+	stats, err = repo.Stats(ctx, Filter{NamePrefix: "no such character"})
+	assert.Nil(t, err)
+	assert.Empty(t, stats)
+	assert.Nil(t, repo.Delete(ctx, "test2", AnyVersion))
+	assert.Nil(t, repo.Delete(ctx, "test3", AnyVersion))
+	_, err = repo.Purge(ctx, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+}
+
+func Test_filterExp(t *testing.T) {
+	db := dbx.NewFromDB(nil, "postgres")
+	minPower, maxValue := int64(5), int64(50)
+	after := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	filter := Filter{
+		CharacterCodes: []int64{1, 3},
+		MinPower:       &minPower,
+		MaxValue:       &maxValue,
+		NamePrefix:     "Fro%",
+		CreatedAfter:   &after,
+	}
+	params := dbx.Params{}
+	sql := filterExp(filter).Build(db, params)
+	assert.Equal(t, `("character_code" IN ({:p0}, {:p1})) AND (character_power >= {:min_power}) AND (character_value <= {:max_value}) AND ("name" ILIKE {:p4}) AND (created_at >= {:created_after})`, sql)
+	assert.Equal(t, `Fro\%%`, params["p4"])
+
+	assert.Equal(t, "", filterExp(Filter{}).Build(db, dbx.Params{}))
+	assert.Equal(t, `"owner_id"={:p0}`, filterExp(Filter{OwnerID: "100"}).Build(db, dbx.Params{}))
+
+	school, min := "fire", float64(100)
+	params = dbx.Params{}
+	sql = filterExp(Filter{Attributes: []AttributeFilter{{Name: "school", Equals: &school}, {Name: "mana", Min: &min}}}).Build(db, params)
+	assert.Equal(t, `(attributes->>{:attr_0} = {:attr_0_equals}) AND (CASE WHEN jsonb_typeof(attributes->{:attr_1}) = 'number' THEN (attributes->>{:attr_1})::numeric END >= {:attr_1_min})`, sql)
+	assert.Equal(t, dbx.Params{"attr_0": "school", "attr_0_equals": "fire", "attr_1": "mana", "attr_1_min": float64(100)}, params)
+}
+
+func Test_keysetExp(t *testing.T) {
+	db := dbx.NewFromDB(nil, "postgres")
+	sort := Sort{{Column: "character_value", Desc: true}, {Column: "id"}}
+	params := dbx.Params{}
+	sql := keysetExp(sort, []interface{}{int64(20), "id1"}).Build(db, params)
+	assert.Equal(t, `(character_value < {:keyset0}) OR (("character_value"={:p1}) AND (id > {:keyset1}))`, sql)
+	assert.Equal(t, int64(20), params["keyset0"])
+	assert.Equal(t, int64(20), params["p1"])
+	assert.Equal(t, "id1", params["keyset1"])
 }
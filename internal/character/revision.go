@@ -0,0 +1,326 @@
+package character
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// Revision represents a recorded change of a character.
+type Revision struct {
+	entity.CharacterRevision
+}
+
+// newRevision builds the revision of a change of a character from before to after made by the current user.
+// Either side is nil when the character did not exist or was in the trash.
+func newRevision(ctx context.Context, action string, before, after *entity.Character) entity.CharacterRevision {
+	rev := entity.CharacterRevision{
+		ID:        entity.GenerateID(),
+		Action:    action,
+		RequestID: log.RequestID(ctx),
+		CreatedAt: time.Now(),
+	}
+	if before != nil {
+		snapshot := entity.CharacterSnapshot(*before)
+		rev.Before = &snapshot
+		rev.CharacterID, rev.Revision = before.ID, before.Version+1
+	}
+	if after != nil {
+		snapshot := entity.CharacterSnapshot(*after)
+		rev.After = &snapshot
+		rev.CharacterID, rev.Revision = after.ID, after.Version
+	}
+	if user := auth.CurrentUser(ctx); user != nil {
+		rev.UserID, rev.UserName = user.GetID(), user.GetName()
+	}
+	return rev
+}
+
+// Listener is notified of the changes of characters, e.g. to check them against other rules.
+type Listener interface {
+	// CharactersChanged is called with the revisions of the changes in the transaction recording them, which fails
+	// if an error is returned.
+	CharactersChanged(ctx context.Context, revisions []entity.CharacterRevision) error
+}
+
+// CombineListeners returns the listener notifying all the given ones in order, until one of them fails.
+func CombineListeners(listeners ...Listener) Listener {
+	return combinedListener(listeners)
+}
+
+type combinedListener []Listener
+
+// CharactersChanged notifies all the combined listeners of the given revisions.
+func (l combinedListener) CharactersChanged(ctx context.Context, revisions []entity.CharacterRevision) error {
+	for _, listener := range l {
+		if err := listener.CharactersChanged(ctx, revisions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record saves the revision of a change of a character. It must run in the transaction making the change.
+func (s service) record(ctx context.Context, action string, before, after *entity.Character) error {
+	return s.recordAll(ctx, []entity.CharacterRevision{newRevision(ctx, action, before, after)})
+}
+
+// recordAll saves the given revisions and notifies the listener of them. It must run in the transaction making the
+// changes.
+func (s service) recordAll(ctx context.Context, revisions []entity.CharacterRevision) error {
+	if err := s.repo.CreateRevisions(ctx, revisions); err != nil {
+		return err
+	}
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.CharactersChanged(ctx, revisions)
+}
+
+// CountRevisions returns the number of revisions of the character with the specified ID.
+// The history of a character in the trash can still be read, and sql.ErrNoRows is returned for unknown characters.
+func (s service) CountRevisions(ctx context.Context, id string) (int, error) {
+	count, err := s.repo.CountRevisions(ctx, id)
+	if err != nil || count > 0 {
+		return count, err
+	}
+	// characters created before revisions were recorded have no history
+	if _, err = s.repo.Get(ctx, id); err == sql.ErrNoRows {
+		_, err = s.repo.GetDeleted(ctx, id)
+	}
+	return 0, err
+}
+
+// QueryRevisions returns the revisions of the character with the specified ID, latest first, with the specified
+// offset and limit.
+func (s service) QueryRevisions(ctx context.Context, id string, offset, limit int) ([]Revision, error) {
+	items, err := s.repo.QueryRevisions(ctx, id, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Revision{}
+	for _, item := range items {
+		result = append(result, Revision{item})
+	}
+	return result, nil
+}
+
+// GetAsOf returns the character with the specified ID as it was at the given time, according to its revisions.
+// sql.ErrNoRows is returned if the character did not exist or was in the trash at that time, or if its state at
+// that time is unknown because it predates the revisions.
+func (s service) GetAsOf(ctx context.Context, id string, at time.Time) (Character, error) {
+	rev, err := s.repo.GetRevisionAt(ctx, id, at)
+	if err == nil {
+		if rev.After == nil {
+			return Character{}, sql.ErrNoRows
+		}
+		return Character{entity.Character(*rev.After)}, nil
+	}
+	if err != sql.ErrNoRows {
+		return Character{}, err
+	}
+
+	// before its first revision, the character was as that revision found it, or as it is now if it has none
+	var snapshot *entity.Character
+	if first, err := s.repo.GetFirstRevision(ctx, id); err == nil {
+		snapshot = (*entity.Character)(first.Before)
+	} else if err != sql.ErrNoRows {
+		return Character{}, err
+	} else if current, err := s.repo.Get(ctx, id); err == nil {
+		snapshot = &current
+	} else if err != sql.ErrNoRows {
+		return Character{}, err
+	}
+	if snapshot == nil || snapshot.DeletedAt != nil || snapshot.UpdatedAt.After(at) {
+		return Character{}, sql.ErrNoRows
+	}
+	return Character{*snapshot}, nil
+}
+
+// FieldChange describes how a field of a character differs between two revisions.
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// Diff lists the fields of a character that differ between two revisions.
+type Diff struct {
+	CharacterID string        `json:"character_id"`
+	From        int64         `json:"from"`
+	To          int64         `json:"to"`
+	Changes     []FieldChange `json:"changes"`
+}
+
+// bookkeepingFields lists the fields that change with every revision of a character, which are left out of diffs.
+var bookkeepingFields = map[string]bool{"version": true, "updated_at": true, "deleted_at": true}
+
+// Diff compares the character with the specified ID at two revisions, which are versions of the character.
+// A field missing on one side, such as on the side of a deletion, is compared to null. The bookkeeping fields are
+// not compared.
+// sql.ErrNoRows is returned if either revision is unknown.
+func (s service) Diff(ctx context.Context, id string, from, to int64) (Diff, error) {
+	diff := Diff{CharacterID: id, From: from, To: to, Changes: []FieldChange{}}
+	before, err := s.fieldsAt(ctx, id, from)
+	if err != nil {
+		return diff, err
+	}
+	after, err := s.fieldsAt(ctx, id, to)
+	if err != nil {
+		return diff, err
+	}
+
+	fields := map[string]bool{}
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+	for field := range fields {
+		if !bookkeepingFields[field] && !reflect.DeepEqual(before[field], after[field]) {
+			diff.Changes = append(diff.Changes, FieldChange{field, before[field], after[field]})
+		}
+	}
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		return diff.Changes[i].Field < diff.Changes[j].Field
+	})
+	return diff, nil
+}
+
+// snapshotAt returns the character with the specified ID at the given version, as recorded by the revision
+// creating that version or, failing that, by the revision following it. The result is nil if the character was in
+// the trash.
+func (s service) snapshotAt(ctx context.Context, id string, version int64) (*entity.CharacterSnapshot, error) {
+	rev, err := s.repo.GetRevision(ctx, id, version)
+	if err == nil {
+		return rev.After, nil
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+	if rev, err = s.repo.GetRevision(ctx, id, version+1); err != nil {
+		return nil, err
+	}
+	if rev.Before == nil {
+		return nil, sql.ErrNoRows
+	}
+	return rev.Before, nil
+}
+
+// fieldsAt returns the fields of the character with the specified ID at the given version, as found by snapshotAt.
+func (s service) fieldsAt(ctx context.Context, id string, version int64) (map[string]interface{}, error) {
+	snapshot, err := s.snapshotAt(ctx, id, version)
+	if err != nil || snapshot == nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// RevertCharacterRequest represents a request reverting a character to an earlier state.
+// Exactly one of Revision and AsOf must be given.
+type RevertCharacterRequest struct {
+	// Revision is the version of the character to revert to.
+	Revision int64 `json:"revision"`
+	// AsOf is the time at which the character was in the state to revert to.
+	AsOf *time.Time `json:"as_of"`
+}
+
+// Validate validates the RevertCharacterRequest fields.
+func (m RevertCharacterRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Revision, validation.Min(int64(0)),
+			validation.When(m.AsOf == nil, validation.Required.Error("either revision or as_of is required")),
+			validation.When(m.AsOf != nil, validation.In(int64(0)).Error("cannot be given with as_of"))),
+	)
+}
+
+// Revert restores the name, type, power and attributes of the character with the specified ID to those of an earlier revision
+// or time, and recomputes its value with the current valuation of its type. The revert is recorded as a new revision,
+// so it can itself be reverted.
+// Like Update, it is reserved to the owner and fails with ErrVersionConflict if the given version is stale.
+func (s service) Revert(ctx context.Context, id string, req RevertCharacterRequest, version int64) (Character, error) {
+	if err := req.Validate(); err != nil {
+		return Character{}, err
+	}
+
+	var character Character
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		if character, err = s.getWritable(ctx, id, version); err != nil {
+			return err
+		}
+		target, err := s.revertTarget(ctx, id, req)
+		if err != nil {
+			return err
+		}
+
+		characterType, err := s.types.Get(ctx, target.CharacterCode)
+		if target.CharacterCode != character.CharacterCode {
+			// changing the type is subject to the same rules as creating a character of that type
+			characterType, err = s.creatableType(ctx, target.CharacterCode)
+		}
+		if err != nil {
+			return err
+		}
+
+		before := character.Character
+		if err := s.setPower(ctx, &character.Character, characterType, target.CharacterPower); err != nil {
+			return err
+		}
+		if character.Attributes, err = validAttributes(characterType, target.Attributes); err != nil {
+			return err
+		}
+		character.Name = target.Name
+		character.CharacterCode = target.CharacterCode
+		return s.save(ctx, entity.ActionRevert, &character, before)
+	})
+	return character, err
+}
+
+// revertTarget returns the state of the character that a revert request refers to.
+// States in which the character was in the trash or did not exist cannot be reverted to.
+func (s service) revertTarget(ctx context.Context, id string, req RevertCharacterRequest) (entity.Character, error) {
+	if req.AsOf != nil {
+		// timestamps are stored without time zone in the local time of the server
+		character, err := s.GetAsOf(ctx, id, req.AsOf.Local())
+		if err == sql.ErrNoRows {
+			return entity.Character{}, validation.Errors{
+				"as_of": errors.New("must be a time at which the character existed and its history was recorded"),
+			}
+		}
+		return character.Character, err
+	}
+	snapshot, err := s.snapshotAt(ctx, id, req.Revision)
+	if err == nil && snapshot == nil {
+		return entity.Character{}, validation.Errors{
+			"revision": errors.New("refers to a deletion"),
+		}
+	} else if err == sql.ErrNoRows {
+		return entity.Character{}, validation.Errors{
+			"revision": errors.New("must be a recorded revision of the character"),
+		}
+	} else if err != nil {
+		return entity.Character{}, err
+	}
+	return entity.Character(*snapshot), nil
+}
@@ -2,24 +2,52 @@ package character
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/charactertype"
 	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/dbcontext"
+	"github.com/hikvineh/go-rest-game-character/pkg/expr"
 	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/hikvineh/go-rest-game-character/pkg/mergepatch"
+	"github.com/hikvineh/go-rest-game-character/pkg/pagination"
 )
 
-// Service encapsulates usecase logic for albums.
+// Service encapsulates usecase logic for characters.
 type Service interface {
 	Get(ctx context.Context, id string) (Character, error)
-	Query(ctx context.Context, offset, limit int) ([]Character, error)
-	Count(ctx context.Context) (int, error)
+	Query(ctx context.Context, filter Filter, sort Sort, offset, limit int) ([]Character, error)
+	QueryCursor(ctx context.Context, filter Filter, sort Sort, pages *pagination.CursorPages) error
+	Count(ctx context.Context, filter Filter) (int, error)
 	Create(ctx context.Context, input CreateCharacterRequest) (Character, error)
-	Update(ctx context.Context, id string, input UpdateCharacterRequest) (Character, error)
-	Delete(ctx context.Context, id string) (Character, error)
+	Update(ctx context.Context, id string, input UpdateCharacterRequest, version int64) (Character, error)
+	Patch(ctx context.Context, id string, patch []byte, version int64) (Character, error)
+	Delete(ctx context.Context, id string, version int64) (Character, error)
+	CountDeleted(ctx context.Context) (int, error)
+	QueryDeleted(ctx context.Context, offset, limit int) ([]Character, error)
+	Restore(ctx context.Context, id string) (Character, error)
+	Purge(ctx context.Context, retention time.Duration) (int64, error)
+	Bulk(ctx context.Context, req BulkRequest) ([]BulkResult, bool, error)
+	Import(ctx context.Context, rows RowReader, options ImportOptions) (ImportReport, error)
+	Export(ctx context.Context, filter Filter, sort Sort, fn func(Character) error) error
+	CountRevisions(ctx context.Context, id string) (int, error)
+	QueryRevisions(ctx context.Context, id string, offset, limit int) ([]Revision, error)
+	GetAsOf(ctx context.Context, id string, at time.Time) (Character, error)
+	Diff(ctx context.Context, id string, from, to int64) (Diff, error)
+	Revert(ctx context.Context, id string, req RevertCharacterRequest, version int64) (Character, error)
+	Leaderboard(ctx context.Context, req LeaderboardRequest) ([]RankedCharacter, error)
+	Stats(ctx context.Context, filter Filter) ([]TypeStats, error)
+	GrantExperience(ctx context.Context, id string, req GrantExperienceRequest) (Character, error)
+	RefreshEquipment(ctx context.Context, id string) (Character, error)
 }
 
-// Character represents the data about an album.
+// Character represents the data about a character.
 type Character struct {
 	entity.Character
 }
@@ -32,26 +60,32 @@ const (
 )
 
 // CreateCharacterRequest represents an character creation request.
+// The attributes are validated by the attribute schema of the character type.
 type CreateCharacterRequest struct {
-	Name           string `json:"name"`
-	CharacterCode  int64  `json:"character_code"`
-	CharacterPower int64  `json:"character_power"`
+	Name           string            `json:"name"`
+	CharacterCode  int64             `json:"character_code"`
+	CharacterPower int64             `json:"character_power"`
+	Attributes     entity.Attributes `json:"attributes"`
 }
 
-// Validate validates the CreateAlbumRequest fields.
+// Validate validates the CreateCharacterRequest fields.
 func (m CreateCharacterRequest) Validate() error {
 	return validation.ValidateStruct(&m,
 		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.CharacterCode, validation.Required),
 	)
 }
 
-// UpdateCharacterRequest represents an album update request.
+// UpdateCharacterRequest represents a character update request.
+// The attributes are left unchanged when they are omitted, and validated by the attribute schema of the character
+// type otherwise.
 type UpdateCharacterRequest struct {
-	Name           string `json:"name"`
-	CharacterPower int64  `json:"character_power"`
+	Name           string            `json:"name"`
+	CharacterPower int64             `json:"character_power"`
+	Attributes     entity.Attributes `json:"attributes"`
 }
 
-// Validate validates the CreateAlbumRequest fields.
+// Validate validates the UpdateCharacterRequest fields.
 func (m UpdateCharacterRequest) Validate() error {
 	return validation.ValidateStruct(&m,
 		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
@@ -59,16 +93,27 @@ func (m UpdateCharacterRequest) Validate() error {
 }
 
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo          Repository
+	types         charactertype.Service
+	valuators     Valuators
+	progression   Progression
+	equipment     Equipment
+	listener      Listener
+	transactional dbcontext.TransactionFunc
+	logger        log.Logger
 }
 
-// NewService creates a new album service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// NewService creates a new character service.
+// The valuators are used to compute the value of characters whenever they are created or updated.
+// The progression gives the levels that characters reach with experience and the power they gain on the way.
+// The equipment gives the modifiers of the items equipped by characters, which count toward their value.
+// The listener, if not nil, is notified of every recorded change of the characters.
+// The transactional function runs the operations that span several repository calls in a transaction.
+func NewService(repo Repository, types charactertype.Service, valuators Valuators, progression Progression, equipment Equipment, listener Listener, transactional dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, types, valuators, progression, equipment, listener, transactional, logger}
 }
 
-// Get returns the album with the specified the album ID.
+// Get returns the character with the specified ID.
 func (s service) Get(ctx context.Context, id string) (Character, error) {
 	character, err := s.repo.Get(ctx, id)
 	if err != nil {
@@ -77,101 +122,376 @@ func (s service) Get(ctx context.Context, id string) (Character, error) {
 	return Character{character}, nil
 }
 
-// Create creates a new album.
+// Create creates a new character.
+// The creation is recorded as the first revision of the character.
 func (s service) Create(ctx context.Context, req CreateCharacterRequest) (Character, error) {
 	if err := req.Validate(); err != nil {
 		return Character{}, err
 	}
+	characterType, err := s.creatableType(ctx, req.CharacterCode)
+	if err != nil {
+		return Character{}, err
+	}
+	character, err := s.newCharacter(ctx, req, characterType)
+	if err != nil {
+		return Character{}, err
+	}
 
-	power := req.CharacterPower
-	var value int64
-
-	if req.CharacterCode == Wizard {
-		value = (power * 150 / 100)
-	} else if req.CharacterCode == Elf {
-		characterValue := power * 110 / 100
-		value = 2 + characterValue
-	} else if req.CharacterCode == Hobbit {
-		if power < 20 {
-			value = power * 200 / 100
-		} else {
-			value = power * 300 / 100
+	var created Character
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, character); err != nil {
+			return err
 		}
-	}
+		if err := s.record(ctx, entity.ActionCreate, nil, &character); err != nil {
+			return err
+		}
+		created, err = s.Get(ctx, character.ID)
+		return err
+	})
+	return created, err
+}
 
-	id := entity.GenerateID()
+// newCharacter builds a new character of the given type from a validated creation request.
+// The character is owned by the current user and valued with the current formula of its type.
+func (s service) newCharacter(ctx context.Context, req CreateCharacterRequest, characterType charactertype.CharacterType) (entity.Character, error) {
+	attributes, err := validAttributes(characterType, req.Attributes)
+	if err != nil {
+		return entity.Character{}, err
+	}
+	value, version, err := s.value(characterType, req.CharacterPower)
+	if err != nil {
+		return entity.Character{}, err
+	}
+	ownerID := ""
+	if user := auth.CurrentUser(ctx); user != nil {
+		ownerID = user.GetID()
+	}
 	now := time.Now()
-	err := s.repo.Create(ctx, entity.Character{
-		ID:             id,
+	return entity.Character{
+		ID:             entity.GenerateID(),
 		Name:           req.Name,
 		CharacterCode:  req.CharacterCode,
-		CharacterPower: power,
+		CharacterPower: req.CharacterPower,
+		EffectivePower: req.CharacterPower,
 		CharacterValue: value,
+		FormulaVersion: version,
+		Level:          1,
+		Attributes:     attributes,
+		Version:        1,
+		OwnerID:        ownerID,
 		CreatedAt:      now,
 		UpdatedAt:      now,
-	})
+	}, nil
+}
 
+// validAttributes checks the given attributes against the attribute schema of the given character type, and returns
+// them as an empty object if they are nil.
+func validAttributes(characterType charactertype.CharacterType, attributes entity.Attributes) (entity.Attributes, error) {
+	if attributes == nil {
+		attributes = entity.Attributes{}
+	}
+	if err := charactertype.ValidateAttributes(characterType.AttributeSchema, attributes); err != nil {
+		return nil, err
+	}
+	return attributes, nil
+}
+
+// creatableType returns the character type with the given code if new characters can be created with it.
+func (s service) creatableType(ctx context.Context, code int64) (charactertype.CharacterType, error) {
+	characterType, err := s.types.Get(ctx, code)
+	if err == sql.ErrNoRows {
+		return characterType, validation.Errors{
+			"character_code": errors.New("must be a registered character type"),
+		}
+	} else if err != nil {
+		return characterType, err
+	}
+	if characterType.Retired {
+		return characterType, validation.Errors{
+			"character_code": errors.New("refers to a retired character type"),
+		}
+	}
+	return characterType, nil
+}
+
+// valuator returns the valuation strategy of the given character type and the formula version it implements.
+// Types without a formula are valued by the registered strategies, whose version is 0.
+func (s service) valuator(characterType charactertype.CharacterType) (Valuator, int64, error) {
+	if characterType.Formula == "" {
+		valuator, ok := s.valuators[characterType.CharacterCode]
+		if !ok {
+			return nil, 0, ErrNoValuator
+		}
+		return valuator, 0, nil
+	}
+	e, err := charactertype.ParseFormula(characterType.Formula)
 	if err != nil {
-		return Character{}, err
+		return nil, 0, err
 	}
-	return s.Get(ctx, id)
+	return ExpressionValuator{e}, characterType.FormulaVersion, nil
 }
 
-// Update updates the album with the specified ID.
-func (s service) Update(ctx context.Context, id string, req UpdateCharacterRequest) (Character, error) {
-	if err := req.Validate(); err != nil {
-		return Character{}, err
+// value computes the value of a character of the given type and power, and returns the formula version used.
+// Valuation failures are reported as validation errors of the field causing them.
+func (s service) value(characterType charactertype.CharacterType, power int64) (int64, int64, error) {
+	valuator, version, err := s.valuator(characterType)
+	if err == nil {
+		var value int64
+		if value, err = valuator.Value(power); err == nil {
+			return value, version, nil
+		}
 	}
+	switch err {
+	case ErrNoValuator:
+		return 0, 0, validation.Errors{
+			"character_code": errors.New("has no valuation strategy"),
+		}
+	case ErrValueOverflow:
+		return 0, 0, validation.Errors{
+			"character_power": errors.New("is too large to be valued"),
+		}
+	case expr.ErrDivisionByZero:
+		return 0, 0, validation.Errors{
+			"character_power": errors.New("cannot be valued: " + err.Error()),
+		}
+	}
+	return 0, 0, err
+}
+
+// isOwner reports whether the user of the given context owns the character.
+func isOwner(ctx context.Context, character entity.Character) bool {
+	user := auth.CurrentUser(ctx)
+	return user != nil && user.GetID() == character.OwnerID
+}
 
+// getWritable returns the character with the specified ID if the current user may change it at the given version.
+// ErrNotOwner is returned if the character is owned by another user, and ErrVersionConflict if it is at another
+// version, unless the version is AnyVersion.
+func (s service) getWritable(ctx context.Context, id string, version int64) (Character, error) {
 	character, err := s.Get(ctx, id)
 	if err != nil {
 		return character, err
 	}
-	power := req.CharacterPower
-	var value int64
+	if !isOwner(ctx, character.Character) {
+		return character, ErrNotOwner
+	}
+	if version != AnyVersion && character.Version != version {
+		return character, ErrVersionConflict
+	}
+	return character, nil
+}
 
-	if character.CharacterCode == Wizard {
-		value = power * (150 / 100)
-	} else if character.CharacterCode == Elf {
-		value = 2 + (110 / 100)
-	} else if character.CharacterCode == Hobbit {
-		if power < 20 {
-			value = power * (200 / 100)
-		} else {
-			value = power * (300 / 100)
-		}
+// Update updates the character with the specified ID.
+// Only the owner can update a character. The version is the one the update is based on; the update fails with
+// ErrVersionConflict if it is stale.
+func (s service) Update(ctx context.Context, id string, req UpdateCharacterRequest, version int64) (Character, error) {
+	if err := req.Validate(); err != nil {
+		return Character{}, err
 	}
 
-	character.Name = req.Name
-	character.CharacterPower = power
-	character.CharacterValue = value
+	var character Character
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		if character, err = s.getWritable(ctx, id, version); err != nil {
+			return err
+		}
+		characterType, err := s.types.Get(ctx, character.CharacterCode)
+		if err != nil {
+			return err
+		}
 
+		before := character.Character
+		if err := s.setPower(ctx, &character.Character, characterType, req.CharacterPower); err != nil {
+			return err
+		}
+		if req.Attributes != nil {
+			if character.Attributes, err = validAttributes(characterType, req.Attributes); err != nil {
+				return err
+			}
+		}
+		character.Name = req.Name
+		return s.save(ctx, entity.ActionUpdate, &character, before)
+	})
+	return character, err
+}
+
+// save writes the changes made to a character and records them as a revision with the given action.
+// The update time of the character is set, and its version is incremented like the stored one.
+func (s service) save(ctx context.Context, action string, character *Character, before entity.Character) error {
+	character.UpdatedAt = time.Now()
 	if err := s.repo.Update(ctx, character.Character); err != nil {
-		return character, err
+		return err
 	}
-	return character, nil
+	character.Version++
+	return s.record(ctx, action, &before, &character.Character)
 }
 
-// Delete deletes the album with the specified ID.
-func (s service) Delete(ctx context.Context, id string) (Character, error) {
-	character, err := s.Get(ctx, id)
+// Patch applies a JSON merge patch (RFC 7396) to the character with the specified ID.
+// Only the fields of UpdateCharacterRequest can be patched, and the value is only recomputed when the power changes.
+// The attributes are merged with the patch like the other fields, and a null patch clears them.
+// Like Update, it is reserved to the owner and fails with ErrVersionConflict if the given version is stale.
+func (s service) Patch(ctx context.Context, id string, patch []byte, version int64) (Character, error) {
+	var character Character
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		if character, err = s.getWritable(ctx, id, version); err != nil {
+			return err
+		}
+		req, err := patchRequest(UpdateCharacterRequest{
+			Name:           character.Name,
+			CharacterPower: character.CharacterPower,
+			Attributes:     character.Attributes,
+		}, patch)
+		if err != nil {
+			return err
+		}
+		if err := req.Validate(); err != nil {
+			return err
+		}
+
+		before := character.Character
+		attributesChanged := !reflect.DeepEqual(req.Attributes, character.Attributes)
+		if req.CharacterPower != character.CharacterPower || attributesChanged {
+			characterType, err := s.types.Get(ctx, character.CharacterCode)
+			if err != nil {
+				return err
+			}
+			if req.CharacterPower != character.CharacterPower {
+				if err := s.setPower(ctx, &character.Character, characterType, req.CharacterPower); err != nil {
+					return err
+				}
+			}
+			if attributesChanged {
+				if character.Attributes, err = validAttributes(characterType, req.Attributes); err != nil {
+					return err
+				}
+			}
+		}
+		character.Name = req.Name
+		return s.save(ctx, entity.ActionUpdate, &character, before)
+	})
+	return character, err
+}
+
+// patchRequest applies a JSON merge patch to the given update request.
+// Members of the patch that are not fields of the request, or have the wrong type, are reported as validation errors.
+func patchRequest(req UpdateCharacterRequest, patch []byte) (UpdateCharacterRequest, error) {
+	doc, err := json.Marshal(req)
 	if err != nil {
-		return Character{}, err
+		return req, err
+	}
+	if doc, err = mergepatch.Apply(doc, patch); err != nil {
+		return req, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return req, validation.Errors{
+			"body": errors.New("must be a JSON object"),
+		}
 	}
-	if err = s.repo.Delete(ctx, id); err != nil {
+	invalid := validation.Errors{}
+	for name := range fields {
+		if name != "name" && name != "character_power" && name != "attributes" {
+			invalid[name] = errors.New("cannot be patched")
+		}
+	}
+	if len(invalid) > 0 {
+		return req, invalid
+	}
+
+	// removed members are reset to their zero values so that required fields fail validation
+	var patched UpdateCharacterRequest
+	if err := json.Unmarshal(doc, &patched); err != nil {
+		if e, ok := err.(*json.UnmarshalTypeError); ok {
+			return req, validation.Errors{
+				e.Field: errors.New("has the wrong type"),
+			}
+		}
+		return req, err
+	}
+	return patched, nil
+}
+
+// Delete moves the character with the specified ID to the trash, from where it can be restored until it is purged.
+// Only the owner can delete a character. It fails with ErrVersionConflict if the given version is stale.
+func (s service) Delete(ctx context.Context, id string, version int64) (Character, error) {
+	var character Character
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		if character, err = s.getWritable(ctx, id, version); err != nil {
+			return err
+		}
+		if err = s.repo.Delete(ctx, id, character.Version); err != nil {
+			return err
+		}
+		return s.record(ctx, entity.ActionDelete, &character.Character, nil)
+	})
+	if err != nil {
 		return Character{}, err
 	}
 	return character, nil
 }
 
-// Count returns the number of albums.
-func (s service) Count(ctx context.Context) (int, error) {
-	return s.repo.Count(ctx)
+// CountDeleted returns the number of characters in the trash.
+func (s service) CountDeleted(ctx context.Context) (int, error) {
+	return s.repo.CountDeleted(ctx)
+}
+
+// QueryDeleted returns the characters in the trash, most recently deleted first, with the specified offset and limit.
+func (s service) QueryDeleted(ctx context.Context, offset, limit int) ([]Character, error) {
+	items, err := s.repo.QueryDeleted(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Character{}
+	for _, item := range items {
+		result = append(result, Character{item})
+	}
+	return result, nil
+}
+
+// Restore moves the character with the specified ID out of the trash.
+// Only the owner of the character can restore it.
+func (s service) Restore(ctx context.Context, id string) (Character, error) {
+	var restored Character
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		character, err := s.repo.GetDeleted(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !isOwner(ctx, character) {
+			return ErrNotOwner
+		}
+		if err := s.repo.Restore(ctx, id); err != nil {
+			return err
+		}
+		if restored, err = s.Get(ctx, id); err != nil {
+			return err
+		}
+		return s.record(ctx, entity.ActionRestore, &character, &restored.Character)
+	})
+	if err != nil {
+		return Character{}, err
+	}
+	return restored, nil
+}
+
+// Purge permanently removes the characters that have been in the trash for longer than the given retention period.
+// It returns the number of characters removed.
+func (s service) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	count, err := s.repo.Purge(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	s.logger.With(ctx).Infof("purged %v deleted characters", count)
+	return count, nil
+}
+
+// Count returns the number of characters satisfying the given filter.
+func (s service) Count(ctx context.Context, filter Filter) (int, error) {
+	return s.repo.Count(ctx, filter)
 }
 
-// Query returns the albums with the specified offset and limit.
-func (s service) Query(ctx context.Context, offset, limit int) ([]Character, error) {
-	items, err := s.repo.Query(ctx, offset, limit)
+// Query returns the characters satisfying the given filter, in the given order, with the specified offset and limit.
+func (s service) Query(ctx context.Context, filter Filter, sort Sort, offset, limit int) ([]Character, error) {
+	items, err := s.repo.Query(ctx, filter, sort, offset, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -181,3 +501,67 @@ func (s service) Query(ctx context.Context, offset, limit int) ([]Character, err
 	}
 	return result, nil
 }
+
+// QueryCursor fills the given cursor pages with the characters satisfying the given filter, in the given order.
+// The page starts right after pages.After, or ends right before pages.Before if it is set.
+func (s service) QueryCursor(ctx context.Context, filter Filter, sort Sort, pages *pagination.CursorPages) error {
+	token, param, querySort := pages.After, pagination.AfterVar, sort
+	backward := pages.Before != ""
+	if backward {
+		// walk the list in the opposite direction from the cursor, then restore the order
+		token, param, querySort = pages.Before, pagination.BeforeVar, sort.Reverse()
+	}
+
+	var keys []interface{}
+	if token != "" {
+		var err error
+		if keys, err = sort.DecodeCursor(token); err != nil {
+			return validation.Errors{
+				param: errors.New("is not a valid cursor for this sort order"),
+			}
+		}
+	}
+
+	items, err := s.repo.QueryAfter(ctx, filter, querySort, keys, pages.Limit())
+	if err != nil {
+		return err
+	}
+	hasMore := len(items) > pages.PerPage
+	if hasMore {
+		items = items[:pages.PerPage]
+	}
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	result := []Character{}
+	for _, item := range items {
+		result = append(result, Character{item})
+	}
+	pages.Items = result
+	pages.NextCursor, pages.PrevCursor = "", ""
+
+	if len(items) == 0 {
+		// an empty page still allows going back to where the client came from
+		if backward {
+			pages.NextCursor = token
+		} else {
+			pages.PrevCursor = token
+		}
+		return nil
+	}
+	first, last := items[0], items[len(items)-1]
+	if hasMore || backward {
+		if pages.NextCursor, err = sort.EncodeCursor(last); err != nil {
+			return err
+		}
+	}
+	if hasMore && backward || !backward && token != "" {
+		if pages.PrevCursor, err = sort.EncodeCursor(first); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,13 +1,25 @@
 package character
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/charactertype"
 	"github.com/hikvineh/go-rest-game-character/internal/entity"
 	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/hikvineh/go-rest-game-character/pkg/pagination"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,6 +33,7 @@ func TestCreateCharacterRequest_Validate(t *testing.T) {
 	}{
 		{"success", CreateCharacterRequest{Name: "test", CharacterCode: 1, CharacterPower: 100}, false},
 		{"required", CreateCharacterRequest{Name: "", CharacterCode: 1, CharacterPower: 100}, true},
+		{"code required", CreateCharacterRequest{Name: "test", CharacterPower: 100}, true},
 		{"too long", CreateCharacterRequest{Name: "1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"}, true},
 	}
 	for _, tt := range tests {
@@ -51,12 +64,13 @@ func TestUpdateCharacterRequest_Validate(t *testing.T) {
 
 func Test_service_CRUD(t *testing.T) {
 	logger, _ := log.NewForTest()
-	s := NewService(&mockRepository{}, logger)
+	repo := &mockRepository{}
+	s := newMockService(repo, logger)
 
-	ctx := context.Background()
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
 
 	// initial count
-	count, _ := s.Count(ctx)
+	count, _ := s.Count(ctx, Filter{})
 	assert.Equal(t, 0, count)
 
 	// successful creation
@@ -80,42 +94,88 @@ func Test_service_CRUD(t *testing.T) {
 	assert.Equal(t, int64(20), characterHobbit2.CharacterValue)
 	assert.NotEmpty(t, characterWizard.CreatedAt)
 	assert.NotEmpty(t, characterWizard.UpdatedAt)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, Filter{})
 	assert.Equal(t, 5, count)
 
 	// validation error in creation
 	_, err = s.Create(ctx, CreateCharacterRequest{Name: ""})
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, Filter{})
+	assert.Equal(t, 5, count)
+
+	// unknown character type in creation
+	_, err = s.Create(ctx, CreateCharacterRequest{Name: "test", CharacterCode: 9, CharacterPower: 100})
+	assert.NotNil(t, err)
+	count, _ = s.Count(ctx, Filter{})
+	assert.Equal(t, 5, count)
+
+	// retired character type in creation
+	_, err = s.Create(ctx, CreateCharacterRequest{Name: "test", CharacterCode: 4, CharacterPower: 100})
+	assert.NotNil(t, err)
+	count, _ = s.Count(ctx, Filter{})
+	assert.Equal(t, 5, count)
+
+	// character type without valuation strategy in creation
+	_, err = s.Create(ctx, CreateCharacterRequest{Name: "test", CharacterCode: 7, CharacterPower: 100})
+	assert.NotNil(t, err)
+
+	// formula failure in creation
+	_, err = s.Create(ctx, CreateCharacterRequest{Name: "test", CharacterCode: 6, CharacterPower: 10})
+	assert.NotNil(t, err)
+	count, _ = s.Count(ctx, Filter{})
 	assert.Equal(t, 5, count)
 
 	// unexpected error in creation
-	_, err = s.Create(ctx, CreateCharacterRequest{Name: "error"})
+	_, err = s.Create(ctx, CreateCharacterRequest{Name: "error", CharacterCode: 1})
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, Filter{})
 	assert.Equal(t, 5, count)
 
-	_, _ = s.Create(ctx, CreateCharacterRequest{Name: "test2"})
+	_, _ = s.Create(ctx, CreateCharacterRequest{Name: "test2", CharacterCode: 1})
 
 	// update
-	character, err = s.Update(ctx, id, UpdateCharacterRequest{Name: "test updated"})
+	character, err = s.Update(ctx, id, UpdateCharacterRequest{Name: "test updated"}, AnyVersion)
 
 	assert.Nil(t, err)
 	assert.Equal(t, "test updated", character.Name)
-	_, err = s.Update(ctx, "none", UpdateCharacterRequest{Name: "test updated"})
+	_, err = s.Update(ctx, "none", UpdateCharacterRequest{Name: "test updated"}, AnyVersion)
+	assert.NotNil(t, err)
+
+	// update values characters the same way as creation
+	updated, err := s.Update(ctx, characterElf.ID, UpdateCharacterRequest{Name: "test", CharacterPower: 60}, AnyVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, characterElf.CharacterValue, updated.CharacterValue)
+	updated, err = s.Update(ctx, characterWizard.ID, UpdateCharacterRequest{Name: "test", CharacterPower: 100}, AnyVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, characterWizard.CharacterValue, updated.CharacterValue)
+
+	// formula valuation records the formula version
+	characterOrc, err := s.Create(ctx, CreateCharacterRequest{Name: "test", CharacterCode: 5, CharacterPower: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(21), characterOrc.CharacterValue)
+	assert.Equal(t, int64(3), characterOrc.FormulaVersion)
+	assert.Equal(t, int64(0), characterWizard.FormulaVersion)
+	updated, err = s.Update(ctx, characterOrc.ID, UpdateCharacterRequest{Name: "test", CharacterPower: 20}, AnyVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(41), updated.CharacterValue)
+	assert.Equal(t, int64(3), updated.FormulaVersion)
+	_, _ = s.Delete(ctx, characterOrc.ID, AnyVersion)
+
+	// value overflow in update
+	_, err = s.Update(ctx, characterHobbit.ID, UpdateCharacterRequest{Name: "test", CharacterPower: math.MaxInt64}, AnyVersion)
 	assert.NotNil(t, err)
 
 	// validation error in update
-	_, err = s.Update(ctx, id, UpdateCharacterRequest{Name: ""})
+	_, err = s.Update(ctx, id, UpdateCharacterRequest{Name: ""}, AnyVersion)
 
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, Filter{})
 	assert.Equal(t, 6, count)
 
 	// unexpected error in update
-	_, err = s.Update(ctx, id, UpdateCharacterRequest{Name: "error"})
+	_, err = s.Update(ctx, id, UpdateCharacterRequest{Name: "error"}, AnyVersion)
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, Filter{})
 	assert.Equal(t, 6, count)
 
 	// get
@@ -127,38 +187,1332 @@ func Test_service_CRUD(t *testing.T) {
 	assert.Equal(t, id, character.ID)
 
 	// query
-	characters, _ := s.Query(ctx, 0, 0)
+	characters, _ := s.Query(ctx, Filter{}, DefaultSort, 0, 0)
 	assert.Equal(t, 6, len(characters))
 
 	// delete
-	_, err = s.Delete(ctx, "none")
+	_, err = s.Delete(ctx, "none", AnyVersion)
 	assert.NotNil(t, err)
-	character, err = s.Delete(ctx, id)
+	character, err = s.Delete(ctx, id, AnyVersion)
 	assert.Nil(t, err)
 	assert.Equal(t, id, character.ID)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, Filter{})
 	assert.Equal(t, 5, count)
 }
 
+func Test_service_QueryCursor(t *testing.T) {
+	logger, _ := log.NewForTest()
+	now := time.Now()
+	repo := &mockRepository{}
+	for i, power := range []int64{30, 10, 50, 10, 40} {
+		repo.items = append(repo.items, entity.Character{
+			ID:             fmt.Sprintf("id%v", i),
+			Name:           "test",
+			CharacterCode:  Wizard,
+			CharacterPower: power,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+	}
+	s := newMockService(repo, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+	order, _ := ParseSort("-character_power")
+	ids := func(pages *pagination.CursorPages) []string {
+		var result []string
+		for _, item := range pages.Items.([]Character) {
+			result = append(result, item.ID)
+		}
+		return result
+	}
+
+	// first page
+	pages := pagination.NewCursor("", "", 2)
+	assert.Nil(t, s.QueryCursor(ctx, Filter{}, order, pages))
+	assert.Equal(t, []string{"id2", "id4"}, ids(pages))
+	assert.NotEmpty(t, pages.NextCursor)
+	assert.Empty(t, pages.PrevCursor)
+
+	// a character inserted before the cursor does not shift the following pages
+	repo.items = append(repo.items, entity.Character{ID: "id5", CharacterPower: 60, CreatedAt: now, UpdatedAt: now})
+
+	// second page
+	pages = pagination.NewCursor(pages.NextCursor, "", 2)
+	assert.Nil(t, s.QueryCursor(ctx, Filter{}, order, pages))
+	assert.Equal(t, []string{"id0", "id1"}, ids(pages))
+	assert.NotEmpty(t, pages.NextCursor)
+	assert.NotEmpty(t, pages.PrevCursor)
+	prev := pages.PrevCursor
+
+	// last page
+	pages = pagination.NewCursor(pages.NextCursor, "", 2)
+	assert.Nil(t, s.QueryCursor(ctx, Filter{}, order, pages))
+	assert.Equal(t, []string{"id3"}, ids(pages))
+	assert.Empty(t, pages.NextCursor)
+	assert.NotEmpty(t, pages.PrevCursor)
+
+	// going back
+	pages = pagination.NewCursor("", prev, 2)
+	assert.Nil(t, s.QueryCursor(ctx, Filter{}, order, pages))
+	assert.Equal(t, []string{"id2", "id4"}, ids(pages))
+	assert.NotEmpty(t, pages.NextCursor)
+	assert.NotEmpty(t, pages.PrevCursor)
+
+	pages = pagination.NewCursor("", pages.PrevCursor, 2)
+	assert.Nil(t, s.QueryCursor(ctx, Filter{}, order, pages))
+	assert.Equal(t, []string{"id5"}, ids(pages))
+	assert.NotEmpty(t, pages.NextCursor)
+	assert.Empty(t, pages.PrevCursor)
+
+	// cursor of another sort order
+	other, _ := ParseSort("name")
+	pages = pagination.NewCursor(prev, "", 2)
+	assert.NotNil(t, s.QueryCursor(ctx, Filter{}, other, pages))
+	pages = pagination.NewCursor("", "garbage", 2)
+	assert.NotNil(t, s.QueryCursor(ctx, Filter{}, order, pages))
+}
+
+func Test_service_Patch(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := newMockService(repo, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	character, err := s.Create(ctx, CreateCharacterRequest{Name: "test", CharacterCode: Hobbit, CharacterPower: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), character.CharacterValue)
+
+	// rename keeps the power and value
+	patched, err := s.Patch(ctx, character.ID, []byte(`{"name":"renamed"}`), AnyVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, "renamed", patched.Name)
+	assert.Equal(t, int64(10), patched.CharacterPower)
+	assert.Equal(t, int64(20), patched.CharacterValue)
+
+	// power change recomputes the value
+	patched, err = s.Patch(ctx, character.ID, []byte(`{"character_power":30}`), AnyVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, "renamed", patched.Name)
+	assert.Equal(t, int64(30), patched.CharacterPower)
+	assert.Equal(t, int64(90), patched.CharacterValue)
+
+	// removing a required field fails validation
+	_, err = s.Patch(ctx, character.ID, []byte(`{"name":null}`), AnyVersion)
+	assert.NotNil(t, err)
+	// removing the power resets it
+	patched, err = s.Patch(ctx, character.ID, []byte(`{"character_power":null}`), AnyVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), patched.CharacterPower)
+	assert.Equal(t, int64(0), patched.CharacterValue)
+
+	// read-only and unknown fields
+	_, err = s.Patch(ctx, character.ID, []byte(`{"character_value":1000}`), AnyVersion)
+	assert.Equal(t, "character_value: cannot be patched.", err.Error())
+	_, err = s.Patch(ctx, character.ID, []byte(`{"id":"other","foo":1}`), AnyVersion)
+	assert.Equal(t, "foo: cannot be patched; id: cannot be patched.", err.Error())
+
+	// wrong types
+	_, err = s.Patch(ctx, character.ID, []byte(`{"character_power":"high"}`), AnyVersion)
+	assert.Equal(t, "character_power: has the wrong type.", err.Error())
+	_, err = s.Patch(ctx, character.ID, []byte(`["name"]`), AnyVersion)
+	assert.Equal(t, "body: must be a JSON object.", err.Error())
+
+	// unknown character
+	_, err = s.Patch(ctx, "none", []byte(`{"name":"renamed"}`), AnyVersion)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// unexpected error
+	_, err = s.Patch(ctx, character.ID, []byte(`{"name":"error"}`), AnyVersion)
+	assert.Equal(t, errCRUD, err)
+
+	character, _ = s.Get(ctx, character.ID)
+	assert.Equal(t, "renamed", character.Name)
+}
+
+func Test_service_Attributes(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := newMockService(repo, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	// attributes default to an empty object
+	hobbit, err := s.Create(ctx, CreateCharacterRequest{Name: "Frodo", CharacterCode: Hobbit, CharacterPower: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.Attributes{}, hobbit.Attributes)
+
+	// the schema of the type is enforced on create
+	_, err = s.Create(ctx, CreateCharacterRequest{Name: "Legolas", CharacterCode: Elf, CharacterPower: 10,
+		Attributes: entity.Attributes{"agility": json.Number("101"), "mana": json.Number("1")}})
+	assert.Equal(t, "attributes.agility: must be no greater than 100; attributes.mana: is not allowed.", err.Error())
+	elf, err := s.Create(ctx, CreateCharacterRequest{Name: "Legolas", CharacterCode: Elf, CharacterPower: 10,
+		Attributes: entity.Attributes{"agility": json.Number("90")}})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.Attributes{"agility": json.Number("90")}, elf.Attributes)
+
+	// omitted attributes are kept on update
+	elf, err = s.Update(ctx, elf.ID, UpdateCharacterRequest{Name: "Legolas", CharacterPower: 20}, AnyVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.Attributes{"agility": json.Number("90")}, elf.Attributes)
+	_, err = s.Update(ctx, elf.ID, UpdateCharacterRequest{Name: "Legolas", CharacterPower: 20,
+		Attributes: entity.Attributes{"agility": "fast"}}, AnyVersion)
+	assert.Equal(t, "attributes.agility: must be a number.", err.Error())
+
+	// patches are merged into the attributes before being validated
+	wizard, err := s.Create(ctx, CreateCharacterRequest{Name: "Gandalf", CharacterCode: Wizard, CharacterPower: 10,
+		Attributes: entity.Attributes{"mana": json.Number("500"), "staff": true}})
+	assert.Nil(t, err)
+	wizard, err = s.Patch(ctx, wizard.ID, []byte(`{"attributes":{"mana":450,"staff":null}}`), AnyVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.Attributes{"mana": json.Number("450")}, wizard.Attributes)
+	_, err = s.Patch(ctx, wizard.ID, []byte(`{"attributes":{"mana":-1}}`), AnyVersion)
+	assert.Equal(t, "attributes.mana: must be no less than 0.", err.Error())
+	wizard, err = s.Patch(ctx, wizard.ID, []byte(`{"attributes":null}`), AnyVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.Attributes{}, wizard.Attributes)
+}
+
+func Test_service_Version(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := newMockService(repo, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	character, err := s.Create(ctx, CreateCharacterRequest{Name: "test", CharacterCode: Wizard, CharacterPower: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), character.Version)
+
+	// every write increments the version
+	updated, err := s.Update(ctx, character.ID, UpdateCharacterRequest{Name: "updated"}, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), updated.Version)
+	patched, err := s.Patch(ctx, character.ID, []byte(`{"name":"patched"}`), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), patched.Version)
+	character, _ = s.Get(ctx, character.ID)
+	assert.Equal(t, int64(3), character.Version)
+
+	// stale versions are rejected
+	_, err = s.Update(ctx, character.ID, UpdateCharacterRequest{Name: "stale"}, 1)
+	assert.Equal(t, ErrVersionConflict, err)
+	_, err = s.Patch(ctx, character.ID, []byte(`{"name":"stale"}`), 2)
+	assert.Equal(t, ErrVersionConflict, err)
+	_, err = s.Delete(ctx, character.ID, 2)
+	assert.Equal(t, ErrVersionConflict, err)
+	character, _ = s.Get(ctx, character.ID)
+	assert.Equal(t, "patched", character.Name)
+
+	// a concurrent write between reading and saving is detected by the repository
+	stale := character.Character
+	assert.Nil(t, repo.Update(ctx, stale))
+	assert.Equal(t, ErrVersionConflict, repo.Update(ctx, stale))
+
+	_, err = s.Delete(ctx, character.ID, 4)
+	assert.Nil(t, err)
+}
+
+func Test_service_Trash(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := newMockService(repo, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	character, err := s.Create(ctx, CreateCharacterRequest{Name: "test", CharacterCode: Wizard, CharacterPower: 10})
+	assert.Nil(t, err)
+	_, err = s.Restore(ctx, character.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// deleted characters are only visible in the trash
+	_, err = s.Delete(ctx, character.ID, AnyVersion)
+	assert.Nil(t, err)
+	_, err = s.Get(ctx, character.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	count, _ := s.Count(ctx, Filter{})
+	assert.Equal(t, 0, count)
+	_, err = s.Delete(ctx, character.ID, AnyVersion)
+	assert.Equal(t, sql.ErrNoRows, err)
+	count, _ = s.CountDeleted(ctx)
+	assert.Equal(t, 1, count)
+	deleted, _ := s.QueryDeleted(ctx, 0, 10)
+	if assert.Equal(t, 1, len(deleted)) {
+		assert.Equal(t, character.ID, deleted[0].ID)
+		assert.NotNil(t, deleted[0].DeletedAt)
+	}
+
+	// restore
+	restored, err := s.Restore(ctx, character.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, int64(3), restored.Version)
+	count, _ = s.CountDeleted(ctx)
+	assert.Equal(t, 0, count)
+
+	// purge only removes the characters deleted longer ago than the retention period
+	_, _ = s.Delete(ctx, character.ID, AnyVersion)
+	purged, err := s.Purge(ctx, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), purged)
+	purged, err = s.Purge(ctx, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), purged)
+	_, err = s.Restore(ctx, character.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func Test_service_Ownership(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := newMockService(repo, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+	other := auth.WithUser(context.Background(), "101", "Other")
+
+	character, err := s.Create(ctx, CreateCharacterRequest{Name: "test", CharacterCode: Wizard, CharacterPower: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, "100", character.OwnerID)
+	mine, _ := s.Count(ctx, Filter{OwnerID: "100"})
+	assert.Equal(t, 1, mine)
+	mine, _ = s.Count(ctx, Filter{OwnerID: "101"})
+	assert.Equal(t, 0, mine)
+
+	// other users can read but not change the character
+	_, err = s.Get(other, character.ID)
+	assert.Nil(t, err)
+	_, err = s.Update(other, character.ID, UpdateCharacterRequest{Name: "stolen"}, AnyVersion)
+	assert.Equal(t, ErrNotOwner, err)
+	_, err = s.Patch(other, character.ID, []byte(`{"name":"stolen"}`), AnyVersion)
+	assert.Equal(t, ErrNotOwner, err)
+	_, err = s.Delete(other, character.ID, AnyVersion)
+	assert.Equal(t, ErrNotOwner, err)
+	_, err = s.Delete(context.Background(), character.ID, AnyVersion)
+	assert.Equal(t, ErrNotOwner, err)
+
+	_, err = s.Delete(ctx, character.ID, AnyVersion)
+	assert.Nil(t, err)
+	_, err = s.Restore(other, character.ID)
+	assert.Equal(t, ErrNotOwner, err)
+	_, err = s.Restore(ctx, character.ID)
+	assert.Nil(t, err)
+}
+
+func Test_service_Bulk(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := newMockService(repo, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	existing, err := s.Create(ctx, CreateCharacterRequest{Name: "existing", CharacterCode: Wizard, CharacterPower: 10})
+	assert.Nil(t, err)
+	operations := []BulkOperation{
+		{Op: BulkCreate, Name: "new", CharacterCode: Hobbit, CharacterPower: 30},
+		{Op: BulkUpdate, ID: existing.ID, Name: "updated", CharacterPower: 20},
+		{Op: BulkCreate, Name: "", CharacterCode: Wizard},
+		{Op: BulkDelete, ID: "none"},
+		{Op: BulkDelete, ID: existing.ID, Version: 1},
+	}
+
+	// best effort keeps the successful operations
+	results, committed, err := s.Bulk(ctx, BulkRequest{Operations: operations})
+	assert.Nil(t, err)
+	assert.True(t, committed)
+	if assert.Equal(t, 5, len(results)) {
+		assert.Nil(t, results[0].Err)
+		assert.Equal(t, int64(90), results[0].Character.CharacterValue)
+		assert.Nil(t, results[1].Err)
+		assert.Equal(t, int64(30), results[1].Character.CharacterValue)
+		assert.NotNil(t, results[2].Err)
+		assert.Equal(t, sql.ErrNoRows, results[3].Err)
+		assert.Equal(t, ErrVersionConflict, results[4].Err)
+		assert.Equal(t, BulkDelete, results[4].Op)
+	}
+	count, _ := s.Count(ctx, Filter{})
+	assert.Equal(t, 2, count)
+	updated, _ := s.Get(ctx, existing.ID)
+	assert.Equal(t, "updated", updated.Name)
+
+	// atomic rolls back everything on the first failure
+	results, committed, err = s.Bulk(ctx, BulkRequest{Atomic: true, Operations: operations})
+	assert.Nil(t, err)
+	assert.False(t, committed)
+	if assert.Equal(t, 5, len(results)) {
+		assert.Nil(t, results[0].Err)
+		assert.NotNil(t, results[2].Err)
+		assert.Equal(t, ErrBulkSkipped, results[3].Err)
+		assert.Equal(t, ErrBulkSkipped, results[4].Err)
+	}
+	count, _ = s.Count(ctx, Filter{})
+	assert.Equal(t, 2, count)
+	updated, _ = s.Get(ctx, existing.ID)
+	assert.Equal(t, int64(2), updated.Version)
+
+	// atomic success
+	results, committed, err = s.Bulk(ctx, BulkRequest{Atomic: true, Operations: operations[:2]})
+	assert.Nil(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, 2, len(results))
+	count, _ = s.Count(ctx, Filter{})
+	assert.Equal(t, 3, count)
+
+	// invalid requests
+	_, _, err = s.Bulk(ctx, BulkRequest{})
+	assert.NotNil(t, err)
+	_, _, err = s.Bulk(ctx, BulkRequest{Operations: []BulkOperation{{Op: "merge"}}})
+	assert.NotNil(t, err)
+	_, _, err = s.Bulk(ctx, BulkRequest{Operations: []BulkOperation{{Op: BulkUpdate}}})
+	assert.NotNil(t, err)
+	_, _, err = s.Bulk(ctx, BulkRequest{Operations: make([]BulkOperation, MaxBulkOperations+1)})
+	assert.NotNil(t, err)
+
+	// required versions
+	results, committed, err = s.Bulk(ctx, BulkRequest{RequireVersion: true, Operations: []BulkOperation{
+		{Op: BulkCreate, Name: "versioned", CharacterCode: Hobbit},
+		{Op: BulkUpdate, ID: existing.ID, Name: "unversioned", CharacterPower: 20},
+		{Op: BulkDelete, ID: existing.ID},
+		{Op: BulkUpdate, ID: existing.ID, Version: 3, Name: "versioned", CharacterPower: 20},
+	}})
+	assert.Nil(t, err)
+	assert.True(t, committed)
+	if assert.Equal(t, 4, len(results)) {
+		assert.Nil(t, results[0].Err)
+		assert.Equal(t, ErrVersionRequired, results[1].Err)
+		assert.Equal(t, ErrVersionRequired, results[2].Err)
+		assert.Nil(t, results[3].Err)
+	}
+	updated, _ = s.Get(ctx, existing.ID)
+	assert.Equal(t, "versioned", updated.Name)
+}
+
+func Test_service_Import(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := newMockService(repo, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+	data := "name,character_code,character_power\n" +
+		"Gandalf,1,100\n" +
+		"Frodo,3,10\n" +
+		",3,10\n" +
+		"Gimli,4,10\n" +
+		"Gimli,4,20\n" +
+		"Treebeard,9,10\n" +
+		"Sam,3,abc\n" +
+		"Merry,3,15\n"
+
+	// dry run
+	rows, _ := NewRowReader(strings.NewReader(data), FormatCSV)
+	report, err := s.Import(ctx, rows, ImportOptions{DryRun: true, BatchSize: 2})
+	assert.Nil(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 8, report.Rows)
+	assert.Equal(t, 3, report.Valid)
+	assert.Equal(t, 0, report.Imported)
+	assert.Equal(t, 5, report.Failed)
+	if assert.Equal(t, 5, len(report.Errors)) {
+		assert.Equal(t, 4, report.Errors[0].Line)
+		assert.Equal(t, "name: cannot be blank.", report.Errors[0].Errors.Error())
+		assert.Equal(t, 5, report.Errors[1].Line)
+		assert.Equal(t, "character_code: refers to a retired character type.", report.Errors[1].Errors.Error())
+		assert.Equal(t, 6, report.Errors[2].Line)
+		assert.Equal(t, 7, report.Errors[3].Line)
+		assert.Equal(t, 8, report.Errors[4].Line)
+	}
+	count, _ := s.Count(ctx, Filter{})
+	assert.Equal(t, 0, count)
+
+	// import in batches
+	rows, _ = NewRowReader(strings.NewReader(data), FormatCSV)
+	report, err = s.Import(ctx, rows, ImportOptions{BatchSize: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, report.Imported)
+	assert.Equal(t, 5, report.Failed)
+	count, _ = s.Count(ctx, Filter{OwnerID: "100"})
+	assert.Equal(t, 3, count)
+	characters, _ := s.Query(ctx, Filter{}, DefaultSort, 0, 10)
+	for _, character := range characters {
+		if character.Name == "Frodo" {
+			assert.Equal(t, int64(20), character.CharacterValue)
+			assert.Equal(t, int64(1), character.Version)
+		}
+	}
+
+	// failed batch
+	rows, _ = NewRowReader(strings.NewReader("name,character_code\nerror,1\n"), FormatCSV)
+	_, err = s.Import(ctx, rows, ImportOptions{})
+	assert.Equal(t, errCRUD, err)
+}
+
+func Test_service_RequiredAttributes(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := newMockService(repo, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	// bulk operations
+	results, committed, err := s.Bulk(ctx, BulkRequest{Operations: []BulkOperation{
+		{Op: BulkCreate, Name: "Smaug", CharacterCode: 8, CharacterPower: 10, Attributes: entity.Attributes{"fire": json.Number("90")}},
+		{Op: BulkCreate, Name: "Glaurung", CharacterCode: 8, CharacterPower: 10},
+	}})
+	assert.Nil(t, err)
+	assert.True(t, committed)
+	if assert.Len(t, results, 2) {
+		assert.Nil(t, results[0].Err)
+		assert.Equal(t, entity.Attributes{"fire": json.Number("90")}, results[0].Character.Attributes)
+		assert.NotNil(t, results[1].Err)
+	}
+	smaug := results[0].Character
+	results, _, _ = s.Bulk(ctx, BulkRequest{Operations: []BulkOperation{
+		{Op: BulkUpdate, ID: smaug.ID, Name: "Smaug", CharacterPower: 20, Attributes: entity.Attributes{"fire": json.Number("95")}},
+		{Op: BulkUpdate, ID: smaug.ID, Name: "Smaug", CharacterPower: 30},
+		{Op: BulkUpdate, ID: smaug.ID, Name: "Smaug", CharacterPower: 30, Attributes: entity.Attributes{"fire": json.Number("-1")}},
+	}})
+	if assert.Len(t, results, 3) {
+		assert.Nil(t, results[0].Err)
+		assert.Nil(t, results[1].Err)
+		assert.Equal(t, entity.Attributes{"fire": json.Number("95")}, results[1].Character.Attributes)
+		assert.NotNil(t, results[2].Err)
+	}
+
+	// csv import
+	rows, _ := NewRowReader(strings.NewReader("name,character_code,character_power,attributes\n"+
+		"Ancalagon,8,50,\"{\"\"fire\"\":100}\"\n"+
+		"Scatha,8,50,\n"+
+		"Chrysophylax,8,50,{fire}\n"), FormatCSV)
+	report, err := s.Import(ctx, rows, ImportOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Imported)
+	if assert.Len(t, report.Errors, 2) {
+		assert.Equal(t, 3, report.Errors[0].Line)
+		assert.Equal(t, "attributes.fire: cannot be blank.", report.Errors[0].Errors.Error())
+		assert.Equal(t, 4, report.Errors[1].Line)
+		assert.Equal(t, "attributes: must be a JSON object.", report.Errors[1].Errors.Error())
+	}
+
+	// csv export round trip
+	var buf bytes.Buffer
+	writer, _ := NewRowWriter(&buf, FormatCSV)
+	assert.Nil(t, s.Export(ctx, Filter{CharacterCodes: []int64{8}}, DefaultSort, writer.Write))
+	assert.Nil(t, writer.Close())
+	assert.Contains(t, buf.String(), `"{""fire"":100}"`)
+	rows, _ = NewRowReader(&buf, FormatCSV)
+	report, err = s.Import(ctx, rows, ImportOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Valid)
+	assert.Equal(t, 0, report.Failed)
+}
+
+func Test_service_Export(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: []entity.Character{
+		{ID: "1", Name: "Gandalf", CharacterCode: 1},
+		{ID: "2", Name: "Frodo", CharacterCode: 3},
+		{ID: "3", Name: "Sam", CharacterCode: 3},
+	}}
+	s := newMockService(repo, logger)
+	ctx := context.Background()
+
+	var names []string
+	err := s.Export(ctx, Filter{CharacterCodes: []int64{3}}, Sort{{Column: "name"}, {Column: "id"}}, func(character Character) error {
+		names = append(names, character.Name)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Frodo", "Sam"}, names)
+
+	// stops at the first error
+	names = nil
+	err = s.Export(ctx, Filter{}, DefaultSort, func(character Character) error {
+		names = append(names, character.Name)
+		return errCRUD
+	})
+	assert.Equal(t, errCRUD, err)
+	assert.Equal(t, []string{"Gandalf"}, names)
+}
+
+func Test_service_Revisions(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: []entity.Character{
+		{ID: "old", Name: "Bilbo", CharacterCode: 3, Version: 1, OwnerID: "100"},
+	}}
+	s := newMockService(repo, logger)
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	ctx := auth.WithUser(log.WithRequest(context.Background(), req), "100", "Tester")
+
+	character, err := s.Create(ctx, CreateCharacterRequest{Name: "Frodo", CharacterCode: 3, CharacterPower: 10})
+	assert.Nil(t, err)
+	id := character.ID
+	_, err = s.Update(ctx, id, UpdateCharacterRequest{Name: "Frodo", CharacterPower: 20}, AnyVersion)
+	assert.Nil(t, err)
+	_, err = s.Patch(ctx, id, []byte(`{"name":"Frodo Baggins"}`), AnyVersion)
+	assert.Nil(t, err)
+	_, err = s.Delete(ctx, id, AnyVersion)
+	assert.Nil(t, err)
+	_, err = s.Restore(ctx, id)
+	assert.Nil(t, err)
+
+	// failed changes are not recorded
+	_, err = s.Update(ctx, id, UpdateCharacterRequest{Name: "Frodo", CharacterPower: 20}, 1)
+	assert.Equal(t, ErrVersionConflict, err)
+	_, err = s.Update(ctx, id, UpdateCharacterRequest{Name: "error", CharacterPower: 20}, AnyVersion)
+	assert.Equal(t, errCRUD, err)
+
+	count, err := s.CountRevisions(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, count)
+	revisions, err := s.QueryRevisions(ctx, id, 0, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, revisions, 5) {
+		actions := make([]string, len(revisions))
+		for i, rev := range revisions {
+			actions[i] = rev.Action
+			assert.Equal(t, int64(5-i), rev.Revision)
+			assert.Equal(t, "100", rev.UserID)
+			assert.Equal(t, "Tester", rev.UserName)
+			assert.Equal(t, "req-1", rev.RequestID)
+		}
+		assert.Equal(t, []string{entity.ActionRestore, entity.ActionDelete, entity.ActionUpdate, entity.ActionUpdate, entity.ActionCreate}, actions)
+		assert.Nil(t, revisions[4].Before)
+		assert.Equal(t, int64(20), revisions[4].After.CharacterValue)
+		assert.Equal(t, int64(20), revisions[3].Before.CharacterValue)
+		assert.Equal(t, int64(60), revisions[3].After.CharacterValue)
+		assert.Equal(t, "Frodo Baggins", revisions[2].After.Name)
+		assert.Nil(t, revisions[1].After)
+		assert.NotNil(t, revisions[0].Before.DeletedAt)
+		assert.Nil(t, revisions[0].After.DeletedAt)
+	}
+	revisions, _ = s.QueryRevisions(ctx, id, 4, 10)
+	assert.Len(t, revisions, 1)
+
+	// characters without history
+	count, err = s.CountRevisions(ctx, "old")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+	_, err = s.CountRevisions(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// imports
+	rows, _ := NewRowReader(strings.NewReader("name,character_code\nSam,3\n"), FormatCSV)
+	_, err = s.Import(ctx, rows, ImportOptions{})
+	assert.Nil(t, err)
+	last := repo.revisions[len(repo.revisions)-1]
+	assert.Equal(t, entity.ActionCreate, last.Action)
+	assert.Equal(t, "Sam", last.After.Name)
+	assert.Equal(t, int64(1), last.Revision)
+}
+
+func Test_service_Listener(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	listener := &mockListener{}
+	s := NewService(repo, newMockTypeService(logger), DefaultValuators(), DefaultProgression(), mockEquipment{}, listener, repo.transactional, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	character, err := s.Create(ctx, CreateCharacterRequest{Name: "Frodo", CharacterCode: 3, CharacterPower: 10})
+	assert.Nil(t, err)
+	id := character.ID
+	_, err = s.Update(ctx, id, UpdateCharacterRequest{Name: "Frodo", CharacterPower: 20}, AnyVersion)
+	assert.Nil(t, err)
+	_, err = s.Delete(ctx, id, AnyVersion)
+	assert.Nil(t, err)
+	rows, _ := NewRowReader(strings.NewReader("name,character_code\nSam,3\nMerry,3\n"), FormatCSV)
+	_, err = s.Import(ctx, rows, ImportOptions{})
+	assert.Nil(t, err)
+
+	if assert.Len(t, listener.calls, 4) {
+		assert.Equal(t, entity.ActionCreate, listener.calls[0][0].Action)
+		assert.Equal(t, id, listener.calls[0][0].CharacterID)
+		assert.Equal(t, entity.ActionUpdate, listener.calls[1][0].Action)
+		assert.Equal(t, int64(20), listener.calls[1][0].Before.CharacterValue)
+		assert.Equal(t, entity.ActionDelete, listener.calls[2][0].Action)
+		assert.Nil(t, listener.calls[2][0].After)
+		assert.Len(t, listener.calls[3], 2)
+	}
+
+	// the change fails along with the listener
+	listener.err = errCRUD
+	_, err = s.Create(ctx, CreateCharacterRequest{Name: "Pippin", CharacterCode: 3, CharacterPower: 10})
+	assert.Equal(t, errCRUD, err)
+	count, _ := s.Count(ctx, Filter{})
+	assert.Equal(t, 2, count)
+}
+
+type mockListener struct {
+	calls [][]entity.CharacterRevision
+	err   error
+}
+
+func (m *mockListener) CharactersChanged(ctx context.Context, revisions []entity.CharacterRevision) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.calls = append(m.calls, revisions)
+	return nil
+}
+
+func TestCombineListeners(t *testing.T) {
+	ctx := context.Background()
+	revisions := []entity.CharacterRevision{{CharacterID: "frodo", Action: entity.ActionCreate}}
+	first, second := &mockListener{}, &mockListener{}
+	assert.Nil(t, CombineListeners(first, second).CharactersChanged(ctx, revisions))
+	assert.Equal(t, [][]entity.CharacterRevision{revisions}, first.calls)
+	assert.Equal(t, [][]entity.CharacterRevision{revisions}, second.calls)
+	assert.Nil(t, CombineListeners().CharactersChanged(ctx, revisions))
+
+	// the listeners after a failing one are not notified
+	first.err = errCRUD
+	assert.Equal(t, errCRUD, CombineListeners(first, second).CharactersChanged(ctx, revisions))
+	assert.Len(t, second.calls, 1)
+}
+
+func Test_service_GetAsOf(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := newMockService(repo, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	character, _ := s.Create(ctx, CreateCharacterRequest{Name: "Frodo", CharacterCode: 3, CharacterPower: 10})
+	id := character.ID
+	_, _ = s.Update(ctx, id, UpdateCharacterRequest{Name: "Frodo", CharacterPower: 20}, AnyVersion)
+	_, _ = s.Delete(ctx, id, AnyVersion)
+	day := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	for i := range repo.revisions {
+		repo.revisions[i].CreatedAt = day.Add(time.Duration(i+1) * 24 * time.Hour)
+	}
+
+	_, err := s.GetAsOf(ctx, id, day)
+	assert.Equal(t, sql.ErrNoRows, err)
+	character, err = s.GetAsOf(ctx, id, day.Add(36*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), character.CharacterPower)
+	assert.Equal(t, int64(1), character.Version)
+	character, err = s.GetAsOf(ctx, id, day.Add(48*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), character.CharacterPower)
+	_, err = s.GetAsOf(ctx, id, day.Add(96*time.Hour))
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// characters changed before revisions were recorded
+	old := entity.Character{ID: "old", Name: "Bilbo", CharacterCode: 3, CharacterPower: 5, Version: 3, OwnerID: "100", UpdatedAt: day}
+	repo.items = append(repo.items, old)
+	character, err = s.GetAsOf(ctx, "old", day.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), character.Version)
+	_, err = s.GetAsOf(ctx, "old", day.Add(-time.Hour))
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, _ = s.Update(ctx, "old", UpdateCharacterRequest{Name: "Bilbo", CharacterPower: 6}, AnyVersion)
+	repo.revisions[len(repo.revisions)-1].CreatedAt = day.Add(48 * time.Hour)
+	character, err = s.GetAsOf(ctx, "old", day.Add(24*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), character.CharacterPower)
+	_, err = s.GetAsOf(ctx, "none", day)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func Test_service_Diff(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: []entity.Character{
+		{ID: "old", Name: "Bilbo", CharacterCode: 3, CharacterPower: 5, EffectivePower: 5, CharacterValue: 10, Version: 3, OwnerID: "100"},
+	}}
+	s := newMockService(repo, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	_, _ = s.Update(ctx, "old", UpdateCharacterRequest{Name: "Bilbo Baggins", CharacterPower: 5}, AnyVersion)
+	_, _ = s.Update(ctx, "old", UpdateCharacterRequest{Name: "Bilbo Baggins", CharacterPower: 20}, AnyVersion)
+	_, _ = s.Delete(ctx, "old", AnyVersion)
+
+	diff, err := s.Diff(ctx, "old", 4, 5)
+	assert.Nil(t, err)
+	fields := map[string][]interface{}{}
+	for _, change := range diff.Changes {
+		fields[change.Field] = []interface{}{change.From, change.To}
+	}
+	assert.Equal(t, []interface{}{json.Number("5"), json.Number("20")}, fields["character_power"])
+	assert.Equal(t, []interface{}{json.Number("10"), json.Number("60")}, fields["character_value"])
+	assert.NotContains(t, fields, "name")
+	// the bookkeeping fields are left out
+	assert.NotContains(t, fields, "version")
+	assert.NotContains(t, fields, "updated_at")
+
+	// the version preceding the first revision
+	diff, err = s.Diff(ctx, "old", 3, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, []FieldChange{{"name", "Bilbo", "Bilbo Baggins"}}, diff.Changes)
+
+	// deletions
+	diff, err = s.Diff(ctx, "old", 5, 6)
+	assert.Nil(t, err)
+	assert.Equal(t, FieldChange{"character_code", json.Number("3"), nil}, diff.Changes[0])
+	for _, change := range diff.Changes {
+		assert.NotContains(t, []string{"version", "updated_at", "deleted_at"}, change.Field)
+	}
+
+	diff, err = s.Diff(ctx, "old", 5, 5)
+	assert.Nil(t, err)
+	assert.Empty(t, diff.Changes)
+	_, err = s.Diff(ctx, "old", 1, 5)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Diff(ctx, "old", 4, 9)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestRevertCharacterRequest_Validate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		model     RevertCharacterRequest
+		wantError bool
+	}{
+		{"revision", RevertCharacterRequest{Revision: 2}, false},
+		{"as of", RevertCharacterRequest{AsOf: &now}, false},
+		{"empty", RevertCharacterRequest{}, true},
+		{"negative", RevertCharacterRequest{Revision: -1}, true},
+		{"both", RevertCharacterRequest{Revision: 2, AsOf: &now}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_GrantExperience(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := newMockService(repo, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	character, _ := s.Create(ctx, CreateCharacterRequest{Name: "Frodo", CharacterCode: Hobbit, CharacterPower: 10})
+	id := character.ID
+	assert.Equal(t, int64(1), character.Level)
+
+	// below the next level
+	character, err := s.GrantExperience(ctx, id, GrantExperienceRequest{Amount: 50})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(50), character.Experience)
+	assert.Equal(t, int64(1), character.Level)
+	assert.Equal(t, int64(10), character.CharacterPower)
+	assert.Equal(t, int64(2), character.Version)
+
+	// two levels at once
+	character, err = s.GrantExperience(ctx, id, GrantExperienceRequest{Amount: 250})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(300), character.Experience)
+	assert.Equal(t, int64(3), character.Level)
+	assert.Equal(t, int64(16), character.CharacterPower)
+	assert.Equal(t, int64(32), character.CharacterValue)
+	stored, _ := s.Get(ctx, id)
+	assert.Equal(t, character, stored)
+	revisions, _ := s.QueryRevisions(ctx, id, 0, 1)
+	if assert.Len(t, revisions, 1) {
+		assert.Equal(t, entity.ActionExperience, revisions[0].Action)
+		assert.Equal(t, int64(50), revisions[0].Before.Experience)
+		assert.Equal(t, int64(1), revisions[0].Before.Level)
+		assert.Equal(t, int64(3), revisions[0].After.Level)
+	}
+
+	// errors
+	_, err = s.GrantExperience(ctx, id, GrantExperienceRequest{})
+	assert.NotNil(t, err)
+	_, err = s.GrantExperience(ctx, "unknown", GrantExperienceRequest{Amount: 1})
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.GrantExperience(auth.WithUser(context.Background(), "101", "Other"), id, GrantExperienceRequest{Amount: 1})
+	assert.Equal(t, ErrNotOwner, err)
+	stored, _ = s.Get(ctx, id)
+	assert.Equal(t, int64(300), stored.Experience)
+
+	// the power growing out of range
+	character, _ = s.Create(ctx, CreateCharacterRequest{Name: "Gandalf", CharacterCode: Wizard, CharacterPower: math.MaxInt64 / 2})
+	_, err = s.GrantExperience(ctx, character.ID, GrantExperienceRequest{Amount: MaxExperienceGrant})
+	if assert.IsType(t, validation.Errors{}, err) {
+		assert.Contains(t, err.(validation.Errors), "amount")
+	}
+	stored, _ = s.Get(ctx, character.ID)
+	assert.Equal(t, int64(0), stored.Experience)
+
+	// the experience growing out of range
+	repo.items[0].Experience = MaxExperience - 10
+	_, err = s.GrantExperience(ctx, id, GrantExperienceRequest{Amount: 11})
+	if assert.IsType(t, validation.Errors{}, err) {
+		assert.Contains(t, err.(validation.Errors), "amount")
+	}
+	stored, _ = s.Get(ctx, id)
+	assert.Equal(t, int64(MaxExperience-10), stored.Experience)
+	character, err = s.GrantExperience(ctx, id, GrantExperienceRequest{Amount: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(MaxExperience), character.Experience)
+}
+
+func Test_service_RefreshEquipment(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	equipment := mockEquipment{}
+	s := NewService(repo, newMockTypeService(logger), DefaultValuators(), DefaultProgression(), equipment, nil, repo.transactional, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	character, _ := s.Create(ctx, CreateCharacterRequest{Name: "Frodo", CharacterCode: Hobbit, CharacterPower: 10})
+	id := character.ID
+	assert.Equal(t, int64(10), character.EffectivePower)
+
+	// equipping
+	equipment[id] = []Modifier{{Flat: 5, Percent: 20}, {Percent: 30}}
+	character, err := s.RefreshEquipment(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), character.CharacterPower)
+	assert.Equal(t, int64(20), character.EffectivePower)
+	assert.Equal(t, int64(60), character.CharacterValue)
+	assert.Equal(t, int64(2), character.Version)
+	revisions, _ := s.QueryRevisions(ctx, id, 0, 1)
+	if assert.Len(t, revisions, 1) {
+		assert.Equal(t, entity.ActionEquipment, revisions[0].Action)
+	}
+
+	// nothing changed
+	character, err = s.RefreshEquipment(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), character.Version)
+
+	// the equipment applies to later changes of the base power
+	character, err = s.Update(ctx, id, UpdateCharacterRequest{Name: "Frodo", CharacterPower: 20}, AnyVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(35), character.EffectivePower)
+	assert.Equal(t, int64(105), character.CharacterValue)
+
+	// the effective power is never negative
+	equipment[id] = []Modifier{{Flat: -100}}
+	character, err = s.RefreshEquipment(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), character.EffectivePower)
+	assert.Equal(t, int64(0), character.CharacterValue)
+
+	_, err = s.RefreshEquipment(ctx, "unknown")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestCombineEquipment(t *testing.T) {
+	ctx := context.Background()
+	items := mockEquipment{"frodo": {{Flat: 5}}}
+	abilities := mockEquipment{"frodo": {{Percent: 10}, {Flat: 1}}, "sam": {{Flat: 2}}}
+	equipment := CombineEquipment(items, abilities)
+
+	modifiers, err := equipment.Modifiers(ctx, "frodo")
+	assert.Nil(t, err)
+	assert.Equal(t, []Modifier{{Flat: 5}, {Percent: 10}, {Flat: 1}}, modifiers)
+	modifiers, err = equipment.Modifiers(ctx, "sam")
+	assert.Nil(t, err)
+	assert.Equal(t, []Modifier{{Flat: 2}}, modifiers)
+	modifiers, err = CombineEquipment().Modifiers(ctx, "frodo")
+	assert.Nil(t, err)
+	assert.Empty(t, modifiers)
+	_, err = equipment.Modifiers(ctx, "error")
+	assert.Equal(t, errCRUD, err)
+}
+
+func Test_service_Revert(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := newMockService(repo, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	character, _ := s.Create(ctx, CreateCharacterRequest{Name: "Frodo", CharacterCode: 3, CharacterPower: 10})
+	id := character.ID
+	_, _ = s.Update(ctx, id, UpdateCharacterRequest{Name: "Frodo Baggins", CharacterPower: 20}, AnyVersion)
+
+	// by revision
+	character, err := s.Revert(ctx, id, RevertCharacterRequest{Revision: 1}, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "Frodo", character.Name)
+	assert.Equal(t, int64(10), character.CharacterPower)
+	assert.Equal(t, int64(20), character.CharacterValue)
+	assert.Equal(t, int64(3), character.Version)
+	stored, _ := s.Get(ctx, id)
+	assert.Equal(t, character.Character, stored.Character)
+	last := repo.revisions[len(repo.revisions)-1]
+	assert.Equal(t, entity.ActionRevert, last.Action)
+	assert.Equal(t, int64(3), last.Revision)
+	assert.Equal(t, "Frodo Baggins", last.Before.Name)
+	assert.Equal(t, "Frodo", last.After.Name)
+
+	// by time
+	day := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	for i := range repo.revisions {
+		repo.revisions[i].CreatedAt = day.Add(time.Duration(i) * 24 * time.Hour)
+	}
+	at := day.Add(36 * time.Hour)
+	character, err = s.Revert(ctx, id, RevertCharacterRequest{AsOf: &at}, AnyVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, "Frodo Baggins", character.Name)
+	assert.Equal(t, int64(60), character.CharacterValue)
+	at = day.Add(-time.Hour)
+	_, err = s.Revert(ctx, id, RevertCharacterRequest{AsOf: &at}, AnyVersion)
+	assert.Contains(t, err.(validation.Errors), "as_of")
+
+	// type changes
+	repo.revisions = append(repo.revisions,
+		entity.CharacterRevision{ID: "orc", CharacterID: id, Revision: 90, After: &entity.CharacterSnapshot{Name: "Orc", CharacterCode: 5, CharacterPower: 10}},
+		entity.CharacterRevision{ID: "dwarf", CharacterID: id, Revision: 91, After: &entity.CharacterSnapshot{Name: "Dwarf", CharacterCode: 4, CharacterPower: 10}},
+	)
+	character, err = s.Revert(ctx, id, RevertCharacterRequest{Revision: 90}, AnyVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), character.CharacterCode)
+	assert.Equal(t, int64(21), character.CharacterValue)
+	assert.Equal(t, int64(3), character.FormulaVersion)
+	_, err = s.Revert(ctx, id, RevertCharacterRequest{Revision: 91}, AnyVersion)
+	assert.Contains(t, err.(validation.Errors), "character_code")
+
+	// failures
+	version := character.Version
+	_, err = s.Revert(ctx, id, RevertCharacterRequest{Revision: 99}, AnyVersion)
+	assert.Contains(t, err.(validation.Errors), "revision")
+	_, err = s.Revert(ctx, id, RevertCharacterRequest{Revision: 1}, 1)
+	assert.Equal(t, ErrVersionConflict, err)
+	_, err = s.Revert(auth.WithUser(context.Background(), "101", "Other"), id, RevertCharacterRequest{Revision: 1}, AnyVersion)
+	assert.Equal(t, ErrNotOwner, err)
+	_, err = s.Revert(ctx, id, RevertCharacterRequest{}, AnyVersion)
+	assert.NotNil(t, err)
+	_, err = s.Revert(ctx, "none", RevertCharacterRequest{Revision: 1}, AnyVersion)
+	assert.Equal(t, sql.ErrNoRows, err)
+	stored, _ = s.Get(ctx, id)
+	assert.Equal(t, version, stored.Version)
+
+	// deletions cannot be reverted to
+	other, _ := s.Create(ctx, CreateCharacterRequest{Name: "Sam", CharacterCode: 3, CharacterPower: 10})
+	_, _ = s.Delete(ctx, other.ID, AnyVersion)
+	_, _ = s.Restore(ctx, other.ID)
+	_, err = s.Revert(ctx, other.ID, RevertCharacterRequest{Revision: 2}, AnyVersion)
+	assert.Contains(t, err.(validation.Errors), "revision")
+}
+
+func TestLeaderboardRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     LeaderboardRequest
+		wantError bool
+	}{
+		{"top", LeaderboardRequest{Top: 10}, false},
+		{"no top", LeaderboardRequest{}, true},
+		{"top too large", LeaderboardRequest{Top: MaxLeaderboardTop + 1}, true},
+		{"negative top", LeaderboardRequest{Top: -1}, true},
+		{"around", LeaderboardRequest{Around: "1", Window: 5}, false},
+		{"window too large", LeaderboardRequest{Around: "1", Window: MaxLeaderboardWindow + 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_Leaderboard(t *testing.T) {
+	logger, _ := log.NewForTest()
+	day := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	repo := &mockRepository{items: []entity.Character{
+		{ID: "a", CharacterCode: 1, CharacterPower: 10, CharacterValue: 15, CreatedAt: day},
+		{ID: "b", CharacterCode: 3, CharacterPower: 20, CharacterValue: 60, CreatedAt: day},
+		{ID: "c", CharacterCode: 3, CharacterPower: 30, CharacterValue: 60, CreatedAt: day},
+		{ID: "d", CharacterCode: 3, CharacterPower: 30, CharacterValue: 60, CreatedAt: day.Add(time.Hour)},
+		{ID: "e", CharacterCode: 3, CharacterPower: 30, CharacterValue: 60, CreatedAt: day.Add(time.Hour)},
+		{ID: "f", CharacterCode: 1, CharacterPower: 100, CharacterValue: 150, CreatedAt: day},
+	}}
+	s := newMockService(repo, logger)
+	ctx := context.Background()
+
+	ranked := func(characters []RankedCharacter) []string {
+		result := make([]string, len(characters))
+		for i, c := range characters {
+			result[i] = fmt.Sprintf("%v:%v", c.Rank, c.ID)
+		}
+		return result
+	}
+
+	characters, err := s.Leaderboard(ctx, LeaderboardRequest{Top: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1:f", "2:c", "3:d", "3:e", "5:b", "6:a"}, ranked(characters))
+	characters, _ = s.Leaderboard(ctx, LeaderboardRequest{Top: 2})
+	assert.Equal(t, []string{"1:f", "2:c"}, ranked(characters))
+	characters, _ = s.Leaderboard(ctx, LeaderboardRequest{Top: 10, Filter: Filter{CharacterCodes: []int64{1}}})
+	assert.Equal(t, []string{"1:f", "2:a"}, ranked(characters))
+	characters, _ = s.Leaderboard(ctx, LeaderboardRequest{Around: "e", Window: 1})
+	assert.Equal(t, []string{"3:d", "3:e", "5:b"}, ranked(characters))
+	characters, _ = s.Leaderboard(ctx, LeaderboardRequest{Around: "f", Window: 1})
+	assert.Equal(t, []string{"1:f", "2:c"}, ranked(characters))
+
+	_, err = s.Leaderboard(ctx, LeaderboardRequest{Around: "f", Filter: Filter{CharacterCodes: []int64{3}}})
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Leaderboard(ctx, LeaderboardRequest{})
+	assert.NotNil(t, err)
+}
+
+func Test_service_Stats(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: []entity.Character{
+		{ID: "1", CharacterCode: 3, CharacterPower: 10, CharacterValue: 20},
+		{ID: "2", CharacterCode: 3, CharacterPower: 20, CharacterValue: 60},
+		{ID: "3", CharacterCode: 3, CharacterPower: 30, CharacterValue: 90},
+		{ID: "4", CharacterCode: 1, CharacterPower: 100, CharacterValue: 150},
+	}}
+	s := newMockService(repo, logger)
+	ctx := context.Background()
+
+	stats, err := s.Stats(ctx, Filter{})
+	assert.Nil(t, err)
+	if assert.Len(t, stats, 2) {
+		assert.Equal(t, TypeStats{CharacterCode: 1, Count: 1,
+			CharacterPower: FieldStats{Sum: 100, Avg: 100, Min: 100, Max: 100, P50: 100, P90: 100, P99: 100},
+			CharacterValue: FieldStats{Sum: 150, Avg: 150, Min: 150, Max: 150, P50: 150, P90: 150, P99: 150},
+		}, stats[0])
+		assert.Equal(t, int64(3), stats[1].Count)
+		assert.Equal(t, FieldStats{Sum: 60, Avg: 20, Min: 10, Max: 30, P50: 20, P90: 28, P99: 29.8}, stats[1].CharacterPower)
+	}
+
+	stats, err = s.Stats(ctx, Filter{CharacterCodes: []int64{2}})
+	assert.Nil(t, err)
+	assert.Equal(t, []TypeStats{}, stats)
+}
+
 type mockRepository struct {
-	items []entity.Character
+	items     []entity.Character
+	revisions []entity.CharacterRevision
 }
 
 func (m mockRepository) Get(ctx context.Context, id string) (entity.Character, error) {
 	for _, item := range m.items {
-		if item.ID == id {
+		if item.ID == id && item.DeletedAt == nil {
 			return item, nil
 		}
 	}
 	return entity.Character{}, sql.ErrNoRows
 }
 
-func (m mockRepository) Count(ctx context.Context) (int, error) {
-	return len(m.items), nil
+func (m mockRepository) Count(ctx context.Context, filter Filter) (int, error) {
+	count := 0
+	for _, item := range m.items {
+		if item.DeletedAt == nil && matchFilter(filter, item) {
+			count++
+		}
+	}
+	return count, nil
 }
 
-func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.Character, error) {
-	return m.items, nil
+func (m mockRepository) Query(ctx context.Context, filter Filter, sort Sort, offset, limit int) ([]entity.Character, error) {
+	var items []entity.Character
+	for _, item := range m.items {
+		if item.DeletedAt == nil && matchFilter(filter, item) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m mockRepository) QueryAfter(ctx context.Context, filter Filter, order Sort, keys []interface{}, limit int) ([]entity.Character, error) {
+	var items []entity.Character
+	for _, item := range m.items {
+		if item.DeletedAt == nil && matchFilter(filter, item) && (keys == nil || compareKeys(order, order.Keys(item), keys) > 0) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return compareKeys(order, order.Keys(items[i]), order.Keys(items[j])) < 0
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func (m mockRepository) Each(ctx context.Context, filter Filter, order Sort, fn func(entity.Character) error) error {
+	items, _ := m.QueryAfter(ctx, filter, order, nil, len(m.items))
+	for _, item := range items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m mockRepository) Rank(ctx context.Context, filter Filter, around string, size int) ([]RankedCharacter, error) {
+	order := Sort{{Column: "character_value", Desc: true}, {Column: "character_power", Desc: true}, {Column: "created_at"}, {Column: "id"}}
+	items, _ := m.QueryAfter(ctx, filter, order, nil, len(m.items))
+	ranked := make([]RankedCharacter, len(items))
+	from, to := 0, size
+	for i, item := range items {
+		ranked[i] = RankedCharacter{item, int64(i + 1)}
+		if i > 0 && compareKeys(order[:3], order.Keys(item)[:3], order.Keys(items[i-1])[:3]) == 0 {
+			ranked[i].Rank = ranked[i-1].Rank
+		}
+		if item.ID == around {
+			from, to = i-size, i+size+1
+		}
+	}
+	if around != "" && to == size {
+		return nil, nil
+	}
+	if from < 0 {
+		from = 0
+	}
+	if to > len(ranked) {
+		to = len(ranked)
+	}
+	return ranked[from:to], nil
+}
+
+func (m mockRepository) Stats(ctx context.Context, filter Filter) ([]TypeStats, error) {
+	groups := map[int64][]entity.Character{}
+	var codes []int64
+	for _, item := range m.items {
+		if item.DeletedAt == nil && matchFilter(filter, item) {
+			if _, ok := groups[item.CharacterCode]; !ok {
+				codes = append(codes, item.CharacterCode)
+			}
+			groups[item.CharacterCode] = append(groups[item.CharacterCode], item)
+		}
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	var stats []TypeStats
+	for _, code := range codes {
+		var powers, values []int64
+		for _, item := range groups[code] {
+			powers = append(powers, item.CharacterPower)
+			values = append(values, item.CharacterValue)
+		}
+		stats = append(stats, TypeStats{code, int64(len(powers)), mockFieldStats(powers), mockFieldStats(values)})
+	}
+	return stats, nil
+}
+
+// mockFieldStats computes the statistics of the given values like PostgreSQL does.
+func mockFieldStats(values []int64) FieldStats {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	percentile := func(p float64) float64 {
+		pos := p * float64(len(values)-1)
+		i := int(pos)
+		if i+1 == len(values) {
+			return float64(values[i])
+		}
+		return float64(values[i]) + (pos-float64(i))*float64(values[i+1]-values[i])
+	}
+	stats := FieldStats{Min: values[0], Max: values[len(values)-1], P50: percentile(0.5), P90: percentile(0.9), P99: percentile(0.99)}
+	for _, v := range values {
+		stats.Sum += v
+	}
+	stats.Avg = float64(stats.Sum) / float64(len(values))
+	return stats
+}
+
+// compareKeys compares two lists of sort column values in the given order.
+func compareKeys(order Sort, a, b []interface{}) int {
+	for i, field := range order {
+		c := 0
+		switch x := a[i].(type) {
+		case string:
+			c = strings.Compare(x, b[i].(string))
+		case int64:
+			if y := b[i].(int64); x < y {
+				c = -1
+			} else if x > y {
+				c = 1
+			}
+		case time.Time:
+			if y := b[i].(time.Time); x.Before(y) {
+				c = -1
+			} else if x.After(y) {
+				c = 1
+			}
+		}
+		if field.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// matchFilter reports whether a character satisfies the filter. Only the character codes and owner are checked.
+func matchFilter(filter Filter, character entity.Character) bool {
+	if filter.OwnerID != "" && filter.OwnerID != character.OwnerID {
+		return false
+	}
+	if len(filter.CharacterCodes) == 0 {
+		return true
+	}
+	for _, code := range filter.CharacterCodes {
+		if code == character.CharacterCode {
+			return true
+		}
+	}
+	return false
+}
+
+// transactional runs the given function and restores the items and revisions of the repository if the function
+// fails.
+func (m *mockRepository) transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	items := append([]entity.Character(nil), m.items...)
+	revisions := append([]entity.CharacterRevision(nil), m.revisions...)
+	if err := f(ctx); err != nil {
+		m.items, m.revisions = items, revisions
+		return err
+	}
+	return nil
+}
+
+func (m *mockRepository) CreateRevisions(ctx context.Context, revisions []entity.CharacterRevision) error {
+	for _, rev := range revisions {
+		for _, r := range m.revisions {
+			if r.CharacterID == rev.CharacterID && r.Revision == rev.Revision {
+				return errors.New("duplicate revision")
+			}
+		}
+		m.revisions = append(m.revisions, rev)
+	}
+	return nil
+}
+
+func (m mockRepository) CountRevisions(ctx context.Context, characterID string) (int, error) {
+	revisions, _ := m.QueryRevisions(ctx, characterID, 0, len(m.revisions))
+	return len(revisions), nil
+}
+
+func (m mockRepository) GetRevision(ctx context.Context, characterID string, revision int64) (entity.CharacterRevision, error) {
+	for _, rev := range m.revisions {
+		if rev.CharacterID == characterID && rev.Revision == revision {
+			return rev, nil
+		}
+	}
+	return entity.CharacterRevision{}, sql.ErrNoRows
+}
+
+func (m mockRepository) GetRevisionAt(ctx context.Context, characterID string, at time.Time) (entity.CharacterRevision, error) {
+	revisions, _ := m.QueryRevisions(ctx, characterID, 0, len(m.revisions))
+	for _, rev := range revisions {
+		if !rev.CreatedAt.After(at) {
+			return rev, nil
+		}
+	}
+	return entity.CharacterRevision{}, sql.ErrNoRows
+}
+
+func (m mockRepository) GetFirstRevision(ctx context.Context, characterID string) (entity.CharacterRevision, error) {
+	revisions, _ := m.QueryRevisions(ctx, characterID, 0, len(m.revisions))
+	if len(revisions) == 0 {
+		return entity.CharacterRevision{}, sql.ErrNoRows
+	}
+	return revisions[len(revisions)-1], nil
+}
+
+func (m mockRepository) QueryRevisions(ctx context.Context, characterID string, offset, limit int) ([]entity.CharacterRevision, error) {
+	var revisions []entity.CharacterRevision
+	for i := len(m.revisions) - 1; i >= 0; i-- {
+		if m.revisions[i].CharacterID == characterID {
+			revisions = append(revisions, m.revisions[i])
+		}
+	}
+	if offset > len(revisions) {
+		offset = len(revisions)
+	}
+	revisions = revisions[offset:]
+	if len(revisions) > limit {
+		revisions = revisions[:limit]
+	}
+	return revisions, nil
 }
 
 func (m *mockRepository) Create(ctx context.Context, character entity.Character) error {
@@ -169,12 +1523,46 @@ func (m *mockRepository) Create(ctx context.Context, character entity.Character)
 	return nil
 }
 
+func (m *mockRepository) CreateBatch(ctx context.Context, characters []entity.Character) error {
+	for _, character := range characters {
+		if character.Name == "error" {
+			return errCRUD
+		}
+	}
+	m.items = append(m.items, characters...)
+	return nil
+}
+
+// mockEquipment holds the modifiers of the equipment of characters indexed by character ID.
+type mockEquipment map[string][]Modifier
+
+func (m mockEquipment) Modifiers(ctx context.Context, characterID string) ([]Modifier, error) {
+	if characterID == "error" {
+		return nil, errCRUD
+	}
+	return m[characterID], nil
+}
+
+func (m *mockRepository) AddExperience(ctx context.Context, id string, amount int64) (entity.Character, error) {
+	for i, item := range m.items {
+		if item.ID == id && item.DeletedAt == nil && item.Experience <= MaxExperience-amount {
+			m.items[i].Experience += amount
+			return m.items[i], nil
+		}
+	}
+	return entity.Character{}, sql.ErrNoRows
+}
+
 func (m *mockRepository) Update(ctx context.Context, character entity.Character) error {
 	if character.Name == "error" {
 		return errCRUD
 	}
 	for i, item := range m.items {
-		if item.ID == character.ID {
+		if item.ID == character.ID && item.DeletedAt == nil {
+			if item.Version != character.Version {
+				return ErrVersionConflict
+			}
+			character.Version++
 			m.items[i] = character
 			break
 		}
@@ -182,11 +1570,137 @@ func (m *mockRepository) Update(ctx context.Context, character entity.Character)
 	return nil
 }
 
-func (m *mockRepository) Delete(ctx context.Context, id string) error {
+func (m *mockRepository) Delete(ctx context.Context, id string, version int64) error {
+	for i, item := range m.items {
+		if item.ID == id && item.DeletedAt == nil {
+			if version != AnyVersion && item.Version != version {
+				return ErrVersionConflict
+			}
+			now := time.Now()
+			m.items[i].DeletedAt = &now
+			m.items[i].Version++
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m mockRepository) GetDeleted(ctx context.Context, id string) (entity.Character, error) {
+	for _, item := range m.items {
+		if item.ID == id && item.DeletedAt != nil {
+			return item, nil
+		}
+	}
+	return entity.Character{}, sql.ErrNoRows
+}
+
+func (m mockRepository) CountDeleted(ctx context.Context) (int, error) {
+	items, err := m.QueryDeleted(ctx, 0, len(m.items))
+	return len(items), err
+}
+
+func (m mockRepository) QueryDeleted(ctx context.Context, offset, limit int) ([]entity.Character, error) {
+	var items []entity.Character
+	for _, item := range m.items {
+		if item.DeletedAt != nil {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *mockRepository) Restore(ctx context.Context, id string) error {
+	for i, item := range m.items {
+		if item.ID == id && item.DeletedAt != nil {
+			m.items[i].DeletedAt = nil
+			m.items[i].Version++
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	var count int64
+	var items []entity.Character
+	for _, item := range m.items {
+		if item.DeletedAt != nil && item.DeletedAt.Before(before) {
+			count++
+		} else {
+			items = append(items, item)
+		}
+	}
+	m.items = items
+	return count, nil
+}
+
+// newMockService returns a service over the given repository with the types of newMockTypeService, the default
+// valuation and progression, no equipment and no listener.
+func newMockService(repo *mockRepository, logger log.Logger) Service {
+	return NewService(repo, newMockTypeService(logger), DefaultValuators(), DefaultProgression(), mockEquipment{}, nil, repo.transactional, logger)
+}
+
+var (
+	zero, hundred = float64(0), float64(100)
+	closed        = false
+)
+
+// newMockTypeService returns a character type service knowing Wizard with a mana, Elf with an agility and no other
+// attribute, and Hobbit, a retired type with code 4,
+// two types valued by formulas with codes 5 and 6, a type without any valuation strategy with code 7, and a type
+// requiring a fire attribute with code 8.
+func newMockTypeService(logger log.Logger) charactertype.Service {
+	now := time.Now()
+	return charactertype.NewService(&mockTypeRepository{items: []entity.CharacterType{
+		{CharacterCode: Wizard, Name: "Wizard", AttributeSchema: entity.AttributeSchema{
+			Properties: map[string]entity.AttributeProperty{"mana": {Type: "integer", Minimum: &zero}},
+		}, CreatedAt: now, UpdatedAt: now},
+		{CharacterCode: Elf, Name: "Elf", AttributeSchema: entity.AttributeSchema{
+			Properties:           map[string]entity.AttributeProperty{"agility": {Type: "integer", Minimum: &zero, Maximum: &hundred}},
+			AdditionalProperties: &closed,
+		}, CreatedAt: now, UpdatedAt: now},
+		{CharacterCode: Hobbit, Name: "Hobbit", CreatedAt: now, UpdatedAt: now},
+		{CharacterCode: 4, Name: "Dwarf", Retired: true, CreatedAt: now, UpdatedAt: now},
+		{CharacterCode: 5, Name: "Orc", Formula: "power * 2 + 1", FormulaVersion: 3, CreatedAt: now, UpdatedAt: now},
+		{CharacterCode: 6, Name: "Troll", Formula: "100 / (power - 10)", FormulaVersion: 1, CreatedAt: now, UpdatedAt: now},
+		{CharacterCode: 7, Name: "Ent", CreatedAt: now, UpdatedAt: now},
+		{CharacterCode: 8, Name: "Dragon", Formula: "power * 3", FormulaVersion: 1, AttributeSchema: entity.AttributeSchema{
+			Properties: map[string]entity.AttributeProperty{"fire": {Type: "integer", Minimum: &zero}},
+			Required:   []string{"fire"},
+		}, CreatedAt: now, UpdatedAt: now},
+	}}, logger)
+}
+
+type mockTypeRepository struct {
+	items []entity.CharacterType
+}
+
+func (m mockTypeRepository) Get(ctx context.Context, code int64) (entity.CharacterType, error) {
+	for _, item := range m.items {
+		if item.CharacterCode == code {
+			return item, nil
+		}
+	}
+	return entity.CharacterType{}, sql.ErrNoRows
+}
+
+func (m mockTypeRepository) Count(ctx context.Context) (int, error) {
+	return len(m.items), nil
+}
+
+func (m mockTypeRepository) Query(ctx context.Context, offset, limit int) ([]entity.CharacterType, error) {
+	return m.items, nil
+}
+
+func (m *mockTypeRepository) Create(ctx context.Context, characterType entity.CharacterType) error {
+	m.items = append(m.items, characterType)
+	return nil
+}
+
+func (m *mockTypeRepository) Update(ctx context.Context, characterType entity.CharacterType) error {
 	for i, item := range m.items {
-		if item.ID == id {
-			m.items[i] = m.items[len(m.items)-1]
-			m.items = m.items[:len(m.items)-1]
+		if item.CharacterCode == characterType.CharacterCode {
+			m.items[i] = characterType
 			break
 		}
 	}
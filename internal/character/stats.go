@@ -0,0 +1,38 @@
+package character
+
+import (
+	"context"
+)
+
+// FieldStats summarizes the values that a numeric field takes among characters.
+// Percentiles are interpolated between the closest values, so they may be fractional.
+type FieldStats struct {
+	Sum int64   `json:"sum"`
+	Avg float64 `json:"avg"`
+	Min int64   `json:"min"`
+	Max int64   `json:"max"`
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+// TypeStats summarizes the characters of a type.
+type TypeStats struct {
+	CharacterCode  int64      `json:"character_code"`
+	Count          int64      `json:"count"`
+	CharacterPower FieldStats `json:"character_power"`
+	CharacterValue FieldStats `json:"character_value"`
+}
+
+// Stats returns the statistics of the power and value of the characters satisfying the given filter, for each
+// character type, ordered by character code. Types without such characters are omitted.
+func (s service) Stats(ctx context.Context, filter Filter) ([]TypeStats, error) {
+	stats, err := s.repo.Stats(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if stats == nil {
+		stats = []TypeStats{}
+	}
+	return stats, nil
+}
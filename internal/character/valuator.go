@@ -0,0 +1,134 @@
+package character
+
+import (
+	"errors"
+	"math"
+
+	"github.com/hikvineh/go-rest-game-character/internal/charactertype"
+	"github.com/hikvineh/go-rest-game-character/pkg/expr"
+)
+
+var (
+	// ErrValueOverflow is returned when a character value does not fit into an int64.
+	ErrValueOverflow = errors.New("character value overflows")
+	// ErrNoValuator is returned when no valuation strategy is registered for a character type.
+	ErrNoValuator = errors.New("no valuation strategy registered")
+)
+
+// Valuator computes the value of a character from its power.
+type Valuator interface {
+	// Value returns the character value for the given power.
+	Value(power int64) (int64, error)
+}
+
+// Valuators holds the valuation strategies indexed by character code.
+type Valuators map[int64]Valuator
+
+// DefaultValuators returns the valuation strategies of the built-in character types.
+func DefaultValuators() Valuators {
+	return Valuators{
+		Wizard: PercentValuator{Percent: 150},
+		Elf:    PercentValuator{Percent: 110, Bonus: 2},
+		Hobbit: ThresholdValuator{
+			Threshold: 20,
+			Below:     PercentValuator{Percent: 200},
+			Above:     PercentValuator{Percent: 300},
+		},
+	}
+}
+
+// Register registers the valuation strategy for the given character code, replacing any existing one.
+func (v Valuators) Register(code int64, valuator Valuator) {
+	v[code] = valuator
+}
+
+// Value computes the value of a character of the given type and power.
+// ErrNoValuator is returned if no strategy is registered for the character code.
+func (v Valuators) Value(code, power int64) (int64, error) {
+	valuator, ok := v[code]
+	if !ok {
+		return 0, ErrNoValuator
+	}
+	return valuator.Value(power)
+}
+
+// PercentValuator values a character at a percentage of its power plus a flat bonus.
+// The result is truncated toward zero.
+type PercentValuator struct {
+	Percent int64
+	Bonus   int64
+}
+
+// Value returns power * Percent / 100 + Bonus.
+func (v PercentValuator) Value(power int64) (int64, error) {
+	value, err := scale(power, v.Percent)
+	if err != nil {
+		return 0, err
+	}
+	return add(value, v.Bonus)
+}
+
+// ThresholdValuator delegates to Below when the power is less than Threshold, and to Above otherwise.
+type ThresholdValuator struct {
+	Threshold int64
+	Below     Valuator
+	Above     Valuator
+}
+
+// Value returns the value computed by the strategy selected by the power.
+func (v ThresholdValuator) Value(power int64) (int64, error) {
+	if power < v.Threshold {
+		return v.Below.Value(power)
+	}
+	return v.Above.Value(power)
+}
+
+// ExpressionValuator values a character with a formula evaluated against its power.
+// The formulas are stored with the character types, see charactertype.ParseFormula.
+type ExpressionValuator struct {
+	Expression *expr.Expression
+}
+
+// Value evaluates the formula with the given power and truncates the result toward zero.
+func (v ExpressionValuator) Value(power int64) (int64, error) {
+	value, err := v.Expression.Int(map[string]int64{charactertype.PowerVariable: power})
+	if err == expr.ErrOverflow {
+		return 0, ErrValueOverflow
+	}
+	return value, err
+}
+
+// scale returns n * percent / 100 truncated toward zero.
+// The division is distributed over n so that the intermediate product only overflows when the result does.
+func scale(n, percent int64) (int64, error) {
+	high, err := mul(n/100, percent)
+	if err != nil {
+		return 0, err
+	}
+	low, err := mul(n%100, percent)
+	if err != nil {
+		return 0, err
+	}
+	return add(high, low/100)
+}
+
+// mul returns a * b, or ErrValueOverflow if the product does not fit into an int64.
+func mul(a, b int64) (int64, error) {
+	if a == 0 || b == 0 {
+		return 0, nil
+	}
+	c := a * b
+	if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, ErrValueOverflow
+	}
+	return c, nil
+}
+
+// add returns a + b, or ErrValueOverflow if the sum does not fit into an int64.
+func add(a, b int64) (int64, error) {
+	c := a + b
+	if (b > 0 && c < a) || (b < 0 && c > a) {
+		return 0, ErrValueOverflow
+	}
+	return c, nil
+}
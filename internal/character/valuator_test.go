@@ -0,0 +1,146 @@
+package character
+
+import (
+	"math"
+	"testing"
+
+	"github.com/hikvineh/go-rest-game-character/internal/charactertype"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValuators_Value(t *testing.T) {
+	valuators := DefaultValuators()
+	tests := []struct {
+		name      string
+		code      int64
+		power     int64
+		wantValue int64
+		wantError error
+	}{
+		{"wizard", Wizard, 100, 150, nil},
+		{"wizard truncated", Wizard, 15, 22, nil},
+		{"wizard zero", Wizard, 0, 0, nil},
+		{"elf", Elf, 60, 68, nil},
+		{"elf zero", Elf, 0, 2, nil},
+		{"hobbit below threshold", Hobbit, 19, 38, nil},
+		{"hobbit at threshold", Hobbit, 20, 60, nil},
+		{"hobbit above threshold", Hobbit, 100, 300, nil},
+		{"wizard large", Wizard, math.MaxInt64 / 2, math.MaxInt64/2 + math.MaxInt64/4, nil},
+		{"wizard overflow", Wizard, math.MaxInt64, 0, ErrValueOverflow},
+		{"hobbit overflow", Hobbit, math.MaxInt64 / 2, 0, ErrValueOverflow},
+		{"unknown type", 9, 100, 0, ErrNoValuator},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := valuators.Value(tt.code, tt.power)
+			assert.Equal(t, tt.wantError, err)
+			assert.Equal(t, tt.wantValue, value)
+		})
+	}
+}
+
+func TestValuators_Register(t *testing.T) {
+	valuators := DefaultValuators()
+	valuators.Register(4, PercentValuator{Percent: 120, Bonus: 5})
+	value, err := valuators.Value(4, 50)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(65), value)
+
+	valuators.Register(Wizard, PercentValuator{Percent: 100})
+	value, err = valuators.Value(Wizard, 50)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(50), value)
+}
+
+func TestPercentValuator_Value(t *testing.T) {
+	value, err := PercentValuator{Percent: 100, Bonus: 1}.Value(math.MaxInt64 - 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(math.MaxInt64), value)
+
+	_, err = PercentValuator{Percent: 100, Bonus: 1}.Value(math.MaxInt64)
+	assert.Equal(t, ErrValueOverflow, err)
+}
+
+func TestExpressionValuator_Value(t *testing.T) {
+	e, err := charactertype.ParseFormula("power < 20 ? power*2 : power*3")
+	assert.Nil(t, err)
+	v := ExpressionValuator{e}
+
+	value, err := v.Value(19)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(38), value)
+	value, err = v.Value(20)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(60), value)
+	_, err = v.Value(math.MaxInt64)
+	assert.Equal(t, ErrValueOverflow, err)
+}
+
+func Test_scale(t *testing.T) {
+	tests := []struct {
+		name      string
+		n         int64
+		percent   int64
+		wantValue int64
+		wantError error
+	}{
+		{"exact", 100, 150, 150, nil},
+		{"truncated", 3, 150, 4, nil},
+		{"negative truncated", -3, 150, -4, nil},
+		{"no intermediate overflow", math.MaxInt64 / 2, 150, math.MaxInt64/2 + math.MaxInt64/4, nil},
+		{"overflow", math.MaxInt64, 200, 0, ErrValueOverflow},
+		{"negative overflow", math.MinInt64, 200, 0, ErrValueOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := scale(tt.n, tt.percent)
+			assert.Equal(t, tt.wantError, err)
+			assert.Equal(t, tt.wantValue, value)
+		})
+	}
+}
+
+func Test_mul(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, b      int64
+		wantValue int64
+		wantError error
+	}{
+		{"zero", 0, math.MaxInt64, 0, nil},
+		{"normal", 7, -6, -42, nil},
+		{"max", math.MaxInt64, 1, math.MaxInt64, nil},
+		{"overflow", math.MaxInt64, 2, 0, ErrValueOverflow},
+		{"min times -1", math.MinInt64, -1, 0, ErrValueOverflow},
+		{"-1 times min", -1, math.MinInt64, 0, ErrValueOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := mul(tt.a, tt.b)
+			assert.Equal(t, tt.wantError, err)
+			assert.Equal(t, tt.wantValue, value)
+		})
+	}
+}
+
+func Test_add(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, b      int64
+		wantValue int64
+		wantError error
+	}{
+		{"normal", 40, 2, 42, nil},
+		{"negative", -40, -2, -42, nil},
+		{"max", math.MaxInt64 - 1, 1, math.MaxInt64, nil},
+		{"overflow", math.MaxInt64, 1, 0, ErrValueOverflow},
+		{"underflow", math.MinInt64, -1, 0, ErrValueOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := add(tt.a, tt.b)
+			assert.Equal(t, tt.wantError, err)
+			assert.Equal(t, tt.wantValue, value)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package charactertype
+
+import (
+	"net/http"
+	"strconv"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/hikvineh/go-rest-game-character/internal/errors"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/hikvineh/go-rest-game-character/pkg/pagination"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+// The adminHandler guards the changes to character types, which are shared by all the characters.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler, adminHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/character-types/<code>", res.get)
+	r.Get("/character-types", res.query)
+
+	r.Use(authHandler, adminHandler)
+
+	// the following endpoints require a valid JWT of an administrator
+	r.Post("/character-types", res.create)
+	r.Put("/character-types/<code>", res.update)
+	r.Delete("/character-types/<code>", res.retire)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	code, err := parseCode(c)
+	if err != nil {
+		return err
+	}
+	characterType, err := r.service.Get(c.Request.Context(), code)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(characterType)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	characterTypes, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = characterTypes
+	return c.Write(pages)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreateCharacterTypeRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	characterType, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(characterType, http.StatusCreated)
+}
+
+func (r resource) update(c *routing.Context) error {
+	code, err := parseCode(c)
+	if err != nil {
+		return err
+	}
+	var input UpdateCharacterTypeRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	characterType, err := r.service.Update(c.Request.Context(), code, input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(characterType)
+}
+
+func (r resource) retire(c *routing.Context) error {
+	code, err := parseCode(c)
+	if err != nil {
+		return err
+	}
+	characterType, err := r.service.Retire(c.Request.Context(), code)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(characterType)
+}
+
+// parseCode returns the character code found in the request path.
+// A code that is not an integer cannot match any character type, so it is reported as not found.
+func parseCode(c *routing.Context) (int64, error) {
+	code, err := strconv.ParseInt(c.Param("code"), 10, 64)
+	if err != nil {
+		return 0, errors.NotFound("")
+	}
+	return code, nil
+}
@@ -0,0 +1,70 @@
+package charactertype
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{items: []entity.CharacterType{
+		{CharacterCode: 1, Name: "Wizard", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, auth.AdminHandler([]string{"100"}), logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/character-types", "", nil, http.StatusOK, `*"total_count":1*`},
+		{"get 1", "GET", "/character-types/1", "", nil, http.StatusOK, `*Wizard*`},
+		{"get unknown", "GET", "/character-types/2", "", nil, http.StatusNotFound, ""},
+		{"get non-numeric", "GET", "/character-types/abc", "", nil, http.StatusNotFound, ""},
+		{"create ok", "POST", "/character-types", `{"character_code":4,"name":"Dwarf"}`, header, http.StatusCreated, "*Dwarf*"},
+		{"create ok count", "GET", "/character-types", "", nil, http.StatusOK, `*"total_count":2*`},
+		{"create formula", "POST", "/character-types", `{"character_code":5,"name":"Orc","formula":"power * 2"}`, header, http.StatusCreated, `*"formula_version":1*`},
+		{"create invalid formula", "POST", "/character-types", `{"character_code":6,"name":"Troll","formula":"power *"}`, header, http.StatusBadRequest, `*formula*`},
+		{"create duplicate", "POST", "/character-types", `{"character_code":4,"name":"Dwarf"}`, header, http.StatusBadRequest, ""},
+		{"create auth error", "POST", "/character-types", `{"character_code":5,"name":"Orc"}`, nil, http.StatusUnauthorized, ""},
+		{"create input error", "POST", "/character-types", `"character_code":5}`, header, http.StatusBadRequest, ""},
+		{"update ok", "PUT", "/character-types/1", `{"name":"Sorcerer"}`, header, http.StatusOK, "*Sorcerer*"},
+		{"update formula", "PUT", "/character-types/5", `{"name":"Orc","formula":"power * 3"}`, header, http.StatusOK, `*"formula_version":2*`},
+		{"update invalid formula", "PUT", "/character-types/5", `{"name":"Orc","formula":"power > 3"}`, header, http.StatusBadRequest, `*formula*`},
+		{"update verify", "GET", "/character-types/1", "", nil, http.StatusOK, `*Sorcerer*`},
+		{"update auth error", "PUT", "/character-types/1", `{"name":"Sorcerer"}`, nil, http.StatusUnauthorized, ""},
+		{"update input error", "PUT", "/character-types/1", `"name":"Sorcerer"}`, header, http.StatusBadRequest, ""},
+		{"retire ok", "DELETE", "/character-types/1", ``, header, http.StatusOK, `*"retired":true*`},
+		{"retire verify", "GET", "/character-types/1", "", nil, http.StatusOK, `*"retired":true*`},
+		{"retire unknown", "DELETE", "/character-types/9", ``, header, http.StatusNotFound, ""},
+		{"retire auth error", "DELETE", "/character-types/1", ``, nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+func TestAPI_admin(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{items: []entity.CharacterType{
+		{CharacterCode: 1, Name: "Wizard", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, auth.AdminHandler(nil), logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get 1", "GET", "/character-types/1", "", nil, http.StatusOK, `*Wizard*`},
+		{"create forbidden", "POST", "/character-types", `{"character_code":4,"name":"Dwarf"}`, header, http.StatusForbidden, ""},
+		{"update forbidden", "PUT", "/character-types/1", `{"name":"Sorcerer"}`, header, http.StatusForbidden, ""},
+		{"retire forbidden", "DELETE", "/character-types/1", ``, header, http.StatusForbidden, ""},
+		{"type unchanged", "GET", "/character-types/1", "", nil, http.StatusOK, `*"name":"Wizard"*`},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
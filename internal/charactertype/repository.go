@@ -0,0 +1,70 @@
+package charactertype
+
+import (
+	"context"
+
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/dbcontext"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// Repository encapsulates the logic to access character types from the data source.
+type Repository interface {
+	// Get returns the character type with the specified character code.
+	Get(ctx context.Context, code int64) (entity.CharacterType, error)
+	// Count returns the number of character types.
+	Count(ctx context.Context) (int, error)
+	// Query returns the list of character types with the given offset and limit.
+	Query(ctx context.Context, offset, limit int) ([]entity.CharacterType, error)
+	// Create saves a new character type in the storage.
+	Create(ctx context.Context, characterType entity.CharacterType) error
+	// Update updates the character type with given character code in the storage.
+	Update(ctx context.Context, characterType entity.CharacterType) error
+}
+
+// repository persists character types in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new character type repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the character type with the specified character code from the database.
+func (r repository) Get(ctx context.Context, code int64) (entity.CharacterType, error) {
+	var characterType entity.CharacterType
+	err := r.db.With(ctx).Select().Model(code, &characterType)
+	return characterType, err
+}
+
+// Create saves a new character type record in the database.
+func (r repository) Create(ctx context.Context, characterType entity.CharacterType) error {
+	return r.db.With(ctx).Model(&characterType).Insert()
+}
+
+// Update saves the changes to a character type in the database.
+func (r repository) Update(ctx context.Context, characterType entity.CharacterType) error {
+	return r.db.With(ctx).Model(&characterType).Update()
+}
+
+// Count returns the number of the character type records in the database.
+func (r repository) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("character_type").Row(&count)
+	return count, err
+}
+
+// Query retrieves the character type records with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.CharacterType, error) {
+	var characterTypes []entity.CharacterType
+	err := r.db.With(ctx).
+		Select().
+		OrderBy("character_code").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&characterTypes)
+	return characterTypes, err
+}
@@ -0,0 +1,67 @@
+package charactertype
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	// character_type is referenced by character, so only the row used by this test is removed
+	_, err := db.DB().Delete("character_type", dbx.HashExp{"character_code": 101}).Execute()
+	assert.Nil(t, err)
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+
+	// initial count
+	count, err := repo.Count(ctx)
+	assert.Nil(t, err)
+
+	// create
+	err = repo.Create(ctx, entity.CharacterType{
+		CharacterCode: 101,
+		Name:          "type1",
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	})
+	assert.Nil(t, err)
+	count2, _ := repo.Count(ctx)
+	assert.Equal(t, 1, count2-count)
+
+	// get
+	characterType, err := repo.Get(ctx, 101)
+	assert.Nil(t, err)
+	assert.Equal(t, "type1", characterType.Name)
+	assert.False(t, characterType.Retired)
+
+	_, err = repo.Get(ctx, 100)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// update
+	err = repo.Update(ctx, entity.CharacterType{
+		CharacterCode: 101,
+		Name:          "type1 updated",
+		Retired:       true,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	})
+	assert.Nil(t, err)
+	characterType, _ = repo.Get(ctx, 101)
+	assert.Equal(t, "type1 updated", characterType.Name)
+	assert.True(t, characterType.Retired)
+
+	// query
+	characterTypes, err := repo.Query(ctx, 0, count2)
+	assert.Nil(t, err)
+	assert.Equal(t, count2, len(characterTypes))
+}
@@ -0,0 +1,154 @@
+package charactertype
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+)
+
+// attributeName matches the names of the attributes described by attribute schemas.
+var attributeName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// attributeTypes lists the types of attributes supported by attribute schemas.
+var attributeTypes = map[string]bool{"string": true, "integer": true, "number": true, "boolean": true}
+
+// validSchema checks that a value is a consistent attribute schema.
+var validSchema = validation.By(func(value interface{}) error {
+	// the schema is not read through validation.Indirect, which would turn it into JSON as a driver.Valuer
+	var schema entity.AttributeSchema
+	switch v := value.(type) {
+	case entity.AttributeSchema:
+		schema = v
+	case *entity.AttributeSchema:
+		if v == nil {
+			return nil
+		}
+		schema = *v
+	}
+	for name, property := range schema.Properties {
+		if !attributeName.MatchString(name) {
+			return fmt.Errorf("property %v must have a name made of letters, digits and underscores", name)
+		}
+		if !attributeTypes[property.Type] {
+			return fmt.Errorf("property %v must have a type among string, integer, number and boolean", name)
+		}
+		if property.Minimum != nil && property.Maximum != nil && *property.Minimum > *property.Maximum {
+			return fmt.Errorf("property %v must have a minimum no greater than its maximum", name)
+		}
+		if property.MinLength != nil && property.MaxLength != nil && *property.MinLength > *property.MaxLength {
+			return fmt.Errorf("property %v must have a minLength no greater than its maxLength", name)
+		}
+		for _, value := range property.Enum {
+			if err := checkAttribute(property, value); err != nil {
+				return fmt.Errorf("property %v must only list valid values in enum", name)
+			}
+		}
+	}
+	for _, name := range schema.Required {
+		if _, ok := schema.Properties[name]; !ok {
+			return fmt.Errorf("required property %v must be described in properties", name)
+		}
+	}
+	return nil
+})
+
+// ValidateAttributes checks the attributes of a character against the attribute schema of its type. The errors are
+// reported as validation errors keyed by "attributes." followed by the name of the attribute.
+func ValidateAttributes(schema entity.AttributeSchema, attributes entity.Attributes) error {
+	errs := validation.Errors{}
+	for _, name := range schema.Required {
+		if _, ok := attributes[name]; !ok {
+			errs["attributes."+name] = errors.New("cannot be blank")
+		}
+	}
+	for name, value := range attributes {
+		property, ok := schema.Properties[name]
+		if !ok {
+			if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+				errs["attributes."+name] = errors.New("is not allowed")
+			}
+			continue
+		}
+		if err := checkAttribute(property, value); err != nil {
+			errs["attributes."+name] = err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkAttribute checks an attribute value against its description.
+func checkAttribute(property entity.AttributeProperty, value interface{}) error {
+	switch property.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return errors.New("must be a string")
+		}
+		length := utf8.RuneCountInString(s)
+		if property.MinLength != nil && length < *property.MinLength {
+			return fmt.Errorf("the length must be no less than %v", *property.MinLength)
+		}
+		if property.MaxLength != nil && length > *property.MaxLength {
+			return fmt.Errorf("the length must be no more than %v", *property.MaxLength)
+		}
+	case "integer", "number":
+		n, ok := number(value)
+		if !ok {
+			return errors.New("must be a number")
+		}
+		if property.Type == "integer" && n != math.Trunc(n) {
+			return errors.New("must be an integer")
+		}
+		if property.Minimum != nil && n < *property.Minimum {
+			return fmt.Errorf("must be no less than %v", *property.Minimum)
+		}
+		if property.Maximum != nil && n > *property.Maximum {
+			return fmt.Errorf("must be no greater than %v", *property.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return errors.New("must be a boolean")
+		}
+	}
+	if len(property.Enum) > 0 && !contains(property.Enum, value) {
+		return errors.New("must be a valid value")
+	}
+	return nil
+}
+
+// number returns the value of a JSON number, decoded either as json.Number or as a Go number.
+func number(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case json.Number:
+		f, err := strconv.ParseFloat(string(n), 64)
+		return f, err == nil
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// contains tells whether a value is among the given scalar JSON values. Numbers are compared by value.
+func contains(values []interface{}, value interface{}) bool {
+	n, isNumber := number(value)
+	for _, v := range values {
+		if m, ok := number(v); ok && isNumber && m == n || v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package charactertype
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_validSchema(t *testing.T) {
+	low, high, short, long := float64(0), float64(100), 1, 20
+	tests := []struct {
+		name      string
+		schema    entity.AttributeSchema
+		wantError bool
+	}{
+		{"empty", entity.AttributeSchema{}, false},
+		{"success", entity.AttributeSchema{
+			Properties: map[string]entity.AttributeProperty{
+				"mana":   {Type: "integer", Minimum: &low, Maximum: &high},
+				"school": {Type: "string", MinLength: &short, MaxLength: &long, Enum: []interface{}{"fire", "ice"}},
+			},
+			Required: []string{"mana"},
+		}, false},
+		{"invalid name", entity.AttributeSchema{Properties: map[string]entity.AttributeProperty{"mana-pool": {Type: "integer"}}}, true},
+		{"unknown type", entity.AttributeSchema{Properties: map[string]entity.AttributeProperty{"mana": {Type: "array"}}}, true},
+		{"empty range", entity.AttributeSchema{Properties: map[string]entity.AttributeProperty{"mana": {Type: "integer", Minimum: &high, Maximum: &low}}}, true},
+		{"empty length range", entity.AttributeSchema{Properties: map[string]entity.AttributeProperty{"school": {Type: "string", MinLength: &long, MaxLength: &short}}}, true},
+		{"invalid enum", entity.AttributeSchema{Properties: map[string]entity.AttributeProperty{"mana": {Type: "integer", Enum: []interface{}{"lots"}}}}, true},
+		{"unknown required", entity.AttributeSchema{Required: []string{"mana"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validSchema.Validate(tt.schema)
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func TestValidateAttributes(t *testing.T) {
+	low, high, long := float64(0), float64(100), 5
+	closed := false
+	schema := entity.AttributeSchema{
+		Properties: map[string]entity.AttributeProperty{
+			"agility": {Type: "integer", Minimum: &low, Maximum: &high},
+			"speed":   {Type: "number"},
+			"school":  {Type: "string", MaxLength: &long, Enum: []interface{}{"fire", "ice"}},
+			"elder":   {Type: "boolean"},
+			"rank":    {Type: "integer", Enum: []interface{}{json.Number("1"), json.Number("2")}},
+		},
+		Required:             []string{"agility"},
+		AdditionalProperties: &closed,
+	}
+	tests := []struct {
+		name       string
+		attributes entity.Attributes
+		want       string
+	}{
+		{"success", entity.Attributes{"agility": json.Number("90"), "speed": json.Number("1.5"), "school": "fire", "elder": true, "rank": float64(2)}, ""},
+		{"required", entity.Attributes{}, "attributes.agility: cannot be blank."},
+		{"additional", entity.Attributes{"agility": json.Number("1"), "mana": json.Number("1")}, "attributes.mana: is not allowed."},
+		{"not an integer", entity.Attributes{"agility": json.Number("1.5")}, "attributes.agility: must be an integer."},
+		{"too low", entity.Attributes{"agility": json.Number("-1")}, "attributes.agility: must be no less than 0."},
+		{"too high", entity.Attributes{"agility": json.Number("101")}, "attributes.agility: must be no greater than 100."},
+		{"not a number", entity.Attributes{"agility": json.Number("1"), "speed": "fast"}, "attributes.speed: must be a number."},
+		{"not a string", entity.Attributes{"agility": json.Number("1"), "school": json.Number("1")}, "attributes.school: must be a string."},
+		{"too long", entity.Attributes{"agility": json.Number("1"), "school": "necromancy"}, "attributes.school: the length must be no more than 5."},
+		{"not in enum", entity.Attributes{"agility": json.Number("1"), "school": "earth", "rank": json.Number("3")}, "attributes.rank: must be a valid value; attributes.school: must be a valid value."},
+		{"not a boolean", entity.Attributes{"agility": json.Number("1"), "elder": "yes"}, "attributes.elder: must be a boolean."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAttributes(schema, tt.attributes)
+			if tt.want == "" {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Equal(t, tt.want, err.Error())
+			}
+		})
+	}
+
+	// without a schema, any attribute is accepted
+	assert.Nil(t, ValidateAttributes(entity.AttributeSchema{}, entity.Attributes{"mana": "lots"}))
+}
@@ -0,0 +1,201 @@
+package charactertype
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/expr"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// PowerVariable is the name of the variable holding the character power in valuation formulas.
+const PowerVariable = "power"
+
+// Service encapsulates usecase logic for character types.
+type Service interface {
+	Get(ctx context.Context, code int64) (CharacterType, error)
+	Query(ctx context.Context, offset, limit int) ([]CharacterType, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, input CreateCharacterTypeRequest) (CharacterType, error)
+	Update(ctx context.Context, code int64, input UpdateCharacterTypeRequest) (CharacterType, error)
+	Retire(ctx context.Context, code int64) (CharacterType, error)
+}
+
+// CharacterType represents the data about a character type.
+type CharacterType struct {
+	entity.CharacterType
+}
+
+// ParseFormula parses a valuation formula, which computes the character value from the character power.
+func ParseFormula(formula string) (*expr.Expression, error) {
+	return expr.Parse(formula, PowerVariable)
+}
+
+// validFormula checks that a value is either empty or a valid valuation formula.
+var validFormula = validation.By(func(value interface{}) error {
+	value, isNil := validation.Indirect(value)
+	formula, _ := value.(string)
+	if isNil || formula == "" {
+		return nil
+	}
+	_, err := ParseFormula(formula)
+	return err
+})
+
+// CreateCharacterTypeRequest represents a character type creation request.
+// An empty formula means the character values are computed by the built-in valuation strategy of the type.
+// The attribute schema validates the attributes of the characters of the type, and allows any attributes if it is
+// omitted.
+type CreateCharacterTypeRequest struct {
+	CharacterCode   int64                  `json:"character_code"`
+	Name            string                 `json:"name"`
+	Formula         string                 `json:"formula"`
+	AttributeSchema entity.AttributeSchema `json:"attribute_schema"`
+}
+
+// Validate validates the CreateCharacterTypeRequest fields.
+func (m CreateCharacterTypeRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.CharacterCode, validation.Required, validation.Min(int64(1))),
+		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.Formula, validFormula),
+		validation.Field(&m.AttributeSchema, validSchema),
+	)
+}
+
+// UpdateCharacterTypeRequest represents a character type update request.
+// The formula and the attribute schema are left unchanged when they are omitted. A new attribute schema only applies
+// to the attributes of the characters written later.
+type UpdateCharacterTypeRequest struct {
+	Name            string                  `json:"name"`
+	Formula         *string                 `json:"formula"`
+	AttributeSchema *entity.AttributeSchema `json:"attribute_schema"`
+}
+
+// Validate validates the UpdateCharacterTypeRequest fields.
+func (m UpdateCharacterTypeRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.Formula, validFormula),
+		validation.Field(&m.AttributeSchema, validSchema),
+	)
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// NewService creates a new character type service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// Get returns the character type with the specified character code.
+func (s service) Get(ctx context.Context, code int64) (CharacterType, error) {
+	characterType, err := s.repo.Get(ctx, code)
+	if err != nil {
+		return CharacterType{}, err
+	}
+	return CharacterType{characterType}, nil
+}
+
+// Create creates a new character type.
+func (s service) Create(ctx context.Context, req CreateCharacterTypeRequest) (CharacterType, error) {
+	if err := req.Validate(); err != nil {
+		return CharacterType{}, err
+	}
+	if _, err := s.repo.Get(ctx, req.CharacterCode); err == nil {
+		return CharacterType{}, validation.Errors{
+			"character_code": errors.New("is already registered"),
+		}
+	} else if err != sql.ErrNoRows {
+		return CharacterType{}, err
+	}
+
+	var version int64
+	if req.Formula != "" {
+		version = 1
+	}
+
+	now := time.Now()
+	err := s.repo.Create(ctx, entity.CharacterType{
+		CharacterCode:   req.CharacterCode,
+		Name:            req.Name,
+		Formula:         req.Formula,
+		FormulaVersion:  version,
+		AttributeSchema: req.AttributeSchema,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	})
+	if err != nil {
+		return CharacterType{}, err
+	}
+	return s.Get(ctx, req.CharacterCode)
+}
+
+// Update renames the character type with the specified character code and changes its formula and its attribute
+// schema.
+// The formula version is increased whenever the formula changes.
+func (s service) Update(ctx context.Context, code int64, req UpdateCharacterTypeRequest) (CharacterType, error) {
+	if err := req.Validate(); err != nil {
+		return CharacterType{}, err
+	}
+
+	characterType, err := s.Get(ctx, code)
+	if err != nil {
+		return characterType, err
+	}
+	characterType.Name = req.Name
+	if req.Formula != nil && *req.Formula != characterType.Formula {
+		characterType.Formula = *req.Formula
+		characterType.FormulaVersion++
+	}
+	if req.AttributeSchema != nil {
+		characterType.AttributeSchema = *req.AttributeSchema
+	}
+	characterType.UpdatedAt = time.Now()
+
+	if err := s.repo.Update(ctx, characterType.CharacterType); err != nil {
+		return characterType, err
+	}
+	return characterType, nil
+}
+
+// Retire marks the character type with the specified character code as retired.
+// A retired type is kept for the characters already using it, but new characters can no longer be created with it.
+func (s service) Retire(ctx context.Context, code int64) (CharacterType, error) {
+	characterType, err := s.Get(ctx, code)
+	if err != nil {
+		return characterType, err
+	}
+	characterType.Retired = true
+	characterType.UpdatedAt = time.Now()
+
+	if err := s.repo.Update(ctx, characterType.CharacterType); err != nil {
+		return characterType, err
+	}
+	return characterType, nil
+}
+
+// Count returns the number of character types.
+func (s service) Count(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
+}
+
+// Query returns the character types with the specified offset and limit.
+func (s service) Query(ctx context.Context, offset, limit int) ([]CharacterType, error) {
+	items, err := s.repo.Query(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []CharacterType{}
+	for _, item := range items {
+		result = append(result, CharacterType{item})
+	}
+	return result, nil
+}
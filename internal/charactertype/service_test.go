@@ -0,0 +1,200 @@
+package charactertype
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var errCRUD = errors.New("error crud")
+
+func TestCreateCharacterTypeRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     CreateCharacterTypeRequest
+		wantError bool
+	}{
+		{"success", CreateCharacterTypeRequest{CharacterCode: 4, Name: "Dwarf"}, false},
+		{"formula", CreateCharacterTypeRequest{CharacterCode: 4, Name: "Dwarf", Formula: "power < 20 ? power*2 : power*3"}, false},
+		{"invalid formula", CreateCharacterTypeRequest{CharacterCode: 4, Name: "Dwarf", Formula: "power *"}, true},
+		{"unknown variable", CreateCharacterTypeRequest{CharacterCode: 4, Name: "Dwarf", Formula: "level * 2"}, true},
+		{"attribute schema", CreateCharacterTypeRequest{CharacterCode: 4, Name: "Dwarf", AttributeSchema: entity.AttributeSchema{Properties: map[string]entity.AttributeProperty{"beard": {Type: "boolean"}}}}, false},
+		{"invalid attribute schema", CreateCharacterTypeRequest{CharacterCode: 4, Name: "Dwarf", AttributeSchema: entity.AttributeSchema{Required: []string{"beard"}}}, true},
+		{"code required", CreateCharacterTypeRequest{Name: "Dwarf"}, true},
+		{"negative code", CreateCharacterTypeRequest{CharacterCode: -1, Name: "Dwarf"}, true},
+		{"name required", CreateCharacterTypeRequest{CharacterCode: 4, Name: ""}, true},
+		{"too long", CreateCharacterTypeRequest{CharacterCode: 4, Name: "1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func TestUpdateCharacterTypeRequest_Validate(t *testing.T) {
+	validFormula, emptyFormula, invalidFormula := "power * 1.5", "", "power > 1"
+	tests := []struct {
+		name      string
+		model     UpdateCharacterTypeRequest
+		wantError bool
+	}{
+		{"success", UpdateCharacterTypeRequest{Name: "Dwarf"}, false},
+		{"formula", UpdateCharacterTypeRequest{Name: "Dwarf", Formula: &validFormula}, false},
+		{"empty formula", UpdateCharacterTypeRequest{Name: "Dwarf", Formula: &emptyFormula}, false},
+		{"invalid formula", UpdateCharacterTypeRequest{Name: "Dwarf", Formula: &invalidFormula}, true},
+		{"invalid attribute schema", UpdateCharacterTypeRequest{Name: "Dwarf", AttributeSchema: &entity.AttributeSchema{Required: []string{"beard"}}}, true},
+		{"required", UpdateCharacterTypeRequest{Name: ""}, true},
+		{"too long", UpdateCharacterTypeRequest{Name: "1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_CRUD(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(&mockRepository{}, logger)
+
+	ctx := context.Background()
+
+	// initial count
+	count, _ := s.Count(ctx)
+	assert.Equal(t, 0, count)
+
+	// successful creation
+	characterType, err := s.Create(ctx, CreateCharacterTypeRequest{CharacterCode: 4, Name: "Dwarf"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), characterType.CharacterCode)
+	assert.Equal(t, "Dwarf", characterType.Name)
+	assert.False(t, characterType.Retired)
+	assert.Equal(t, "", characterType.Formula)
+	assert.Equal(t, int64(0), characterType.FormulaVersion)
+	assert.NotEmpty(t, characterType.CreatedAt)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 1, count)
+
+	// creation with a formula
+	characterType, err = s.Create(ctx, CreateCharacterTypeRequest{CharacterCode: 5, Name: "Orc", Formula: "power * 2"})
+	assert.Nil(t, err)
+	assert.Equal(t, "power * 2", characterType.Formula)
+	assert.Equal(t, int64(1), characterType.FormulaVersion)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 2, count)
+
+	// invalid formula in creation
+	_, err = s.Create(ctx, CreateCharacterTypeRequest{CharacterCode: 6, Name: "Troll", Formula: "power * "})
+	assert.NotNil(t, err)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 2, count)
+
+	// duplicate code
+	_, err = s.Create(ctx, CreateCharacterTypeRequest{CharacterCode: 4, Name: "Dwarf"})
+	assert.NotNil(t, err)
+
+	// validation error in creation
+	_, err = s.Create(ctx, CreateCharacterTypeRequest{CharacterCode: 6})
+	assert.NotNil(t, err)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 2, count)
+
+	// unexpected error in creation
+	_, err = s.Create(ctx, CreateCharacterTypeRequest{CharacterCode: 6, Name: "error"})
+	assert.Equal(t, errCRUD, err)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 2, count)
+
+	// rename
+	characterType, err = s.Update(ctx, 4, UpdateCharacterTypeRequest{Name: "Dwarf Lord"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Dwarf Lord", characterType.Name)
+	_, err = s.Update(ctx, 99, UpdateCharacterTypeRequest{Name: "Dwarf Lord"})
+	assert.NotNil(t, err)
+	_, err = s.Update(ctx, 4, UpdateCharacterTypeRequest{Name: ""})
+	assert.NotNil(t, err)
+
+	// formula changes bump the formula version
+	formula := "power * 3"
+	characterType, err = s.Update(ctx, 5, UpdateCharacterTypeRequest{Name: "Orc", Formula: &formula})
+	assert.Nil(t, err)
+	assert.Equal(t, "power * 3", characterType.Formula)
+	assert.Equal(t, int64(2), characterType.FormulaVersion)
+	characterType, err = s.Update(ctx, 5, UpdateCharacterTypeRequest{Name: "Orc", Formula: &formula})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), characterType.FormulaVersion)
+	characterType, err = s.Update(ctx, 5, UpdateCharacterTypeRequest{Name: "Orc Chief"})
+	assert.Nil(t, err)
+	assert.Equal(t, "power * 3", characterType.Formula)
+	assert.Equal(t, int64(2), characterType.FormulaVersion)
+	invalid := "power ? 1 : 2"
+	_, err = s.Update(ctx, 5, UpdateCharacterTypeRequest{Name: "Orc", Formula: &invalid})
+	assert.NotNil(t, err)
+
+	// retire
+	characterType, err = s.Retire(ctx, 4)
+	assert.Nil(t, err)
+	assert.True(t, characterType.Retired)
+	_, err = s.Retire(ctx, 99)
+	assert.NotNil(t, err)
+
+	// get
+	characterType, err = s.Get(ctx, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, "Dwarf Lord", characterType.Name)
+	assert.True(t, characterType.Retired)
+
+	// query
+	characterTypes, _ := s.Query(ctx, 0, 0)
+	assert.Equal(t, 2, len(characterTypes))
+}
+
+type mockRepository struct {
+	items []entity.CharacterType
+}
+
+func (m mockRepository) Get(ctx context.Context, code int64) (entity.CharacterType, error) {
+	for _, item := range m.items {
+		if item.CharacterCode == code {
+			return item, nil
+		}
+	}
+	return entity.CharacterType{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context) (int, error) {
+	return len(m.items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.CharacterType, error) {
+	return m.items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, characterType entity.CharacterType) error {
+	if characterType.Name == "error" {
+		return errCRUD
+	}
+	m.items = append(m.items, characterType)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, characterType entity.CharacterType) error {
+	if characterType.Name == "error" {
+		return errCRUD
+	}
+	for i, item := range m.items {
+		if item.CharacterCode == characterType.CharacterCode {
+			m.items[i] = characterType
+			break
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"io/ioutil"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
@@ -12,6 +13,9 @@ import (
 const (
 	defaultServerPort         = 8000
 	defaultJWTExpirationHours = 72
+	defaultTrashRetentionDays = 30
+	defaultPartySize          = 5
+	defaultIdempotencyTTL     = 24
 )
 
 // Config represents an application configuration.
@@ -24,6 +28,22 @@ type Config struct {
 	JWTSigningKey string `yaml:"jwt_signing_key" env:"JWT_SIGNING_KEY,secret"`
 	// JWT expiration in hours. Defaults to 72 hours (3 days)
 	JWTExpiration int `yaml:"jwt_expiration" env:"JWT_EXPIRATION"`
+	// the IDs of the users allowed to perform administrative actions, such as changing the character types or purging deleted characters
+	AdminIDs []string `yaml:"admin_ids" env:"ADMIN_IDS"`
+	// whether writes to a character must carry an If-Match header. Defaults to false
+	RequireIfMatch bool `yaml:"require_if_match" env:"REQUIRE_IF_MATCH"`
+	// the number of days deleted characters are kept before they can be purged. Defaults to 30 days
+	TrashRetention int `yaml:"trash_retention" env:"TRASH_RETENTION"`
+	// the total experience points required to reach each character level from level 2 on, in increasing order.
+	// Defaults to 50 * n * (n - 1) points for level n, up to level 50
+	LevelCurve []int64 `yaml:"level_curve" env:"LEVEL_CURVE"`
+	// the maximum number of members of a party. Defaults to 5
+	PartySize int `yaml:"party_size" env:"PARTY_SIZE"`
+	// the maximum number of members of each character type in a party, indexed by character code, e.g. {"1": 1}.
+	// Defaults to at most one wizard
+	PartyTypeLimits map[int64]int `yaml:"party_type_limits" env:"PARTY_TYPE_LIMITS"`
+	// the number of hours the responses of requests made with an Idempotency-Key header are replayed. Defaults to 24 hours
+	IdempotencyTTL int `yaml:"idempotency_ttl" env:"IDEMPOTENCY_TTL"`
 }
 
 // Validate validates the application configuration.
@@ -31,15 +51,34 @@ func (c Config) Validate() error {
 	return validation.ValidateStruct(&c,
 		validation.Field(&c.DSN, validation.Required),
 		validation.Field(&c.JWTSigningKey, validation.Required),
+		validation.Field(&c.TrashRetention, validation.Min(0)),
+		validation.Field(&c.LevelCurve, validation.By(increasing)),
+		validation.Field(&c.PartySize, validation.Min(1)),
+		validation.Field(&c.PartyTypeLimits, validation.Each(validation.Min(0))),
+		validation.Field(&c.IdempotencyTTL, validation.Min(1)),
 	)
 }
 
+// increasing checks that a level curve lists positive thresholds in strictly increasing order.
+func increasing(value interface{}) error {
+	thresholds, _ := value.([]int64)
+	for i, threshold := range thresholds {
+		if threshold <= 0 || i > 0 && threshold <= thresholds[i-1] {
+			return errors.New("must list positive thresholds in increasing order")
+		}
+	}
+	return nil
+}
+
 // Load returns an application configuration which is populated from the given configuration file and environment variables.
 func Load(file string, logger log.Logger) (*Config, error) {
 	// default config
 	c := Config{
-		ServerPort:    defaultServerPort,
-		JWTExpiration: defaultJWTExpirationHours,
+		ServerPort:     defaultServerPort,
+		JWTExpiration:  defaultJWTExpirationHours,
+		TrashRetention: defaultTrashRetentionDays,
+		PartySize:      defaultPartySize,
+		IdempotencyTTL: defaultIdempotencyTTL,
 	}
 
 	// load from YAML config file
@@ -0,0 +1,27 @@
+package entity
+
+import (
+	"time"
+)
+
+// Ability represents an ability record. Only the characters of type CharacterCode that reached MinLevel can learn
+// an ability, after learning its prerequisite, if any. Learned abilities change the effective power of a character by
+// PowerPercent percent of its base power plus PowerBonus.
+type Ability struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	CharacterCode  int64     `json:"character_code"`
+	MinLevel       int64     `json:"min_level"`
+	PrerequisiteID string    `json:"prerequisite_id"`
+	PowerBonus     int64     `json:"power_bonus"`
+	PowerPercent   int64     `json:"power_percent"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CharacterAbility represents an ability learned by a character.
+type CharacterAbility struct {
+	CharacterID string    `json:"character_id" db:"pk"`
+	AbilityID   string    `json:"ability_id" db:"pk"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,88 @@
+package entity
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// Attributes holds the attributes of a character that depend on its type, such as the mana of a wizard, stored as
+// JSON. Numbers are decoded as json.Number so that they keep their precision.
+type Attributes map[string]interface{}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *Attributes) UnmarshalJSON(data []byte) error {
+	var m map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&m); err != nil {
+		return err
+	}
+	*a = m
+	return nil
+}
+
+// Value implements driver.Valuer. Nil attributes are stored as an empty object.
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner.
+func (a *Attributes) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, a)
+	case string:
+		return json.Unmarshal([]byte(data), a)
+	}
+	return errors.New("unsupported attributes type")
+}
+
+// AttributeSchema describes the attributes of the characters of a type with a subset of JSON Schema: the type and
+// the bounds of each property, the required properties, and whether other properties are allowed.
+type AttributeSchema struct {
+	Properties map[string]AttributeProperty `json:"properties,omitempty"`
+	Required   []string                     `json:"required,omitempty"`
+	// AdditionalProperties tells whether attributes that are not listed in Properties are allowed. Defaults to true.
+	AdditionalProperties *bool `json:"additionalProperties,omitempty"`
+}
+
+// AttributeProperty describes an attribute of characters. Type is one of "string", "integer", "number" and
+// "boolean". Minimum and Maximum bound numbers, MinLength and MaxLength bound the length of strings, and Enum lists
+// the allowed values.
+type AttributeProperty struct {
+	Type      string        `json:"type"`
+	Minimum   *float64      `json:"minimum,omitempty"`
+	Maximum   *float64      `json:"maximum,omitempty"`
+	MinLength *int          `json:"minLength,omitempty"`
+	MaxLength *int          `json:"maxLength,omitempty"`
+	Enum      []interface{} `json:"enum,omitempty"`
+}
+
+// Value implements driver.Valuer.
+func (s AttributeSchema) Value() (driver.Value, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner.
+func (s *AttributeSchema) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, s)
+	case string:
+		return json.Unmarshal([]byte(data), s)
+	}
+	return errors.New("unsupported attribute schema type")
+}
@@ -0,0 +1,67 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Battle represents a recorded fight between two characters.
+type Battle struct {
+	ID         string `json:"id"`
+	AttackerID string `json:"attacker_id"`
+	DefenderID string `json:"defender_id"`
+	// Seed initializes the random number generator of the simulation, which is reproducible from it.
+	Seed int64 `json:"seed"`
+	// WinnerID is the ID of the winning character. It is empty if the battle is a draw.
+	WinnerID string `json:"winner_id"`
+	// Attacker and Defender are the characters as they were when the battle was fought.
+	Attacker CharacterSnapshot `json:"attacker"`
+	Defender CharacterSnapshot `json:"defender"`
+	// AttackerHP and DefenderHP are the hit points of the characters at the start of the battle.
+	AttackerHP int64        `json:"attacker_hp"`
+	DefenderHP int64        `json:"defender_hp"`
+	Rounds     BattleRounds `json:"rounds"`
+	UserID     string       `json:"user_id"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// BattleRound represents the attacks made during a round of a battle.
+type BattleRound struct {
+	Round   int            `json:"round"`
+	Attacks []BattleAttack `json:"attacks"`
+}
+
+// BattleAttack represents an attack made by a character during a battle.
+type BattleAttack struct {
+	AttackerID string `json:"attacker_id"`
+	DefenderID string `json:"defender_id"`
+	Damage     int64  `json:"damage"`
+	Critical   bool   `json:"critical"`
+	// RemainingHP is the number of hit points left to the defender after the attack.
+	RemainingHP int64 `json:"remaining_hp"`
+}
+
+// BattleRounds is the log of a battle stored as JSON.
+type BattleRounds []BattleRound
+
+// Value implements driver.Valuer.
+func (r BattleRounds) Value() (driver.Value, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner.
+func (r *BattleRounds) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, r)
+	case string:
+		return json.Unmarshal([]byte(data), r)
+	}
+	return errors.New("unsupported battle rounds type")
+}
@@ -4,13 +4,23 @@ import (
 	"time"
 )
 
-// Character represents an album record.
+// Character represents a character record.
 type Character struct {
-	ID             string    `json:"id"`
-	Name           string    `json:"name"`
-	CharacterCode  int64     `json:"character_code"`
-	CharacterPower int64     `json:"character_power"`
-	CharacterValue int64     `json:"character_value"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	CharacterCode  int64  `json:"character_code"`
+	CharacterPower int64  `json:"character_power"`
+	// EffectivePower is the power of the character with its equipment, from which its value is computed.
+	EffectivePower int64 `json:"effective_power"`
+	CharacterValue int64 `json:"character_value"`
+	FormulaVersion int64 `json:"formula_version"`
+	Experience     int64 `json:"experience"`
+	Level          int64 `json:"level"`
+	// Attributes are validated by the attribute schema of the character type.
+	Attributes Attributes `json:"attributes"`
+	Version    int64      `json:"version"`
+	OwnerID    string     `json:"owner_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
 }
@@ -0,0 +1,61 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Character revision actions
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionRevert  = "revert"
+	// ActionExperience is a grant of experience points, which may level the character up.
+	ActionExperience = "experience"
+	// ActionEquipment is a change of the equipment or the abilities of the character, which changes its effective power.
+	ActionEquipment = "equipment"
+)
+
+// CharacterRevision represents a recorded change of a character.
+type CharacterRevision struct {
+	ID          string `json:"id"`
+	CharacterID string `json:"character_id"`
+	// Revision is the version of the character after the change.
+	Revision int64  `json:"revision"`
+	Action   string `json:"action"`
+	// Before is the character before the change. It is nil for creations and restorations.
+	Before *CharacterSnapshot `json:"before"`
+	// After is the character after the change. It is nil for deletions.
+	After     *CharacterSnapshot `json:"after"`
+	UserID    string             `json:"user_id"`
+	UserName  string             `json:"user_name"`
+	RequestID string             `json:"request_id"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+// CharacterSnapshot is a copy of a character stored as JSON.
+type CharacterSnapshot Character
+
+// Value implements driver.Valuer.
+func (s CharacterSnapshot) Value() (driver.Value, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner.
+func (s *CharacterSnapshot) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, s)
+	case string:
+		return json.Unmarshal([]byte(data), s)
+	}
+	return errors.New("unsupported character snapshot type")
+}
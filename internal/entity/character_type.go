@@ -0,0 +1,18 @@
+package entity
+
+import (
+	"time"
+)
+
+// CharacterType represents a character type record.
+type CharacterType struct {
+	CharacterCode  int64  `json:"character_code" db:"pk"`
+	Name           string `json:"name"`
+	Formula        string `json:"formula"`
+	FormulaVersion int64  `json:"formula_version"`
+	Retired        bool   `json:"retired"`
+	// AttributeSchema validates the attributes of the characters of the type.
+	AttributeSchema AttributeSchema `json:"attribute_schema"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
@@ -0,0 +1,49 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IdempotencyKey represents the response recorded for a request made by a user with an Idempotency-Key header.
+type IdempotencyKey struct {
+	UserID string
+	Key    string
+	// Fingerprint identifies the request made with the key, so that the key cannot be reused for another request.
+	// It is empty while the request is being processed, as the body is hashed while it is read.
+	Fingerprint string
+	// Status is the HTTP status of the response, or 0 while the request is being processed.
+	Status    int
+	Header    ResponseHeader
+	Body      []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// ResponseHeader holds the HTTP headers of a recorded response, stored as JSON.
+type ResponseHeader map[string][]string
+
+// Value implements driver.Valuer.
+func (h ResponseHeader) Value() (driver.Value, error) {
+	if h == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner.
+func (h *ResponseHeader) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, h)
+	case string:
+		return json.Unmarshal([]byte(data), h)
+	}
+	return errors.New("unsupported response header type")
+}
@@ -0,0 +1,27 @@
+package entity
+
+import (
+	"time"
+)
+
+// Item represents an item record. Items equipped by a character change its effective power by PowerPercent percent
+// of its base power plus PowerBonus. Items without a slot cannot be equipped.
+type Item struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Slot         string    `json:"slot"`
+	PowerBonus   int64     `json:"power_bonus"`
+	PowerPercent int64     `json:"power_percent"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// InventoryItem represents the items of a kind held by a character.
+type InventoryItem struct {
+	CharacterID string    `json:"character_id" db:"pk"`
+	ItemID      string    `json:"item_id" db:"pk"`
+	Quantity    int64     `json:"quantity"`
+	Equipped    bool      `json:"equipped"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
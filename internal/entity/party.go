@@ -0,0 +1,21 @@
+package entity
+
+import (
+	"time"
+)
+
+// Party represents a party record.
+type Party struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	OwnerID   string    `json:"owner_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PartyMember represents the membership of a character in a party. A character belongs to at most one party.
+type PartyMember struct {
+	CharacterID string    `json:"character_id" db:"pk"`
+	PartyID     string    `json:"party_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,118 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Webhook events
+const (
+	EventCharacterCreated = "character.created"
+	EventCharacterUpdated = "character.updated"
+	EventCharacterDeleted = "character.deleted"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook represents a subscription of a URL to events.
+type Webhook struct {
+	ID     string        `json:"id"`
+	URL    string        `json:"url"`
+	Events WebhookEvents `json:"events"`
+	// Secret is the key signing the deliveries. It is only shown when the webhook is created.
+	Secret    string    `json:"-"`
+	Active    bool      `json:"active"`
+	OwnerID   string    `json:"owner_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery represents an event sent to a webhook, which may take several attempts.
+type WebhookDelivery struct {
+	ID        string         `json:"id"`
+	WebhookID string         `json:"webhook_id"`
+	Event     string         `json:"event"`
+	Payload   WebhookPayload `json:"payload"`
+	Status    string         `json:"status"`
+	Attempts  int            `json:"attempts"`
+	// NextAttemptAt is the time of the next attempt. It is nil once the delivery succeeded or failed for good.
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// WebhookAttempt represents an attempt to deliver an event to a webhook.
+type WebhookAttempt struct {
+	ID         string `json:"id"`
+	DeliveryID string `json:"delivery_id"`
+	Attempt    int    `json:"attempt"`
+	// StatusCode is the HTTP status of the response, or 0 if no response was received.
+	StatusCode int    `json:"status_code"`
+	Error      string `json:"error"`
+	// Duration is the time taken by the attempt in milliseconds.
+	Duration  int64     `json:"duration"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookEvents is the list of events of a webhook stored as JSON.
+type WebhookEvents []string
+
+// Value implements driver.Valuer.
+func (e WebhookEvents) Value() (driver.Value, error) {
+	if e == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner.
+func (e *WebhookEvents) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, e)
+	case string:
+		return json.Unmarshal([]byte(data), e)
+	}
+	return errors.New("unsupported webhook events type")
+}
+
+// WebhookPayload is the JSON document sent to a webhook. It is stored and sent as is, so that its signature does not
+// change between attempts.
+type WebhookPayload []byte
+
+// MarshalJSON implements json.Marshaler.
+func (p WebhookPayload) MarshalJSON() ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
+// Value implements driver.Valuer.
+func (p WebhookPayload) Value() (driver.Value, error) {
+	return string(p), nil
+}
+
+// Scan implements sql.Scanner.
+func (p *WebhookPayload) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case []byte:
+		*p = append(WebhookPayload{}, data...)
+		return nil
+	case string:
+		*p = WebhookPayload(data)
+		return nil
+	}
+	return errors.New("unsupported webhook payload type")
+}
@@ -26,7 +26,7 @@ func Handler(logger log.Logger) routing.Handler {
 			}
 
 			if err != nil {
-				res := buildErrorResponse(err)
+				res := BuildErrorResponse(err)
 				if res.StatusCode() == http.StatusInternalServerError {
 					l.Errorf("encountered internal server error: %v", err)
 				}
@@ -42,8 +42,9 @@ func Handler(logger log.Logger) routing.Handler {
 	}
 }
 
-// buildErrorResponse builds an error response from an error.
-func buildErrorResponse(err error) ErrorResponse {
+// BuildErrorResponse builds an error response from an error.
+// It can be used to report errors that do not abort the request, such as the failures of individual bulk items.
+func BuildErrorResponse(err error) ErrorResponse {
 	switch err.(type) {
 	case ErrorResponse:
 		return err.(ErrorResponse)
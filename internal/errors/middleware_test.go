@@ -50,23 +50,23 @@ func TestHandler(t *testing.T) {
 	})
 }
 
-func Test_buildErrorResponse(t *testing.T) {
+func TestBuildErrorResponse(t *testing.T) {
 	res := NotFound("")
-	assert.Equal(t, res, buildErrorResponse(res))
+	assert.Equal(t, res, BuildErrorResponse(res))
 
-	res = buildErrorResponse(routing.NewHTTPError(http.StatusNotFound))
+	res = BuildErrorResponse(routing.NewHTTPError(http.StatusNotFound))
 	assert.Equal(t, http.StatusNotFound, res.Status)
 
-	res = buildErrorResponse(validation.Errors{})
+	res = BuildErrorResponse(validation.Errors{})
 	assert.Equal(t, http.StatusBadRequest, res.Status)
 
-	res = buildErrorResponse(routing.NewHTTPError(http.StatusForbidden))
+	res = BuildErrorResponse(routing.NewHTTPError(http.StatusForbidden))
 	assert.Equal(t, http.StatusForbidden, res.Status)
 
-	res = buildErrorResponse(sql.ErrNoRows)
+	res = BuildErrorResponse(sql.ErrNoRows)
 	assert.Equal(t, http.StatusNotFound, res.Status)
 
-	res = buildErrorResponse(fmt.Errorf("test"))
+	res = BuildErrorResponse(fmt.Errorf("test"))
 	assert.Equal(t, http.StatusInternalServerError, res.Status)
 }
 
@@ -78,6 +78,28 @@ func BadRequest(msg string) ErrorResponse {
 	}
 }
 
+// PreconditionFailed creates a new error response representing a failed request precondition (HTTP 412)
+func PreconditionFailed(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The resource has been modified since you last retrieved it."
+	}
+	return ErrorResponse{
+		Status:  http.StatusPreconditionFailed,
+		Message: msg,
+	}
+}
+
+// PreconditionRequired creates a new error response representing a missing request precondition (HTTP 428)
+func PreconditionRequired(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The request must be conditional, such as by specifying an If-Match header."
+	}
+	return ErrorResponse{
+		Status:  http.StatusPreconditionRequired,
+		Message: msg,
+	}
+}
+
 type invalidField struct {
 	Field string `json:"field"`
 	Error string `json:"error"`
@@ -62,6 +62,22 @@ func TestBadRequest(t *testing.T) {
 	assert.NotEmpty(t, res.Error())
 }
 
+func TestPreconditionFailed(t *testing.T) {
+	res := PreconditionFailed("test")
+	assert.Equal(t, http.StatusPreconditionFailed, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = PreconditionFailed("")
+	assert.NotEmpty(t, res.Error())
+}
+
+func TestPreconditionRequired(t *testing.T) {
+	res := PreconditionRequired("test")
+	assert.Equal(t, http.StatusPreconditionRequired, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = PreconditionRequired("")
+	assert.NotEmpty(t, res.Error())
+}
+
 func TestInvalidInput(t *testing.T) {
 	err := InvalidInput(validation.Errors{
 		"xyz": fmt.Errorf("2"),
@@ -0,0 +1,194 @@
+// Package idempotency provides a middleware that lets clients safely retry POST requests with an Idempotency-Key header.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/errors"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+const (
+	// KeyHeader is the request header carrying the idempotency key chosen by the client.
+	KeyHeader = "Idempotency-Key"
+	// ReplayedHeader is the response header set to "true" when a recorded response is replayed.
+	ReplayedHeader = "Idempotent-Replayed"
+	// MaxKeyLength is the maximum length of an idempotency key.
+	MaxKeyLength = 255
+)
+
+var (
+	// ErrMismatch is returned when an idempotency key is reused for a different request.
+	ErrMismatch = errors.ErrorResponse{
+		Status:  http.StatusUnprocessableEntity,
+		Message: "The Idempotency-Key has already been used for a different request.",
+	}
+	// ErrInProgress is returned when a request is retried while the original request is still being processed.
+	ErrInProgress = errors.ErrorResponse{
+		Status:  http.StatusConflict,
+		Message: "A request with the same Idempotency-Key is still being processed.",
+	}
+)
+
+// Handler returns a middleware that records the responses of the POST requests made with an Idempotency-Key header
+// for the given time to live, and replays them when the requests are retried with the same key. A key reused for a
+// request with a different method, path or body is rejected with a 422 error.
+//
+// The keys are scoped to the current user, so the middleware must be used after an authentication middleware. The
+// requests failing with an error are not recorded, so that they can be retried.
+func Handler(repo Repository, ttl time.Duration, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		key := c.Request.Header.Get(KeyHeader)
+		user := auth.CurrentUser(c.Request.Context())
+		if c.Request.Method != http.MethodPost || key == "" || user == nil {
+			return nil
+		}
+		if len(key) > MaxKeyLength {
+			return errors.BadRequest(fmt.Sprintf("The %v header must be at most %v characters long.", KeyHeader, MaxKeyLength))
+		}
+
+		ctx := c.Request.Context()
+		now := time.Now()
+		record := entity.IdempotencyKey{
+			UserID:    user.GetID(),
+			Key:       key,
+			CreatedAt: now,
+			ExpiresAt: now.Add(ttl),
+		}
+		reserved, err := repo.Reserve(ctx, record)
+		if err != nil {
+			return err
+		}
+		if !reserved {
+			return replay(c, repo, record)
+		}
+
+		// the record is completed or released even if the client is gone, as it is when a retry is most likely
+		completed := false
+		defer func() {
+			if !completed {
+				if err := repo.Release(context.Background(), record.UserID, record.Key); err != nil {
+					logger.With(ctx).Errorf("failed to release idempotency key %v: %v", record.Key, err)
+				}
+			}
+		}()
+
+		// the body is hashed while the next handlers read it, so that it is never held in memory
+		fingerprint := newFingerprinter(c.Request)
+		rw := &responseRecorder{ResponseWriter: c.Response, status: http.StatusOK}
+		c.Response = rw
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		if record.Fingerprint, err = fingerprint.Sum(); err != nil {
+			logger.With(ctx).Errorf("failed to read the request of idempotency key %v: %v", record.Key, err)
+			return nil
+		}
+		record.Status = rw.status
+		record.Header = entity.ResponseHeader(rw.Header().Clone())
+		record.Body = rw.body.Bytes()
+		if err := repo.Complete(context.Background(), record); err != nil {
+			logger.With(ctx).Errorf("failed to record the response of idempotency key %v: %v", record.Key, err)
+			return nil
+		}
+		completed = true
+		return nil
+	}
+}
+
+// replay writes the recorded response of the given key, provided that it was recorded for the same request.
+func replay(c *routing.Context, repo Repository, record entity.IdempotencyKey) error {
+	recorded, err := repo.Get(c.Request.Context(), record.UserID, record.Key)
+	if err == sql.ErrNoRows {
+		// the original request failed and released the key since it was reserved
+		return ErrInProgress
+	} else if err != nil {
+		return err
+	}
+	// the fingerprint of the original request is only known once it is completed
+	if recorded.Status == 0 {
+		return ErrInProgress
+	}
+	fingerprint, err := newFingerprinter(c.Request).Sum()
+	if err != nil {
+		return err
+	}
+	if recorded.Fingerprint != fingerprint {
+		return ErrMismatch
+	}
+
+	c.Abort()
+	header := c.Response.Header()
+	for name, values := range recorded.Header {
+		header[name] = values
+	}
+	header.Set(ReplayedHeader, "true")
+	c.Response.WriteHeader(recorded.Status)
+	_, err = c.Response.Write(recorded.Body)
+	return err
+}
+
+// fingerprinter computes a hash of the method, URL and body of a request while its body is read.
+type fingerprinter struct {
+	hash hash.Hash
+	body io.Reader
+}
+
+// newFingerprinter returns a fingerprinter of the given request. The body of the request is replaced by one that
+// feeds the hash as it is read, and that is left open for the fingerprinter to read the rest of it.
+func newFingerprinter(req *http.Request) *fingerprinter {
+	f := &fingerprinter{hash: sha256.New(), body: req.Body}
+	fmt.Fprintf(f.hash, "%v %v\n", req.Method, req.URL.RequestURI())
+	if req.Body != nil {
+		req.Body = ioutil.NopCloser(io.TeeReader(req.Body, f.hash))
+	}
+	return f
+}
+
+// Sum reads the part of the body that was not read yet and returns the fingerprint of the request.
+func (f *fingerprinter) Sum() (string, error) {
+	if f.body != nil {
+		if _, err := io.Copy(f.hash, f.body); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(f.hash.Sum(nil)), nil
+}
+
+// responseRecorder is an http.ResponseWriter that keeps a copy of the status and body of the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+// WriteHeader records the status of the response before writing it.
+func (w *responseRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the data written to the response body before writing it.
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
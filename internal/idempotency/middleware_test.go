@@ -0,0 +1,232 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{}
+	created := 0
+	router.Use(auth.MockAuthHandler, Handler(repo, time.Hour, logger))
+	router.Post("/characters", func(c *routing.Context) error {
+		var input struct {
+			Name string `json:"name"`
+		}
+		if err := c.Read(&input); err != nil || input.Name == "error" {
+			return errors.New("failed")
+		}
+		created++
+		c.Response.Header().Set("ETag", fmt.Sprintf(`"%v"`, created))
+		return c.WriteWithStatus(map[string]interface{}{"id": created, "name": input.Name}, http.StatusCreated)
+	})
+	header := auth.MockAuthHeader()
+	header.Set(KeyHeader, "key1")
+	other := auth.MockAuthHeader()
+	other.Set(KeyHeader, "key2")
+
+	tests := []test.APITestCase{
+		{"without key", "POST", "/characters", `{"name":"Frodo"}`, auth.MockAuthHeader(), http.StatusCreated, `{"id":1,"name":"Frodo"}`},
+		{"without key again", "POST", "/characters", `{"name":"Frodo"}`, auth.MockAuthHeader(), http.StatusCreated, `{"id":2,"name":"Frodo"}`},
+		{"with key", "POST", "/characters", `{"name":"Sam"}`, header, http.StatusCreated, `{"id":3,"name":"Sam"}`},
+		{"retry", "POST", "/characters", `{"name":"Sam"}`, header, http.StatusCreated, `{"id":3,"name":"Sam"}`},
+		{"different body", "POST", "/characters", `{"name":"Merry"}`, header, http.StatusUnprocessableEntity, `*Idempotency-Key*`},
+		{"different path", "POST", "/characters?dry_run=true", `{"name":"Sam"}`, header, http.StatusUnprocessableEntity, ""},
+		{"failure", "POST", "/characters", `{"name":"error"}`, other, http.StatusInternalServerError, ""},
+		{"retry after failure", "POST", "/characters", `{"name":"Pippin"}`, other, http.StatusCreated, `{"id":4,"name":"Pippin"}`},
+		{"unauthenticated", "POST", "/characters", `{"name":"Sam"}`, nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+	assert.Equal(t, 4, created)
+
+	// the replayed response carries the recorded headers
+	req, _ := http.NewRequest("POST", "/characters", bytes.NewBufferString(`{"name":"Sam"}`))
+	req.Header = header
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, `"3"`, res.Header().Get("ETag"))
+	assert.Equal(t, "true", res.Header().Get(ReplayedHeader))
+
+	// keys are scoped to the user
+	repo.items = append(repo.items, entity.IdempotencyKey{UserID: "200", Key: "key3", Status: http.StatusCreated, ExpiresAt: time.Now().Add(time.Hour)})
+	header.Set(KeyHeader, "key3")
+	test.Endpoint(t, router, test.APITestCase{"other user", "POST", "/characters", `{"name":"Bilbo"}`, header, http.StatusCreated, `{"id":5,"name":"Bilbo"}`})
+
+	// an expired key can be reused
+	repo.items[0].ExpiresAt = time.Now().Add(-time.Minute)
+	header.Set(KeyHeader, repo.items[0].Key)
+	test.Endpoint(t, router, test.APITestCase{"expired", "POST", "/characters", `{"name":"Gollum"}`, header, http.StatusCreated, `{"id":6,"name":"Gollum"}`})
+
+	// a request in progress, whose fingerprint is not known yet
+	repo.items = append(repo.items, entity.IdempotencyKey{UserID: "100", Key: "key4", ExpiresAt: time.Now().Add(time.Hour)})
+	header.Set(KeyHeader, "key4")
+	test.Endpoint(t, router, test.APITestCase{"in progress", "POST", "/characters", `{"name":"Bilbo"}`, header, http.StatusConflict, ""})
+
+	// the key length is limited
+	header.Set(KeyHeader, strings.Repeat("k", MaxKeyLength+1))
+	test.Endpoint(t, router, test.APITestCase{"too long", "POST", "/characters", `{"name":"Bilbo"}`, header, http.StatusBadRequest, ""})
+}
+
+func TestHandler_streaming(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{}
+	router.Use(auth.MockAuthHandler, Handler(repo, time.Hour, logger))
+	var body *countingReader
+	read := -1
+	router.Post("/characters/import", func(c *routing.Context) error {
+		// the body has not been read before the handler, which only reads its first bytes
+		read = body.count
+		part := make([]byte, 5)
+		if _, err := io.ReadFull(c.Request.Body, part); err != nil {
+			return err
+		}
+		return c.Write(string(part))
+	})
+	post := func(data string) *httptest.ResponseRecorder {
+		body = &countingReader{Reader: strings.NewReader(data)}
+		req, _ := http.NewRequest("POST", "/characters/import", body)
+		req.Header = auth.MockAuthHeader()
+		req.Header.Set(KeyHeader, "key1")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	res := post("name\nFrodo\nSam\n")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 0, read)
+	// the rest of the body counts toward the fingerprint even though the handler did not read it
+	assert.Equal(t, http.StatusUnprocessableEntity, post("name\nFrodo\nMerry\n").Code)
+	res = post("name\nFrodo\nSam\n")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "true", res.Header().Get(ReplayedHeader))
+}
+
+// countingReader counts the bytes read from the body of a request.
+type countingReader struct {
+	io.Reader
+	count int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.count += n
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	return nil
+}
+
+func Test_fingerprinter(t *testing.T) {
+	fingerprint := func(method, url, body string) string {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		sum, err := newFingerprinter(req).Sum()
+		assert.Nil(t, err)
+		return sum
+	}
+
+	// the body can still be read, and the part read counts toward the fingerprint like the rest
+	req, _ := http.NewRequest("POST", "/characters?a=1", bytes.NewBufferString(`{"name":"Sam"}`))
+	f := newFingerprinter(req)
+	part := make([]byte, 5)
+	_, err := io.ReadFull(req.Body, part)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"nam`, string(part))
+	fp1, err := f.Sum()
+	assert.Nil(t, err)
+	req, _ = http.NewRequest("POST", "/characters?a=1", bytes.NewBufferString(`{"name":"Sam"}`))
+	f = newFingerprinter(req)
+	body, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, `{"name":"Sam"}`, string(body))
+	fp2, _ := f.Sum()
+	assert.Equal(t, fp1, fp2)
+	assert.Equal(t, fp1, fingerprint("POST", "/characters?a=1", `{"name":"Sam"}`))
+
+	assert.NotEqual(t, fp1, fingerprint("POST", "/characters?a=2", `{"name":"Sam"}`))
+	assert.NotEqual(t, fp1, fingerprint("PUT", "/characters?a=1", `{"name":"Sam"}`))
+	assert.NotEqual(t, fp1, fingerprint("POST", "/characters?a=1", `{"name":"Merry"}`))
+}
+
+type mockRepository struct {
+	items []entity.IdempotencyKey
+}
+
+func (m mockRepository) Get(ctx context.Context, userID, key string) (entity.IdempotencyKey, error) {
+	for _, item := range m.items {
+		if item.UserID == userID && item.Key == key {
+			return item, nil
+		}
+	}
+	return entity.IdempotencyKey{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Reserve(ctx context.Context, record entity.IdempotencyKey) (bool, error) {
+	for i, item := range m.items {
+		if item.UserID == record.UserID && item.Key == record.Key {
+			if item.ExpiresAt.After(record.CreatedAt) {
+				return false, nil
+			}
+			m.items[i] = record
+			return true, nil
+		}
+	}
+	m.items = append(m.items, record)
+	return true, nil
+}
+
+func (m *mockRepository) Complete(ctx context.Context, record entity.IdempotencyKey) error {
+	for i, item := range m.items {
+		if item.UserID == record.UserID && item.Key == record.Key {
+			m.items[i] = record
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Release(ctx context.Context, userID, key string) error {
+	for i, item := range m.items {
+		if item.UserID == userID && item.Key == key && item.Status == 0 {
+			m.items = append(m.items[:i], m.items[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	var count int64
+	var items []entity.IdempotencyKey
+	for _, item := range m.items {
+		if item.ExpiresAt.Before(before) {
+			count++
+		} else {
+			items = append(items, item)
+		}
+	}
+	m.items = items
+	return count, nil
+}
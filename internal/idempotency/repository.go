@@ -0,0 +1,98 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/dbcontext"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// Repository encapsulates the logic to access the recorded responses of idempotent requests from the data source.
+type Repository interface {
+	// Get returns the record of the given key of the given user.
+	Get(ctx context.Context, userID, key string) (entity.IdempotencyKey, error)
+	// Reserve saves a new record for a request being processed, unless an unexpired record exists for its key. It
+	// reports whether the record was saved.
+	Reserve(ctx context.Context, record entity.IdempotencyKey) (bool, error)
+	// Complete saves the fingerprint of the request and the response of a reserved record.
+	Complete(ctx context.Context, record entity.IdempotencyKey) error
+	// Release removes the record of the given key of the given user if its request is still being processed.
+	Release(ctx context.Context, userID, key string) error
+	// Purge removes the records that expired before the given time, and returns how many were removed.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// repository persists the records of idempotency keys in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new idempotency key repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the record of the given key of the given user from the database.
+func (r repository) Get(ctx context.Context, userID, key string) (entity.IdempotencyKey, error) {
+	var record entity.IdempotencyKey
+	err := r.db.With(ctx).
+		Select().
+		From("idempotency_key").
+		Where(dbx.HashExp{"user_id": userID, "key": key}).
+		One(&record)
+	return record, err
+}
+
+// Reserve inserts a record in the database, or replaces the record of the same key if it has expired.
+func (r repository) Reserve(ctx context.Context, record entity.IdempotencyKey) (bool, error) {
+	result, err := r.db.With(ctx).
+		NewQuery("INSERT INTO {{idempotency_key}} ([[user_id]], [[key]], [[fingerprint]], [[created_at]], [[expires_at]]) " +
+			"VALUES ({:user_id}, {:key}, {:fingerprint}, {:created_at}, {:expires_at}) " +
+			"ON CONFLICT ([[user_id]], [[key]]) DO UPDATE SET [[fingerprint]] = EXCLUDED.fingerprint, [[status]] = 0, " +
+			"[[header]] = '{}', [[body]] = '', [[created_at]] = EXCLUDED.created_at, [[expires_at]] = EXCLUDED.expires_at " +
+			"WHERE {{idempotency_key}}.[[expires_at]] <= EXCLUDED.created_at").
+		Bind(dbx.Params{
+			"user_id":     record.UserID,
+			"key":         record.Key,
+			"fingerprint": record.Fingerprint,
+			"created_at":  record.CreatedAt,
+			"expires_at":  record.ExpiresAt,
+		}).
+		Execute()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// Complete saves the fingerprint of the request and the status, header and body of the response of a record in the
+// database.
+func (r repository) Complete(ctx context.Context, record entity.IdempotencyKey) error {
+	_, err := r.db.With(ctx).Update("idempotency_key", dbx.Params{
+		"fingerprint": record.Fingerprint,
+		"status":      record.Status,
+		"header":      record.Header,
+		"body":        record.Body,
+	}, dbx.HashExp{"user_id": record.UserID, "key": record.Key}).Execute()
+	return err
+}
+
+// Release deletes the record of the given key of the given user from the database if it has no response.
+func (r repository) Release(ctx context.Context, userID, key string) error {
+	_, err := r.db.With(ctx).Delete("idempotency_key", dbx.HashExp{"user_id": userID, "key": key, "status": 0}).Execute()
+	return err
+}
+
+// Purge deletes the records that expired before the given time from the database.
+func (r repository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.With(ctx).Delete("idempotency_key", dbx.NewExp("expires_at < {:before}", dbx.Params{"before": before})).Execute()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
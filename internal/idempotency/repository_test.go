@@ -0,0 +1,79 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "idempotency_key")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	// reserve
+	record := entity.IdempotencyKey{UserID: "100", Key: "key1", Fingerprint: "abc", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	reserved, err := repo.Reserve(ctx, record)
+	assert.Nil(t, err)
+	assert.True(t, reserved)
+	reserved, err = repo.Reserve(ctx, record)
+	assert.Nil(t, err)
+	assert.False(t, reserved)
+	reserved, _ = repo.Reserve(ctx, entity.IdempotencyKey{UserID: "200", Key: "key1", Fingerprint: "abc", CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	assert.True(t, reserved)
+
+	// get
+	saved, err := repo.Get(ctx, "100", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", saved.Fingerprint)
+	assert.Equal(t, 0, saved.Status)
+	_, err = repo.Get(ctx, "100", "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// complete
+	record.Fingerprint = "abd"
+	record.Status = http.StatusCreated
+	record.Header = entity.ResponseHeader{"Content-Type": {"application/json"}}
+	record.Body = []byte(`{"id":"1"}`)
+	assert.Nil(t, repo.Complete(ctx, record))
+	saved, _ = repo.Get(ctx, "100", "key1")
+	assert.Equal(t, "abd", saved.Fingerprint)
+	assert.Equal(t, http.StatusCreated, saved.Status)
+	assert.Equal(t, record.Header, saved.Header)
+	assert.Equal(t, record.Body, saved.Body)
+
+	// release only removes the requests in progress
+	assert.Nil(t, repo.Release(ctx, "100", "key1"))
+	assert.Nil(t, repo.Release(ctx, "200", "key1"))
+	_, err = repo.Get(ctx, "100", "key1")
+	assert.Nil(t, err)
+	_, err = repo.Get(ctx, "200", "key1")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// expired records are replaced
+	later := now.Add(2 * time.Hour)
+	reserved, _ = repo.Reserve(ctx, entity.IdempotencyKey{UserID: "100", Key: "key1", Fingerprint: "def", CreatedAt: later, ExpiresAt: later.Add(time.Hour)})
+	assert.True(t, reserved)
+	saved, _ = repo.Get(ctx, "100", "key1")
+	assert.Equal(t, "def", saved.Fingerprint)
+	assert.Equal(t, 0, saved.Status)
+	assert.Empty(t, saved.Body)
+
+	// purge
+	count, err := repo.Purge(ctx, later.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+	count, _ = repo.Purge(ctx, later.Add(2*time.Hour))
+	assert.Equal(t, int64(1), count)
+}
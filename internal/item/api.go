@@ -0,0 +1,162 @@
+package item
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	apperrors "github.com/hikvineh/go-rest-game-character/internal/errors"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/hikvineh/go-rest-game-character/pkg/pagination"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+// The adminHandler guards the changes to the item catalog, which affect the characters holding the items.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler, adminHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/items/<id>", res.get)
+	r.Get("/items", res.query)
+	r.Get("/characters/<id>/items", res.inventory)
+
+	r.Use(authHandler)
+
+	// the following endpoints require a valid JWT
+	r.Post("/items", adminHandler, res.create)
+	r.Put("/items/<id>", adminHandler, res.update)
+	r.Delete("/items/<id>", adminHandler, res.delete)
+	r.Post("/characters/<id>/items", res.add)
+	r.Delete("/characters/<id>/items/<item_id>", res.remove)
+	r.Post("/characters/<id>/items/<item_id>/equip", res.equip)
+	r.Post("/characters/<id>/items/<item_id>/unequip", res.unequip)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	item, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(item)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	items, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = items
+	return c.Write(pages)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreateItemRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return apperrors.BadRequest("")
+	}
+	item, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(item, http.StatusCreated)
+}
+
+func (r resource) update(c *routing.Context) error {
+	var input UpdateItemRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return apperrors.BadRequest("")
+	}
+
+	item, err := r.service.Update(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(item)
+}
+
+func (r resource) delete(c *routing.Context) error {
+	item, err := r.service.Delete(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(item)
+}
+
+func (r resource) inventory(c *routing.Context) error {
+	inventory, err := r.service.Inventory(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(inventory)
+}
+
+func (r resource) add(c *routing.Context) error {
+	var input AddItemRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return apperrors.BadRequest("")
+	}
+
+	inventory, err := r.service.AddToInventory(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(inventory)
+}
+
+func (r resource) remove(c *routing.Context) error {
+	var quantity int64
+	if value := c.Query("quantity"); value != "" {
+		var err error
+		if quantity, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return validation.Errors{
+				"quantity": errors.New("must be an integer"),
+			}
+		}
+	}
+
+	inventory, err := r.service.RemoveFromInventory(c.Request.Context(), c.Param("id"), c.Param("item_id"), quantity)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(inventory)
+}
+
+func (r resource) equip(c *routing.Context) error {
+	inventory, err := r.service.Equip(c.Request.Context(), c.Param("id"), c.Param("item_id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(inventory)
+}
+
+func (r resource) unequip(c *routing.Context) error {
+	inventory, err := r.service.Unequip(c.Request.Context(), c.Param("id"), c.Param("item_id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(inventory)
+}
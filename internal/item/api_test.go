@@ -0,0 +1,85 @@
+package item
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{items: []entity.Item{
+		{ID: "sting", Name: "Sting", Slot: "weapon", PowerBonus: 5, PowerPercent: 10},
+		{ID: "lembas", Name: "Lembas"},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, newMockCharacterService(repo), repo.transactional, logger), auth.MockAuthHandler, auth.AdminHandler([]string{"100"}), logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/items", "", nil, http.StatusOK, `*"total_count":2*`},
+		{"get 1", "GET", "/items/sting", "", nil, http.StatusOK, `*"name":"Sting","slot":"weapon","power_bonus":5,"power_percent":10*`},
+		{"get unknown", "GET", "/items/none", "", nil, http.StatusNotFound, ""},
+		{"create ok", "POST", "/items", `{"name":"Mithril","slot":"armor","power_percent":50}`, header, http.StatusCreated, "*Mithril*"},
+		{"create ok count", "GET", "/items", "", nil, http.StatusOK, `*"total_count":3*`},
+		{"create auth error", "POST", "/items", `{"name":"Mithril"}`, nil, http.StatusUnauthorized, ""},
+		{"create input error", "POST", "/items", `"name":"Mithril"}`, header, http.StatusBadRequest, ""},
+		{"create validation error", "POST", "/items", `{"name":"Mithril","power_percent":-200}`, header, http.StatusBadRequest, `*power_percent*`},
+		{"update ok", "PUT", "/items/sting", `{"name":"Sting","power_bonus":6,"power_percent":10}`, header, http.StatusOK, `*"power_bonus":6*`},
+		{"update unknown", "PUT", "/items/none", `{"name":"Sting"}`, header, http.StatusNotFound, ""},
+		{"update auth error", "PUT", "/items/sting", `{"name":"Sting"}`, nil, http.StatusUnauthorized, ""},
+		{"inventory empty", "GET", "/characters/frodo/items", "", nil, http.StatusOK, `*"items":[]*`},
+		{"inventory unknown", "GET", "/characters/unknown/items", "", nil, http.StatusNotFound, ""},
+		{"add", "POST", "/characters/frodo/items", `{"item_id":"sting"}`, header, http.StatusOK, `*"items":[{"id":"sting","name":"Sting"*`},
+		{"add quantity", "POST", "/characters/frodo/items", `{"item_id":"lembas","quantity":3}`, header, http.StatusOK, `*"quantity":3,"equipped":false}*`},
+		{"add unknown item", "POST", "/characters/frodo/items", `{"item_id":"none"}`, header, http.StatusBadRequest, `*item_id*`},
+		{"add not owner", "POST", "/characters/sam/items", `{"item_id":"sting"}`, header, http.StatusForbidden, ""},
+		{"add auth error", "POST", "/characters/frodo/items", `{"item_id":"sting"}`, nil, http.StatusUnauthorized, ""},
+		{"equip", "POST", "/characters/frodo/items/sting/equip", "", header, http.StatusOK, `*"effective_power":17,"character_value":34*`},
+		{"equip verify", "GET", "/characters/frodo/items", "", nil, http.StatusOK, `*"quantity":1,"equipped":true}]}`},
+		{"equip no slot", "POST", "/characters/frodo/items/lembas/equip", "", header, http.StatusBadRequest, ""},
+		{"equip not held", "POST", "/characters/frodo/items/none/equip", "", header, http.StatusNotFound, ""},
+		{"equip auth error", "POST", "/characters/frodo/items/sting/equip", "", nil, http.StatusUnauthorized, ""},
+		{"unequip", "POST", "/characters/frodo/items/sting/unequip", "", header, http.StatusOK, `*"effective_power":10,*`},
+		{"unequip auth error", "POST", "/characters/frodo/items/sting/unequip", "", nil, http.StatusUnauthorized, ""},
+		{"remove some", "DELETE", "/characters/frodo/items/lembas?quantity=2", "", header, http.StatusOK, `*"quantity":1,"equipped":false},{*`},
+		{"remove too many", "DELETE", "/characters/frodo/items/lembas?quantity=2", "", header, http.StatusBadRequest, `*quantity*`},
+		{"remove invalid quantity", "DELETE", "/characters/frodo/items/lembas?quantity=abc", "", header, http.StatusBadRequest, `*quantity*`},
+		{"remove all", "DELETE", "/characters/frodo/items/lembas", "", header, http.StatusOK, `*"items":[{"id":"sting",*`},
+		{"remove not held", "DELETE", "/characters/frodo/items/lembas", "", header, http.StatusNotFound, ""},
+		{"remove auth error", "DELETE", "/characters/frodo/items/sting", "", nil, http.StatusUnauthorized, ""},
+		{"delete ok", "DELETE", "/items/sting", ``, header, http.StatusOK, "*Sting*"},
+		{"delete verify", "GET", "/items/sting", ``, nil, http.StatusNotFound, ""},
+		{"delete inventory verify", "GET", "/characters/frodo/items", "", nil, http.StatusOK, `*"items":[]*`},
+		{"delete auth error", "DELETE", "/items/lembas", ``, nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+func TestAPI_admin(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{items: []entity.Item{
+		{ID: "sting", Name: "Sting", Slot: "weapon", PowerBonus: 5, PowerPercent: 10},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, newMockCharacterService(repo), repo.transactional, logger), auth.MockAuthHandler, auth.AdminHandler(nil), logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get 1", "GET", "/items/sting", "", nil, http.StatusOK, "*Sting*"},
+		{"create forbidden", "POST", "/items", `{"name":"Mithril"}`, header, http.StatusForbidden, ""},
+		{"update forbidden", "PUT", "/items/sting", `{"name":"Sting","power_bonus":50}`, header, http.StatusForbidden, ""},
+		{"delete forbidden", "DELETE", "/items/sting", ``, header, http.StatusForbidden, ""},
+		{"catalog unchanged", "GET", "/items/sting", "", nil, http.StatusOK, `*"power_bonus":5,*`},
+		{"add", "POST", "/characters/frodo/items", `{"item_id":"sting"}`, header, http.StatusOK, `*"id":"sting"*`},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
@@ -0,0 +1,8 @@
+package item
+
+import (
+	"github.com/hikvineh/go-rest-game-character/internal/errors"
+)
+
+// ErrNotEquippable is returned when a character attempts to equip an item without a slot.
+var ErrNotEquippable = errors.BadRequest("The item has no slot and cannot be equipped.")
@@ -0,0 +1,195 @@
+package item
+
+import (
+	"context"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/dbcontext"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// Repository encapsulates the logic to access items and the inventories of characters from the data source.
+// It implements character.Equipment.
+type Repository interface {
+	// Get returns the item with the specified ID.
+	Get(ctx context.Context, id string) (entity.Item, error)
+	// Count returns the number of items.
+	Count(ctx context.Context) (int, error)
+	// Query returns the list of items ordered by name with the given offset and limit.
+	Query(ctx context.Context, offset, limit int) ([]entity.Item, error)
+	// Create saves a new item in the storage.
+	Create(ctx context.Context, item entity.Item) error
+	// Update updates the item with given ID in the storage.
+	Update(ctx context.Context, item entity.Item) error
+	// Delete removes the item with given ID from the storage, along with the inventory items of that kind.
+	Delete(ctx context.Context, id string) error
+	// QueryInventory returns the items held by the character with the given ID, ordered by name.
+	QueryInventory(ctx context.Context, characterID string) ([]InventoryItem, error)
+	// LockInventoryItem returns the items of the given kind held by the character with the given ID. They stay
+	// locked until the end of the transaction, so that concurrent changes wait for it.
+	LockInventoryItem(ctx context.Context, characterID, itemID string) (entity.InventoryItem, error)
+	// AddInventoryItem adds items of a kind to the inventory of a character, on top of those already held.
+	AddInventoryItem(ctx context.Context, item entity.InventoryItem) error
+	// UpdateInventoryItem saves the quantity and the equipped state of the items of a kind held by a character.
+	UpdateInventoryItem(ctx context.Context, item entity.InventoryItem) error
+	// DeleteInventoryItem removes the items of the given kind from the inventory of the character with the given ID.
+	DeleteInventoryItem(ctx context.Context, characterID, itemID string) error
+	// UnequipSlot unequips the items of the given slot equipped by the character with the given ID.
+	UnequipSlot(ctx context.Context, characterID, slot string) error
+	// QueryEquippers returns the IDs of the characters that have equipped the item with the given ID.
+	QueryEquippers(ctx context.Context, itemID string) ([]string, error)
+	// Modifiers returns the stat modifiers of the items equipped by the character with the given ID.
+	Modifiers(ctx context.Context, characterID string) ([]character.Modifier, error)
+}
+
+// repository persists items and inventories in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new item repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the item with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Item, error) {
+	var item entity.Item
+	err := r.db.With(ctx).Select().Model(id, &item)
+	return item, err
+}
+
+// Create saves a new item record in the database.
+func (r repository) Create(ctx context.Context, item entity.Item) error {
+	return r.db.With(ctx).Model(&item).Insert()
+}
+
+// Update saves the changes to an item in the database.
+func (r repository) Update(ctx context.Context, item entity.Item) error {
+	return r.db.With(ctx).Model(&item).Update()
+}
+
+// Delete deletes the item record with the specified ID from the database. The inventory item records of that kind
+// are deleted by the foreign key.
+func (r repository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.With(ctx).Delete("item", dbx.HashExp{"id": id}).Execute()
+	return err
+}
+
+// Count returns the number of the item records in the database.
+func (r repository) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("item").Row(&count)
+	return count, err
+}
+
+// Query retrieves the item records ordered by name with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Item, error) {
+	var items []entity.Item
+	err := r.db.With(ctx).
+		Select().
+		OrderBy("name", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&items)
+	return items, err
+}
+
+// QueryInventory retrieves the inventory item records of the character with the given ID, joined with their items
+// and ordered by name, from the database.
+func (r repository) QueryInventory(ctx context.Context, characterID string) ([]InventoryItem, error) {
+	var items []InventoryItem
+	err := r.db.With(ctx).
+		Select("item.*", "inventory_item.quantity", "inventory_item.equipped").
+		From("inventory_item").
+		InnerJoin("item", dbx.NewExp("item.id = inventory_item.item_id")).
+		Where(dbx.HashExp{"inventory_item.character_id": characterID}).
+		OrderBy("item.name", "item.id").
+		All(&items)
+	return items, err
+}
+
+// LockInventoryItem reads the inventory item record of the given character and item from the database and locks it
+// until the end of the transaction.
+func (r repository) LockInventoryItem(ctx context.Context, characterID, itemID string) (entity.InventoryItem, error) {
+	var item entity.InventoryItem
+	err := r.db.With(ctx).
+		NewQuery("SELECT * FROM {{inventory_item}} WHERE [[character_id]] = {:character_id} AND [[item_id]] = {:item_id} FOR UPDATE").
+		Bind(dbx.Params{"character_id": characterID, "item_id": itemID}).
+		One(&item)
+	return item, err
+}
+
+// AddInventoryItem inserts an inventory item record in the database, or adds its quantity to the existing one.
+func (r repository) AddInventoryItem(ctx context.Context, item entity.InventoryItem) error {
+	_, err := r.db.With(ctx).
+		NewQuery("INSERT INTO {{inventory_item}} ([[character_id]], [[item_id]], [[quantity]], [[equipped]], [[created_at]], [[updated_at]]) " +
+			"VALUES ({:character_id}, {:item_id}, {:quantity}, {:equipped}, {:created_at}, {:updated_at}) " +
+			"ON CONFLICT ([[character_id]], [[item_id]]) DO UPDATE " +
+			"SET [[quantity]] = {{inventory_item}}.[[quantity]] + EXCLUDED.[[quantity]], [[updated_at]] = EXCLUDED.[[updated_at]]").
+		Bind(dbx.Params{
+			"character_id": item.CharacterID,
+			"item_id":      item.ItemID,
+			"quantity":     item.Quantity,
+			"equipped":     item.Equipped,
+			"created_at":   item.CreatedAt,
+			"updated_at":   item.UpdatedAt,
+		}).
+		Execute()
+	return err
+}
+
+// UpdateInventoryItem saves the changes to an inventory item in the database.
+func (r repository) UpdateInventoryItem(ctx context.Context, item entity.InventoryItem) error {
+	_, err := r.db.With(ctx).Update("inventory_item", dbx.Params{
+		"quantity":   item.Quantity,
+		"equipped":   item.Equipped,
+		"updated_at": item.UpdatedAt,
+	}, dbx.HashExp{"character_id": item.CharacterID, "item_id": item.ItemID}).Execute()
+	return err
+}
+
+// DeleteInventoryItem deletes the inventory item record of the given character and item from the database.
+func (r repository) DeleteInventoryItem(ctx context.Context, characterID, itemID string) error {
+	_, err := r.db.With(ctx).Delete("inventory_item", dbx.HashExp{"character_id": characterID, "item_id": itemID}).Execute()
+	return err
+}
+
+// UnequipSlot clears the equipped flag of the inventory item records of the given character whose items go into the
+// given slot in the database.
+func (r repository) UnequipSlot(ctx context.Context, characterID, slot string) error {
+	_, err := r.db.With(ctx).Update("inventory_item", dbx.Params{"equipped": false}, dbx.And(
+		dbx.HashExp{"character_id": characterID, "equipped": true},
+		dbx.NewExp("item_id IN (SELECT id FROM item WHERE slot = {:slot})", dbx.Params{"slot": slot}),
+	)).Execute()
+	return err
+}
+
+// QueryEquippers retrieves the IDs of the characters having an equipped inventory item record of the given item from
+// the database.
+func (r repository) QueryEquippers(ctx context.Context, itemID string) ([]string, error) {
+	var ids []string
+	err := r.db.With(ctx).
+		Select("character_id").
+		From("inventory_item").
+		Where(dbx.HashExp{"item_id": itemID, "equipped": true}).
+		OrderBy("character_id").
+		Column(&ids)
+	return ids, err
+}
+
+// Modifiers retrieves the stat modifiers of the items of the equipped inventory item records of the given character
+// from the database.
+func (r repository) Modifiers(ctx context.Context, characterID string) ([]character.Modifier, error) {
+	var modifiers []character.Modifier
+	err := r.db.With(ctx).
+		Select("item.power_bonus AS flat", "item.power_percent AS percent").
+		From("inventory_item").
+		InnerJoin("item", dbx.NewExp("item.id = inventory_item.item_id")).
+		Where(dbx.HashExp{"inventory_item.character_id": characterID, "inventory_item.equipped": true}).
+		All(&modifiers)
+	return modifiers, err
+}
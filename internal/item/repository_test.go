@@ -0,0 +1,109 @@
+package item
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "item")
+	// inventories reference characters, so a character is created for this test
+	_, err := db.DB().Delete("character", dbx.HashExp{"id": "item_test"}).Execute()
+	assert.Nil(t, err)
+	_, err = db.DB().Insert("character", dbx.Params{
+		"id": "item_test", "name": "Frodo", "character_code": 3, "character_power": 10, "effective_power": 10,
+		"character_value": 20, "version": 1, "created_at": time.Now(), "updated_at": time.Now(),
+	}).Execute()
+	assert.Nil(t, err)
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+
+	// create
+	now := time.Now()
+	assert.Nil(t, repo.Create(ctx, entity.Item{ID: "sting", Name: "Sting", Slot: "weapon", PowerBonus: 5, PowerPercent: 10, CreatedAt: now, UpdatedAt: now}))
+	assert.Nil(t, repo.Create(ctx, entity.Item{ID: "glamdring", Name: "Glamdring", Slot: "weapon", PowerBonus: 20, CreatedAt: now, UpdatedAt: now}))
+	assert.Nil(t, repo.Create(ctx, entity.Item{ID: "lembas", Name: "Lembas", CreatedAt: now, UpdatedAt: now}))
+	count, err := repo.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+
+	// get
+	item, err := repo.Get(ctx, "sting")
+	assert.Nil(t, err)
+	assert.Equal(t, "weapon", item.Slot)
+	assert.Equal(t, int64(10), item.PowerPercent)
+	_, err = repo.Get(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// update
+	item.PowerBonus = 6
+	assert.Nil(t, repo.Update(ctx, item))
+	item, _ = repo.Get(ctx, "sting")
+	assert.Equal(t, int64(6), item.PowerBonus)
+
+	// query
+	items, err := repo.Query(ctx, 0, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, items, 3) {
+		assert.Equal(t, "Glamdring", items[0].Name)
+	}
+
+	// inventory
+	held := entity.InventoryItem{CharacterID: "item_test", ItemID: "lembas", Quantity: 2, CreatedAt: now, UpdatedAt: now}
+	assert.Nil(t, repo.AddInventoryItem(ctx, held))
+	assert.Nil(t, repo.AddInventoryItem(ctx, held))
+	assert.Nil(t, repo.AddInventoryItem(ctx, entity.InventoryItem{CharacterID: "item_test", ItemID: "sting", Quantity: 1, CreatedAt: now, UpdatedAt: now}))
+	assert.Nil(t, repo.AddInventoryItem(ctx, entity.InventoryItem{CharacterID: "item_test", ItemID: "glamdring", Quantity: 1, CreatedAt: now, UpdatedAt: now}))
+	inventory, err := repo.QueryInventory(ctx, "item_test")
+	assert.Nil(t, err)
+	if assert.Len(t, inventory, 3) {
+		assert.Equal(t, "Lembas", inventory[1].Name)
+		assert.Equal(t, int64(4), inventory[1].Quantity)
+	}
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		held, err := repo.LockInventoryItem(ctx, "item_test", "sting")
+		assert.Nil(t, err)
+		held.Equipped = true
+		return repo.UpdateInventoryItem(ctx, held)
+	})
+	assert.Nil(t, err)
+	_, err = repo.LockInventoryItem(ctx, "item_test", "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// equipment
+	modifiers, err := repo.Modifiers(ctx, "item_test")
+	assert.Nil(t, err)
+	assert.Equal(t, []character.Modifier{{Flat: 6, Percent: 10}}, modifiers)
+	ids, err := repo.QueryEquippers(ctx, "sting")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"item_test"}, ids)
+	assert.Nil(t, repo.UnequipSlot(ctx, "item_test", "weapon"))
+	modifiers, _ = repo.Modifiers(ctx, "item_test")
+	assert.Empty(t, modifiers)
+
+	// delete
+	assert.Nil(t, repo.DeleteInventoryItem(ctx, "item_test", "lembas"))
+	assert.Nil(t, repo.Delete(ctx, "glamdring"))
+	inventory, _ = repo.QueryInventory(ctx, "item_test")
+	if assert.Len(t, inventory, 1) {
+		assert.Equal(t, "sting", inventory[0].ID)
+	}
+	count, _ = repo.Count(ctx)
+	assert.Equal(t, 2, count)
+	_, err = db.DB().Delete("character", dbx.HashExp{"id": "item_test"}).Execute()
+	assert.Nil(t, err)
+	inventory, _ = repo.QueryInventory(ctx, "item_test")
+	assert.Empty(t, inventory)
+}
@@ -0,0 +1,379 @@
+package item
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/dbcontext"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// Stat modifier and quantity bounds
+const (
+	// MaxPowerBonus is the maximum flat power bonus or malus of an item.
+	MaxPowerBonus = 1000000
+	// MinPowerPercent and MaxPowerPercent bound the percentage of the base power that an item adds.
+	MinPowerPercent = -100
+	MaxPowerPercent = 1000
+	// MaxQuantity is the maximum number of items added to an inventory at once.
+	MaxQuantity = 1000000
+)
+
+// Service encapsulates usecase logic for items and inventories.
+type Service interface {
+	Get(ctx context.Context, id string) (Item, error)
+	Query(ctx context.Context, offset, limit int) ([]Item, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, input CreateItemRequest) (Item, error)
+	Update(ctx context.Context, id string, input UpdateItemRequest) (Item, error)
+	Delete(ctx context.Context, id string) (Item, error)
+	Inventory(ctx context.Context, characterID string) (Inventory, error)
+	AddToInventory(ctx context.Context, characterID string, input AddItemRequest) (Inventory, error)
+	RemoveFromInventory(ctx context.Context, characterID, itemID string, quantity int64) (Inventory, error)
+	Equip(ctx context.Context, characterID, itemID string) (Inventory, error)
+	Unequip(ctx context.Context, characterID, itemID string) (Inventory, error)
+}
+
+// Item represents the data about an item.
+type Item struct {
+	entity.Item
+}
+
+// InventoryItem represents the items of a kind held by a character.
+type InventoryItem struct {
+	entity.Item
+	Quantity int64 `json:"quantity"`
+	Equipped bool  `json:"equipped"`
+}
+
+// Inventory represents the items held by a character, along with the character. The effective power and the value
+// of the character account for the items it has equipped.
+type Inventory struct {
+	Character character.Character `json:"character"`
+	Items     []InventoryItem     `json:"items"`
+}
+
+// CreateItemRequest represents an item creation request.
+type CreateItemRequest struct {
+	Name         string `json:"name"`
+	Slot         string `json:"slot"`
+	PowerBonus   int64  `json:"power_bonus"`
+	PowerPercent int64  `json:"power_percent"`
+}
+
+// Validate validates the CreateItemRequest fields.
+func (m CreateItemRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.Slot, validation.Length(0, 32)),
+		validation.Field(&m.PowerBonus, validation.Min(int64(-MaxPowerBonus)), validation.Max(int64(MaxPowerBonus))),
+		validation.Field(&m.PowerPercent, validation.Min(int64(MinPowerPercent)), validation.Max(int64(MaxPowerPercent))),
+	)
+}
+
+// UpdateItemRequest represents an item update request. The slot of an item cannot be changed.
+type UpdateItemRequest struct {
+	Name         string `json:"name"`
+	PowerBonus   int64  `json:"power_bonus"`
+	PowerPercent int64  `json:"power_percent"`
+}
+
+// Validate validates the UpdateItemRequest fields.
+func (m UpdateItemRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.PowerBonus, validation.Min(int64(-MaxPowerBonus)), validation.Max(int64(MaxPowerBonus))),
+		validation.Field(&m.PowerPercent, validation.Min(int64(MinPowerPercent)), validation.Max(int64(MaxPowerPercent))),
+	)
+}
+
+// AddItemRequest represents a request adding items of a kind to an inventory. The quantity defaults to 1.
+type AddItemRequest struct {
+	ItemID   string `json:"item_id"`
+	Quantity int64  `json:"quantity"`
+}
+
+// Validate validates the AddItemRequest fields.
+func (m AddItemRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.ItemID, validation.Required),
+		validation.Field(&m.Quantity, validation.Min(int64(1)), validation.Max(int64(MaxQuantity))),
+	)
+}
+
+type service struct {
+	repo          Repository
+	characters    character.Service
+	transactional dbcontext.TransactionFunc
+	logger        log.Logger
+}
+
+// NewService creates a new item service.
+// The character service is used to recompute the characters whose equipment changes, in the transaction run by the
+// transactional function.
+func NewService(repo Repository, characters character.Service, transactional dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, characters, transactional, logger}
+}
+
+// Get returns the item with the specified ID.
+func (s service) Get(ctx context.Context, id string) (Item, error) {
+	item, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Item{}, err
+	}
+	return Item{item}, nil
+}
+
+// Count returns the number of items.
+func (s service) Count(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
+}
+
+// Query returns the items ordered by name with the specified offset and limit.
+func (s service) Query(ctx context.Context, offset, limit int) ([]Item, error) {
+	items, err := s.repo.Query(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Item{}
+	for _, item := range items {
+		result = append(result, Item{item})
+	}
+	return result, nil
+}
+
+// Create creates a new item.
+func (s service) Create(ctx context.Context, req CreateItemRequest) (Item, error) {
+	if err := req.Validate(); err != nil {
+		return Item{}, err
+	}
+	now := time.Now()
+	id := entity.GenerateID()
+	err := s.repo.Create(ctx, entity.Item{
+		ID:           id,
+		Name:         req.Name,
+		Slot:         req.Slot,
+		PowerBonus:   req.PowerBonus,
+		PowerPercent: req.PowerPercent,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	})
+	if err != nil {
+		return Item{}, err
+	}
+	return s.Get(ctx, id)
+}
+
+// Update renames the item with the specified ID and changes its stat modifiers. The characters that have equipped
+// the item are recomputed in the same transaction.
+func (s service) Update(ctx context.Context, id string, req UpdateItemRequest) (Item, error) {
+	if err := req.Validate(); err != nil {
+		return Item{}, err
+	}
+
+	var item Item
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		if item, err = s.Get(ctx, id); err != nil {
+			return err
+		}
+		refresh := item.PowerBonus != req.PowerBonus || item.PowerPercent != req.PowerPercent
+		item.Name = req.Name
+		item.PowerBonus = req.PowerBonus
+		item.PowerPercent = req.PowerPercent
+		item.UpdatedAt = time.Now()
+		if err := s.repo.Update(ctx, item.Item); err != nil {
+			return err
+		}
+		if !refresh {
+			return nil
+		}
+		return s.refreshEquippers(ctx, id)
+	})
+	return item, err
+}
+
+// Delete deletes the item with the specified ID and removes it from the inventories. The characters that had
+// equipped the item are recomputed in the same transaction.
+func (s service) Delete(ctx context.Context, id string) (Item, error) {
+	var item Item
+	err := s.transactional(ctx, func(ctx context.Context) (err error) {
+		if item, err = s.Get(ctx, id); err != nil {
+			return err
+		}
+		equippers, err := s.repo.QueryEquippers(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.refresh(ctx, equippers)
+	})
+	return item, err
+}
+
+// refreshEquippers recomputes the characters that have equipped the item with the specified ID.
+func (s service) refreshEquippers(ctx context.Context, id string) error {
+	equippers, err := s.repo.QueryEquippers(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.refresh(ctx, equippers)
+}
+
+// refresh recomputes the characters with the specified IDs after their equipment changed.
+func (s service) refresh(ctx context.Context, characterIDs []string) error {
+	for _, id := range characterIDs {
+		if _, err := s.characters.RefreshEquipment(ctx, id); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+	return nil
+}
+
+// Inventory returns the inventory of the character with the specified ID.
+func (s service) Inventory(ctx context.Context, characterID string) (Inventory, error) {
+	c, err := s.characters.Get(ctx, characterID)
+	if err != nil {
+		return Inventory{}, err
+	}
+	return s.inventory(ctx, c)
+}
+
+// inventory returns the inventory of the given character.
+func (s service) inventory(ctx context.Context, c character.Character) (Inventory, error) {
+	items, err := s.repo.QueryInventory(ctx, c.ID)
+	if err != nil {
+		return Inventory{}, err
+	}
+	if items == nil {
+		items = []InventoryItem{}
+	}
+	return Inventory{Character: c, Items: items}, nil
+}
+
+// changeInventory applies a change to the inventory of the character with the specified ID in a transaction, and
+// returns the resulting inventory. Only the owner of a character can change its inventory. The change reports whether
+// it affected the equipment of the character, which is then recomputed.
+func (s service) changeInventory(ctx context.Context, characterID string, change func(ctx context.Context) (bool, error)) (Inventory, error) {
+	var inventory Inventory
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		c, err := s.characters.Get(ctx, characterID)
+		if err != nil {
+			return err
+		}
+		if user := auth.CurrentUser(ctx); user == nil || user.GetID() != c.OwnerID {
+			return character.ErrNotOwner
+		}
+		equipment, err := change(ctx)
+		if err != nil {
+			return err
+		}
+		if equipment {
+			if c, err = s.characters.RefreshEquipment(ctx, characterID); err != nil {
+				return err
+			}
+		}
+		inventory, err = s.inventory(ctx, c)
+		return err
+	})
+	return inventory, err
+}
+
+// AddToInventory adds items of a kind to the inventory of the character with the specified ID. The added items are
+// not equipped, unless items of that kind were already equipped by the character.
+func (s service) AddToInventory(ctx context.Context, characterID string, req AddItemRequest) (Inventory, error) {
+	if err := req.Validate(); err != nil {
+		return Inventory{}, err
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	return s.changeInventory(ctx, characterID, func(ctx context.Context) (bool, error) {
+		if _, err := s.repo.Get(ctx, req.ItemID); err == sql.ErrNoRows {
+			return false, validation.Errors{
+				"item_id": errors.New("must be the ID of an existing item"),
+			}
+		} else if err != nil {
+			return false, err
+		}
+		now := time.Now()
+		return false, s.repo.AddInventoryItem(ctx, entity.InventoryItem{
+			CharacterID: characterID,
+			ItemID:      req.ItemID,
+			Quantity:    req.Quantity,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		})
+	})
+}
+
+// RemoveFromInventory removes items of a kind from the inventory of the character with the specified ID, or all of
+// them if the quantity is 0. Removing all the items of an equipped kind unequips it.
+// sql.ErrNoRows is returned if the character holds no such item.
+func (s service) RemoveFromInventory(ctx context.Context, characterID, itemID string, quantity int64) (Inventory, error) {
+	if err := validation.Validate(quantity, validation.Min(int64(0))); err != nil {
+		return Inventory{}, validation.Errors{"quantity": err}
+	}
+	return s.changeInventory(ctx, characterID, func(ctx context.Context) (bool, error) {
+		held, err := s.repo.LockInventoryItem(ctx, characterID, itemID)
+		if err != nil {
+			return false, err
+		}
+		if quantity > held.Quantity {
+			return false, validation.Errors{
+				"quantity": errors.New("must not exceed the quantity held"),
+			}
+		}
+		if quantity == 0 || quantity == held.Quantity {
+			return held.Equipped, s.repo.DeleteInventoryItem(ctx, characterID, itemID)
+		}
+		held.Quantity -= quantity
+		held.UpdatedAt = time.Now()
+		return false, s.repo.UpdateInventoryItem(ctx, held)
+	})
+}
+
+// Equip equips the character with the specified ID with an item of its inventory. The item previously equipped in
+// the same slot, if any, is unequipped. sql.ErrNoRows is returned if the character holds no such item.
+func (s service) Equip(ctx context.Context, characterID, itemID string) (Inventory, error) {
+	return s.changeInventory(ctx, characterID, func(ctx context.Context) (bool, error) {
+		held, err := s.repo.LockInventoryItem(ctx, characterID, itemID)
+		if err != nil || held.Equipped {
+			return false, err
+		}
+		item, err := s.repo.Get(ctx, itemID)
+		if err != nil {
+			return false, err
+		}
+		if item.Slot == "" {
+			return false, ErrNotEquippable
+		}
+		if err := s.repo.UnequipSlot(ctx, characterID, item.Slot); err != nil {
+			return false, err
+		}
+		held.Equipped = true
+		held.UpdatedAt = time.Now()
+		return true, s.repo.UpdateInventoryItem(ctx, held)
+	})
+}
+
+// Unequip unequips an item of the inventory of the character with the specified ID, which keeps holding it.
+// sql.ErrNoRows is returned if the character holds no such item.
+func (s service) Unequip(ctx context.Context, characterID, itemID string) (Inventory, error) {
+	return s.changeInventory(ctx, characterID, func(ctx context.Context) (bool, error) {
+		held, err := s.repo.LockInventoryItem(ctx, characterID, itemID)
+		if err != nil || !held.Equipped {
+			return false, err
+		}
+		held.Equipped = false
+		held.UpdatedAt = time.Now()
+		return true, s.repo.UpdateInventoryItem(ctx, held)
+	})
+}
@@ -0,0 +1,388 @@
+package item
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"testing"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test/charactertest"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var errCRUD = errors.New("error crud")
+
+func TestCreateItemRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     CreateItemRequest
+		wantError bool
+	}{
+		{"success", CreateItemRequest{Name: "Sting", Slot: "weapon", PowerBonus: 5, PowerPercent: 10}, false},
+		{"no slot", CreateItemRequest{Name: "Lembas"}, false},
+		{"malus", CreateItemRequest{Name: "Ring", Slot: "finger", PowerBonus: -5, PowerPercent: -100}, false},
+		{"name required", CreateItemRequest{Slot: "weapon"}, true},
+		{"bonus too large", CreateItemRequest{Name: "Sting", PowerBonus: MaxPowerBonus + 1}, true},
+		{"percent too small", CreateItemRequest{Name: "Sting", PowerPercent: MinPowerPercent - 1}, true},
+		{"percent too large", CreateItemRequest{Name: "Sting", PowerPercent: MaxPowerPercent + 1}, true},
+		{"slot too long", CreateItemRequest{Name: "Sting", Slot: "123456789012345678901234567890123"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func TestUpdateItemRequest_Validate(t *testing.T) {
+	assert.Nil(t, UpdateItemRequest{Name: "Sting", PowerBonus: 10}.Validate())
+	assert.NotNil(t, UpdateItemRequest{}.Validate())
+	assert.NotNil(t, UpdateItemRequest{Name: "Sting", PowerBonus: -MaxPowerBonus - 1}.Validate())
+}
+
+func TestAddItemRequest_Validate(t *testing.T) {
+	assert.Nil(t, AddItemRequest{ItemID: "sting"}.Validate())
+	assert.Nil(t, AddItemRequest{ItemID: "sting", Quantity: MaxQuantity}.Validate())
+	assert.NotNil(t, AddItemRequest{Quantity: 1}.Validate())
+	assert.NotNil(t, AddItemRequest{ItemID: "sting", Quantity: -1}.Validate())
+	assert.NotNil(t, AddItemRequest{ItemID: "sting", Quantity: MaxQuantity + 1}.Validate())
+}
+
+func Test_service_CRUD(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, newMockCharacterService(repo), repo.transactional, logger)
+	ctx := context.Background()
+
+	count, _ := s.Count(ctx)
+	assert.Equal(t, 0, count)
+
+	// successful creation
+	item, err := s.Create(ctx, CreateItemRequest{Name: "Sting", Slot: "weapon", PowerBonus: 5})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, item.ID)
+	id := item.ID
+	assert.Equal(t, "Sting", item.Name)
+	assert.Equal(t, "weapon", item.Slot)
+	assert.Equal(t, int64(5), item.PowerBonus)
+	assert.NotEmpty(t, item.CreatedAt)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 1, count)
+
+	// validation error in creation
+	_, err = s.Create(ctx, CreateItemRequest{Name: ""})
+	assert.NotNil(t, err)
+
+	// unexpected error in creation
+	_, err = s.Create(ctx, CreateItemRequest{Name: "error"})
+	assert.Equal(t, errCRUD, err)
+
+	// update
+	item, err = s.Update(ctx, id, UpdateItemRequest{Name: "Sting updated", PowerBonus: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, "Sting updated", item.Name)
+	assert.Equal(t, "weapon", item.Slot)
+	_, err = s.Update(ctx, "none", UpdateItemRequest{Name: "Sting"})
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Update(ctx, id, UpdateItemRequest{Name: ""})
+	assert.NotNil(t, err)
+
+	// get
+	item, _ = s.Get(ctx, id)
+	assert.Equal(t, int64(10), item.PowerBonus)
+	_, err = s.Get(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// query
+	items, _ := s.Query(ctx, 0, 0)
+	assert.Equal(t, 1, len(items))
+
+	// delete
+	_, err = s.Delete(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+	item, err = s.Delete(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, id, item.ID)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 0, count)
+}
+
+func Test_service_Inventory(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: []entity.Item{
+		{ID: "sting", Name: "Sting", Slot: "weapon", PowerBonus: 5, PowerPercent: 10},
+		{ID: "glamdring", Name: "Glamdring", Slot: "weapon", PowerBonus: 20},
+		{ID: "mithril", Name: "Mithril", Slot: "armor", PowerPercent: 50},
+		{ID: "lembas", Name: "Lembas"},
+	}}
+	characters := newMockCharacterService(repo)
+	s := NewService(repo, characters, repo.transactional, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	inventory, err := s.Inventory(ctx, "frodo")
+	assert.Nil(t, err)
+	assert.Equal(t, "frodo", inventory.Character.ID)
+	assert.Empty(t, inventory.Items)
+	_, err = s.Inventory(ctx, "unknown")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// add
+	inventory, err = s.AddToInventory(ctx, "frodo", AddItemRequest{ItemID: "sting"})
+	assert.Nil(t, err)
+	if assert.Len(t, inventory.Items, 1) {
+		assert.Equal(t, "Sting", inventory.Items[0].Name)
+		assert.Equal(t, int64(1), inventory.Items[0].Quantity)
+		assert.False(t, inventory.Items[0].Equipped)
+	}
+	_, _ = s.AddToInventory(ctx, "frodo", AddItemRequest{ItemID: "glamdring"})
+	_, _ = s.AddToInventory(ctx, "frodo", AddItemRequest{ItemID: "mithril"})
+	inventory, err = s.AddToInventory(ctx, "frodo", AddItemRequest{ItemID: "lembas", Quantity: 3})
+	assert.Nil(t, err)
+	inventory, err = s.AddToInventory(ctx, "frodo", AddItemRequest{ItemID: "lembas", Quantity: 2})
+	assert.Nil(t, err)
+	assert.Len(t, inventory.Items, 4)
+	assert.Equal(t, int64(5), inventory.Items[1].Quantity)
+	assert.Equal(t, int64(10), inventory.Character.EffectivePower)
+
+	_, err = s.AddToInventory(ctx, "frodo", AddItemRequest{ItemID: "none"})
+	assert.IsType(t, validation.Errors{}, err)
+	_, err = s.AddToInventory(ctx, "frodo", AddItemRequest{})
+	assert.IsType(t, validation.Errors{}, err)
+	_, err = s.AddToInventory(ctx, "sam", AddItemRequest{ItemID: "sting"})
+	assert.Equal(t, character.ErrNotOwner, err)
+	_, err = s.AddToInventory(ctx, "unknown", AddItemRequest{ItemID: "sting"})
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// equip
+	inventory, err = s.Equip(ctx, "frodo", "sting")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(16), inventory.Character.EffectivePower)
+	assert.Equal(t, int64(32), inventory.Character.CharacterValue)
+	inventory, err = s.Equip(ctx, "frodo", "mithril")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(21), inventory.Character.EffectivePower)
+
+	// equipping replaces the item of the same slot
+	inventory, err = s.Equip(ctx, "frodo", "glamdring")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(35), inventory.Character.EffectivePower)
+	equipped := map[string]bool{}
+	for _, item := range inventory.Items {
+		equipped[item.ID] = item.Equipped
+	}
+	assert.Equal(t, map[string]bool{"glamdring": true, "lembas": false, "mithril": true, "sting": false}, equipped)
+	version := inventory.Character.Version
+	inventory, err = s.Equip(ctx, "frodo", "glamdring")
+	assert.Nil(t, err)
+	assert.Equal(t, version, inventory.Character.Version)
+
+	_, err = s.Equip(ctx, "frodo", "lembas")
+	assert.Equal(t, ErrNotEquippable, err)
+	_, err = s.Equip(ctx, "frodo", "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Equip(ctx, "sam", "sting")
+	assert.Equal(t, character.ErrNotOwner, err)
+
+	// unequip
+	inventory, err = s.Unequip(ctx, "frodo", "mithril")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(30), inventory.Character.EffectivePower)
+	_, err = s.Unequip(ctx, "frodo", "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// changing an equipped item recomputes its holders
+	_, err = s.Update(ctx, "glamdring", UpdateItemRequest{Name: "Glamdring", PowerBonus: 30})
+	assert.Nil(t, err)
+	inventory, _ = s.Inventory(ctx, "frodo")
+	assert.Equal(t, int64(40), inventory.Character.EffectivePower)
+
+	// remove
+	inventory, err = s.RemoveFromInventory(ctx, "frodo", "lembas", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), inventory.Items[1].Quantity)
+	_, err = s.RemoveFromInventory(ctx, "frodo", "lembas", 4)
+	assert.IsType(t, validation.Errors{}, err)
+	_, err = s.RemoveFromInventory(ctx, "frodo", "lembas", -1)
+	assert.IsType(t, validation.Errors{}, err)
+	inventory, err = s.RemoveFromInventory(ctx, "frodo", "glamdring", 0)
+	assert.Nil(t, err)
+	assert.Len(t, inventory.Items, 3)
+	assert.Equal(t, int64(10), inventory.Character.EffectivePower)
+	_, err = s.RemoveFromInventory(ctx, "frodo", "glamdring", 0)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// deleting an equipped item recomputes its holders
+	_, _ = s.Equip(ctx, "frodo", "mithril")
+	_, err = s.Delete(ctx, "mithril")
+	assert.Nil(t, err)
+	inventory, _ = s.Inventory(ctx, "frodo")
+	assert.Len(t, inventory.Items, 2)
+	assert.Equal(t, int64(10), inventory.Character.EffectivePower)
+}
+
+type mockRepository struct {
+	items     []entity.Item
+	inventory []entity.InventoryItem
+}
+
+// transactional runs f and restores the items and the inventories if it fails.
+func (m *mockRepository) transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	items := append([]entity.Item{}, m.items...)
+	inventory := append([]entity.InventoryItem{}, m.inventory...)
+	err := f(ctx)
+	if err != nil {
+		m.items, m.inventory = items, inventory
+	}
+	return err
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.Item, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.Item{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context) (int, error) {
+	return len(m.items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.Item, error) {
+	return m.items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, item entity.Item) error {
+	if item.Name == "error" {
+		return errCRUD
+	}
+	m.items = append(m.items, item)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, item entity.Item) error {
+	for i, existing := range m.items {
+		if existing.ID == item.ID {
+			m.items[i] = item
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items = append(m.items[:i], m.items[i+1:]...)
+			break
+		}
+	}
+	var inventory []entity.InventoryItem
+	for _, held := range m.inventory {
+		if held.ItemID != id {
+			inventory = append(inventory, held)
+		}
+	}
+	m.inventory = inventory
+	return nil
+}
+
+func (m mockRepository) QueryInventory(ctx context.Context, characterID string) ([]InventoryItem, error) {
+	var items []InventoryItem
+	for _, held := range m.inventory {
+		if held.CharacterID == characterID {
+			item, _ := m.Get(ctx, held.ItemID)
+			items = append(items, InventoryItem{item, held.Quantity, held.Equipped})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+	return items, nil
+}
+
+func (m mockRepository) LockInventoryItem(ctx context.Context, characterID, itemID string) (entity.InventoryItem, error) {
+	for _, held := range m.inventory {
+		if held.CharacterID == characterID && held.ItemID == itemID {
+			return held, nil
+		}
+	}
+	return entity.InventoryItem{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) AddInventoryItem(ctx context.Context, item entity.InventoryItem) error {
+	for i, held := range m.inventory {
+		if held.CharacterID == item.CharacterID && held.ItemID == item.ItemID {
+			m.inventory[i].Quantity += item.Quantity
+			return nil
+		}
+	}
+	m.inventory = append(m.inventory, item)
+	return nil
+}
+
+func (m *mockRepository) UpdateInventoryItem(ctx context.Context, item entity.InventoryItem) error {
+	for i, held := range m.inventory {
+		if held.CharacterID == item.CharacterID && held.ItemID == item.ItemID {
+			m.inventory[i] = item
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) DeleteInventoryItem(ctx context.Context, characterID, itemID string) error {
+	for i, held := range m.inventory {
+		if held.CharacterID == characterID && held.ItemID == itemID {
+			m.inventory = append(m.inventory[:i], m.inventory[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) UnequipSlot(ctx context.Context, characterID, slot string) error {
+	for i, held := range m.inventory {
+		item, _ := m.Get(ctx, held.ItemID)
+		if held.CharacterID == characterID && item.Slot == slot {
+			m.inventory[i].Equipped = false
+		}
+	}
+	return nil
+}
+
+func (m mockRepository) QueryEquippers(ctx context.Context, itemID string) ([]string, error) {
+	var ids []string
+	for _, held := range m.inventory {
+		if held.ItemID == itemID && held.Equipped {
+			ids = append(ids, held.CharacterID)
+		}
+	}
+	return ids, nil
+}
+
+func (m mockRepository) Modifiers(ctx context.Context, characterID string) ([]character.Modifier, error) {
+	var modifiers []character.Modifier
+	for _, held := range m.inventory {
+		if held.CharacterID == characterID && held.Equipped {
+			item, _ := m.Get(ctx, held.ItemID)
+			modifiers = append(modifiers, character.Modifier{Flat: item.PowerBonus, Percent: item.PowerPercent})
+		}
+	}
+	return modifiers, nil
+}
+
+// newMockCharacterService returns a character service serving frodo, owned by the user 100, and sam, owned by the
+// user 101, with the modifiers of the given equipment.
+func newMockCharacterService(equipment character.Equipment) *charactertest.Service {
+	return charactertest.NewService(equipment,
+		entity.Character{ID: "frodo", Name: "Frodo", CharacterCode: 3, CharacterPower: 10, EffectivePower: 10, CharacterValue: 20, Version: 1, OwnerID: "100"},
+		entity.Character{ID: "sam", Name: "Sam", CharacterCode: 3, CharacterPower: 10, EffectivePower: 10, CharacterValue: 20, Version: 1, OwnerID: "101"},
+	)
+}
@@ -0,0 +1,101 @@
+package party
+
+import (
+	"net/http"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/hikvineh/go-rest-game-character/internal/errors"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/hikvineh/go-rest-game-character/pkg/pagination"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/parties/<id>", res.get)
+	r.Get("/parties", res.query)
+
+	r.Use(authHandler)
+
+	// the following endpoints require a valid JWT
+	r.Post("/parties", res.create)
+	r.Delete("/parties/<id>", res.delete)
+	r.Post("/parties/<id>/members", res.addMember)
+	r.Delete("/parties/<id>/members/<character_id>", res.removeMember)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	party, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(party)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	parties, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = parties
+	return c.Write(pages)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreatePartyRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	party, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(party, http.StatusCreated)
+}
+
+func (r resource) delete(c *routing.Context) error {
+	party, err := r.service.Delete(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(party)
+}
+
+func (r resource) addMember(c *routing.Context) error {
+	var input AddMemberRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	party, err := r.service.AddMember(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(party)
+}
+
+func (r resource) removeMember(c *routing.Context) error {
+	party, err := r.service.RemoveMember(c.Request.Context(), c.Param("id"), c.Param("character_id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(party)
+}
@@ -0,0 +1,52 @@
+package party
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := newMockRepository()
+	repo.parties = []entity.Party{
+		{ID: "fellowship", Name: "Fellowship", OwnerID: "100"},
+		{ID: "company", Name: "Company", OwnerID: "101"},
+	}
+	RegisterHandlers(router.Group(""), NewService(repo, mockCharacterService{repo: repo}, DefaultRules(), repo.transactional, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/parties", "", nil, http.StatusOK, `*"total_count":2*`},
+		{"get 1", "GET", "/parties/fellowship", "", nil, http.StatusOK, `*"members":[],"totals":{"members":0,"character_power":0,"effective_power":0,"character_value":0}}`},
+		{"get unknown", "GET", "/parties/none", "", nil, http.StatusNotFound, ""},
+		{"create ok", "POST", "/parties", `{"name":"Rangers"}`, header, http.StatusCreated, `*"name":"Rangers","owner_id":"100"*`},
+		{"create auth error", "POST", "/parties", `{"name":"Rangers"}`, nil, http.StatusUnauthorized, ""},
+		{"create input error", "POST", "/parties", `"name":"Rangers"}`, header, http.StatusBadRequest, ""},
+		{"create validation error", "POST", "/parties", `{"name":""}`, header, http.StatusBadRequest, `*name*`},
+		{"add member", "POST", "/parties/fellowship/members", `{"character_id":"frodo"}`, header, http.StatusOK, `*"totals":{"members":1,"character_power":10,"effective_power":10,"character_value":20}}`},
+		{"add wizard", "POST", "/parties/fellowship/members", `{"character_id":"gandalf"}`, header, http.StatusOK, `*"totals":{"members":2,"character_power":30,"effective_power":35,"character_value":70}}`},
+		{"add second wizard", "POST", "/parties/fellowship/members", `{"character_id":"radagast"}`, header, http.StatusBadRequest, `*character type*`},
+		{"add member again", "POST", "/parties/fellowship/members", `{"character_id":"frodo"}`, header, http.StatusConflict, ""},
+		{"add unknown character", "POST", "/parties/fellowship/members", `{"character_id":"none"}`, header, http.StatusBadRequest, `*character_id*`},
+		{"add not character owner", "POST", "/parties/fellowship/members", `{"character_id":"sam"}`, header, http.StatusForbidden, ""},
+		{"add not party owner", "POST", "/parties/company/members", `{"character_id":"pippin"}`, header, http.StatusForbidden, ""},
+		{"add unknown party", "POST", "/parties/none/members", `{"character_id":"pippin"}`, header, http.StatusNotFound, ""},
+		{"add auth error", "POST", "/parties/fellowship/members", `{"character_id":"pippin"}`, nil, http.StatusUnauthorized, ""},
+		{"remove member", "DELETE", "/parties/fellowship/members/gandalf", "", header, http.StatusOK, `*"totals":{"members":1,*`},
+		{"remove not member", "DELETE", "/parties/fellowship/members/gandalf", "", header, http.StatusNotFound, ""},
+		{"remove auth error", "DELETE", "/parties/fellowship/members/frodo", "", nil, http.StatusUnauthorized, ""},
+		{"delete not owner", "DELETE", "/parties/company", "", header, http.StatusForbidden, ""},
+		{"delete auth error", "DELETE", "/parties/fellowship", "", nil, http.StatusUnauthorized, ""},
+		{"delete ok", "DELETE", "/parties/fellowship", "", header, http.StatusOK, `*"members":[{"id":"frodo"*`},
+		{"delete verify", "GET", "/parties/fellowship", "", nil, http.StatusNotFound, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
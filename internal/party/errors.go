@@ -0,0 +1,19 @@
+package party
+
+import (
+	"net/http"
+
+	"github.com/hikvineh/go-rest-game-character/internal/errors"
+)
+
+var (
+	// ErrNotOwner is returned when a user attempts to change a party owned by someone else.
+	ErrNotOwner = errors.Forbidden("Only the owner of the party can change it.")
+	// ErrFull is returned when a character is added to a party that has reached its maximum size.
+	ErrFull = errors.BadRequest("The party is full.")
+	// ErrAlreadyMember is returned when a character that belongs to a party is added to a party.
+	ErrAlreadyMember = errors.ErrorResponse{
+		Status:  http.StatusConflict,
+		Message: "The character is already a member of a party.",
+	}
+)
@@ -0,0 +1,141 @@
+package party
+
+import (
+	"context"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/dbcontext"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// Repository encapsulates the logic to access parties and their members from the data source.
+type Repository interface {
+	// Get returns the party with the specified ID.
+	Get(ctx context.Context, id string) (entity.Party, error)
+	// Lock returns the party with the specified ID. It stays locked until the end of the transaction, so that
+	// concurrent changes to its members wait for it.
+	Lock(ctx context.Context, id string) (entity.Party, error)
+	// Count returns the number of parties.
+	Count(ctx context.Context) (int, error)
+	// Query returns the list of parties ordered by name with the given offset and limit.
+	Query(ctx context.Context, offset, limit int) ([]entity.Party, error)
+	// Create saves a new party in the storage.
+	Create(ctx context.Context, party entity.Party) error
+	// Delete removes the party with given ID from the storage, along with its memberships.
+	Delete(ctx context.Context, id string) error
+	// QueryMembers returns the characters of the party with the given ID, in the order they joined it. Deleted
+	// characters are excluded.
+	QueryMembers(ctx context.Context, partyID string) ([]entity.Character, error)
+	// GetMember returns the membership of the character with the given ID.
+	GetMember(ctx context.Context, characterID string) (entity.PartyMember, error)
+	// AddMember saves a new membership in the storage, unless the character already belongs to a party. It reports
+	// whether the membership was saved.
+	AddMember(ctx context.Context, member entity.PartyMember) (bool, error)
+	// DeleteMember removes the membership of the character with the given ID from the storage.
+	DeleteMember(ctx context.Context, characterID string) error
+}
+
+// repository persists parties in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new party repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the party with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Party, error) {
+	var party entity.Party
+	err := r.db.With(ctx).Select().Model(id, &party)
+	return party, err
+}
+
+// Lock reads the party with the specified ID from the database and locks it until the end of the transaction.
+func (r repository) Lock(ctx context.Context, id string) (entity.Party, error) {
+	var party entity.Party
+	err := r.db.With(ctx).
+		NewQuery("SELECT * FROM {{party}} WHERE [[id]] = {:id} FOR UPDATE").
+		Bind(dbx.Params{"id": id}).
+		One(&party)
+	return party, err
+}
+
+// Create saves a new party record in the database.
+func (r repository) Create(ctx context.Context, party entity.Party) error {
+	return r.db.With(ctx).Model(&party).Insert()
+}
+
+// Delete deletes the party record with the specified ID from the database. The party member records are deleted by
+// the foreign key.
+func (r repository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.With(ctx).Delete("party", dbx.HashExp{"id": id}).Execute()
+	return err
+}
+
+// Count returns the number of the party records in the database.
+func (r repository) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("party").Row(&count)
+	return count, err
+}
+
+// Query retrieves the party records ordered by name with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Party, error) {
+	var parties []entity.Party
+	err := r.db.With(ctx).
+		Select().
+		OrderBy("name", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&parties)
+	return parties, err
+}
+
+// QueryMembers retrieves the character records of the party member records of the given party, in the order they
+// were created, from the database.
+func (r repository) QueryMembers(ctx context.Context, partyID string) ([]entity.Character, error) {
+	var characters []entity.Character
+	err := r.db.With(ctx).
+		Select("character.*").
+		From("party_member").
+		InnerJoin("character", dbx.NewExp("character.id = party_member.character_id")).
+		Where(dbx.HashExp{"party_member.party_id": partyID, "character.deleted_at": nil}).
+		OrderBy("party_member.created_at", "character.id").
+		All(&characters)
+	return characters, err
+}
+
+// GetMember reads the party member record of the given character from the database.
+func (r repository) GetMember(ctx context.Context, characterID string) (entity.PartyMember, error) {
+	var member entity.PartyMember
+	err := r.db.With(ctx).Select().Model(characterID, &member)
+	return member, err
+}
+
+// AddMember inserts a party member record in the database, unless one exists for the character.
+func (r repository) AddMember(ctx context.Context, member entity.PartyMember) (bool, error) {
+	result, err := r.db.With(ctx).
+		NewQuery("INSERT INTO {{party_member}} ([[character_id]], [[party_id]], [[created_at]]) " +
+			"VALUES ({:character_id}, {:party_id}, {:created_at}) ON CONFLICT ([[character_id]]) DO NOTHING").
+		Bind(dbx.Params{
+			"character_id": member.CharacterID,
+			"party_id":     member.PartyID,
+			"created_at":   member.CreatedAt,
+		}).
+		Execute()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// DeleteMember deletes the party member record of the given character from the database.
+func (r repository) DeleteMember(ctx context.Context, characterID string) error {
+	_, err := r.db.With(ctx).Delete("party_member", dbx.HashExp{"character_id": characterID}).Execute()
+	return err
+}
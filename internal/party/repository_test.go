@@ -0,0 +1,96 @@
+package party
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "party")
+	// members reference characters, so characters are created for this test
+	_, err := db.DB().Delete("character", dbx.HashExp{"id": []interface{}{"party_test_1", "party_test_2"}}).Execute()
+	assert.Nil(t, err)
+	for i, id := range []string{"party_test_1", "party_test_2"} {
+		_, err = db.DB().Insert("character", dbx.Params{
+			"id": id, "name": "Frodo", "character_code": 3, "character_power": 10 * (i + 1), "effective_power": 10 * (i + 1),
+			"character_value": 20 * (i + 1), "version": 1, "created_at": time.Now(), "updated_at": time.Now(),
+		}).Execute()
+		assert.Nil(t, err)
+	}
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+
+	// create
+	now := time.Now()
+	assert.Nil(t, repo.Create(ctx, entity.Party{ID: "fellowship", Name: "Fellowship", OwnerID: "100", CreatedAt: now, UpdatedAt: now}))
+	assert.Nil(t, repo.Create(ctx, entity.Party{ID: "company", Name: "Company", OwnerID: "100", CreatedAt: now, UpdatedAt: now}))
+	count, err := repo.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	// get and query
+	party, err := repo.Get(ctx, "fellowship")
+	assert.Nil(t, err)
+	assert.Equal(t, "100", party.OwnerID)
+	_, err = repo.Get(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+	parties, err := repo.Query(ctx, 0, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, parties, 2) {
+		assert.Equal(t, "company", parties[0].ID)
+	}
+
+	// members
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		_, err := repo.Lock(ctx, "fellowship")
+		assert.Nil(t, err)
+		added, err := repo.AddMember(ctx, entity.PartyMember{CharacterID: "party_test_1", PartyID: "fellowship", CreatedAt: now})
+		assert.True(t, added)
+		return err
+	})
+	assert.Nil(t, err)
+	added, err := repo.AddMember(ctx, entity.PartyMember{CharacterID: "party_test_2", PartyID: "fellowship", CreatedAt: now.Add(time.Second)})
+	assert.Nil(t, err)
+	assert.True(t, added)
+	added, err = repo.AddMember(ctx, entity.PartyMember{CharacterID: "party_test_1", PartyID: "company", CreatedAt: now})
+	assert.Nil(t, err)
+	assert.False(t, added)
+	member, err := repo.GetMember(ctx, "party_test_1")
+	assert.Nil(t, err)
+	assert.Equal(t, "fellowship", member.PartyID)
+	characters, err := repo.QueryMembers(ctx, "fellowship")
+	assert.Nil(t, err)
+	if assert.Len(t, characters, 2) {
+		assert.Equal(t, "party_test_1", characters[0].ID)
+		assert.Equal(t, int64(40), characters[1].CharacterValue)
+	}
+
+	// deleted characters are not listed
+	_, err = db.DB().Update("character", dbx.Params{"deleted_at": now}, dbx.HashExp{"id": "party_test_2"}).Execute()
+	assert.Nil(t, err)
+	characters, _ = repo.QueryMembers(ctx, "fellowship")
+	assert.Len(t, characters, 1)
+
+	// delete member
+	assert.Nil(t, repo.DeleteMember(ctx, "party_test_1"))
+	_, err = repo.GetMember(ctx, "party_test_1")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// delete party
+	assert.Nil(t, repo.Delete(ctx, "fellowship"))
+	_, err = repo.Get(ctx, "fellowship")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = repo.GetMember(ctx, "party_test_2")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
@@ -0,0 +1,347 @@
+package party
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	apperrors "github.com/hikvineh/go-rest-game-character/internal/errors"
+	"github.com/hikvineh/go-rest-game-character/pkg/dbcontext"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// Service encapsulates usecase logic for parties.
+type Service interface {
+	Get(ctx context.Context, id string) (Party, error)
+	Query(ctx context.Context, offset, limit int) ([]Party, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, input CreatePartyRequest) (Party, error)
+	Delete(ctx context.Context, id string) (Party, error)
+	AddMember(ctx context.Context, id string, input AddMemberRequest) (Party, error)
+	RemoveMember(ctx context.Context, id, characterID string) (Party, error)
+}
+
+// Party represents the data about a party, along with its members and their totals.
+type Party struct {
+	entity.Party
+	Members []character.Character `json:"members"`
+	Totals  Totals                `json:"totals"`
+}
+
+// Totals represents the combined stats of the members of a party. The sums stop at the largest representable value.
+type Totals struct {
+	Members        int   `json:"members"`
+	CharacterPower int64 `json:"character_power"`
+	EffectivePower int64 `json:"effective_power"`
+	CharacterValue int64 `json:"character_value"`
+}
+
+// Rules holds the limits on the members of parties.
+type Rules struct {
+	// MaxMembers is the maximum number of members of a party.
+	MaxMembers int
+	// TypeLimits holds the maximum number of members of a character type, indexed by character code. Types that are
+	// not listed are not limited.
+	TypeLimits map[int64]int
+}
+
+// DefaultRules returns the rules used by default for parties: at most five members, including at most one wizard.
+func DefaultRules() Rules {
+	return Rules{
+		MaxMembers: 5,
+		TypeLimits: map[int64]int{character.Wizard: 1},
+	}
+}
+
+// CreatePartyRequest represents a party creation request.
+type CreatePartyRequest struct {
+	Name string `json:"name"`
+}
+
+// Validate validates the CreatePartyRequest fields.
+func (m CreatePartyRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
+	)
+}
+
+// AddMemberRequest represents a request to add a character to a party.
+type AddMemberRequest struct {
+	CharacterID string `json:"character_id"`
+}
+
+// Validate validates the AddMemberRequest fields.
+func (m AddMemberRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.CharacterID, validation.Required),
+	)
+}
+
+type service struct {
+	repo          Repository
+	characters    character.Service
+	rules         Rules
+	transactional dbcontext.TransactionFunc
+	logger        log.Logger
+}
+
+// NewService creates a new party service.
+// The characters joining parties are read from the character service and checked against the given rules. The
+// membership changes run in transactions started by the transactional function.
+func NewService(repo Repository, characters character.Service, rules Rules, transactional dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, characters, rules, transactional, logger}
+}
+
+// Get returns the party with the specified ID.
+func (s service) Get(ctx context.Context, id string) (Party, error) {
+	party, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Party{}, err
+	}
+	return s.withMembers(ctx, party)
+}
+
+// withMembers returns the given party along with its members and their totals.
+func (s service) withMembers(ctx context.Context, party entity.Party) (Party, error) {
+	members, err := s.repo.QueryMembers(ctx, party.ID)
+	if err != nil {
+		return Party{}, err
+	}
+	result := Party{Party: party, Members: []character.Character{}}
+	for _, member := range members {
+		result.Members = append(result.Members, character.Character{Character: member})
+		result.Totals.Members++
+		result.Totals.CharacterPower = add(result.Totals.CharacterPower, member.CharacterPower)
+		result.Totals.EffectivePower = add(result.Totals.EffectivePower, member.EffectivePower)
+		result.Totals.CharacterValue = add(result.Totals.CharacterValue, member.CharacterValue)
+	}
+	return result, nil
+}
+
+// add returns the sum of two non-negative values, or the largest representable value if it overflows.
+func add(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+// Count returns the number of parties.
+func (s service) Count(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
+}
+
+// Query returns the parties ordered by name with the specified offset and limit.
+func (s service) Query(ctx context.Context, offset, limit int) ([]Party, error) {
+	parties, err := s.repo.Query(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Party{}
+	for _, party := range parties {
+		p, err := s.withMembers(ctx, party)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// Create creates a new party owned by the current user.
+func (s service) Create(ctx context.Context, req CreatePartyRequest) (Party, error) {
+	if err := req.Validate(); err != nil {
+		return Party{}, err
+	}
+	var ownerID string
+	if user := auth.CurrentUser(ctx); user != nil {
+		ownerID = user.GetID()
+	}
+	now := time.Now()
+	id := entity.GenerateID()
+	err := s.repo.Create(ctx, entity.Party{
+		ID:        id,
+		Name:      req.Name,
+		OwnerID:   ownerID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return Party{}, err
+	}
+	return s.Get(ctx, id)
+}
+
+// Delete disbands the party with the specified ID. Only the owner of a party can disband it.
+func (s service) Delete(ctx context.Context, id string) (Party, error) {
+	var party Party
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		p, err := s.lock(ctx, id)
+		if err != nil {
+			return err
+		}
+		if party, err = s.withMembers(ctx, p); err != nil {
+			return err
+		}
+		return s.repo.Delete(ctx, id)
+	})
+	return party, err
+}
+
+// lock returns the party with the specified ID, locked until the end of the transaction, if the current user owns it.
+func (s service) lock(ctx context.Context, id string) (entity.Party, error) {
+	party, err := s.repo.Lock(ctx, id)
+	if err != nil {
+		return party, err
+	}
+	if user := auth.CurrentUser(ctx); user == nil || user.GetID() != party.OwnerID {
+		return party, ErrNotOwner
+	}
+	return party, nil
+}
+
+// AddMember adds a character to the party with the specified ID. Only the owner of a party can add members to it,
+// and only characters they own. A character belongs to at most one party, and the size of a party and the number of
+// its members of each type are limited by the rules of the service.
+func (s service) AddMember(ctx context.Context, id string, req AddMemberRequest) (Party, error) {
+	if err := req.Validate(); err != nil {
+		return Party{}, err
+	}
+	var party Party
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		p, err := s.lock(ctx, id)
+		if err != nil {
+			return err
+		}
+		c, err := s.characters.Get(ctx, req.CharacterID)
+		if err == sql.ErrNoRows {
+			return validation.Errors{
+				"character_id": errors.New("must be an existing character"),
+			}
+		} else if err != nil {
+			return err
+		}
+		if c.OwnerID != p.OwnerID {
+			return character.ErrNotOwner
+		}
+		members, err := s.repo.QueryMembers(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.rules.check(members, c.Character); err != nil {
+			return err
+		}
+		added, err := s.repo.AddMember(ctx, entity.PartyMember{
+			CharacterID: c.ID,
+			PartyID:     id,
+			CreatedAt:   time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		if !added {
+			return ErrAlreadyMember
+		}
+		party, err = s.withMembers(ctx, p)
+		return err
+	})
+	return party, err
+}
+
+// check returns an error if the given character cannot join a party with the given members.
+func (r Rules) check(members []entity.Character, c entity.Character) error {
+	return r.validate(append(members, c))
+}
+
+// validate returns an error if a party cannot have the given members.
+func (r Rules) validate(members []entity.Character) error {
+	if len(members) > r.MaxMembers {
+		return ErrFull
+	}
+	counts := map[int64]int{}
+	for _, member := range members {
+		counts[member.CharacterCode]++
+	}
+	for code, count := range counts {
+		if limit, ok := r.TypeLimits[code]; ok && count > limit {
+			return apperrors.BadRequest(fmt.Sprintf("The party cannot have more than %v members of this character type.", limit))
+		}
+	}
+	return nil
+}
+
+// RemoveMember removes a character from the party with the specified ID. Only the owner of a party can remove
+// members from it. sql.ErrNoRows is returned if the character is not a member of the party.
+func (s service) RemoveMember(ctx context.Context, id, characterID string) (Party, error) {
+	var party Party
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		p, err := s.lock(ctx, id)
+		if err != nil {
+			return err
+		}
+		member, err := s.repo.GetMember(ctx, characterID)
+		if err != nil {
+			return err
+		}
+		if member.PartyID != id {
+			return sql.ErrNoRows
+		}
+		if err := s.repo.DeleteMember(ctx, characterID); err != nil {
+			return err
+		}
+		party, err = s.withMembers(ctx, p)
+		return err
+	})
+	return party, err
+}
+
+// Guard enforces the rules of parties on the changes of their members that do not go through the party service:
+// a member coming back from the trash, or changing type when it is reverted.
+type Guard struct {
+	repo  Repository
+	rules Rules
+}
+
+// NewGuard creates a guard checking the parties of the given repository against the given rules. It is meant to be
+// the listener of the character service.
+func NewGuard(repo Repository, rules Rules) Guard {
+	return Guard{repo, rules}
+}
+
+// CharactersChanged returns an error if a restored character, or a character that changed type, breaks the rules of
+// its party. It runs in the transaction of the changes, which fails along with it.
+func (g Guard) CharactersChanged(ctx context.Context, revisions []entity.CharacterRevision) error {
+	for _, rev := range revisions {
+		if rev.Before == nil || rev.After == nil {
+			continue
+		}
+		if rev.Action != entity.ActionRestore && rev.Before.CharacterCode == rev.After.CharacterCode {
+			continue
+		}
+		member, err := g.repo.GetMember(ctx, rev.CharacterID)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return err
+		}
+		// the party stays locked until the end of the transaction, so that no member is added meanwhile
+		if _, err := g.repo.Lock(ctx, member.PartyID); err != nil {
+			return err
+		}
+		members, err := g.repo.QueryMembers(ctx, member.PartyID)
+		if err != nil {
+			return err
+		}
+		if err := g.rules.validate(members); err != nil {
+			return err
+		}
+	}
+	return nil
+}
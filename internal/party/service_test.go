@@ -0,0 +1,304 @@
+package party
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var errCRUD = errors.New("error crud")
+
+func TestCreatePartyRequest_Validate(t *testing.T) {
+	assert.Nil(t, CreatePartyRequest{Name: "Fellowship"}.Validate())
+	assert.NotNil(t, CreatePartyRequest{}.Validate())
+}
+
+func TestAddMemberRequest_Validate(t *testing.T) {
+	assert.Nil(t, AddMemberRequest{CharacterID: "frodo"}.Validate())
+	assert.NotNil(t, AddMemberRequest{}.Validate())
+}
+
+func TestRules_check(t *testing.T) {
+	rules := Rules{MaxMembers: 3, TypeLimits: map[int64]int{character.Wizard: 1, character.Elf: 0}}
+	wizard := entity.Character{CharacterCode: character.Wizard}
+	hobbit := entity.Character{CharacterCode: character.Hobbit}
+	assert.Nil(t, rules.check(nil, wizard))
+	assert.Nil(t, rules.check([]entity.Character{hobbit, hobbit}, hobbit))
+	assert.Equal(t, ErrFull, rules.check([]entity.Character{hobbit, hobbit, hobbit}, hobbit))
+	assert.EqualError(t, rules.check([]entity.Character{wizard}, wizard), "The party cannot have more than 1 members of this character type.")
+	assert.NotNil(t, rules.check(nil, entity.Character{CharacterCode: character.Elf}))
+}
+
+func TestGuard_CharactersChanged(t *testing.T) {
+	repo := newMockRepository()
+	repo.parties = []entity.Party{{ID: "fellowship", OwnerID: "100"}}
+	repo.members = []entity.PartyMember{
+		{CharacterID: "frodo", PartyID: "fellowship"},
+		{CharacterID: "gandalf", PartyID: "fellowship"},
+		{CharacterID: "pippin", PartyID: "fellowship"},
+	}
+	g := NewGuard(repo, Rules{MaxMembers: 2, TypeLimits: map[int64]int{character.Wizard: 1}})
+	ctx := context.Background()
+	revision := func(action string, before, after entity.Character) entity.CharacterRevision {
+		b, a := entity.CharacterSnapshot(before), entity.CharacterSnapshot(after)
+		return entity.CharacterRevision{CharacterID: after.ID, Action: action, Before: &b, After: &a}
+	}
+
+	// pippin is in the trash, so that the party is not full
+	deleted := repo.characters["pippin"]
+	now := time.Now()
+	deleted.DeletedAt = &now
+	repo.characters["pippin"] = deleted
+	frodo := repo.characters["frodo"]
+	renamed := frodo
+	renamed.Name = "Frodo"
+	assert.Nil(t, g.CharactersChanged(ctx, []entity.CharacterRevision{revision(entity.ActionUpdate, frodo, renamed)}))
+
+	// a member reverted to another type
+	wizard := frodo
+	wizard.CharacterCode = character.Wizard
+	repo.characters["frodo"] = wizard
+	assert.EqualError(t, g.CharactersChanged(ctx, []entity.CharacterRevision{revision(entity.ActionRevert, frodo, wizard)}), "The party cannot have more than 1 members of this character type.")
+	repo.characters["frodo"] = frodo
+
+	// a member restored into a full party
+	restored := deleted
+	restored.DeletedAt = nil
+	repo.characters["pippin"] = restored
+	assert.Equal(t, ErrFull, g.CharactersChanged(ctx, []entity.CharacterRevision{revision(entity.ActionRestore, deleted, restored)}))
+
+	// characters without a party
+	sam := repo.characters["sam"]
+	elf := sam
+	elf.CharacterCode = character.Elf
+	assert.Nil(t, g.CharactersChanged(ctx, []entity.CharacterRevision{revision(entity.ActionRevert, sam, elf)}))
+}
+
+func Test_service(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := newMockRepository()
+	s := NewService(repo, mockCharacterService{repo: repo}, DefaultRules(), repo.transactional, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	// creation
+	party, err := s.Create(ctx, CreatePartyRequest{Name: "Fellowship"})
+	assert.Nil(t, err)
+	id := party.ID
+	assert.NotEmpty(t, id)
+	assert.Equal(t, "100", party.OwnerID)
+	assert.Empty(t, party.Members)
+	_, err = s.Create(ctx, CreatePartyRequest{})
+	assert.NotNil(t, err)
+	count, _ := s.Count(ctx)
+	assert.Equal(t, 1, count)
+
+	// adding members updates the totals
+	party, err = s.AddMember(ctx, id, AddMemberRequest{CharacterID: "frodo"})
+	assert.Nil(t, err)
+	party, err = s.AddMember(ctx, id, AddMemberRequest{CharacterID: "gandalf"})
+	assert.Nil(t, err)
+	if assert.Len(t, party.Members, 2) {
+		assert.Equal(t, "frodo", party.Members[0].ID)
+	}
+	assert.Equal(t, Totals{Members: 2, CharacterPower: 30, EffectivePower: 35, CharacterValue: 70}, party.Totals)
+
+	// rules
+	_, err = s.AddMember(ctx, id, AddMemberRequest{CharacterID: "radagast"})
+	assert.NotNil(t, err)
+	_, err = s.AddMember(ctx, id, AddMemberRequest{CharacterID: "frodo"})
+	assert.Equal(t, ErrAlreadyMember, err)
+	_, err = s.AddMember(ctx, id, AddMemberRequest{CharacterID: "sam"})
+	assert.Equal(t, character.ErrNotOwner, err)
+	_, err = s.AddMember(ctx, id, AddMemberRequest{CharacterID: "none"})
+	assert.EqualError(t, err, "character_id: must be an existing character.")
+	_, err = s.AddMember(ctx, id, AddMemberRequest{})
+	assert.NotNil(t, err)
+	_, err = s.AddMember(ctx, "none", AddMemberRequest{CharacterID: "frodo"})
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.AddMember(auth.WithUser(context.Background(), "101", "Other"), id, AddMemberRequest{CharacterID: "sam"})
+	assert.Equal(t, ErrNotOwner, err)
+
+	// a character belongs to one party only
+	other, _ := s.Create(ctx, CreatePartyRequest{Name: "Company"})
+	_, err = s.AddMember(ctx, other.ID, AddMemberRequest{CharacterID: "gandalf"})
+	assert.Equal(t, ErrAlreadyMember, err)
+	_, err = s.RemoveMember(ctx, other.ID, "gandalf")
+	assert.Equal(t, sql.ErrNoRows, err)
+	parties, err := s.Query(ctx, 0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, parties, 2)
+
+	// size limit
+	rules := DefaultRules()
+	rules.MaxMembers = 2
+	_, err = NewService(repo, mockCharacterService{repo: repo}, rules, repo.transactional, logger).AddMember(ctx, id, AddMemberRequest{CharacterID: "pippin"})
+	assert.Equal(t, ErrFull, err)
+
+	// removal
+	party, err = s.RemoveMember(ctx, id, "gandalf")
+	assert.Nil(t, err)
+	assert.Equal(t, Totals{Members: 1, CharacterPower: 10, EffectivePower: 10, CharacterValue: 20}, party.Totals)
+	_, err = s.RemoveMember(ctx, id, "gandalf")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.RemoveMember(context.Background(), id, "frodo")
+	assert.Equal(t, ErrNotOwner, err)
+	party, err = s.AddMember(ctx, other.ID, AddMemberRequest{CharacterID: "gandalf"})
+	assert.Nil(t, err)
+	assert.Len(t, party.Members, 1)
+
+	// failures roll back
+	_, err = s.AddMember(ctx, id, AddMemberRequest{CharacterID: "error"})
+	assert.Equal(t, errCRUD, err)
+
+	// disbanding
+	_, err = s.Delete(context.Background(), id)
+	assert.Equal(t, ErrNotOwner, err)
+	party, err = s.Delete(ctx, id)
+	assert.Nil(t, err)
+	assert.Len(t, party.Members, 1)
+	_, err = s.Get(ctx, id)
+	assert.Equal(t, sql.ErrNoRows, err)
+	party, err = s.AddMember(ctx, other.ID, AddMemberRequest{CharacterID: "frodo"})
+	assert.Nil(t, err)
+	assert.Len(t, party.Members, 2)
+}
+
+func Test_add(t *testing.T) {
+	assert.Equal(t, int64(3), add(1, 2))
+	assert.Equal(t, int64(math.MaxInt64), add(math.MaxInt64-1, 2))
+}
+
+type mockRepository struct {
+	parties    []entity.Party
+	members    []entity.PartyMember
+	characters map[string]entity.Character
+}
+
+// newMockRepository returns a repository with the characters frodo, pippin, gandalf and radagast, owned by the user
+// 100, and sam, owned by the user 101.
+func newMockRepository() *mockRepository {
+	return &mockRepository{characters: map[string]entity.Character{
+		"frodo":    {ID: "frodo", CharacterCode: character.Hobbit, CharacterPower: 10, EffectivePower: 10, CharacterValue: 20, OwnerID: "100"},
+		"pippin":   {ID: "pippin", CharacterCode: character.Hobbit, CharacterPower: 10, EffectivePower: 10, CharacterValue: 20, OwnerID: "100"},
+		"gandalf":  {ID: "gandalf", CharacterCode: character.Wizard, CharacterPower: 20, EffectivePower: 25, CharacterValue: 50, OwnerID: "100"},
+		"radagast": {ID: "radagast", CharacterCode: character.Wizard, CharacterPower: 20, EffectivePower: 20, CharacterValue: 40, OwnerID: "100"},
+		"sam":      {ID: "sam", CharacterCode: character.Hobbit, CharacterPower: 10, EffectivePower: 10, CharacterValue: 20, OwnerID: "101"},
+	}}
+}
+
+// transactional runs f and restores the parties and the members if it fails.
+func (m *mockRepository) transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	parties := append([]entity.Party{}, m.parties...)
+	members := append([]entity.PartyMember{}, m.members...)
+	err := f(ctx)
+	if err != nil {
+		m.parties, m.members = parties, members
+	}
+	return err
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.Party, error) {
+	for _, party := range m.parties {
+		if party.ID == id {
+			return party, nil
+		}
+	}
+	return entity.Party{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Lock(ctx context.Context, id string) (entity.Party, error) {
+	return m.Get(ctx, id)
+}
+
+func (m mockRepository) Count(ctx context.Context) (int, error) {
+	return len(m.parties), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.Party, error) {
+	return m.parties, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, party entity.Party) error {
+	m.parties = append(m.parties, party)
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	for i, party := range m.parties {
+		if party.ID == id {
+			m.parties = append(m.parties[:i], m.parties[i+1:]...)
+			break
+		}
+	}
+	members := []entity.PartyMember{}
+	for _, member := range m.members {
+		if member.PartyID != id {
+			members = append(members, member)
+		}
+	}
+	m.members = members
+	return nil
+}
+
+func (m mockRepository) QueryMembers(ctx context.Context, partyID string) ([]entity.Character, error) {
+	var characters []entity.Character
+	for _, member := range m.members {
+		if c := m.characters[member.CharacterID]; member.PartyID == partyID && c.DeletedAt == nil {
+			characters = append(characters, c)
+		}
+	}
+	return characters, nil
+}
+
+func (m mockRepository) GetMember(ctx context.Context, characterID string) (entity.PartyMember, error) {
+	for _, member := range m.members {
+		if member.CharacterID == characterID {
+			return member, nil
+		}
+	}
+	return entity.PartyMember{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) AddMember(ctx context.Context, member entity.PartyMember) (bool, error) {
+	if _, err := m.GetMember(ctx, member.CharacterID); err == nil {
+		return false, nil
+	}
+	m.members = append(m.members, member)
+	return true, nil
+}
+
+func (m *mockRepository) DeleteMember(ctx context.Context, characterID string) error {
+	for i, member := range m.members {
+		if member.CharacterID == characterID {
+			m.members = append(m.members[:i], m.members[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// mockCharacterService serves the characters of the mock repository. Getting the character "error" fails. Its other
+// methods are not implemented.
+type mockCharacterService struct {
+	character.Service
+	repo *mockRepository
+}
+
+func (m mockCharacterService) Get(ctx context.Context, id string) (character.Character, error) {
+	if id == "error" {
+		return character.Character{}, errCRUD
+	}
+	if c, ok := m.repo.characters[id]; ok {
+		return character.Character{Character: c}, nil
+	}
+	return character.Character{}, sql.ErrNoRows
+}
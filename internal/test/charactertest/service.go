@@ -0,0 +1,60 @@
+// Package charactertest provides a fake character service for testing the packages built upon the characters.
+package charactertest
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/hikvineh/go-rest-game-character/internal/character"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+)
+
+// Service is a character service holding its characters in memory, which values them at twice their effective power.
+// Only Get and RefreshEquipment are implemented; the other methods of character.Service panic.
+type Service struct {
+	character.Service
+	// Equipment gives the modifiers applied by RefreshEquipment.
+	Equipment character.Equipment
+	// Characters holds the characters indexed by ID.
+	Characters map[string]*character.Character
+}
+
+// NewService creates a service holding the given characters, whose modifiers are read from the given equipment.
+func NewService(equipment character.Equipment, characters ...entity.Character) *Service {
+	s := &Service{Equipment: equipment, Characters: map[string]*character.Character{}}
+	for _, c := range characters {
+		s.Characters[c.ID] = &character.Character{Character: c}
+	}
+	return s
+}
+
+// Get returns the character with the specified ID.
+func (s *Service) Get(ctx context.Context, id string) (character.Character, error) {
+	if c, ok := s.Characters[id]; ok {
+		return *c, nil
+	}
+	return character.Character{}, sql.ErrNoRows
+}
+
+// RefreshEquipment recomputes the effective power and the value of the character with the specified ID from its
+// modifiers. The version of the character is incremented when they change.
+func (s *Service) RefreshEquipment(ctx context.Context, id string) (character.Character, error) {
+	c, ok := s.Characters[id]
+	if !ok {
+		return character.Character{}, sql.ErrNoRows
+	}
+	modifiers, err := s.Equipment.Modifiers(ctx, id)
+	if err != nil {
+		return character.Character{}, err
+	}
+	power := c.CharacterPower
+	for _, modifier := range modifiers {
+		power += c.CharacterPower*modifier.Percent/100 + modifier.Flat
+	}
+	if power != c.EffectivePower {
+		c.EffectivePower = power
+		c.CharacterValue = power * 2
+		c.Version++
+	}
+	return *c, nil
+}
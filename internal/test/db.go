@@ -35,10 +35,10 @@ func DB(t *testing.T) *dbcontext.DB {
 	return db
 }
 
-// ResetTables truncates all data in the specified tables.
+// ResetTables truncates all data in the specified tables and in the tables referencing them.
 func ResetTables(t *testing.T, db *dbcontext.DB, tables ...string) {
 	for _, table := range tables {
-		_, err := db.DB().TruncateTable(table).Execute()
+		_, err := db.DB().NewQuery("TRUNCATE TABLE {{" + table + "}} CASCADE").Execute()
 		if err != nil {
 			t.Error(err)
 			t.FailNow()
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	now := time.Now()
+	repo := &mockRepository{
+		items: []entity.Webhook{
+			{ID: "w1", URL: "https://example.com/hook", Events: entity.WebhookEvents{"character.created"}, Secret: "0123456789abcdef", Active: true, OwnerID: "100", CreatedAt: now, UpdatedAt: now},
+			{ID: "w2", URL: "https://example.com/other", Events: entity.WebhookEvents{"character.created"}, Secret: "0123456789abcdef", Active: true, OwnerID: "200", CreatedAt: now, UpdatedAt: now},
+		},
+		deliveries: []entity.WebhookDelivery{
+			{ID: "d1", WebhookID: "w1", Event: "character.created", Payload: entity.WebhookPayload(`{"id":"r1"}`), Status: entity.DeliverySucceeded, Attempts: 2, CreatedAt: now, UpdatedAt: now},
+		},
+		attempts: []entity.WebhookAttempt{
+			{ID: "a1", DeliveryID: "d1", Attempt: 1, StatusCode: http.StatusInternalServerError, Error: "unexpected response status 500 Internal Server Error", CreatedAt: now},
+			{ID: "a2", DeliveryID: "d1", Attempt: 2, StatusCode: http.StatusOK, CreatedAt: now},
+		},
+	}
+	RegisterHandlers(router.Group(""), NewService(repo, mockResolver{}, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/webhooks", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get all auth error", "GET", "/webhooks", "", nil, http.StatusUnauthorized, ""},
+		{"get 1", "GET", "/webhooks/w1", "", header, http.StatusOK, `*example.com/hook*`},
+		{"get secret hidden", "GET", "/webhooks/w1", "", header, http.StatusOK, `{"id":"w1","url":"https://example.com/hook","events":["character.created"],"active":true,"owner_id":"100",*`},
+		{"get unknown", "GET", "/webhooks/none", "", header, http.StatusNotFound, ""},
+		{"get not owned", "GET", "/webhooks/w2", "", header, http.StatusNotFound, ""},
+		{"create ok", "POST", "/webhooks", `{"url":"https://example.com/new","events":["character.deleted"],"secret":"fedcba9876543210"}`, header, http.StatusCreated, `*"secret":"fedcba9876543210"*`},
+		{"create ok count", "GET", "/webhooks", "", header, http.StatusOK, `*"total_count":2*`},
+		{"create invalid event", "POST", "/webhooks", `{"url":"https://example.com/new","events":["character.renamed"]}`, header, http.StatusBadRequest, `*events*`},
+		{"create invalid url", "POST", "/webhooks", `{"url":"example.com","events":["character.created"]}`, header, http.StatusBadRequest, `*url*`},
+		{"create auth error", "POST", "/webhooks", `{"url":"https://example.com/new","events":["character.created"]}`, nil, http.StatusUnauthorized, ""},
+		{"create input error", "POST", "/webhooks", `"url":"https://example.com/new"}`, header, http.StatusBadRequest, ""},
+		{"update ok", "PUT", "/webhooks/w1", `{"url":"https://example.com/updated","events":["character.updated"],"active":false}`, header, http.StatusOK, `*"active":false*`},
+		{"update verify", "GET", "/webhooks/w1", "", header, http.StatusOK, `*example.com/updated*`},
+		{"update not owned", "PUT", "/webhooks/w2", `{"url":"https://example.com/updated","events":["character.updated"]}`, header, http.StatusNotFound, ""},
+		{"update invalid", "PUT", "/webhooks/w1", `{"url":"https://example.com/updated","events":[]}`, header, http.StatusBadRequest, `*events*`},
+		{"update auth error", "PUT", "/webhooks/w1", `{"url":"https://example.com/updated","events":["character.updated"]}`, nil, http.StatusUnauthorized, ""},
+		{"update input error", "PUT", "/webhooks/w1", `"url":"https://example.com/updated"}`, header, http.StatusBadRequest, ""},
+		{"get deliveries", "GET", "/webhooks/w1/deliveries", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get deliveries not owned", "GET", "/webhooks/w2/deliveries", "", header, http.StatusNotFound, ""},
+		{"get deliveries auth error", "GET", "/webhooks/w1/deliveries", "", nil, http.StatusUnauthorized, ""},
+		{"get delivery", "GET", "/webhooks/w1/deliveries/d1", "", header, http.StatusOK, `*"attempt":2,"status_code":200*`},
+		{"get delivery unknown", "GET", "/webhooks/w1/deliveries/none", "", header, http.StatusNotFound, ""},
+		{"get delivery not owned", "GET", "/webhooks/w2/deliveries/d1", "", header, http.StatusNotFound, ""},
+		{"delete ok", "DELETE", "/webhooks/w1", ``, header, http.StatusOK, `*w1*`},
+		{"delete verify", "GET", "/webhooks/w1", ``, header, http.StatusNotFound, ""},
+		{"delete not owned", "DELETE", "/webhooks/w2", ``, header, http.StatusNotFound, ""},
+		{"delete auth error", "DELETE", "/webhooks/w2", ``, nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
@@ -0,0 +1,232 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// The headers sent with every delivery.
+const (
+	// EventHeader is the event of the delivery, e.g. "character.created".
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader is the ID of the delivery, which is the same for all its attempts.
+	DeliveryHeader = "X-Webhook-Delivery"
+	// TimestampHeader is the Unix time at which the attempt was signed.
+	TimestampHeader = "X-Webhook-Timestamp"
+	// SignatureHeader is the signature of the attempt computed by Sign.
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	// DefaultTimeout is the time given to webhooks to respond by default.
+	DefaultTimeout = 10 * time.Second
+	// DefaultBatchSize is the maximum number of deliveries attempted at once by default.
+	DefaultBatchSize = 100
+)
+
+// RetryPolicy specifies how failed deliveries are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts after which a delivery fails for good.
+	MaxAttempts int
+	// MinBackoff is the delay before the second attempt, which doubles after each failed attempt up to MaxBackoff.
+	MinBackoff, MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used by default: 8 attempts, waiting from 10 seconds up to an hour
+// between them.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 8,
+		MinBackoff:  10 * time.Second,
+		MaxBackoff:  time.Hour,
+	}
+}
+
+// Backoff returns the delay before the next attempt of a delivery that failed the given number of attempts.
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	delay := p.MinBackoff
+	for i := 1; i < attempts && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return delay
+}
+
+// Sign returns the signature of a delivery attempt made at the given Unix time with the given payload: "sha256="
+// followed by the hex-encoded HMAC-SHA256 of the timestamp, a dot and the payload, keyed by the secret of the webhook.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher sends the pending deliveries to their webhooks and retries them with exponential backoff.
+type Dispatcher struct {
+	repo      Repository
+	client    *http.Client
+	policy    RetryPolicy
+	batchSize int
+	logger    log.Logger
+}
+
+// NewDispatcher creates a new dispatcher sending the deliveries with the given client, or if it is nil with a client
+// waiting for DefaultTimeout, which only connects to public addresses and does not follow redirects.
+func NewDispatcher(repo Repository, client *http.Client, policy RetryPolicy, logger log.Logger) Dispatcher {
+	if client == nil {
+		client = newClient(DefaultTimeout, isPublicIP)
+	}
+	return Dispatcher{repo, client, policy, DefaultBatchSize, logger}
+}
+
+// Run dispatches the due deliveries at the given interval until the context is done. The deliveries in progress when
+// the context is done are completed before it returns, so that they are not cut off on shutdown.
+func (d Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.Dispatch(context.Background()); err != nil {
+				d.logger.With(ctx).Errorf("failed to dispatch webhook deliveries: %v", err)
+			}
+		}
+	}
+}
+
+// Dispatch attempts the deliveries that are due, and returns how many were attempted. Every attempt is logged, and
+// the deliveries that fail are scheduled again until they reach the maximum number of attempts.
+func (d Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	now := time.Now()
+	// the deliveries are leased long enough for the attempts to complete before they can be claimed again
+	lease := now.Add(d.client.Timeout + time.Minute)
+	if d.client.Timeout == 0 {
+		lease = now.Add(DefaultTimeout + time.Minute)
+	}
+	deliveries, err := d.repo.ClaimDeliveries(ctx, now, lease, d.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	webhooks := map[string]*entity.Webhook{}
+	for _, delivery := range deliveries {
+		if _, ok := webhooks[delivery.WebhookID]; ok {
+			continue
+		}
+		webhook, err := d.repo.Get(ctx, delivery.WebhookID)
+		if err == sql.ErrNoRows {
+			webhooks[delivery.WebhookID] = nil
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		webhooks[delivery.WebhookID] = &webhook
+	}
+
+	count := 0
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		webhook := webhooks[delivery.WebhookID]
+		if webhook == nil {
+			// the webhook was deleted along with its deliveries
+			continue
+		}
+		if !webhook.Active {
+			d.finish(ctx, delivery, entity.DeliveryFailed)
+			continue
+		}
+		count++
+		wg.Add(1)
+		go func(delivery entity.WebhookDelivery) {
+			defer wg.Done()
+			d.attempt(ctx, *webhook, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+	return count, nil
+}
+
+// attempt sends a delivery to its webhook once, logs the attempt and schedules the next one if it failed.
+func (d Dispatcher) attempt(ctx context.Context, webhook entity.Webhook, delivery entity.WebhookDelivery) {
+	start := time.Now()
+	attempt := entity.WebhookAttempt{
+		ID:         entity.GenerateID(),
+		DeliveryID: delivery.ID,
+		Attempt:    delivery.Attempts + 1,
+		CreatedAt:  start,
+	}
+	attempt.StatusCode, attempt.Error = d.send(ctx, webhook, delivery, start)
+	attempt.Duration = time.Since(start).Milliseconds()
+	if err := d.repo.CreateAttempt(ctx, attempt); err != nil {
+		d.logger.With(ctx).Errorf("failed to log the attempt of webhook delivery %v: %v", delivery.ID, err)
+	}
+
+	delivery.Attempts = attempt.Attempt
+	switch {
+	case attempt.Error == "":
+		d.finish(ctx, delivery, entity.DeliverySucceeded)
+	case delivery.Attempts >= d.policy.MaxAttempts:
+		d.finish(ctx, delivery, entity.DeliveryFailed)
+	default:
+		next := time.Now().Add(d.policy.Backoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+		delivery.UpdatedAt = time.Now()
+		if err := d.repo.UpdateDelivery(ctx, delivery); err != nil {
+			d.logger.With(ctx).Errorf("failed to reschedule webhook delivery %v: %v", delivery.ID, err)
+		}
+	}
+}
+
+// send posts the payload of a delivery to its webhook, and returns the status of the response along with an error
+// message if it did not succeed.
+func (d Dispatcher) send(ctx context.Context, webhook entity.Webhook, delivery entity.WebhookDelivery, now time.Time) (int, string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, delivery.Payload))
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer res.Body.Close()
+	// the response is drained so that the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Sprintf("unexpected response status %v", res.Status)
+	}
+	return res.StatusCode, ""
+}
+
+// finish ends a delivery with the given status.
+func (d Dispatcher) finish(ctx context.Context, delivery entity.WebhookDelivery, status string) {
+	delivery.Status = status
+	delivery.NextAttemptAt = nil
+	delivery.UpdatedAt = time.Now()
+	if err := d.repo.UpdateDelivery(ctx, delivery); err != nil {
+		d.logger.With(ctx).Errorf("failed to update webhook delivery %v: %v", delivery.ID, err)
+	}
+}
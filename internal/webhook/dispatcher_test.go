@@ -0,0 +1,292 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempts), func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.Backoff(tt.attempts))
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1582707600.{"id":"1"}' | openssl dgst -sha256 -hmac secret
+	signature := Sign("secret", 1582707600, []byte(`{"id":"1"}`))
+	assert.Equal(t, "sha256=408072c09d7fa9cd53e2254332fdcdb7894a4d5cbf56d0fe3473270ae1157c80", signature)
+	assert.NotEqual(t, signature, Sign("other", 1582707600, []byte(`{"id":"1"}`)))
+	assert.NotEqual(t, signature, Sign("secret", 1582707601, []byte(`{"id":"1"}`)))
+	assert.NotEqual(t, signature, Sign("secret", 1582707600, []byte(`{"id":"2"}`)))
+}
+
+// receiver is an httptest receiver of deliveries that responds with the given statuses in turn.
+type receiver struct {
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// testClient returns a delivery client allowing the loopback addresses of the httptest receivers.
+func testClient() *http.Client {
+	return newClient(time.Second, func(ip net.IP) bool { return ip.IsLoopback() })
+}
+
+func newDelivery(webhookID string) entity.WebhookDelivery {
+	now := time.Now()
+	return entity.WebhookDelivery{
+		ID:            entity.GenerateID(),
+		WebhookID:     webhookID,
+		Event:         entity.EventCharacterCreated,
+		Payload:       entity.WebhookPayload(`{"id":"r1","event":"character.created"}`),
+		Status:        entity.DeliveryPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	logger, _ := log.NewForTest()
+	rec := &receiver{statuses: []int{http.StatusInternalServerError}}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	repo := &mockRepository{
+		items: []entity.Webhook{{ID: "w1", URL: server.URL, Events: entity.WebhookEvents{entity.EventCharacterCreated}, Secret: "0123456789abcdef", Active: true}},
+	}
+	delivery := newDelivery("w1")
+	repo.deliveries = []entity.WebhookDelivery{delivery}
+	policy := RetryPolicy{MaxAttempts: 3, MinBackoff: time.Minute, MaxBackoff: time.Hour}
+	d := NewDispatcher(repo, testClient(), policy, logger)
+	ctx := context.Background()
+
+	// the first attempt fails and is retried after the backoff
+	start := time.Now()
+	count, err := d.Dispatch(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	if assert.Len(t, rec.requests, 1) {
+		req := rec.requests[0]
+		assert.Equal(t, http.MethodPost, req.Method)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		assert.Equal(t, entity.EventCharacterCreated, req.Header.Get(EventHeader))
+		assert.Equal(t, delivery.ID, req.Header.Get(DeliveryHeader))
+		timestamp, err := strconv.ParseInt(req.Header.Get(TimestampHeader), 10, 64)
+		assert.Nil(t, err)
+		assert.Equal(t, Sign("0123456789abcdef", timestamp, rec.bodies[0]), req.Header.Get(SignatureHeader))
+		assert.Equal(t, `{"id":"r1","event":"character.created"}`, string(rec.bodies[0]))
+	}
+	if assert.Len(t, repo.attempts, 1) {
+		assert.Equal(t, 1, repo.attempts[0].Attempt)
+		assert.Equal(t, http.StatusInternalServerError, repo.attempts[0].StatusCode)
+		assert.NotEmpty(t, repo.attempts[0].Error)
+	}
+	retried := repo.deliveries[0]
+	assert.Equal(t, entity.DeliveryPending, retried.Status)
+	assert.Equal(t, 1, retried.Attempts)
+	assert.False(t, retried.NextAttemptAt.Before(start.Add(time.Minute)))
+
+	// nothing is due before the backoff ends
+	count, _ = d.Dispatch(ctx)
+	assert.Equal(t, 0, count)
+	assert.Len(t, rec.requests, 1)
+
+	// the second attempt succeeds
+	now := time.Now()
+	repo.deliveries[0].NextAttemptAt = &now
+	count, _ = d.Dispatch(ctx)
+	assert.Equal(t, 1, count)
+	assert.Len(t, rec.requests, 2)
+	assert.Equal(t, rec.requests[0].Header.Get(DeliveryHeader), rec.requests[1].Header.Get(DeliveryHeader))
+	if assert.Len(t, repo.attempts, 2) {
+		assert.Equal(t, 2, repo.attempts[1].Attempt)
+		assert.Equal(t, http.StatusOK, repo.attempts[1].StatusCode)
+		assert.Empty(t, repo.attempts[1].Error)
+	}
+	assert.Equal(t, entity.DeliverySucceeded, repo.deliveries[0].Status)
+	assert.Equal(t, 2, repo.deliveries[0].Attempts)
+	assert.Nil(t, repo.deliveries[0].NextAttemptAt)
+
+	// a finished delivery is not attempted again
+	count, _ = d.Dispatch(ctx)
+	assert.Equal(t, 0, count)
+}
+
+func TestDispatcher_Dispatch_maxAttempts(t *testing.T) {
+	logger, _ := log.NewForTest()
+	rec := &receiver{statuses: []int{http.StatusBadGateway, http.StatusNotFound}}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	repo := &mockRepository{
+		items:      []entity.Webhook{{ID: "w1", URL: server.URL, Secret: "0123456789abcdef", Active: true}},
+		deliveries: []entity.WebhookDelivery{newDelivery("w1")},
+	}
+	d := NewDispatcher(repo, testClient(), RetryPolicy{MaxAttempts: 2, MinBackoff: time.Second, MaxBackoff: time.Second}, logger)
+	ctx := context.Background()
+
+	_, _ = d.Dispatch(ctx)
+	assert.Equal(t, entity.DeliveryPending, repo.deliveries[0].Status)
+	now := time.Now()
+	repo.deliveries[0].NextAttemptAt = &now
+	_, _ = d.Dispatch(ctx)
+	assert.Equal(t, entity.DeliveryFailed, repo.deliveries[0].Status)
+	assert.Equal(t, 2, repo.deliveries[0].Attempts)
+	assert.Nil(t, repo.deliveries[0].NextAttemptAt)
+	if assert.Len(t, repo.attempts, 2) {
+		assert.Equal(t, http.StatusNotFound, repo.attempts[1].StatusCode)
+	}
+}
+
+func TestDispatcher_Dispatch_unreachable(t *testing.T) {
+	logger, _ := log.NewForTest()
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	repo := &mockRepository{
+		items:      []entity.Webhook{{ID: "w1", URL: url, Secret: "0123456789abcdef", Active: true}},
+		deliveries: []entity.WebhookDelivery{newDelivery("w1")},
+	}
+	d := NewDispatcher(repo, testClient(), DefaultRetryPolicy(), logger)
+	count, err := d.Dispatch(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	if assert.Len(t, repo.attempts, 1) {
+		assert.Equal(t, 0, repo.attempts[0].StatusCode)
+		assert.NotEmpty(t, repo.attempts[0].Error)
+	}
+	assert.Equal(t, entity.DeliveryPending, repo.deliveries[0].Status)
+}
+
+func TestDispatcher_Dispatch_inactive(t *testing.T) {
+	logger, _ := log.NewForTest()
+	rec := &receiver{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	repo := &mockRepository{
+		items:      []entity.Webhook{{ID: "w1", URL: server.URL, Secret: "0123456789abcdef"}},
+		deliveries: []entity.WebhookDelivery{newDelivery("w1"), newDelivery("w2")},
+	}
+	d := NewDispatcher(repo, testClient(), DefaultRetryPolicy(), logger)
+	count, err := d.Dispatch(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+	assert.Empty(t, rec.requests)
+	assert.Empty(t, repo.attempts)
+	assert.Equal(t, entity.DeliveryFailed, repo.deliveries[0].Status)
+	assert.Nil(t, repo.deliveries[0].NextAttemptAt)
+}
+
+func TestDispatcher_Dispatch_nonPublic(t *testing.T) {
+	logger, _ := log.NewForTest()
+	rec := &receiver{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	// the default client refuses to connect to loopback addresses
+	repo := &mockRepository{
+		items:      []entity.Webhook{{ID: "w1", URL: server.URL, Secret: "0123456789abcdef", Active: true}},
+		deliveries: []entity.WebhookDelivery{newDelivery("w1")},
+	}
+	d := NewDispatcher(repo, nil, DefaultRetryPolicy(), logger)
+	count, err := d.Dispatch(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Empty(t, rec.requests)
+	if assert.Len(t, repo.attempts, 1) {
+		assert.Equal(t, 0, repo.attempts[0].StatusCode)
+		assert.Contains(t, repo.attempts[0].Error, errNonPublicAddress.Error())
+	}
+}
+
+func TestDispatcher_Dispatch_redirect(t *testing.T) {
+	logger, _ := log.NewForTest()
+	target := &receiver{}
+	targetServer := httptest.NewServer(target)
+	defer targetServer.Close()
+	server := httptest.NewServer(http.RedirectHandler(targetServer.URL, http.StatusTemporaryRedirect))
+	defer server.Close()
+
+	// redirects are not followed, and fail the attempt
+	repo := &mockRepository{
+		items:      []entity.Webhook{{ID: "w1", URL: server.URL, Secret: "0123456789abcdef", Active: true}},
+		deliveries: []entity.WebhookDelivery{newDelivery("w1")},
+	}
+	d := NewDispatcher(repo, testClient(), DefaultRetryPolicy(), logger)
+	_, _ = d.Dispatch(context.Background())
+	assert.Empty(t, target.requests)
+	if assert.Len(t, repo.attempts, 1) {
+		assert.Equal(t, http.StatusTemporaryRedirect, repo.attempts[0].StatusCode)
+		assert.NotEmpty(t, repo.attempts[0].Error)
+	}
+	assert.Equal(t, entity.DeliveryPending, repo.deliveries[0].Status)
+}
+
+func TestDispatcher_Run(t *testing.T) {
+	logger, _ := log.NewForTest()
+	received := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(received)
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	repo := &mockRepository{
+		items:      []entity.Webhook{{ID: "w1", URL: server.URL, Secret: "0123456789abcdef", Active: true}},
+		deliveries: []entity.WebhookDelivery{newDelivery("w1")},
+	}
+	d := NewDispatcher(repo, testClient(), DefaultRetryPolicy(), logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx, 10*time.Millisecond)
+	}()
+
+	// the delivery in progress completes after the context is done
+	<-received
+	cancel()
+	<-done
+	assert.Equal(t, entity.DeliverySucceeded, repo.deliveries[0].Status)
+	if assert.Len(t, repo.attempts, 1) {
+		assert.Equal(t, http.StatusOK, repo.attempts[0].StatusCode)
+	}
+}
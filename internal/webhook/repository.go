@@ -0,0 +1,230 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/dbcontext"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// Repository encapsulates the logic to access webhooks and their deliveries from the data source.
+type Repository interface {
+	// Get returns the webhook with the specified ID.
+	Get(ctx context.Context, id string) (entity.Webhook, error)
+	// Count returns the number of webhooks owned by the given user.
+	Count(ctx context.Context, ownerID string) (int, error)
+	// Query returns the list of webhooks owned by the given user, oldest first, with the given offset and limit.
+	Query(ctx context.Context, ownerID string, offset, limit int) ([]entity.Webhook, error)
+	// QueryActive returns all the active webhooks.
+	QueryActive(ctx context.Context) ([]entity.Webhook, error)
+	// Create saves a new webhook in the storage.
+	Create(ctx context.Context, webhook entity.Webhook) error
+	// Update updates the webhook with given ID in the storage.
+	Update(ctx context.Context, webhook entity.Webhook) error
+	// Delete removes the webhook with given ID from the storage, along with its deliveries.
+	Delete(ctx context.Context, id string) error
+	// GetDelivery returns the delivery with the specified ID.
+	GetDelivery(ctx context.Context, id string) (entity.WebhookDelivery, error)
+	// CountDeliveries returns the number of deliveries of the webhook with the given ID.
+	CountDeliveries(ctx context.Context, webhookID string) (int, error)
+	// QueryDeliveries returns the deliveries of the webhook with the given ID, latest first, with the given offset
+	// and limit.
+	QueryDeliveries(ctx context.Context, webhookID string, offset, limit int) ([]entity.WebhookDelivery, error)
+	// CreateDeliveries saves the given new deliveries in the storage with as few statements as possible.
+	CreateDeliveries(ctx context.Context, deliveries []entity.WebhookDelivery) error
+	// ClaimDeliveries returns at most limit pending deliveries due at the given time, oldest first, and postpones
+	// their next attempt until the given lease ends, so that they are not claimed again meanwhile.
+	ClaimDeliveries(ctx context.Context, now, lease time.Time, limit int) ([]entity.WebhookDelivery, error)
+	// UpdateDelivery updates the delivery with given ID in the storage.
+	UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error
+	// CreateAttempt saves a new delivery attempt in the storage.
+	CreateAttempt(ctx context.Context, attempt entity.WebhookAttempt) error
+	// QueryAttempts returns the attempts of the delivery with the given ID in order.
+	QueryAttempts(ctx context.Context, deliveryID string) ([]entity.WebhookAttempt, error)
+}
+
+// repository persists webhooks in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new webhook repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the webhook with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Webhook, error) {
+	var webhook entity.Webhook
+	err := r.db.With(ctx).Select().Model(id, &webhook)
+	return webhook, err
+}
+
+// Count returns the number of the webhook records owned by the given user in the database.
+func (r repository) Count(ctx context.Context, ownerID string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("webhook").Where(dbx.HashExp{"owner_id": ownerID}).Row(&count)
+	return count, err
+}
+
+// Query retrieves the webhook records owned by the given user with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, ownerID string, offset, limit int) ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"owner_id": ownerID}).
+		OrderBy("created_at", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&webhooks)
+	return webhooks, err
+}
+
+// QueryActive retrieves the active webhook records from the database.
+func (r repository) QueryActive(ctx context.Context) ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"active": true}).
+		OrderBy("created_at", "id").
+		All(&webhooks)
+	return webhooks, err
+}
+
+// Create saves a new webhook record in the database.
+func (r repository) Create(ctx context.Context, webhook entity.Webhook) error {
+	return r.db.With(ctx).Model(&webhook).Insert()
+}
+
+// Update saves the changes to a webhook in the database.
+func (r repository) Update(ctx context.Context, webhook entity.Webhook) error {
+	return r.db.With(ctx).Model(&webhook).Update()
+}
+
+// Delete deletes a webhook with the specified ID from the database. Its deliveries are deleted in cascade.
+func (r repository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.With(ctx).Delete("webhook", dbx.HashExp{"id": id}).Execute()
+	return err
+}
+
+// GetDelivery reads the delivery with the specified ID from the database.
+func (r repository) GetDelivery(ctx context.Context, id string) (entity.WebhookDelivery, error) {
+	var delivery entity.WebhookDelivery
+	err := r.db.With(ctx).Select().Model(id, &delivery)
+	return delivery, err
+}
+
+// CountDeliveries returns the number of the delivery records of the given webhook in the database.
+func (r repository) CountDeliveries(ctx context.Context, webhookID string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("webhook_delivery").Where(dbx.HashExp{"webhook_id": webhookID}).Row(&count)
+	return count, err
+}
+
+// QueryDeliveries retrieves the delivery records of the given webhook with the specified offset and limit from the
+// database.
+func (r repository) QueryDeliveries(ctx context.Context, webhookID string, offset, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"webhook_id": webhookID}).
+		OrderBy("created_at DESC", "id DESC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&deliveries)
+	return deliveries, err
+}
+
+// deliveryBatchSize is the maximum number of delivery records inserted by a single statement, which keeps the
+// statements under the limit of parameters of PostgreSQL.
+const deliveryBatchSize = 1000
+
+// CreateDeliveries saves new delivery records in the database with a statement per batch of records.
+func (r repository) CreateDeliveries(ctx context.Context, deliveries []entity.WebhookDelivery) error {
+	for start := 0; start < len(deliveries); start += deliveryBatchSize {
+		end := start + deliveryBatchSize
+		if end > len(deliveries) {
+			end = len(deliveries)
+		}
+		rows := make([][]interface{}, 0, end-start)
+		for _, d := range deliveries[start:end] {
+			// a nil next attempt is passed untyped so that it is stored as NULL
+			var next interface{}
+			if d.NextAttemptAt != nil {
+				next = *d.NextAttemptAt
+			}
+			rows = append(rows, []interface{}{d.ID, d.WebhookID, d.Event, d.Payload, d.Status, d.Attempts, next,
+				d.CreatedAt, d.UpdatedAt})
+		}
+		if err := r.insertRows(ctx, "webhook_delivery", []string{"id", "webhook_id", "event", "payload", "status",
+			"attempts", "next_attempt_at", "created_at", "updated_at"}, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertRows inserts several rows into the given table with a single statement.
+func (r repository) insertRows(ctx context.Context, table string, columns []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	params := dbx.Params{}
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		placeholders := make([]string, len(row))
+		for j, value := range row {
+			name := fmt.Sprintf("r%v_%v", i, j)
+			params[name] = value
+			placeholders[j] = "{:" + name + "}"
+		}
+		values[i] = "(" + strings.Join(placeholders, ", ") + ")"
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = "[[" + column + "]]"
+	}
+	sql := fmt.Sprintf("INSERT INTO {{%v}} (%v) VALUES %v", table, strings.Join(quoted, ", "), strings.Join(values, ", "))
+	_, err := r.db.With(ctx).NewQuery(sql).Bind(params).Execute()
+	return err
+}
+
+// ClaimDeliveries postpones the next attempt of the due pending delivery records in the database and returns them.
+// The claimed records are skipped by concurrent claims, so that several servers can deliver them.
+func (r repository) ClaimDeliveries(ctx context.Context, now, lease time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := r.db.With(ctx).
+		NewQuery("UPDATE {{webhook_delivery}} SET [[next_attempt_at]] = {:lease} WHERE [[id]] IN (" +
+			"SELECT [[id]] FROM {{webhook_delivery}} WHERE [[status]] = {:status} AND [[next_attempt_at]] <= {:now} " +
+			"ORDER BY [[next_attempt_at]], [[id]] LIMIT {:limit} FOR UPDATE SKIP LOCKED) RETURNING *").
+		Bind(dbx.Params{"lease": lease, "status": entity.DeliveryPending, "now": now, "limit": limit}).
+		All(&deliveries)
+	return deliveries, err
+}
+
+// UpdateDelivery saves the changes to a delivery in the database.
+func (r repository) UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	return r.db.With(ctx).Model(&delivery).Update()
+}
+
+// CreateAttempt saves a new delivery attempt record in the database.
+func (r repository) CreateAttempt(ctx context.Context, attempt entity.WebhookAttempt) error {
+	return r.db.With(ctx).Model(&attempt).Insert()
+}
+
+// QueryAttempts retrieves the attempt records of the given delivery from the database.
+func (r repository) QueryAttempts(ctx context.Context, deliveryID string) ([]entity.WebhookAttempt, error) {
+	var attempts []entity.WebhookAttempt
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"delivery_id": deliveryID}).
+		OrderBy("attempt").
+		All(&attempts)
+	return attempts, err
+}
@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/internal/test"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "webhook")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	// create
+	webhook := entity.Webhook{
+		ID:        "w1",
+		URL:       "https://example.com/hook",
+		Events:    entity.WebhookEvents{entity.EventCharacterCreated},
+		Secret:    "0123456789abcdef",
+		Active:    true,
+		OwnerID:   "100",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	assert.Nil(t, repo.Create(ctx, webhook))
+	other := webhook
+	other.ID, other.OwnerID, other.Active = "w2", "200", false
+	assert.Nil(t, repo.Create(ctx, other))
+
+	// get
+	saved, err := repo.Get(ctx, "w1")
+	assert.Nil(t, err)
+	assert.Equal(t, webhook.Events, saved.Events)
+	assert.Equal(t, webhook.Secret, saved.Secret)
+	_, err = repo.Get(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// count and query
+	count, err := repo.Count(ctx, "100")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	webhooks, err := repo.Query(ctx, "100", 0, count)
+	assert.Nil(t, err)
+	assert.Len(t, webhooks, 1)
+	webhooks, err = repo.QueryActive(ctx)
+	assert.Nil(t, err)
+	if assert.Len(t, webhooks, 1) {
+		assert.Equal(t, "w1", webhooks[0].ID)
+	}
+
+	// update
+	webhook.Events = entity.WebhookEvents{entity.EventCharacterUpdated, entity.EventCharacterDeleted}
+	assert.Nil(t, repo.Update(ctx, webhook))
+	saved, _ = repo.Get(ctx, "w1")
+	assert.Equal(t, webhook.Events, saved.Events)
+
+	// deliveries
+	first, second := newDelivery("w1"), newDelivery("w1")
+	later := now.Add(time.Hour)
+	second.NextAttemptAt = &later
+	assert.Nil(t, repo.CreateDeliveries(ctx, []entity.WebhookDelivery{first, second}))
+	count, err = repo.CountDeliveries(ctx, "w1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	deliveries, err := repo.QueryDeliveries(ctx, "w1", 0, count)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 2)
+	delivery, err := repo.GetDelivery(ctx, first.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, first.Payload, delivery.Payload)
+	_, err = repo.GetDelivery(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// claim only returns the due deliveries once
+	lease := time.Now().Add(time.Minute)
+	claimed, err := repo.ClaimDeliveries(ctx, time.Now(), lease, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, claimed, 1) {
+		assert.Equal(t, first.ID, claimed[0].ID)
+	}
+	claimed, err = repo.ClaimDeliveries(ctx, time.Now(), lease, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, claimed)
+
+	// update delivery
+	delivery.Status = entity.DeliverySucceeded
+	delivery.Attempts = 1
+	delivery.NextAttemptAt = nil
+	assert.Nil(t, repo.UpdateDelivery(ctx, delivery))
+	delivery, _ = repo.GetDelivery(ctx, first.ID)
+	assert.Equal(t, entity.DeliverySucceeded, delivery.Status)
+	assert.Nil(t, delivery.NextAttemptAt)
+
+	// attempts
+	assert.Nil(t, repo.CreateAttempt(ctx, entity.WebhookAttempt{ID: "a2", DeliveryID: first.ID, Attempt: 2, StatusCode: 200, CreatedAt: now}))
+	assert.Nil(t, repo.CreateAttempt(ctx, entity.WebhookAttempt{ID: "a1", DeliveryID: first.ID, Attempt: 1, Error: "timeout", CreatedAt: now}))
+	attempts, err := repo.QueryAttempts(ctx, first.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, attempts, 2) {
+		assert.Equal(t, 1, attempts[0].Attempt)
+		assert.Equal(t, "timeout", attempts[0].Error)
+	}
+
+	// batches of deliveries
+	batch := make([]entity.WebhookDelivery, deliveryBatchSize+1)
+	for i := range batch {
+		batch[i] = newDelivery("w1")
+	}
+	batch[0].Status, batch[0].NextAttemptAt = entity.DeliveryFailed, nil
+	assert.Nil(t, repo.CreateDeliveries(ctx, batch))
+	count, _ = repo.CountDeliveries(ctx, "w1")
+	assert.Equal(t, deliveryBatchSize+3, count)
+	delivery, _ = repo.GetDelivery(ctx, batch[0].ID)
+	assert.Nil(t, delivery.NextAttemptAt)
+	assert.Nil(t, repo.CreateDeliveries(ctx, nil))
+
+	// delete removes the deliveries in cascade
+	assert.Nil(t, repo.Delete(ctx, "w1"))
+	_, err = repo.Get(ctx, "w1")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = repo.GetDelivery(ctx, first.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, repo.Delete(ctx, "w1"))
+}
@@ -0,0 +1,399 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+)
+
+// Service encapsulates usecase logic for webhooks. It also implements character.Listener, so that the changes of
+// characters are delivered to the webhooks subscribed to them.
+type Service interface {
+	Get(ctx context.Context, id string) (Webhook, error)
+	Query(ctx context.Context, offset, limit int) ([]Webhook, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, input CreateWebhookRequest) (CreatedWebhook, error)
+	Update(ctx context.Context, id string, input UpdateWebhookRequest) (Webhook, error)
+	Delete(ctx context.Context, id string) (Webhook, error)
+	CountDeliveries(ctx context.Context, id string) (int, error)
+	QueryDeliveries(ctx context.Context, id string, offset, limit int) ([]Delivery, error)
+	GetDelivery(ctx context.Context, id, deliveryID string) (DeliveryDetails, error)
+	CharactersChanged(ctx context.Context, revisions []entity.CharacterRevision) error
+}
+
+// Webhook represents the data about a webhook.
+type Webhook struct {
+	entity.Webhook
+}
+
+// CreatedWebhook represents a newly created webhook, along with the secret signing its deliveries.
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// Delivery represents an event sent to a webhook.
+type Delivery struct {
+	entity.WebhookDelivery
+}
+
+// DeliveryDetails represents an event sent to a webhook, along with its attempts.
+type DeliveryDetails struct {
+	Delivery
+	AttemptLog []entity.WebhookAttempt `json:"attempt_log"`
+}
+
+// Payload is the JSON document sent to webhooks for a change of a character.
+type Payload struct {
+	// ID identifies the event. It is the ID of the revision of the change, and is the same for all webhooks.
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      PayloadData `json:"data"`
+}
+
+// PayloadData describes the change of a character sent to webhooks.
+type PayloadData struct {
+	// Character is the character after the change, or before it for deletions.
+	Character *entity.CharacterSnapshot `json:"character"`
+	// Previous is the character before the change. It is only set for updates.
+	Previous *entity.CharacterSnapshot `json:"previous,omitempty"`
+	// Action is the action of the revision of the change, such as "update" or "experience".
+	Action   string `json:"action"`
+	Revision int64  `json:"revision"`
+	UserID   string `json:"user_id"`
+}
+
+// Events lists the events that webhooks can subscribe to.
+var Events = []interface{}{entity.EventCharacterCreated, entity.EventCharacterUpdated, entity.EventCharacterDeleted}
+
+// CreateWebhookRequest represents a webhook creation request.
+// A secret is generated unless one is given.
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// Validate validates the CreateWebhookRequest fields.
+func (m CreateWebhookRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.URL, validation.Required, validation.Length(0, 2048), validation.By(httpURL)),
+		validation.Field(&m.Events, validation.Required, validation.Each(validation.In(Events...))),
+		validation.Field(&m.Secret, validation.Length(16, 256)),
+	)
+}
+
+// UpdateWebhookRequest represents a webhook update request.
+// The webhook is left active or inactive if Active is omitted.
+type UpdateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// Validate validates the UpdateWebhookRequest fields.
+func (m UpdateWebhookRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.URL, validation.Required, validation.Length(0, 2048), validation.By(httpURL)),
+		validation.Field(&m.Events, validation.Required, validation.Each(validation.In(Events...))),
+	)
+}
+
+// httpURL checks that a value is an absolute HTTP or HTTPS URL.
+func httpURL(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return errors.New("must be a valid HTTP or HTTPS URL")
+	}
+	return nil
+}
+
+type service struct {
+	repo     Repository
+	resolver Resolver
+	logger   log.Logger
+}
+
+// NewService creates a new webhook service. The resolver checks that the hosts of the webhooks are public.
+func NewService(repo Repository, resolver Resolver, logger log.Logger) Service {
+	return service{repo, resolver, logger}
+}
+
+// Get returns the webhook with the specified ID if the current user owns it.
+func (s service) Get(ctx context.Context, id string) (Webhook, error) {
+	webhook, err := s.getOwned(ctx, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	return Webhook{webhook}, nil
+}
+
+// getOwned returns the webhook with the specified ID. The webhooks of other users are reported as sql.ErrNoRows, so
+// that their URLs are not disclosed.
+func (s service) getOwned(ctx context.Context, id string) (entity.Webhook, error) {
+	webhook, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return webhook, err
+	}
+	if user := auth.CurrentUser(ctx); user == nil || user.GetID() != webhook.OwnerID {
+		return entity.Webhook{}, sql.ErrNoRows
+	}
+	return webhook, nil
+}
+
+// Count returns the number of webhooks of the current user.
+func (s service) Count(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx, currentUserID(ctx))
+}
+
+// Query returns the webhooks of the current user, oldest first, with the specified offset and limit.
+func (s service) Query(ctx context.Context, offset, limit int) ([]Webhook, error) {
+	items, err := s.repo.Query(ctx, currentUserID(ctx), offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Webhook{}
+	for _, item := range items {
+		result = append(result, Webhook{item})
+	}
+	return result, nil
+}
+
+// Create creates a new active webhook owned by the current user.
+func (s service) Create(ctx context.Context, req CreateWebhookRequest) (CreatedWebhook, error) {
+	if err := req.Validate(); err != nil {
+		return CreatedWebhook{}, err
+	}
+	if err := s.checkURL(ctx, req.URL); err != nil {
+		return CreatedWebhook{}, err
+	}
+	secret := req.Secret
+	if secret == "" {
+		var err error
+		if secret, err = generateSecret(); err != nil {
+			return CreatedWebhook{}, err
+		}
+	}
+	now := time.Now()
+	webhook := entity.Webhook{
+		ID:        entity.GenerateID(),
+		URL:       req.URL,
+		Events:    entity.WebhookEvents(req.Events),
+		Secret:    secret,
+		Active:    true,
+		OwnerID:   currentUserID(ctx),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.Create(ctx, webhook); err != nil {
+		return CreatedWebhook{}, err
+	}
+	return CreatedWebhook{Webhook{webhook}, secret}, nil
+}
+
+// checkURL returns a validation error if the given webhook URL does not point to the public internet.
+func (s service) checkURL(ctx context.Context, rawURL string) error {
+	if err := checkPublicURL(ctx, s.resolver, rawURL); err != nil {
+		return validation.Errors{"url": err}
+	}
+	return nil
+}
+
+// generateSecret returns a random secret for signing deliveries.
+func generateSecret() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// Update updates the webhook with the specified ID if the current user owns it.
+func (s service) Update(ctx context.Context, id string, req UpdateWebhookRequest) (Webhook, error) {
+	if err := req.Validate(); err != nil {
+		return Webhook{}, err
+	}
+	webhook, err := s.getOwned(ctx, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if err := s.checkURL(ctx, req.URL); err != nil {
+		return Webhook{}, err
+	}
+	webhook.URL = req.URL
+	webhook.Events = entity.WebhookEvents(req.Events)
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+	webhook.UpdatedAt = time.Now()
+	if err := s.repo.Update(ctx, webhook); err != nil {
+		return Webhook{}, err
+	}
+	return Webhook{webhook}, nil
+}
+
+// Delete deletes the webhook with the specified ID, along with its deliveries, if the current user owns it.
+func (s service) Delete(ctx context.Context, id string) (Webhook, error) {
+	webhook, err := s.getOwned(ctx, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if err = s.repo.Delete(ctx, id); err != nil {
+		return Webhook{}, err
+	}
+	return Webhook{webhook}, nil
+}
+
+// CountDeliveries returns the number of deliveries of the webhook with the specified ID if the current user owns it.
+func (s service) CountDeliveries(ctx context.Context, id string) (int, error) {
+	if _, err := s.getOwned(ctx, id); err != nil {
+		return 0, err
+	}
+	return s.repo.CountDeliveries(ctx, id)
+}
+
+// QueryDeliveries returns the deliveries of the webhook with the specified ID, latest first, with the specified
+// offset and limit, if the current user owns it.
+func (s service) QueryDeliveries(ctx context.Context, id string, offset, limit int) ([]Delivery, error) {
+	if _, err := s.getOwned(ctx, id); err != nil {
+		return nil, err
+	}
+	items, err := s.repo.QueryDeliveries(ctx, id, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Delivery{}
+	for _, item := range items {
+		result = append(result, Delivery{item})
+	}
+	return result, nil
+}
+
+// GetDelivery returns a delivery of the webhook with the specified ID along with its attempts, if the current user
+// owns the webhook.
+func (s service) GetDelivery(ctx context.Context, id, deliveryID string) (DeliveryDetails, error) {
+	if _, err := s.getOwned(ctx, id); err != nil {
+		return DeliveryDetails{}, err
+	}
+	delivery, err := s.repo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return DeliveryDetails{}, err
+	}
+	if delivery.WebhookID != id {
+		return DeliveryDetails{}, sql.ErrNoRows
+	}
+	attempts, err := s.repo.QueryAttempts(ctx, deliveryID)
+	if err != nil {
+		return DeliveryDetails{}, err
+	}
+	if attempts == nil {
+		attempts = []entity.WebhookAttempt{}
+	}
+	return DeliveryDetails{Delivery{delivery}, attempts}, nil
+}
+
+// CharactersChanged schedules the delivery of the given revisions to the active webhooks subscribed to their events.
+// It runs in the transaction recording the revisions, so that the deliveries are only scheduled for saved changes.
+func (s service) CharactersChanged(ctx context.Context, revisions []entity.CharacterRevision) error {
+	webhooks, err := s.repo.QueryActive(ctx)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+	now := time.Now()
+	var deliveries []entity.WebhookDelivery
+	for _, revision := range revisions {
+		event := eventOf(revision)
+		var payload []byte
+		for _, webhook := range webhooks {
+			if !subscribed(webhook, event) {
+				continue
+			}
+			if payload == nil {
+				if payload, err = newPayload(event, revision); err != nil {
+					return err
+				}
+			}
+			deliveries = append(deliveries, entity.WebhookDelivery{
+				ID:            entity.GenerateID(),
+				WebhookID:     webhook.ID,
+				Event:         event,
+				Payload:       payload,
+				Status:        entity.DeliveryPending,
+				NextAttemptAt: &now,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			})
+		}
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return s.repo.CreateDeliveries(ctx, deliveries)
+}
+
+// eventOf returns the webhook event of a revision. Restored characters are reported as created, since they were
+// reported as deleted when they were moved to the trash.
+func eventOf(revision entity.CharacterRevision) string {
+	switch {
+	case revision.After == nil:
+		return entity.EventCharacterDeleted
+	case revision.Before == nil:
+		return entity.EventCharacterCreated
+	}
+	return entity.EventCharacterUpdated
+}
+
+// subscribed tells whether the given webhook is subscribed to the given event.
+func subscribed(webhook entity.Webhook, event string) bool {
+	for _, e := range webhook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// newPayload returns the JSON document sent to webhooks for the given event of a revision.
+func newPayload(event string, revision entity.CharacterRevision) ([]byte, error) {
+	payload := Payload{
+		ID:        revision.ID,
+		Event:     event,
+		CreatedAt: revision.CreatedAt,
+		Data: PayloadData{
+			Character: revision.After,
+			Action:    revision.Action,
+			Revision:  revision.Revision,
+			UserID:    revision.UserID,
+		},
+	}
+	switch event {
+	case entity.EventCharacterDeleted:
+		payload.Data.Character = revision.Before
+	case entity.EventCharacterUpdated:
+		payload.Data.Previous = revision.Before
+	}
+	return json.Marshal(payload)
+}
+
+// currentUserID returns the ID of the current user, or an empty string if there is none.
+func currentUserID(ctx context.Context) string {
+	if user := auth.CurrentUser(ctx); user != nil {
+		return user.GetID()
+	}
+	return ""
+}
@@ -0,0 +1,377 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hikvineh/go-rest-game-character/internal/auth"
+	"github.com/hikvineh/go-rest-game-character/internal/entity"
+	"github.com/hikvineh/go-rest-game-character/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var errCRUD = errors.New("error crud")
+
+func TestCreateWebhookRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     CreateWebhookRequest
+		wantError bool
+	}{
+		{"success", CreateWebhookRequest{URL: "https://example.com/hook", Events: []string{"character.created"}}, false},
+		{"secret", CreateWebhookRequest{URL: "http://example.com", Events: []string{"character.deleted"}, Secret: "0123456789abcdef"}, false},
+		{"short secret", CreateWebhookRequest{URL: "http://example.com", Events: []string{"character.deleted"}, Secret: "secret"}, true},
+		{"url required", CreateWebhookRequest{Events: []string{"character.created"}}, true},
+		{"relative url", CreateWebhookRequest{URL: "/hook", Events: []string{"character.created"}}, true},
+		{"other scheme", CreateWebhookRequest{URL: "ftp://example.com", Events: []string{"character.created"}}, true},
+		{"events required", CreateWebhookRequest{URL: "https://example.com/hook"}, true},
+		{"unknown event", CreateWebhookRequest{URL: "https://example.com/hook", Events: []string{"character.renamed"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func TestUpdateWebhookRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     UpdateWebhookRequest
+		wantError bool
+	}{
+		{"success", UpdateWebhookRequest{URL: "https://example.com/hook", Events: []string{"character.updated"}}, false},
+		{"url required", UpdateWebhookRequest{Events: []string{"character.updated"}}, true},
+		{"events required", UpdateWebhookRequest{URL: "https://example.com/hook"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_CRUD(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(&mockRepository{}, mockResolver{}, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	// initial count
+	count, _ := s.Count(ctx)
+	assert.Equal(t, 0, count)
+
+	// successful creation
+	created, err := s.Create(ctx, CreateWebhookRequest{URL: "https://example.com/hook", Events: []string{"character.created"}})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, created.ID)
+	assert.Len(t, created.Secret, 64)
+	assert.Equal(t, created.Secret, created.Webhook.Secret)
+	assert.True(t, created.Active)
+	assert.Equal(t, "100", created.OwnerID)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 1, count)
+	chosen, err := s.Create(ctx, CreateWebhookRequest{URL: "https://example.com/other", Events: []string{"character.deleted"}, Secret: "0123456789abcdef"})
+	assert.Nil(t, err)
+	assert.Equal(t, "0123456789abcdef", chosen.Secret)
+
+	// validation error in creation
+	_, err = s.Create(ctx, CreateWebhookRequest{URL: "example.com", Events: []string{"character.created"}})
+	assert.NotNil(t, err)
+
+	// unexpected error in creation
+	_, err = s.Create(ctx, CreateWebhookRequest{URL: "https://example.com/error", Events: []string{"character.created"}})
+	assert.Equal(t, errCRUD, err)
+
+	// non-public hosts in creation
+	for _, url := range []string{
+		"http://localhost:8000/hook",
+		"http://127.0.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://[::ffff:10.0.0.1]/hook",
+		"https://internal.example.com/hook",
+		"https://unknown.example.com/hook",
+	} {
+		_, err = s.Create(ctx, CreateWebhookRequest{URL: url, Events: []string{"character.created"}})
+		if assert.NotNil(t, err, url) {
+			assert.Contains(t, err.Error(), "url: ", url)
+		}
+	}
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 2, count)
+
+	// update
+	inactive := false
+	webhook, err := s.Update(ctx, created.ID, UpdateWebhookRequest{URL: "https://example.com/updated", Events: []string{"character.updated"}, Active: &inactive})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/updated", webhook.URL)
+	assert.Equal(t, entity.WebhookEvents{"character.updated"}, webhook.Events)
+	assert.False(t, webhook.Active)
+	webhook, _ = s.Update(ctx, created.ID, UpdateWebhookRequest{URL: "https://example.com/updated", Events: []string{"character.created"}})
+	assert.False(t, webhook.Active)
+	_, err = s.Update(ctx, created.ID, UpdateWebhookRequest{URL: "http://192.168.1.1/hook", Events: []string{"character.created"}})
+	assert.NotNil(t, err)
+	webhook, _ = s.Get(ctx, created.ID)
+	assert.Equal(t, "https://example.com/updated", webhook.URL)
+	_, err = s.Update(ctx, "none", UpdateWebhookRequest{URL: "https://example.com/updated", Events: []string{"character.created"}})
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// get
+	_, err = s.Get(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+	webhook, err = s.Get(ctx, created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, created.Secret, webhook.Secret)
+
+	// query
+	webhooks, _ := s.Query(ctx, 0, 0)
+	assert.Equal(t, 2, len(webhooks))
+
+	// the webhooks of other users are hidden
+	other := auth.WithUser(context.Background(), "200", "Other")
+	_, err = s.Get(other, created.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Update(other, created.ID, UpdateWebhookRequest{URL: "https://evil.example.com", Events: []string{"character.created"}})
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Delete(other, created.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.QueryDeliveries(other, created.ID, 0, 10)
+	assert.Equal(t, sql.ErrNoRows, err)
+	count, _ = s.Count(other)
+	assert.Equal(t, 0, count)
+
+	// delete
+	_, err = s.Delete(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+	webhook, err = s.Delete(ctx, created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, created.ID, webhook.ID)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 1, count)
+}
+
+func Test_service_CharactersChanged(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, mockResolver{}, logger)
+	ctx := auth.WithUser(context.Background(), "100", "Tester")
+
+	all, _ := s.Create(ctx, CreateWebhookRequest{URL: "https://example.com/all", Events: []string{"character.created", "character.updated", "character.deleted"}})
+	deleted, _ := s.Create(ctx, CreateWebhookRequest{URL: "https://example.com/deleted", Events: []string{"character.deleted"}})
+	inactive, _ := s.Create(ctx, CreateWebhookRequest{URL: "https://example.com/inactive", Events: []string{"character.created"}})
+	off := false
+	_, _ = s.Update(ctx, inactive.ID, UpdateWebhookRequest{URL: inactive.URL, Events: inactive.Events, Active: &off})
+
+	frodo := entity.CharacterSnapshot{ID: "frodo", Name: "Frodo", CharacterCode: 3, CharacterPower: 10, Version: 1}
+	renamed := frodo
+	renamed.Name, renamed.Version = "Mr. Underhill", 2
+	now := time.Now()
+	assert.Nil(t, s.CharactersChanged(ctx, []entity.CharacterRevision{
+		{ID: "r1", CharacterID: "frodo", Revision: 1, Action: entity.ActionCreate, After: &frodo, UserID: "100", CreatedAt: now},
+		{ID: "r2", CharacterID: "frodo", Revision: 2, Action: entity.ActionUpdate, Before: &frodo, After: &renamed, UserID: "100", CreatedAt: now},
+		{ID: "r3", CharacterID: "frodo", Revision: 3, Action: entity.ActionDelete, Before: &renamed, UserID: "100", CreatedAt: now},
+		{ID: "r4", CharacterID: "frodo", Revision: 4, Action: entity.ActionRestore, After: &renamed, UserID: "100", CreatedAt: now},
+	}))
+
+	deliveries, _ := s.QueryDeliveries(ctx, all.ID, 0, 10)
+	if assert.Len(t, deliveries, 4) {
+		var events []string
+		for _, delivery := range deliveries {
+			events = append(events, delivery.Event)
+			assert.Equal(t, entity.DeliveryPending, delivery.Status)
+			assert.NotNil(t, delivery.NextAttemptAt)
+		}
+		sort.Strings(events)
+		assert.Equal(t, []string{"character.created", "character.created", "character.deleted", "character.updated"}, events)
+	}
+	deliveries, _ = s.QueryDeliveries(ctx, deleted.ID, 0, 10)
+	if assert.Len(t, deliveries, 1) {
+		var payload Payload
+		assert.Nil(t, json.Unmarshal(deliveries[0].Payload, &payload))
+		assert.Equal(t, "r3", payload.ID)
+		assert.Equal(t, "character.deleted", payload.Event)
+		assert.Equal(t, "Mr. Underhill", payload.Data.Character.Name)
+		assert.Nil(t, payload.Data.Previous)
+		assert.Equal(t, int64(3), payload.Data.Revision)
+	}
+	count, _ := s.CountDeliveries(ctx, inactive.ID)
+	assert.Equal(t, 0, count)
+
+	// the update carries the previous character
+	for _, delivery := range repo.deliveries {
+		if delivery.Event == entity.EventCharacterUpdated {
+			var payload Payload
+			assert.Nil(t, json.Unmarshal(delivery.Payload, &payload))
+			assert.Equal(t, "Mr. Underhill", payload.Data.Character.Name)
+			assert.Equal(t, "Frodo", payload.Data.Previous.Name)
+			assert.Equal(t, entity.ActionUpdate, payload.Data.Action)
+
+			details, err := s.GetDelivery(ctx, all.ID, delivery.ID)
+			assert.Nil(t, err)
+			assert.Equal(t, []entity.WebhookAttempt{}, details.AttemptLog)
+			_, err = s.GetDelivery(ctx, deleted.ID, delivery.ID)
+			assert.Equal(t, sql.ErrNoRows, err)
+		}
+	}
+
+	// no delivery without webhooks
+	repo = &mockRepository{}
+	assert.Nil(t, NewService(repo, mockResolver{}, logger).CharactersChanged(ctx, []entity.CharacterRevision{{ID: "r1", After: &frodo}}))
+	assert.Empty(t, repo.deliveries)
+}
+
+// mockResolver resolves internal.example.com to a private address, fails to resolve unknown.example.com, and
+// resolves any other host to a public address.
+type mockResolver struct{}
+
+func (mockResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	switch host {
+	case "internal.example.com":
+		return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}, {IP: net.ParseIP("10.0.0.1")}}, nil
+	case "unknown.example.com":
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}}, nil
+}
+
+type mockRepository struct {
+	items      []entity.Webhook
+	deliveries []entity.WebhookDelivery
+	attempts   []entity.WebhookAttempt
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.Webhook, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.Webhook{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context, ownerID string) (int, error) {
+	items, _ := m.Query(ctx, ownerID, 0, 0)
+	return len(items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, ownerID string, offset, limit int) ([]entity.Webhook, error) {
+	var items []entity.Webhook
+	for _, item := range m.items {
+		if item.OwnerID == ownerID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m mockRepository) QueryActive(ctx context.Context) ([]entity.Webhook, error) {
+	var items []entity.Webhook
+	for _, item := range m.items {
+		if item.Active {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, webhook entity.Webhook) error {
+	if webhook.URL == "https://example.com/error" {
+		return errCRUD
+	}
+	m.items = append(m.items, webhook)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, webhook entity.Webhook) error {
+	for i, item := range m.items {
+		if item.ID == webhook.ID {
+			m.items[i] = webhook
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items[i] = m.items[len(m.items)-1]
+			m.items = m.items[:len(m.items)-1]
+			break
+		}
+	}
+	return nil
+}
+
+func (m mockRepository) GetDelivery(ctx context.Context, id string) (entity.WebhookDelivery, error) {
+	for _, delivery := range m.deliveries {
+		if delivery.ID == id {
+			return delivery, nil
+		}
+	}
+	return entity.WebhookDelivery{}, sql.ErrNoRows
+}
+
+func (m mockRepository) CountDeliveries(ctx context.Context, webhookID string) (int, error) {
+	deliveries, _ := m.QueryDeliveries(ctx, webhookID, 0, 0)
+	return len(deliveries), nil
+}
+
+func (m mockRepository) QueryDeliveries(ctx context.Context, webhookID string, offset, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *mockRepository) CreateDeliveries(ctx context.Context, deliveries []entity.WebhookDelivery) error {
+	m.deliveries = append(m.deliveries, deliveries...)
+	return nil
+}
+
+func (m *mockRepository) ClaimDeliveries(ctx context.Context, now, lease time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	for i, delivery := range m.deliveries {
+		if delivery.Status == entity.DeliveryPending && !delivery.NextAttemptAt.After(now) && len(deliveries) < limit {
+			m.deliveries[i].NextAttemptAt = &lease
+			deliveries = append(deliveries, m.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *mockRepository) UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	for i, item := range m.deliveries {
+		if item.ID == delivery.ID {
+			m.deliveries[i] = delivery
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) CreateAttempt(ctx context.Context, attempt entity.WebhookAttempt) error {
+	m.attempts = append(m.attempts, attempt)
+	return nil
+}
+
+func (m mockRepository) QueryAttempts(ctx context.Context, deliveryID string) ([]entity.WebhookAttempt, error) {
+	var attempts []entity.WebhookAttempt
+	for _, attempt := range m.attempts {
+		if attempt.DeliveryID == deliveryID {
+			attempts = append(attempts, attempt)
+		}
+	}
+	return attempts, nil
+}
@@ -0,0 +1 @@
+ALTER TABLE character_type DROP COLUMN retired;
@@ -0,0 +1 @@
+ALTER TABLE character_type ADD COLUMN retired boolean NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+ALTER TABLE character DROP COLUMN formula_version;
+ALTER TABLE character_type DROP COLUMN formula_version;
+ALTER TABLE character_type DROP COLUMN formula;
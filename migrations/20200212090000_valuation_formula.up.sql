@@ -0,0 +1,3 @@
+ALTER TABLE character_type ADD COLUMN formula VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE character_type ADD COLUMN formula_version bigint NOT NULL DEFAULT 0;
+ALTER TABLE character ADD COLUMN formula_version bigint NOT NULL DEFAULT 0;
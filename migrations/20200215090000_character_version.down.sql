@@ -0,0 +1 @@
+ALTER TABLE character DROP COLUMN version;
@@ -0,0 +1 @@
+ALTER TABLE character ADD COLUMN version bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_character_deleted_at;
+ALTER TABLE character DROP COLUMN deleted_at;
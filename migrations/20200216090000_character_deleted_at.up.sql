@@ -0,0 +1,2 @@
+ALTER TABLE character ADD COLUMN deleted_at TIMESTAMP NULL;
+CREATE INDEX idx_character_deleted_at ON character (deleted_at) WHERE deleted_at IS NOT NULL;
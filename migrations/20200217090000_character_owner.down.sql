@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_character_owner_id;
+ALTER TABLE character DROP COLUMN owner_id;
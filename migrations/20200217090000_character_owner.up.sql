@@ -0,0 +1,2 @@
+ALTER TABLE character ADD COLUMN owner_id VARCHAR NOT NULL DEFAULT '';
+CREATE INDEX idx_character_owner_id ON character (owner_id);
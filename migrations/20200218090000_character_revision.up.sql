@@ -0,0 +1,15 @@
+CREATE TABLE character_revision
+(
+    id                      VARCHAR PRIMARY KEY,
+    character_id            VARCHAR NOT NULL,
+    revision                bigint NOT NULL,
+    action                  VARCHAR NOT NULL,
+    before                  JSONB NULL,
+    after                   JSONB NULL,
+    user_id                 VARCHAR NOT NULL DEFAULT '',
+    user_name               VARCHAR NOT NULL DEFAULT '',
+    request_id              VARCHAR NOT NULL DEFAULT '',
+    created_at              TIMESTAMP NOT NULL,
+
+    CONSTRAINT uq_character_revision UNIQUE (character_id, revision)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE character DROP COLUMN level;
+ALTER TABLE character DROP COLUMN experience;
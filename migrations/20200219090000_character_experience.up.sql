@@ -0,0 +1,2 @@
+ALTER TABLE character ADD COLUMN experience BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE character ADD COLUMN level BIGINT NOT NULL DEFAULT 1;
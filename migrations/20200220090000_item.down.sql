@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS inventory_item;
+DROP TABLE IF EXISTS item;
+ALTER TABLE character DROP COLUMN effective_power;
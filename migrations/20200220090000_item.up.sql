@@ -0,0 +1,26 @@
+ALTER TABLE character ADD COLUMN effective_power BIGINT NOT NULL DEFAULT 0;
+UPDATE character SET effective_power = character_power;
+
+CREATE TABLE item
+(
+    id                      VARCHAR PRIMARY KEY,
+    name                    VARCHAR NOT NULL,
+    slot                    VARCHAR NOT NULL DEFAULT '',
+    power_bonus             BIGINT NOT NULL DEFAULT 0,
+    power_percent           BIGINT NOT NULL DEFAULT 0,
+    created_at              TIMESTAMP NOT NULL,
+    updated_at              TIMESTAMP NOT NULL
+);
+
+CREATE TABLE inventory_item
+(
+    character_id            VARCHAR NOT NULL REFERENCES character(id) ON DELETE CASCADE,
+    item_id                 VARCHAR NOT NULL REFERENCES item(id) ON DELETE CASCADE,
+    quantity                BIGINT NOT NULL CHECK (quantity > 0),
+    equipped                BOOLEAN NOT NULL DEFAULT false,
+    created_at              TIMESTAMP NOT NULL,
+    updated_at              TIMESTAMP NOT NULL,
+
+    PRIMARY KEY (character_id, item_id)
+);
+CREATE INDEX idx_inventory_item_item_id ON inventory_item (item_id);
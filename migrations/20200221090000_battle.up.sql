@@ -0,0 +1,17 @@
+CREATE TABLE battle
+(
+    id                      VARCHAR PRIMARY KEY,
+    attacker_id             VARCHAR NOT NULL,
+    defender_id             VARCHAR NOT NULL,
+    seed                    BIGINT NOT NULL,
+    winner_id               VARCHAR NOT NULL DEFAULT '',
+    attacker                JSONB NOT NULL,
+    defender                JSONB NOT NULL,
+    attacker_hp             BIGINT NOT NULL,
+    defender_hp             BIGINT NOT NULL,
+    rounds                  JSONB NOT NULL,
+    user_id                 VARCHAR NOT NULL DEFAULT '',
+    created_at              TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_battle_attacker_id ON battle (attacker_id);
+CREATE INDEX idx_battle_defender_id ON battle (defender_id);
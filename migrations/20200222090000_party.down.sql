@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS party_member;
+DROP TABLE IF EXISTS party;
@@ -0,0 +1,17 @@
+CREATE TABLE party
+(
+    id                      VARCHAR PRIMARY KEY,
+    name                    VARCHAR NOT NULL,
+    owner_id                VARCHAR NOT NULL DEFAULT '',
+    created_at              TIMESTAMP NOT NULL,
+    updated_at              TIMESTAMP NOT NULL
+);
+
+-- a character belongs to at most one party
+CREATE TABLE party_member
+(
+    character_id            VARCHAR PRIMARY KEY REFERENCES character(id) ON DELETE CASCADE,
+    party_id                VARCHAR NOT NULL REFERENCES party(id) ON DELETE CASCADE,
+    created_at              TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_party_member_party_id ON party_member (party_id);
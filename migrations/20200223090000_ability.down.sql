@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS character_ability;
+DROP TABLE IF EXISTS ability;
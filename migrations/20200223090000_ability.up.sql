@@ -0,0 +1,24 @@
+CREATE TABLE ability
+(
+    id                      VARCHAR PRIMARY KEY,
+    name                    VARCHAR NOT NULL,
+    character_code          BIGINT NOT NULL,
+    min_level               BIGINT NOT NULL DEFAULT 1,
+    prerequisite_id         VARCHAR NOT NULL DEFAULT '',
+    power_bonus             BIGINT NOT NULL DEFAULT 0,
+    power_percent           BIGINT NOT NULL DEFAULT 0,
+    created_at              TIMESTAMP NOT NULL,
+    updated_at              TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_ability_character_code ON ability (character_code);
+CREATE INDEX idx_ability_prerequisite_id ON ability (prerequisite_id);
+
+CREATE TABLE character_ability
+(
+    character_id            VARCHAR NOT NULL REFERENCES character(id) ON DELETE CASCADE,
+    ability_id              VARCHAR NOT NULL REFERENCES ability(id) ON DELETE CASCADE,
+    created_at              TIMESTAMP NOT NULL,
+
+    PRIMARY KEY (character_id, ability_id)
+);
+CREATE INDEX idx_character_ability_ability_id ON character_ability (ability_id);
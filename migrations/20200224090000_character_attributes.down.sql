@@ -0,0 +1,2 @@
+ALTER TABLE character_type DROP COLUMN IF EXISTS attribute_schema;
+ALTER TABLE character DROP COLUMN IF EXISTS attributes;
@@ -0,0 +1,5 @@
+ALTER TABLE character ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE character_type ADD COLUMN attribute_schema JSONB NOT NULL DEFAULT '{}';
+
+UPDATE character_type SET attribute_schema = '{"properties":{"mana":{"type":"integer","minimum":0}}}' WHERE character_code = 1;
+UPDATE character_type SET attribute_schema = '{"properties":{"agility":{"type":"integer","minimum":0,"maximum":100}}}' WHERE character_code = 2;
@@ -0,0 +1,15 @@
+-- the responses of POST requests made with an Idempotency-Key header, scoped to the user who made them;
+-- a status of 0 marks a request that is still being processed
+CREATE TABLE idempotency_key
+(
+    user_id                 VARCHAR NOT NULL,
+    key                     VARCHAR NOT NULL,
+    fingerprint             VARCHAR NOT NULL,
+    status                  INT NOT NULL DEFAULT 0,
+    header                  JSONB NOT NULL DEFAULT '{}',
+    body                    BYTEA NOT NULL DEFAULT '',
+    created_at              TIMESTAMP NOT NULL,
+    expires_at              TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+CREATE INDEX idx_idempotency_key_expires_at ON idempotency_key (expires_at);
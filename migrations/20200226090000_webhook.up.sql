@@ -0,0 +1,40 @@
+CREATE TABLE webhook
+(
+    id                      VARCHAR PRIMARY KEY,
+    url                     VARCHAR NOT NULL,
+    events                  JSONB NOT NULL DEFAULT '[]',
+    secret                  VARCHAR NOT NULL,
+    active                  BOOLEAN NOT NULL DEFAULT TRUE,
+    owner_id                VARCHAR NOT NULL DEFAULT '',
+    created_at              TIMESTAMP NOT NULL,
+    updated_at              TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_webhook_owner_id ON webhook (owner_id);
+
+-- the payloads of the events sent to webhooks; next_attempt_at is null once the delivery succeeded or failed for good
+CREATE TABLE webhook_delivery
+(
+    id                      VARCHAR PRIMARY KEY,
+    webhook_id              VARCHAR NOT NULL REFERENCES webhook(id) ON DELETE CASCADE,
+    event                   VARCHAR NOT NULL,
+    payload                 TEXT NOT NULL,
+    status                  VARCHAR NOT NULL,
+    attempts                INT NOT NULL DEFAULT 0,
+    next_attempt_at         TIMESTAMP,
+    created_at              TIMESTAMP NOT NULL,
+    updated_at              TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_webhook_delivery_webhook_id ON webhook_delivery (webhook_id, created_at);
+CREATE INDEX idx_webhook_delivery_next_attempt_at ON webhook_delivery (next_attempt_at) WHERE status = 'pending';
+
+CREATE TABLE webhook_attempt
+(
+    id                      VARCHAR PRIMARY KEY,
+    delivery_id             VARCHAR NOT NULL REFERENCES webhook_delivery(id) ON DELETE CASCADE,
+    attempt                 INT NOT NULL,
+    status_code             INT NOT NULL DEFAULT 0,
+    error                   VARCHAR NOT NULL DEFAULT '',
+    duration                BIGINT NOT NULL,
+    created_at              TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_webhook_attempt_delivery_id ON webhook_attempt (delivery_id);
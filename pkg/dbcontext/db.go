@@ -4,6 +4,8 @@ package dbcontext
 
 import (
 	"context"
+	"fmt"
+	"sync/atomic"
 
 	dbx "github.com/go-ozzo/ozzo-dbx"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
@@ -45,12 +47,43 @@ func (db *DB) With(ctx context.Context) dbx.Builder {
 
 // Transactional starts a transaction and calls the given function with a context storing the transaction.
 // The transaction associated with the context can be accesse via With().
+// If the given context already stores a transaction, the function runs within a savepoint of that transaction
+// instead, so that its failure only rolls back its own changes and leaves the enclosing transaction usable.
 func (db *DB) Transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	if tx, ok := ctx.Value(txKey).(*dbx.Tx); ok {
+		return savepoint(ctx, tx, f)
+	}
 	return db.db.TransactionalContext(ctx, nil, func(tx *dbx.Tx) error {
 		return f(context.WithValue(ctx, txKey, tx))
 	})
 }
 
+// savepointID is used to generate unique savepoint names.
+var savepointID uint64
+
+// savepoint calls the given function within a savepoint of the given transaction.
+// The savepoint is released if the function succeeds and rolled back if it fails or panics.
+func savepoint(ctx context.Context, tx *dbx.Tx, f func(ctx context.Context) error) (err error) {
+	name := fmt.Sprintf("sp_%v", atomic.AddUint64(&savepointID, 1))
+	if _, err = tx.NewQuery("SAVEPOINT " + name).WithContext(ctx).Execute(); err != nil {
+		return err
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			_, _ = tx.NewQuery("ROLLBACK TO SAVEPOINT " + name).Execute()
+			panic(e)
+		}
+	}()
+	if err = f(ctx); err != nil {
+		if _, e := tx.NewQuery("ROLLBACK TO SAVEPOINT " + name).WithContext(ctx).Execute(); e != nil {
+			return e
+		}
+		return err
+	}
+	_, err = tx.NewQuery("RELEASE SAVEPOINT " + name).WithContext(ctx).Execute()
+	return err
+}
+
 // TransactionHandler returns a middleware that starts a transaction.
 // The transaction started is kept in the context and can be accessed via With().
 func (db *DB) TransactionHandler() routing.Handler {
@@ -63,6 +63,47 @@ func TestDB_Transactional(t *testing.T) {
 	})
 }
 
+func TestDB_Transactional_nested(t *testing.T) {
+	runDBTest(t, func(db *dbx.DB) {
+		assert.Zero(t, runCountQuery(t, db))
+		dbc := New(db)
+
+		// a failed nested transaction only rolls back its own changes
+		err := dbc.Transactional(context.Background(), func(ctx context.Context) error {
+			_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "1", "name": "name1"}).Execute()
+			assert.Nil(t, err)
+			err = dbc.Transactional(ctx, func(ctx context.Context) error {
+				_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "2", "name": "name2"}).Execute()
+				assert.Nil(t, err)
+				// fails because of the duplicate key, which would abort the whole transaction without a savepoint
+				_, err = dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "1", "name": "name1"}).Execute()
+				return err
+			})
+			assert.NotNil(t, err)
+			err = dbc.Transactional(ctx, func(ctx context.Context) error {
+				_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "3", "name": "name3"}).Execute()
+				return err
+			})
+			assert.Nil(t, err)
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, runCountQuery(t, db))
+
+		// a failed enclosing transaction rolls back the nested ones
+		err = dbc.Transactional(context.Background(), func(ctx context.Context) error {
+			err := dbc.Transactional(ctx, func(ctx context.Context) error {
+				_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "4", "name": "name4"}).Execute()
+				return err
+			})
+			assert.Nil(t, err)
+			return sql.ErrNoRows
+		})
+		assert.Equal(t, sql.ErrNoRows, err)
+		assert.Equal(t, 2, runCountQuery(t, db))
+	})
+}
+
 func TestDB_TransactionHandler(t *testing.T) {
 	runDBTest(t, func(db *dbx.DB) {
 		assert.Zero(t, runCountQuery(t, db))
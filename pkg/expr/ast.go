@@ -0,0 +1,251 @@
+package expr
+
+import (
+	"math/big"
+)
+
+// kind is the static type of an expression node.
+type kind int
+
+const (
+	kindNumber kind = iota
+	kindBool
+)
+
+func (k kind) String() string {
+	if k == kindBool {
+		return "boolean"
+	}
+	return "number"
+}
+
+// value is the result of evaluating a node. Only the field matching the node kind is meaningful.
+type value struct {
+	num  *big.Rat
+	bool bool
+}
+
+// node is an element of a parsed expression tree.
+type node interface {
+	// kind returns the static type of the node.
+	kind() kind
+	// eval evaluates the node using the given variable values.
+	eval(vars map[string]*big.Rat) (value, error)
+}
+
+type numberNode struct {
+	num *big.Rat
+}
+
+func (n numberNode) kind() kind {
+	return kindNumber
+}
+
+func (n numberNode) eval(vars map[string]*big.Rat) (value, error) {
+	return value{num: n.num}, nil
+}
+
+type variableNode struct {
+	name string
+}
+
+func (n variableNode) kind() kind {
+	return kindNumber
+}
+
+func (n variableNode) eval(vars map[string]*big.Rat) (value, error) {
+	v, ok := vars[n.name]
+	if !ok {
+		return value{}, &UndefinedVariableError{n.name}
+	}
+	return value{num: v}, nil
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n unaryNode) kind() kind {
+	if n.op == "!" {
+		return kindBool
+	}
+	return kindNumber
+}
+
+func (n unaryNode) eval(vars map[string]*big.Rat) (value, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return value{}, err
+	}
+	if n.op == "!" {
+		return value{bool: !v.bool}, nil
+	}
+	return value{num: new(big.Rat).Neg(v.num)}, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n binaryNode) kind() kind {
+	switch n.op {
+	case "+", "-", "*", "/", "%":
+		return kindNumber
+	}
+	return kindBool
+}
+
+func (n binaryNode) eval(vars map[string]*big.Rat) (value, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return value{}, err
+	}
+
+	// logical operators short-circuit
+	switch n.op {
+	case "&&":
+		if !left.bool {
+			return value{bool: false}, nil
+		}
+		return n.right.eval(vars)
+	case "||":
+		if left.bool {
+			return value{bool: true}, nil
+		}
+		return n.right.eval(vars)
+	}
+
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch n.op {
+	case "+":
+		return value{num: new(big.Rat).Add(left.num, right.num)}, nil
+	case "-":
+		return value{num: new(big.Rat).Sub(left.num, right.num)}, nil
+	case "*":
+		return value{num: new(big.Rat).Mul(left.num, right.num)}, nil
+	case "/":
+		if right.num.Sign() == 0 {
+			return value{}, ErrDivisionByZero
+		}
+		return value{num: new(big.Rat).Quo(left.num, right.num)}, nil
+	case "%":
+		if right.num.Sign() == 0 {
+			return value{}, ErrDivisionByZero
+		}
+		// a % b = a - b * trunc(a / b), so that the result has the sign of a as in Go
+		q := new(big.Rat).Quo(left.num, right.num)
+		q.SetInt(truncate(q))
+		return value{num: new(big.Rat).Sub(left.num, q.Mul(q, right.num))}, nil
+	case "==":
+		if n.left.kind() == kindBool {
+			return value{bool: left.bool == right.bool}, nil
+		}
+		return value{bool: left.num.Cmp(right.num) == 0}, nil
+	case "!=":
+		if n.left.kind() == kindBool {
+			return value{bool: left.bool != right.bool}, nil
+		}
+		return value{bool: left.num.Cmp(right.num) != 0}, nil
+	case "<":
+		return value{bool: left.num.Cmp(right.num) < 0}, nil
+	case "<=":
+		return value{bool: left.num.Cmp(right.num) <= 0}, nil
+	case ">":
+		return value{bool: left.num.Cmp(right.num) > 0}, nil
+	default: // ">="
+		return value{bool: left.num.Cmp(right.num) >= 0}, nil
+	}
+}
+
+type conditionalNode struct {
+	cond, then, otherwise node
+}
+
+func (n conditionalNode) kind() kind {
+	return n.then.kind()
+}
+
+func (n conditionalNode) eval(vars map[string]*big.Rat) (value, error) {
+	cond, err := n.cond.eval(vars)
+	if err != nil {
+		return value{}, err
+	}
+	if cond.bool {
+		return n.then.eval(vars)
+	}
+	return n.otherwise.eval(vars)
+}
+
+type callNode struct {
+	fn   function
+	args []node
+}
+
+func (n callNode) kind() kind {
+	return kindNumber
+}
+
+func (n callNode) eval(vars map[string]*big.Rat) (value, error) {
+	args := make([]*big.Rat, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return value{}, err
+		}
+		args[i] = v.num
+	}
+	return value{num: n.fn.call(args)}, nil
+}
+
+// function describes a built-in function that can be called from an expression.
+type function struct {
+	minArgs, maxArgs int
+	call             func(args []*big.Rat) *big.Rat
+}
+
+// functions lists the built-in functions. A maxArgs of -1 means the function is variadic.
+var functions = map[string]function{
+	"min": {1, -1, func(args []*big.Rat) *big.Rat {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) < 0 {
+				result = arg
+			}
+		}
+		return result
+	}},
+	"max": {1, -1, func(args []*big.Rat) *big.Rat {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) > 0 {
+				result = arg
+			}
+		}
+		return result
+	}},
+	"floor": {1, 1, func(args []*big.Rat) *big.Rat {
+		i := truncate(args[0])
+		if args[0].Sign() < 0 && !args[0].IsInt() {
+			i.Sub(i, big.NewInt(1))
+		}
+		return new(big.Rat).SetInt(i)
+	}},
+	"ceil": {1, 1, func(args []*big.Rat) *big.Rat {
+		i := truncate(args[0])
+		if args[0].Sign() > 0 && !args[0].IsInt() {
+			i.Add(i, big.NewInt(1))
+		}
+		return new(big.Rat).SetInt(i)
+	}},
+}
+
+// truncate returns the integer part of r, rounding toward zero.
+func truncate(r *big.Rat) *big.Int {
+	return new(big.Int).Quo(r.Num(), r.Denom())
+}
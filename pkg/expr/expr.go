@@ -0,0 +1,117 @@
+// Package expr provides a small and safe expression language for numeric formulas, such as "power * 1.5"
+// or "power < 20 ? power * 2 : power * 3".
+//
+// Expressions support decimal numbers, the variables declared when parsing, the arithmetic operators + - * / %,
+// the comparison operators < <= > >= == !=, the logical operators && || !, the conditional operator ?:,
+// parentheses and the functions min, max, floor and ceil. Arithmetic is exact: it is carried out on rational
+// numbers and only truncated when an integer result is requested. Expressions are type checked when parsed,
+// cannot loop and cannot access anything besides the given variables.
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	// MaxLength specifies the maximum length of the source of an expression
+	MaxLength = 1024
+	// MaxDepth specifies the maximum nesting depth of an expression
+	MaxDepth = 64
+)
+
+var (
+	// ErrDivisionByZero is returned when an expression divides by zero.
+	ErrDivisionByZero = errors.New("division by zero")
+	// ErrOverflow is returned when the result of an expression does not fit into an int64.
+	ErrOverflow = errors.New("result overflows")
+)
+
+// SyntaxError describes a problem found while parsing an expression.
+type SyntaxError struct {
+	// Pos is the byte offset in the source where the problem is found.
+	Pos int
+	// Msg describes the problem.
+	Msg string
+}
+
+// Error is required by the error interface.
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%v at position %v", e.Msg, e.Pos)
+}
+
+// UndefinedVariableError is returned when an expression is evaluated without a value for one of its variables.
+type UndefinedVariableError struct {
+	Name string
+}
+
+// Error is required by the error interface.
+func (e *UndefinedVariableError) Error() string {
+	return fmt.Sprintf("variable %q is undefined", e.Name)
+}
+
+// Expression represents a parsed expression.
+type Expression struct {
+	src  string
+	root node
+}
+
+// Parse parses the source of an expression which may refer to the given variables.
+// The expression must evaluate to a number.
+func Parse(src string, variables ...string) (*Expression, error) {
+	if len(src) > MaxLength {
+		return nil, &SyntaxError{MaxLength, fmt.Sprintf("expression is longer than %v characters", MaxLength)}
+	}
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, variables: map[string]bool{}}
+	for _, name := range variables {
+		p.variables[name] = true
+	}
+	root, err := p.parseConditional()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, p.unexpected("operator expected")
+	}
+	if err := checkKind(root, kindNumber, 0); err != nil {
+		return nil, err
+	}
+	return &Expression{src, root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression using the given variable values and returns the exact result.
+func (e *Expression) Eval(vars map[string]int64) (*big.Rat, error) {
+	values := make(map[string]*big.Rat, len(vars))
+	for name, v := range vars {
+		values[name] = new(big.Rat).SetInt64(v)
+	}
+	result, err := e.root.eval(values)
+	if err != nil {
+		return nil, err
+	}
+	return result.num, nil
+}
+
+// Int evaluates the expression using the given variable values and returns the result truncated toward zero.
+// ErrOverflow is returned if the result does not fit into an int64.
+func (e *Expression) Int(vars map[string]int64) (int64, error) {
+	result, err := e.Eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	i := truncate(result)
+	if !i.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return i.Int64(), nil
+}
@@ -0,0 +1,127 @@
+package expr
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		wantError bool
+	}{
+		{"number", "42", false},
+		{"decimal", "1.5", false},
+		{"variable", "power", false},
+		{"arithmetic", "power * 1.5 + 2", false},
+		{"conditional", "power < 20 ? power*2 : power*3", false},
+		{"nested conditional", "power < 10 ? 1 : power < 20 ? 2 : 3", false},
+		{"logical", "power > 1 && power < 10 || !(power == 5) ? 1 : 0", false},
+		{"functions", "max(power, 10) - min(1, 2, 3) + floor(power / 3) + ceil(1.2)", false},
+		{"whitespace", " \tpower\n*\r2 ", false},
+		{"empty", "", true},
+		{"unknown variable", "level * 2", true},
+		{"unknown function", "sqrt(power)", true},
+		{"wrong argument count", "floor(1, 2)", true},
+		{"no arguments", "max()", true},
+		{"missing operand", "power *", true},
+		{"missing operator", "power 2", true},
+		{"unbalanced parenthesis", "(power * 2", true},
+		{"bad character", "power $ 2", true},
+		{"bad decimal", "1.", true},
+		{"boolean result", "power > 2", true},
+		{"boolean arithmetic", "(power > 2) * 3", true},
+		{"number condition", "power ? 1 : 2", true},
+		{"mismatched branches", "power > 2 ? 1 : power > 3", true},
+		{"number logical", "power && 1", true},
+		{"negated number", "!power", true},
+		{"chained comparison", "1 < power < 3 ? 1 : 0", true},
+		{"missing colon", "power > 1 ? 1", true},
+		{"too long", strings.Repeat("1+", MaxLength) + "1", true},
+		{"too deep", strings.Repeat("(", MaxDepth+1) + "1" + strings.Repeat(")", MaxDepth+1), true},
+		{"too many negations", strings.Repeat("-", MaxDepth+1) + "1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Parse(tt.src, "power")
+			assert.Equal(t, tt.wantError, err != nil, "%v", err)
+			if err == nil {
+				assert.Equal(t, tt.src, e.String())
+			}
+		})
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	_, err := Parse("power * * 2", "power")
+	if assert.IsType(t, &SyntaxError{}, err) {
+		assert.Equal(t, 8, err.(*SyntaxError).Pos)
+		assert.Equal(t, `unexpected "*", operand expected at position 8`, err.Error())
+	}
+}
+
+func TestExpression_Int(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		power     int64
+		wantValue int64
+		wantError error
+	}{
+		{"wizard", "power * 1.5", 100, 150, nil},
+		{"wizard truncated", "power * 1.5", 15, 22, nil},
+		{"elf", "power * 1.1 + 2", 60, 68, nil},
+		{"hobbit low", "power < 20 ? power*2 : power*3", 19, 38, nil},
+		{"hobbit high", "power < 20 ? power*2 : power*3", 20, 60, nil},
+		{"precedence", "2 + power * 3 - 4 / 2", 5, 15, nil},
+		{"left associative", "power - 3 - 2", 10, 5, nil},
+		{"parentheses", "(2 + power) * 3", 5, 21, nil},
+		{"negative truncated", "-power / 2", 3, -1, nil},
+		{"modulo", "power % 3", 10, 1, nil},
+		{"negative modulo", "-power % 3", 10, -1, nil},
+		{"exact rational", "power / 3 * 3", 10, 10, nil},
+		{"equality", "power == 5 ? 1 : 0", 5, 1, nil},
+		{"inequality", "power != 5 ? 1 : 0", 5, 0, nil},
+		{"boolean equality", "(power > 1) == (power > 2) ? 1 : 0", 2, 0, nil},
+		{"and", "power > 1 && power < 10 ? 1 : 0", 5, 1, nil},
+		{"or", "power < 1 || power > 10 ? 1 : 0", 5, 0, nil},
+		{"not", "!(power > 1) ? 1 : 0", 5, 0, nil},
+		{"min", "min(power, 10, 3)", 5, 3, nil},
+		{"max", "max(power, 10, 3)", 5, 10, nil},
+		{"floor", "floor(-power / 2)", 3, -2, nil},
+		{"ceil", "ceil(power / 2)", 3, 2, nil},
+		{"short circuit", "power == 0 || 1 / power > 0 ? 1 : 0", 0, 1, nil},
+		{"division by zero", "1 / power", 0, 0, ErrDivisionByZero},
+		{"modulo by zero", "1 % power", 0, 0, ErrDivisionByZero},
+		{"max int64", "power", math.MaxInt64, math.MaxInt64, nil},
+		{"overflow", "power * 2", math.MaxInt64, 0, ErrOverflow},
+		{"no intermediate overflow", "power * 2 / 4", math.MaxInt64, math.MaxInt64 / 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Parse(tt.src, "power")
+			if !assert.Nil(t, err) {
+				return
+			}
+			value, err := e.Int(map[string]int64{"power": tt.power})
+			assert.Equal(t, tt.wantError, err)
+			assert.Equal(t, tt.wantValue, value)
+		})
+	}
+}
+
+func TestExpression_Eval(t *testing.T) {
+	e, err := Parse("power / 3", "power")
+	assert.Nil(t, err)
+	result, err := e.Eval(map[string]int64{"power": 10})
+	assert.Nil(t, err)
+	assert.Equal(t, "10/3", result.String())
+
+	_, err = e.Eval(nil)
+	assert.Equal(t, &UndefinedVariableError{"power"}, err)
+	assert.Equal(t, `variable "power" is undefined`, err.Error())
+}
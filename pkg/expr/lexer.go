@@ -0,0 +1,87 @@
+package expr
+
+import (
+	"fmt"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenIdent
+	tokenOperator
+)
+
+// token represents a lexical token in an expression.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators lists the recognized operators, with the two-character ones first so that they win over their prefixes.
+var operators = []string{
+	"<=", ">=", "==", "!=", "&&", "||",
+	"+", "-", "*", "/", "%", "<", ">", "!", "?", ":", "(", ")", ",",
+}
+
+// tokenize splits the source of an expression into tokens.
+// The returned slice always ends with a tokenEOF token.
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isDigit(c):
+			start := i
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			if i < len(src) && src[i] == '.' {
+				i++
+				if i >= len(src) || !isDigit(src[i]) {
+					return nil, &SyntaxError{i, "digit expected after decimal point"}
+				}
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, token{tokenNumber, src[start:i], start})
+		case isLetter(c):
+			start := i
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, src[start:i], start})
+		default:
+			op := matchOperator(src[i:])
+			if op == "" {
+				return nil, &SyntaxError{i, fmt.Sprintf("unexpected character %q", c)}
+			}
+			tokens = append(tokens, token{tokenOperator, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(src)}), nil
+}
+
+// matchOperator returns the operator found at the beginning of s, or an empty string if there is none.
+func matchOperator(s string) string {
+	for _, op := range operators {
+		if len(s) >= len(op) && s[:len(op)] == op {
+			return op
+		}
+	}
+	return ""
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
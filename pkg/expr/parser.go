@@ -0,0 +1,311 @@
+package expr
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// parser builds an expression tree from a list of tokens using recursive descent.
+// Operator precedence, from lowest to highest, is: ?:, ||, &&, comparisons, + -, * / %, unary - !.
+type parser struct {
+	tokens    []token
+	pos       int
+	depth     int
+	variables map[string]bool
+}
+
+// peek returns the current token without consuming it.
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// next consumes and returns the current token.
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the current token if it is one of the given operators.
+func (p *parser) accept(ops ...string) (token, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return t, false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return p.next(), true
+		}
+	}
+	return t, false
+}
+
+// expect consumes the current token, which must be the given operator.
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		return p.unexpected(fmt.Sprintf("%q expected", op))
+	}
+	return nil
+}
+
+// unexpected returns a syntax error about the current token.
+func (p *parser) unexpected(msg string) error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return &SyntaxError{t.pos, "unexpected end of expression, " + msg}
+	}
+	return &SyntaxError{t.pos, fmt.Sprintf("unexpected %q, %v", t.text, msg)}
+}
+
+// enter guards against deeply nested expressions exhausting the stack.
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > MaxDepth {
+		return &SyntaxError{p.peek().pos, "expression is nested too deeply"}
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+// checkKind reports an error if the node does not have the wanted kind.
+func checkKind(n node, want kind, pos int) error {
+	if n.kind() != want {
+		return &SyntaxError{pos, fmt.Sprintf("%v operand expected, found %v", want, n.kind())}
+	}
+	return nil
+}
+
+func (p *parser) parseConditional() (node, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	pos := p.peek().pos
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.accept("?"); !ok {
+		return cond, nil
+	}
+	if err := checkKind(cond, kindBool, pos); err != nil {
+		return nil, err
+	}
+	then, err := p.parseConditional()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	pos = p.peek().pos
+	otherwise, err := p.parseConditional()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKind(otherwise, then.kind(), pos); err != nil {
+		return nil, err
+	}
+	return conditionalNode{cond, then, otherwise}, nil
+}
+
+// parseLogical parses a left-associative chain of boolean operators.
+func (p *parser) parseLogical(op string, operand func() (node, error)) (node, error) {
+	pos := p.peek().pos
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept(op)
+		if !ok {
+			return left, nil
+		}
+		if err := checkKind(left, kindBool, pos); err != nil {
+			return nil, err
+		}
+		pos = p.peek().pos
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkKind(right, kindBool, pos); err != nil {
+			return nil, err
+		}
+		left = binaryNode{t.text, left, right}
+	}
+}
+
+func (p *parser) parseOr() (node, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *parser) parseAnd() (node, error) {
+	return p.parseLogical("&&", p.parseComparison)
+}
+
+// parseComparison parses a comparison. Comparisons do not chain, so "a < b < c" is rejected.
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.accept("<", "<=", ">", ">=", "==", "!=")
+	if !ok {
+		return left, nil
+	}
+	pos := p.peek().pos
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if t.text == "==" || t.text == "!=" {
+		if err := checkKind(right, left.kind(), pos); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := checkKind(left, kindNumber, t.pos); err != nil {
+			return nil, err
+		}
+		if err := checkKind(right, kindNumber, pos); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := p.accept("<", "<=", ">", ">=", "==", "!="); ok {
+		return nil, &SyntaxError{p.tokens[p.pos-1].pos, "comparisons cannot be chained"}
+	}
+	return binaryNode{t.text, left, right}, nil
+}
+
+// parseArithmetic parses a left-associative chain of numeric operators.
+func (p *parser) parseArithmetic(ops []string, operand func() (node, error)) (node, error) {
+	pos := p.peek().pos
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+		if err := checkKind(left, kindNumber, pos); err != nil {
+			return nil, err
+		}
+		pos = p.peek().pos
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkKind(right, kindNumber, pos); err != nil {
+			return nil, err
+		}
+		left = binaryNode{t.text, left, right}
+	}
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	return p.parseArithmetic([]string{"+", "-"}, p.parseMultiplicative)
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	return p.parseArithmetic([]string{"*", "/", "%"}, p.parseUnary)
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t, ok := p.accept("-", "!")
+	if !ok {
+		return p.parsePrimary()
+	}
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	pos := p.peek().pos
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	want := kindNumber
+	if t.text == "!" {
+		want = kindBool
+	}
+	if err := checkKind(operand, want, pos); err != nil {
+		return nil, err
+	}
+	return unaryNode{t.text, operand}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenNumber:
+		p.next()
+		num, ok := new(big.Rat).SetString(t.text)
+		if !ok {
+			return nil, &SyntaxError{t.pos, fmt.Sprintf("invalid number %q", t.text)}
+		}
+		return numberNode{num}, nil
+	case tokenIdent:
+		p.next()
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(t)
+		}
+		if !p.variables[t.text] {
+			return nil, &SyntaxError{t.pos, fmt.Sprintf("unknown variable %q", t.text)}
+		}
+		return variableNode{t.text}, nil
+	case tokenOperator:
+		if t.text == "(" {
+			p.next()
+			n, err := p.parseConditional()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		}
+	}
+	return nil, p.unexpected("operand expected")
+}
+
+// parseCall parses the arguments of a function call whose opening parenthesis has been consumed.
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, &SyntaxError{name.pos, fmt.Sprintf("unknown function %q", name.text)}
+	}
+	var args []node
+	if _, ok := p.accept(")"); !ok {
+		for {
+			pos := p.peek().pos
+			arg, err := p.parseConditional()
+			if err != nil {
+				return nil, err
+			}
+			if err := checkKind(arg, kindNumber, pos); err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) < fn.minArgs || fn.maxArgs >= 0 && len(args) > fn.maxArgs {
+		return nil, &SyntaxError{name.pos, fmt.Sprintf("wrong number of arguments for %v()", name.text)}
+	}
+	return callNode{fn, args}, nil
+}
@@ -32,6 +32,12 @@ func TestWithRequest(t *testing.T) {
 	assert.Equal(t, "123", ctx.Value(correlationIDKey).(string))
 }
 
+func TestRequestID(t *testing.T) {
+	assert.Empty(t, RequestID(context.Background()))
+	ctx := WithRequest(context.Background(), buildRequest("abc", ""))
+	assert.Equal(t, "abc", RequestID(ctx))
+}
+
 func Test_getCorrelationID(t *testing.T) {
 	req, _ := http.NewRequest("GET", "http://example.com", bytes.NewBufferString(""))
 	assert.Empty(t, getCorrelationID(req))
@@ -0,0 +1,59 @@
+// Package mergepatch implements JSON Merge Patch as defined in RFC 7396.
+package mergepatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// Apply applies a merge patch to a JSON document and returns the patched document.
+//
+// Object members of the patch replace the members of the same name in the document, recursively,
+// and null members remove them. A patch that is not an object replaces the whole document.
+// An empty document is treated as null.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if len(doc) > 0 {
+		if err := unmarshal(doc, &target); err != nil {
+			return nil, err
+		}
+	}
+	if err := unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(target, p))
+}
+
+// unmarshal decodes a JSON value, keeping numbers as json.Number so that large integers do not lose precision.
+func unmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after top-level JSON value")
+	}
+	return nil
+}
+
+// merge implements the MergePatch function of RFC 7396 on decoded JSON values.
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+		} else {
+			t[name] = merge(t[name], value)
+		}
+	}
+	return t
+}
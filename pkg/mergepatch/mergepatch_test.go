@@ -0,0 +1,45 @@
+package mergepatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	// the examples of RFC 7396, Appendix A
+	tests := []struct {
+		tag, doc, patch, result string
+	}{
+		{"t1", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"t2", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"t3", `{"a":"b"}`, `{"a":null}`, `{}`},
+		{"t4", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"t5", `{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"t6", `{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{"t7", `{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{"t8", `{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{"t9", `["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{"t10", `{"a":"b"}`, `["c"]`, `["c"]`},
+		{"t11", `{"a":"foo"}`, `null`, `null`},
+		{"t12", `{"a":"foo"}`, `"bar"`, `"bar"`},
+		{"t13", `{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{"t14", `[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{"t15", `{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{"t16", ``, `{"a":1}`, `{"a":1}`},
+		{"t17", `{"a":9223372036854775807}`, `{"b":9223372036854775806}`, `{"a":9223372036854775807,"b":9223372036854775806}`},
+	}
+	for _, test := range tests {
+		result, err := Apply([]byte(test.doc), []byte(test.patch))
+		if assert.Nil(t, err, test.tag) {
+			assert.JSONEq(t, test.result, string(result), test.tag)
+		}
+	}
+
+	_, err := Apply([]byte(`{"a":`), []byte(`{}`))
+	assert.NotNil(t, err)
+	_, err = Apply([]byte(`{}`), []byte(`{"a":`))
+	assert.NotNil(t, err)
+	_, err = Apply([]byte(`{}`), []byte(`{} {}`))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,122 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+var (
+	// AfterVar specifies the query parameter name for the cursor after which items are returned
+	AfterVar = "after"
+	// BeforeVar specifies the query parameter name for the cursor before which items are returned
+	BeforeVar = "before"
+)
+
+// ErrInvalidCursor is returned when a cursor cannot be decoded or was issued for a different ordering.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CursorPages represents a list of data items paginated by cursors.
+//
+// Unlike Pages, which skips a number of items, CursorPages continues from the position of the last item seen.
+// The position is encoded as an opaque cursor holding the sort key and ID of that item, so pages stay stable
+// when items are inserted or deleted while the client scrolls through the list.
+type CursorPages struct {
+	PerPage int `json:"per_page"`
+	// After is the cursor after which items are requested. It is empty when listing from the beginning.
+	After string `json:"-"`
+	// Before is the cursor before which items are requested. It takes precedence over After.
+	Before string `json:"-"`
+	// NextCursor can be used as After to get the following page. It is empty on the last page.
+	NextCursor string `json:"next_cursor"`
+	// PrevCursor can be used as Before to get the preceding page. It is empty on the first page.
+	PrevCursor string      `json:"prev_cursor"`
+	Items      interface{} `json:"items"`
+}
+
+// NewCursor creates a new CursorPages instance.
+// The perPage parameter refers to the number of items on each page.
+func NewCursor(after, before string, perPage int) *CursorPages {
+	if perPage <= 0 {
+		perPage = DefaultPageSize
+	}
+	if perPage > MaxPageSize {
+		perPage = MaxPageSize
+	}
+	return &CursorPages{
+		PerPage: perPage,
+		After:   after,
+		Before:  before,
+	}
+}
+
+// IsCursorRequest reports whether the given HTTP request asks for cursor pagination.
+// It does so by specifying either the after or the before query parameter, which may be empty to start from
+// the beginning of the list.
+func IsCursorRequest(req *http.Request) bool {
+	query := req.URL.Query()
+	_, after := query[AfterVar]
+	_, before := query[BeforeVar]
+	return after || before
+}
+
+// NewCursorFromRequest creates a CursorPages object using the query parameters found in the given HTTP request.
+func NewCursorFromRequest(req *http.Request) *CursorPages {
+	query := req.URL.Query()
+	perPage := parseInt(query.Get(PageSizeVar), DefaultPageSize)
+	return NewCursor(query.Get(AfterVar), query.Get(BeforeVar), perPage)
+}
+
+// Limit returns the LIMIT value that can be used in a SQL statement.
+// One more item than the page size is requested so that the presence of a following page can be detected.
+func (p *CursorPages) Limit() int {
+	return p.PerPage + 1
+}
+
+// cursor is the decoded form of a cursor.
+type cursor struct {
+	Sort string            `json:"s"`
+	Keys []json.RawMessage `json:"k"`
+}
+
+// EncodeCursor returns an opaque cursor holding the given sort key values of an item.
+// The sort parameter identifies the ordering of the list and is checked when the cursor is decoded.
+func EncodeCursor(sort string, keys ...interface{}) (string, error) {
+	c := cursor{Sort: sort, Keys: make([]json.RawMessage, len(keys))}
+	for i, key := range keys {
+		data, err := json.Marshal(key)
+		if err != nil {
+			return "", err
+		}
+		c.Keys[i] = data
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor decodes a cursor created by EncodeCursor into the given pointers to the sort key values.
+// ErrInvalidCursor is returned if the cursor is malformed, holds a different number of keys, or was
+// created for a different sort.
+func DecodeCursor(token, sort string, keys ...interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return ErrInvalidCursor
+	}
+	if c.Sort != sort || len(c.Keys) != len(keys) {
+		return ErrInvalidCursor
+	}
+	for i, key := range keys {
+		if err := json.Unmarshal(c.Keys[i], key); err != nil {
+			return ErrInvalidCursor
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package pagination
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCursor(t *testing.T) {
+	tests := []struct {
+		tag                    string
+		perPage                int
+		expectedPerPage, limit int
+	}{
+		{"t1", 20, 20, 21},
+		{"t2", 0, 100, 101},
+		{"t3", -1, 100, 101},
+		{"t4", 1001, 1000, 1001},
+	}
+
+	for _, test := range tests {
+		p := NewCursor("a", "b", test.perPage)
+		assert.Equal(t, "a", p.After, test.tag)
+		assert.Equal(t, "b", p.Before, test.tag)
+		assert.Equal(t, test.expectedPerPage, p.PerPage, test.tag)
+		assert.Equal(t, test.limit, p.Limit(), test.tag)
+	}
+}
+
+func TestNewCursorFromRequest(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com?after=abc&per_page=20", nil)
+	assert.True(t, IsCursorRequest(req))
+	p := NewCursorFromRequest(req)
+	assert.Equal(t, "abc", p.After)
+	assert.Equal(t, "", p.Before)
+	assert.Equal(t, 20, p.PerPage)
+
+	req, _ = http.NewRequest("GET", "http://example.com?before=", nil)
+	assert.True(t, IsCursorRequest(req))
+
+	req, _ = http.NewRequest("GET", "http://example.com?page=2", nil)
+	assert.False(t, IsCursorRequest(req))
+}
+
+func TestEncodeCursor(t *testing.T) {
+	created := time.Date(2019, 10, 1, 15, 36, 38, 123, time.UTC)
+	token, err := EncodeCursor("-value,id", int64(9007199254740993), created, "id-1")
+	assert.Nil(t, err)
+	assert.NotContains(t, token, "=")
+
+	var value int64
+	var createdAt time.Time
+	var id string
+	assert.Nil(t, DecodeCursor(token, "-value,id", &value, &createdAt, &id))
+	assert.Equal(t, int64(9007199254740993), value)
+	assert.True(t, created.Equal(createdAt))
+	assert.Equal(t, "id-1", id)
+
+	// different sort
+	assert.Equal(t, ErrInvalidCursor, DecodeCursor(token, "value,id", &value, &createdAt, &id))
+	// different number of keys
+	assert.Equal(t, ErrInvalidCursor, DecodeCursor(token, "-value,id", &value, &id))
+	// different key types
+	assert.Equal(t, ErrInvalidCursor, DecodeCursor(token, "-value,id", &id, &createdAt, &value))
+	// malformed
+	assert.Equal(t, ErrInvalidCursor, DecodeCursor("!!!", "-value,id", &value, &createdAt, &id))
+	assert.Equal(t, ErrInvalidCursor, DecodeCursor("YWJj", "-value,id", &value, &createdAt, &id))
+}